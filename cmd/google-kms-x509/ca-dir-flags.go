@@ -0,0 +1,19 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	caDirPath string
+)
+
+func addCADirFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(
+		&caDirPath,
+		"ca-dir",
+		"",
+		"'openssl ca' directory: certificates are numbered by its serial file and recorded in "+
+			"index.txt and newcerts/, CRLs list the certificates revoked in index.txt",
+	)
+}
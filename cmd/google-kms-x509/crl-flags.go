@@ -0,0 +1,212 @@
+package main
+
+import (
+	"crypto/x509"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/ericnorris/google-kms-x509/kmssign"
+	"github.com/spf13/cobra"
+)
+
+var (
+	crlRevoked      []string
+	crlNumber       int64
+	crlThisUpdate   string
+	crlNextUpdate   string
+	crlStatePath    string
+	crlDelta        bool
+	crlBaseNumber   int64
+	crlFreshestCRLs []string
+)
+
+func addCRLFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(
+		&crlRevoked,
+		"revoked",
+		[]string{},
+		"revoked certificate as SERIAL[,REVOCATION-TIME[,REASON[,INVALIDITY-TIME]]], may be repeated; "+
+			"SERIAL is decimal, 0x-prefixed or colon-separated hex, times are RFC 3339 (default "+
+			"--this-update), REASON is a CRLReason name such as keyCompromise",
+	)
+
+	addCRLUpdateFlags(cmd)
+	cmd.MarkFlagRequired("next-update")
+
+	cmd.Flags().BoolVar(
+		&crlDelta,
+		"delta",
+		false,
+		"issue a delta CRL with the changes since the base CRL",
+	)
+
+	cmd.Flags().Int64Var(
+		&crlBaseNumber,
+		"base-crl-number",
+		0,
+		"CRL number of the complete CRL a delta CRL is based on, defaults to the last one in --crl-state",
+	)
+}
+
+// addCRLUpdateFlags adds the flags for the number, validity and extensions of a complete CRL.
+func addCRLUpdateFlags(cmd *cobra.Command) {
+	cmd.Flags().Int64Var(
+		&crlNumber,
+		"crl-number",
+		0,
+		"CRL number, increasing with each CRL issued; required unless --crl-state is set",
+	)
+
+	cmd.Flags().StringVar(
+		&crlThisUpdate, "this-update", "", "CRL thisUpdate time in RFC 3339 format (default now)",
+	)
+
+	cmd.Flags().StringVar(
+		&crlNextUpdate, "next-update", "", "CRL nextUpdate time in RFC 3339 format",
+	)
+
+	cmd.Flags().StringVar(
+		&crlStatePath,
+		"crl-state",
+		"",
+		"file recording the CRL numbers issued for each issuer and KMS key, created if missing; "+
+			"the next CRL number is taken from it unless --crl-number is set",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&crlFreshestCRLs,
+		"freshest-crl",
+		[]string{},
+		"URLs where delta CRLs are published, for the Freshest CRL extension of complete CRLs",
+	)
+}
+
+func convertCRLFlagsToRevokedCertificates(
+	thisUpdate time.Time,
+) ([]x509.RevocationListEntry, error) {
+	var entries []x509.RevocationListEntry
+
+	for _, revoked := range crlRevoked {
+		entry, err := parseRevokedCertificate(revoked, thisUpdate)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: Invalid --revoked %q: %v", cli.ErrInvalidInput, revoked, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+func parseRevokedCertificate(
+	revoked string,
+	thisUpdate time.Time,
+) (x509.RevocationListEntry, error) {
+	fields := strings.Split(revoked, ",")
+
+	if len(fields) > 4 {
+		return x509.RevocationListEntry{}, fmt.Errorf("Too many fields")
+	}
+
+	serialNumber, err := parseSerialNumber(fields[0])
+
+	if err != nil {
+		return x509.RevocationListEntry{}, err
+	}
+
+	entry := x509.RevocationListEntry{SerialNumber: serialNumber, RevocationTime: thisUpdate}
+
+	if len(fields) > 1 && fields[1] != "" {
+		if entry.RevocationTime, err = time.Parse(time.RFC3339, fields[1]); err != nil {
+			return x509.RevocationListEntry{}, err
+		}
+	}
+
+	if len(fields) > 2 && fields[2] != "" {
+		if entry.ReasonCode, err = kmssign.ParseRevocationReason(fields[2]); err != nil {
+			return x509.RevocationListEntry{}, err
+		}
+	}
+
+	if len(fields) > 3 && fields[3] != "" {
+		invalidityDate, err := time.Parse(time.RFC3339, fields[3])
+
+		if err != nil {
+			return x509.RevocationListEntry{}, err
+		}
+
+		invalidityDateExt, err := kmssign.InvalidityDateExtension(invalidityDate)
+
+		if err != nil {
+			return x509.RevocationListEntry{}, err
+		}
+
+		entry.ExtraExtensions = append(entry.ExtraExtensions, invalidityDateExt)
+	}
+
+	return entry, nil
+}
+
+// parseSerialNumber accepts a serial number in decimal, in hex with a 0x prefix, or in hex with
+// colon-separated bytes as printed by openssl.
+func parseSerialNumber(serial string) (*big.Int, error) {
+	digits, base := serial, 10
+
+	if strings.HasPrefix(serial, "0x") || strings.HasPrefix(serial, "0X") {
+		digits, base = serial[2:], 16
+	} else if strings.Contains(serial, ":") {
+		digits, base = strings.ReplaceAll(serial, ":", ""), 16
+	}
+
+	serialNumber, ok := new(big.Int).SetString(digits, base)
+
+	if !ok || serialNumber.Sign() < 0 {
+		return nil, fmt.Errorf("Invalid serial number %q", serial)
+	}
+
+	return serialNumber, nil
+}
+
+func convertCRLFlagsToCRLOptions(cmd *cobra.Command, now time.Time) (cli.CRLOptions, error) {
+	options := cli.CRLOptions{
+		ThisUpdate:  now,
+		StatePath:   crlStatePath,
+		Delta:       crlDelta,
+		FreshestCRL: crlFreshestCRLs,
+		CADir:       caDirPath,
+		IssuanceDB:  issuanceDBPath,
+	}
+
+	if cmd.Flags().Changed("crl-number") {
+		options.Number = big.NewInt(crlNumber)
+	}
+
+	if cmd.Flags().Changed("base-crl-number") {
+		options.BaseNumber = big.NewInt(crlBaseNumber)
+	}
+
+	var err error
+
+	if crlThisUpdate != "" {
+		if options.ThisUpdate, err = time.Parse(time.RFC3339, crlThisUpdate); err != nil {
+			return cli.CRLOptions{}, fmt.Errorf("%w: Invalid --this-update: %v", cli.ErrInvalidInput, err)
+		}
+	}
+
+	if options.NextUpdate, err = time.Parse(time.RFC3339, crlNextUpdate); err != nil {
+		return cli.CRLOptions{}, fmt.Errorf("%w: Invalid --next-update: %v", cli.ErrInvalidInput, err)
+	}
+
+	if !options.NextUpdate.After(options.ThisUpdate) {
+		return cli.CRLOptions{}, fmt.Errorf(
+			"%w: --next-update must be after --this-update",
+			cli.ErrInvalidInput,
+		)
+	}
+
+	return options, nil
+}
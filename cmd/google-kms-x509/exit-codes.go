@@ -0,0 +1,78 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/ericnorris/google-kms-x509/kmssign"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes returned by google-kms-x509, documented in the README.
+const (
+	exitGeneralError      = 1
+	exitUsageError        = 2
+	exitInvalidInput      = 3
+	exitUnusableKey       = 4
+	exitParentCannotSign  = 5
+	exitPermissionDenied  = 6
+	exitKMSUnavailable    = 7
+	exitVerificationError = 8
+)
+
+// runError marks an error returned while running a command, as opposed to a flag or argument
+// error reported by cobra.
+type runError struct {
+	err error
+}
+
+func (e *runError) Error() string {
+	return e.err.Error()
+}
+
+func (e *runError) Unwrap() error {
+	return e.err
+}
+
+// runE adapts f for use as a cobra RunE function. Usage is only printed for flag and argument
+// errors, not for errors returned by f.
+func runE(f func(cmd *cobra.Command, args []string) error) func(*cobra.Command, []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		if err := f(cmd, args); err != nil {
+			return &runError{err}
+		}
+
+		return nil
+	}
+}
+
+// exitCode maps an error returned by mainCmd to the process exit code.
+func exitCode(err error) int {
+	var runErr *runError
+
+	switch {
+	case !errors.As(err, &runErr):
+		return exitUsageError
+	case errors.Is(err, cli.ErrInvalidInput):
+		return exitInvalidInput
+	case errors.Is(err, kmssign.ErrUnsupportedAlgorithm),
+		errors.Is(err, kmssign.ErrWrongKeyPurpose),
+		errors.Is(err, kmssign.ErrProtectionLevelTooLow),
+		errors.Is(err, kmssign.ErrKeyVersionNotEnabled):
+		return exitUnusableKey
+	case errors.Is(err, kmssign.ErrParentNotCA),
+		errors.Is(err, kmssign.ErrParentKeyMismatch):
+		return exitParentCannotSign
+	case errors.Is(err, kmssign.ErrPermissionDenied):
+		return exitPermissionDenied
+	case errors.Is(err, kmssign.ErrKMSUnavailable):
+		return exitKMSUnavailable
+	case errors.Is(err, kmssign.ErrSignatureVerificationFailed),
+		errors.Is(err, kmssign.ErrIntegrityCheckFailed):
+		return exitVerificationError
+	default:
+		return exitGeneralError
+	}
+}
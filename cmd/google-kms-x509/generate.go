@@ -12,32 +12,51 @@ var generateCmd = &cobra.Command{
 }
 
 var generateRootCACmd = &cobra.Command{
-	Use:   "root-ca",
-	Short: "",
-	Long:  ``,
-	Run: func(cmd *cobra.Command, args []string) {
-		cli.GenerateRootCA(
-			kmsKey,
-			generateComment,
+	Use:     "root-ca",
+	Short:   "",
+	Long:    ``,
+	PreRunE: requireValidityFlags,
+	RunE: runE(func(cmd *cobra.Command, args []string) error {
+		validityOptions, err := convertValidityFlagsToValidityOptions(cmd, 0)
+
+		if err != nil {
+			return err
+		}
+
+		out, err := convertOutFlagsToFile()
+
+		if err != nil {
+			return err
+		}
+
+		return cli.GenerateRootCA(
+			convertKeyFlagsToKeyOptions(),
 			convertSubjectFlagsToName(),
-			days,
-			convertOutFlagsToFile(),
+			validityOptions,
+			convertKeyUsageFlagsToKeyUsageOptions(),
+			convertURLFlagsToURLOptions(),
+			out,
 		)
-	},
+	}),
 }
 
 var generateCSRCmd = &cobra.Command{
 	Use:   "csr",
 	Short: "",
 	Long:  ``,
-	Run: func(cmd *cobra.Command, args []string) {
-		cli.GenerateCSR(
-			kmsKey,
-			generateComment,
+	RunE: runE(func(cmd *cobra.Command, args []string) error {
+		out, err := convertOutFlagsToFile()
+
+		if err != nil {
+			return err
+		}
+
+		return cli.GenerateCSR(
+			convertKeyFlagsToKeyOptions(),
 			convertSubjectFlagsToName(),
-			convertOutFlagsToFile(),
+			out,
 		)
-	},
+	}),
 }
 
 func init() {
@@ -51,7 +70,17 @@ func init() {
 	addOutFlags(generateCSRCmd)
 
 	// 'generate root-ca' only flags
-	addDaysFlags(generateRootCACmd)
+	addValidityFlags(generateRootCACmd, "")
+	addIssuanceFlags(generateRootCACmd)
+	addChildURLFlags(generateRootCACmd)
+	addKeyUsageFlags(generateRootCACmd, "digitalSignature,keyCertSign,cRLSign")
+
+	generateRootCACmd.Flags().StringVar(
+		&issuerDefaultsPath,
+		"issuer-defaults",
+		"",
+		"JSON file to record the --child-* URLs in, for 'sign --issuer-defaults'",
+	)
 
 	generateCmd.AddCommand(generateRootCACmd)
 	generateCmd.AddCommand(generateCSRCmd)
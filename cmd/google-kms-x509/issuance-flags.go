@@ -0,0 +1,27 @@
+package main
+
+import (
+	"github.com/spf13/cobra"
+)
+
+var (
+	issuanceDBPath string
+	requester      string
+)
+
+func addIssuanceFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(
+		&issuanceDBPath,
+		"issuance-db",
+		"",
+		"database recording every certificate issued, created if missing; "+
+			"serial numbers already issued by the same issuer are never reused",
+	)
+
+	cmd.Flags().StringVar(
+		&requester,
+		"requester",
+		"",
+		"requester recorded in --issuance-db (default the current user)",
+	)
+}
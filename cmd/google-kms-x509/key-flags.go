@@ -1,16 +1,54 @@
 package main
 
 import (
+	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/ericnorris/google-kms-x509/kmssign"
 	"github.com/spf13/cobra"
 )
 
 var (
 	kmsKey          string
 	generateComment bool
+	kmsEndpoint     string
+	kmsInsecure     bool
+	kmsMaxAttempts  int
+	signatureHash   string
+	versionSelector string
+	minProtection   string
+	allowExternal   bool
 )
 
 func addKeyFlags(cmd *cobra.Command) {
-	cmd.Flags().StringVarP(&kmsKey, "kms-key", "k", "", "Google KMS key resource ID")
-	cmd.Flags().BoolVar(&generateComment, "generate-comment", true, "generate an x509 comment showing the Google KMS key resource ID used")
+	addOptionalKeyFlags(cmd)
 	cmd.MarkFlagRequired("kms-key")
 }
+
+// addOptionalKeyFlags adds the key flags to commands that only use a KMS key for some operations.
+func addOptionalKeyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&kmsKey, "kms-key", "k", "", "Google KMS key version resource ID, or a key resource ID to use the version chosen by --kms-version-selector")
+	cmd.Flags().BoolVar(&generateComment, "generate-comment", true, "generate an x509 comment showing the Google KMS key resource ID used")
+	cmd.Flags().StringVar(&kmsEndpoint, "kms-endpoint", "", "Cloud KMS API endpoint (host:port), defaults to the Google endpoint")
+	cmd.Flags().BoolVar(&kmsInsecure, "kms-insecure", false, "connect to --kms-endpoint without TLS or credentials, e.g. for a local emulator")
+	cmd.Flags().IntVar(&kmsMaxAttempts, "kms-max-attempts", kmssign.DefaultRetryPolicy.MaxAttempts, "attempts per Cloud KMS call before giving up on transient errors, with exponential backoff between attempts")
+	cmd.Flags().StringVar(&versionSelector, "kms-version-selector", "newest-enabled", "how to choose the version when --kms-key is a key: newest-enabled, highest-number, or label=<name> for the version number in that key label")
+	cmd.Flags().StringVar(&minProtection, "kms-min-protection-level", "", "refuse keys with a weaker protection level: SOFTWARE < HSM, while EXTERNAL is a separate level that only meets HSM with --kms-allow-external-keys")
+	cmd.Flags().BoolVar(&allowExternal, "kms-allow-external-keys", false, "let EXTERNAL and EXTERNAL_VPC keys meet an HSM --kms-min-protection-level")
+	cmd.Flags().StringVar(&signatureHash, "signature-hash", "", "hash for RSA_SIGN_RAW_PKCS1_* keys: SHA256, SHA384 or SHA512 (default SHA256)")
+}
+
+func convertKeyFlagsToKeyOptions() cli.KeyOptions {
+	return cli.KeyOptions{
+		Name:               kmsKey,
+		GenerateComment:    generateComment,
+		Endpoint:           kmsEndpoint,
+		Insecure:           kmsInsecure,
+		MaxAttempts:        kmsMaxAttempts,
+		SignatureHash:      signatureHash,
+		VersionSelector:    versionSelector,
+		MinProtectionLevel: minProtection,
+		AllowExternalKeys:  allowExternal,
+		IssuanceDB:         issuanceDBPath,
+		Requester:          requester,
+		CADir:              caDirPath,
+	}
+}
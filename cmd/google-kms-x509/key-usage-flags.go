@@ -0,0 +1,36 @@
+package main
+
+import (
+	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keyUsage    []string
+	extKeyUsage []string
+)
+
+func addKeyUsageFlags(cmd *cobra.Command, defaultKeyUsage string) {
+	cmd.Flags().StringSliceVar(
+		&keyUsage,
+		"key-usage",
+		[]string{},
+		"key usages for x509 Key Usage extension, e.g. digitalSignature,keyAgreement "+
+			"(default "+defaultKeyUsage+")",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&extKeyUsage,
+		"ext-key-usage",
+		[]string{},
+		"extended key usages for x509 Extended Key Usage extension: serverAuth, clientAuth, "+
+			"codeSigning, emailProtection, timeStamping, OCSPSigning, ... or dotted OIDs",
+	)
+}
+
+func convertKeyUsageFlagsToKeyUsageOptions() cli.KeyUsageOptions {
+	return cli.KeyUsageOptions{
+		KeyUsage:    keyUsage,
+		ExtKeyUsage: extKeyUsage,
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "",
+	Long:  ``,
+}
+
+var listCertificatesCmd = &cobra.Command{
+	Use:   "certificates",
+	Short: "",
+	Long:  ``,
+	RunE: runE(func(cmd *cobra.Command, args []string) error {
+		out, err := convertOutFlagsToFile()
+
+		if err != nil {
+			return err
+		}
+
+		return cli.ListCertificates(
+			issuanceDBPath,
+			cli.ListOptions{
+				ExpiringWithin: listExpiringWithin,
+				JSON:           listJSON,
+			},
+			out,
+		)
+	}),
+}
+
+var (
+	listExpiringWithin time.Duration
+	listJSON           bool
+)
+
+func init() {
+	addOutFlags(listCertificatesCmd)
+
+	listCertificatesCmd.Flags().StringVar(
+		&issuanceDBPath,
+		"issuance-db",
+		"",
+		"database of issued certificates, as written with --issuance-db by 'sign'",
+	)
+	listCertificatesCmd.MarkFlagRequired("issuance-db")
+
+	listCertificatesCmd.Flags().DurationVar(
+		&listExpiringWithin,
+		"expiring-within",
+		0,
+		"only list certificates expiring within this duration, e.g. 720h, including expired ones",
+	)
+
+	listCertificatesCmd.Flags().BoolVar(
+		&listJSON, "json", false, "write one JSON record per line, including the PEM certificate",
+	)
+
+	listCmd.AddCommand(listCertificatesCmd)
+}
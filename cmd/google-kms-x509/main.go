@@ -1,6 +1,9 @@
 package main
 
 import (
+	"fmt"
+	"os"
+
 	"github.com/spf13/cobra"
 )
 
@@ -12,11 +15,19 @@ var mainCmd = &cobra.Command{
 	Long:  ``,
 
 	Version: Version,
+
+	SilenceErrors: true,
 }
 
 func main() {
 	mainCmd.AddCommand(generateCmd)
 	mainCmd.AddCommand(signCmd)
+	mainCmd.AddCommand(serveCmd)
+	mainCmd.AddCommand(listCmd)
+	mainCmd.AddCommand(revokeCmd)
 
-	mainCmd.Execute()
+	if err := mainCmd.Execute(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(exitCode(err))
+	}
 }
@@ -0,0 +1,2249 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/ericnorris/google-kms-x509/internal/issuancedb"
+	"github.com/ericnorris/google-kms-x509/kmssign"
+	"github.com/ericnorris/google-kms-x509/kmssign/kmsfake"
+)
+
+// The tests below run the compiled test binary as google-kms-x509 against a kmsfake server, and
+// compare a description of the PEM output with the files in testdata/. Run with -update to
+// rewrite them.
+
+const runMainEnv = "GOOGLE_KMS_X509_TEST_RUN_MAIN"
+
+const testCryptoKeys = "projects/test/locations/global/keyRings/test/cryptoKeys/"
+
+var update = flag.Bool("update", false, "update golden files in testdata/")
+
+var (
+	testEndpoint string
+	testDir      string
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) != "" {
+		main()
+		os.Exit(0)
+	}
+
+	flag.Parse()
+
+	client := kmsfake.NewKeyManagementClient()
+
+	var err error
+
+	for _, key := range []struct {
+		name      string
+		algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+	}{
+		{"root", kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384},
+		{"intermediate", kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256},
+		{"leaf", kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256},
+		{"ed25519", kmspb.CryptoKeyVersion_EC_SIGN_ED25519},
+		{"secp256k1", kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256},
+		{"raw-pkcs1", kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_2048},
+	} {
+		_, err = client.AddSigningKey(context.Background(), testCryptoKeys+key.name, key.algorithm)
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// a rotated key whose newest version is disabled, for tests that pass a CryptoKey name.
+	for i := 0; i < 3; i++ {
+		_, err = client.AddSigningKey(
+			context.Background(),
+			testCryptoKeys+"rotated",
+			kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+		)
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	err = client.SetVersionState(
+		testCryptoKeys+"rotated/cryptoKeyVersions/3",
+		kmspb.CryptoKeyVersion_DISABLED,
+	)
+
+	if err != nil {
+		panic(err)
+	}
+
+	testDir, err = ioutil.TempDir("", "google-kms-x509-test")
+
+	if err != nil {
+		panic(err)
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+
+	if err != nil {
+		panic(err)
+	}
+
+	grpcServer := kmsfake.NewServer(client).Serve(listener)
+	testEndpoint = listener.Addr().String()
+
+	code := m.Run()
+
+	grpcServer.Stop()
+	os.RemoveAll(testDir)
+	os.Exit(code)
+}
+
+func testKeyVersion(name string) string {
+	return testCryptoKeys + name + "/cryptoKeyVersions/1"
+}
+
+// run executes google-kms-x509 with the given arguments, plus the flags needed to reach the test
+// KMS server, and returns its standard output.
+func run(t *testing.T, args ...string) []byte {
+	t.Helper()
+
+	return runLocal(t, append(args, "--kms-endpoint", testEndpoint, "--kms-insecure")...)
+}
+
+// runLocal is like run, for commands that do not use KMS.
+func runLocal(t *testing.T, args ...string) []byte {
+	t.Helper()
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+
+	var stdout, stderr bytes.Buffer
+
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("google-kms-x509 %s failed: %v\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+
+	return stdout.Bytes()
+}
+
+// runFailure is like run, but expects google-kms-x509 to fail with the given exit code, and
+// returns its standard error.
+func runFailure(t *testing.T, wantCode int, args ...string) string {
+	t.Helper()
+
+	args = append(args, "--kms-endpoint", testEndpoint, "--kms-insecure")
+
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+
+	var stderr bytes.Buffer
+
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+
+	if err == nil {
+		t.Fatalf("google-kms-x509 %s succeeded, want failure", strings.Join(args, " "))
+	}
+
+	var exitErr *exec.ExitError
+
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("google-kms-x509 %s failed: %v", strings.Join(args, " "), err)
+	}
+
+	if exitErr.ExitCode() != wantCode {
+		t.Fatalf(
+			"google-kms-x509 %s exited with code %d, want %d\n%s",
+			strings.Join(args, " "), exitErr.ExitCode(), wantCode, stderr.String(),
+		)
+	}
+
+	return stderr.String()
+}
+
+// writeTemp writes data to a file in a temporary directory, and returns its path.
+func writeTemp(t *testing.T, name string, data []byte) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir(testDir, t.Name())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, name)
+
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func checkGolden(t *testing.T, name string, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got != string(want) {
+		t.Errorf("Output does not match %s:\n--- got\n%s\n--- want\n%s", path, got, want)
+	}
+}
+
+func decodePEM(t *testing.T, data []byte, blockType string) []byte {
+	t.Helper()
+
+	block, _ := pem.Decode(data)
+
+	if block == nil || block.Type != blockType {
+		t.Fatalf("Output is not a PEM %s:\n%s", blockType, data)
+	}
+
+	return block.Bytes
+}
+
+// describeCertificate renders the parts of a certificate that are stable between runs, leaving out
+// serial numbers, key identifiers, validity timestamps and signatures.
+func describeCertificate(t *testing.T, pemCertificate []byte) string {
+	t.Helper()
+
+	certificate, err := kmssign.ParseCertificate(decodePEM(t, pemCertificate, "CERTIFICATE"))
+
+	if err != nil {
+		t.Fatalf("Could not parse certificate: %v", err)
+	}
+
+	var description strings.Builder
+
+	fmt.Fprintf(&description, "Subject: %s\n", certificate.Subject)
+	fmt.Fprintf(&description, "Issuer: %s\n", certificate.Issuer)
+	fmt.Fprintf(&description, "SignatureAlgorithm: %s\n", certificate.SignatureAlgorithm)
+	fmt.Fprintf(&description, "PublicKeyAlgorithm: %s\n", certificate.PublicKeyAlgorithm)
+	fmt.Fprintf(&description, "Validity: %s\n", certificate.NotAfter.Sub(certificate.NotBefore))
+	fmt.Fprintf(&description, "IsCA: %t\n", certificate.IsCA)
+	fmt.Fprintf(&description, "MaxPathLen: %d\n", certificate.MaxPathLen)
+	fmt.Fprintf(&description, "KeyUsage: %s\n", describeKeyUsage(certificate.KeyUsage))
+	fmt.Fprintf(&description, "ExtKeyUsage: %v\n", certificate.ExtKeyUsage)
+	fmt.Fprintf(&description, "DNSNames: %v\n", certificate.DNSNames)
+	fmt.Fprintf(&description, "IPAddresses: %v\n", certificate.IPAddresses)
+	fmt.Fprintf(&description, "PermittedDNSDomains: %v\n", certificate.PermittedDNSDomains)
+	describeExtensions(&description, certificate.Extensions)
+
+	return description.String()
+}
+
+func describeCertificateRequest(t *testing.T, pemCertificateRequest []byte) string {
+	t.Helper()
+
+	csr, err := kmssign.ParseCertificateRequest(
+		decodePEM(t, pemCertificateRequest, "CERTIFICATE REQUEST"),
+	)
+
+	if err != nil {
+		t.Fatalf("Could not parse certificate request: %v", err)
+	}
+
+	if err := csr.CheckSignature(); err != nil {
+		t.Errorf("Certificate request signature is invalid: %v", err)
+	}
+
+	var description strings.Builder
+
+	fmt.Fprintf(&description, "Subject: %s\n", csr.Subject)
+	fmt.Fprintf(&description, "SignatureAlgorithm: %s\n", csr.SignatureAlgorithm)
+	fmt.Fprintf(&description, "PublicKeyAlgorithm: %s\n", csr.PublicKeyAlgorithm)
+	describeExtensions(&description, csr.Extensions)
+
+	return description.String()
+}
+
+// describeRevocationList renders a CRL, after checking its signature against the issuer
+// certificate. Its times are taken from the command line, so they are stable between runs.
+func describeRevocationList(t *testing.T, pemRevocationList []byte, issuerPath string) string {
+	t.Helper()
+
+	revocationList, err := x509.ParseRevocationList(decodePEM(t, pemRevocationList, "X509 CRL"))
+
+	if err != nil {
+		t.Fatalf("Could not parse revocation list: %v", err)
+	}
+
+	issuer, err := kmssign.ParseCertificate(decodePEM(t, readFile(t, issuerPath), "CERTIFICATE"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := revocationList.CheckSignatureFrom(issuer); err != nil {
+		t.Errorf("Revocation list signature is invalid: %v", err)
+	}
+
+	if !bytes.Equal(revocationList.AuthorityKeyId, issuer.SubjectKeyId) {
+		t.Errorf("Revocation list authority key ID does not match the issuer")
+	}
+
+	var description strings.Builder
+
+	fmt.Fprintf(&description, "Issuer: %s\n", revocationList.Issuer)
+	fmt.Fprintf(&description, "SignatureAlgorithm: %s\n", revocationList.SignatureAlgorithm)
+	fmt.Fprintf(&description, "Number: %s\n", revocationList.Number)
+	fmt.Fprintf(&description, "ThisUpdate: %s\n", revocationList.ThisUpdate.UTC())
+	fmt.Fprintf(&description, "NextUpdate: %s\n", revocationList.NextUpdate.UTC())
+
+	for _, entry := range revocationList.RevokedCertificateEntries {
+		fmt.Fprintf(
+			&description,
+			"Revoked: %s at %s reason=%d\n",
+			entry.SerialNumber,
+			entry.RevocationTime.UTC(),
+			entry.ReasonCode,
+		)
+
+		for _, extension := range entry.Extensions {
+			fmt.Fprintf(&description, "  Extension: %s value=%x\n", extension.Id, extension.Value)
+		}
+	}
+
+	describeExtensions(&description, revocationList.Extensions)
+
+	return description.String()
+}
+
+var keyUsageNames = []string{
+	"DigitalSignature",
+	"ContentCommitment",
+	"KeyEncipherment",
+	"DataEncipherment",
+	"KeyAgreement",
+	"CertSign",
+	"CRLSign",
+	"EncipherOnly",
+	"DecipherOnly",
+}
+
+func describeKeyUsage(keyUsage x509.KeyUsage) string {
+	var names []string
+
+	for i, name := range keyUsageNames {
+		if keyUsage&(1<<uint(i)) != 0 {
+			names = append(names, name)
+		}
+	}
+
+	return strings.Join(names, "|")
+}
+
+var stableExtensionValues = map[string]bool{
+	"1.3.6.1.5.5.7.1.1":      true, // authority information access
+	"1.3.6.1.5.5.7.48.1.5":   true, // OCSP no check
+	"2.16.840.1.113730.1.13": true, // Netscape comment
+	"2.5.29.15":              true, // key usage
+	"2.5.29.17":              true, // subject alternative name
+	"2.5.29.19":              true, // basic constraints
+	"2.5.29.20":              true, // CRL number
+	"2.5.29.27":              true, // delta CRL indicator
+	"2.5.29.30":              true, // name constraints
+	"2.5.29.31":              true, // CRL distribution points
+	"2.5.29.32":              true, // certificate policies
+	"2.5.29.33":              true, // policy mappings
+	"2.5.29.36":              true, // policy constraints
+	"2.5.29.37":              true, // extended key usage
+	"2.5.29.46":              true, // freshest CRL
+	"2.5.29.54":              true, // inhibit anyPolicy
+}
+
+func describeExtensions(description *strings.Builder, extensions []pkix.Extension) {
+	var lines []string
+
+	for _, extension := range extensions {
+		line := fmt.Sprintf("Extension: %s critical=%t", extension.Id, extension.Critical)
+
+		if stableExtensionValues[extension.Id.String()] {
+			line += fmt.Sprintf(" value=%x", extension.Value)
+		}
+
+		lines = append(lines, line)
+	}
+
+	sort.Strings(lines)
+
+	for _, line := range lines {
+		description.WriteString(line + "\n")
+	}
+}
+
+type testChain struct {
+	rootPath         string
+	intermediatePath string
+}
+
+// signTestChain creates a root CA and an intermediate CA, for tests of the 'sign' commands.
+func signTestChain(t *testing.T) testChain {
+	t.Helper()
+
+	root := run(t,
+		"generate", "root-ca",
+		"--kms-key", testKeyVersion("root"),
+		"--common-name", "Test Root CA",
+		"--days", "3650",
+	)
+
+	intermediateCSR := run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--common-name", "Test Intermediate CA",
+	)
+
+	rootPath := writeTemp(t, "root.pem", root)
+
+	intermediate := run(t,
+		"sign", "intermediate-ca",
+		"--kms-key", testKeyVersion("root"),
+		"--parent-cert", rootPath,
+		"--child-csr", writeTemp(t, "intermediate.csr", intermediateCSR),
+		"--common-name", "Test Intermediate CA",
+		"--days", "365",
+	)
+
+	return testChain{
+		rootPath:         rootPath,
+		intermediatePath: writeTemp(t, "intermediate.pem", intermediate),
+	}
+}
+
+func TestGenerateRootCA(t *testing.T) {
+	output := run(t,
+		"generate", "root-ca",
+		"--kms-key", testKeyVersion("root"),
+		"--common-name", "Test Root CA",
+		"--country", "US",
+		"--province", "New York",
+		"--locality", "New York",
+		"--organization", "Example",
+		"--organizationalUnit", "Security",
+		"--emailAddress", "security@example.com",
+		"--days", "3650",
+	)
+
+	checkGolden(t, "generate-root-ca", describeCertificate(t, output))
+}
+
+func TestGenerateCSR(t *testing.T) {
+	output := run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--common-name", "Test Intermediate CA",
+		"--organization", "Example",
+	)
+
+	checkGolden(t, "generate-csr", describeCertificateRequest(t, output))
+
+	output = run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "leaf.example.com",
+		"--generate-comment=false",
+	)
+
+	checkGolden(t, "generate-csr-no-comment", describeCertificateRequest(t, output))
+}
+
+func TestSignIntermediateCA(t *testing.T) {
+	chain := signTestChain(t)
+
+	csr := run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--common-name", "ignored",
+	)
+
+	output := run(t,
+		"sign", "intermediate-ca",
+		"--kms-key", testKeyVersion("root"),
+		"--parent-cert", chain.rootPath,
+		"--child-csr", writeTemp(t, "intermediate.csr", csr),
+		"--common-name", "Test Constrained Intermediate CA",
+		"--organization", "Example",
+		"--days", "365",
+		"--path-len", "1",
+		"--permitted-dns-domains", "example.com,example.net",
+	)
+
+	checkGolden(t, "sign-intermediate-ca", describeCertificate(t, output))
+}
+
+func TestSignIntermediateCANameConstraints(t *testing.T) {
+	chain := signTestChain(t)
+
+	csr := writeTemp(t, "intermediate.csr", run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--common-name", "ignored",
+	))
+
+	signIntermediate := func(extraArgs ...string) []string {
+		return append([]string{
+			"sign", "intermediate-ca",
+			"--kms-key", testKeyVersion("root"),
+			"--parent-cert", chain.rootPath,
+			"--child-csr", csr,
+			"--common-name", "Team CA",
+			"--days", "365",
+		}, extraArgs...)
+	}
+
+	output := run(t, signIntermediate(
+		"--name-constraints-critical=false",
+		"--permitted-dns-domains", "team.example.com",
+		"--excluded-dns-domains", "internal.team.example.com",
+		"--permitted-ip-ranges", "10.0.0.0/8",
+		"--excluded-ip-ranges", "10.0.0.0/16,192.168.0.0/16",
+		"--permitted-email-addresses", ".team.example.com",
+		"--excluded-email-addresses", "root@team.example.com",
+		"--permitted-uri-domains", "spiffe://team.example.org",
+		"--excluded-uri-domains", ".internal.example.org",
+	)...)
+
+	checkGolden(t, "sign-intermediate-ca-name-constraints", describeCertificate(t, output))
+
+	intermediatePath := writeTemp(t, "team-ca.pem", output)
+
+	leafCSR := writeTemp(t, "leaf.csr", run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	))
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(readFile(t, chain.rootPath))
+
+	intermediates := x509.NewCertPool()
+	intermediates.AppendCertsFromPEM(output)
+
+	for _, test := range []struct {
+		ipAddress string
+		allowed   bool
+	}{
+		{"10.1.0.1", true},
+		{"10.0.0.1", false},
+		{"172.16.0.1", false},
+	} {
+		leafPEM := run(t,
+			"sign", "leaf",
+			"--kms-key", testKeyVersion("intermediate"),
+			"--parent-cert", intermediatePath,
+			"--child-csr", leafCSR,
+			"--common-name", "www.team.example.com",
+			"--days", "30",
+			"--dns-names", "www.team.example.com",
+			"--ip-addresses", test.ipAddress,
+		)
+
+		leaf, err := x509.ParseCertificate(decodePEM(t, leafPEM, "CERTIFICATE"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+
+		if test.allowed && err != nil {
+			t.Errorf("Could not verify a leaf for %s: %v", test.ipAddress, err)
+		} else if !test.allowed && err == nil {
+			t.Errorf("Verified a leaf for %s, outside the name constraints", test.ipAddress)
+		}
+	}
+
+	for name, args := range map[string][]string{
+		"an IP range that is not a CIDR": signIntermediate("--excluded-ip-ranges", "10.0.0.1"),
+		"a URI domain with a path": signIntermediate(
+			"--permitted-uri-domains", "spiffe://example.org/ns",
+		),
+	} {
+		t.Run(name, func(t *testing.T) {
+			runFailure(t, exitInvalidInput, args...)
+		})
+	}
+}
+
+func TestSignLeaf(t *testing.T) {
+	chain := signTestChain(t)
+
+	csr := run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	)
+
+	output := run(t,
+		"sign", "leaf",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--parent-cert", chain.intermediatePath,
+		"--child-csr", writeTemp(t, "leaf.csr", csr),
+		"--common-name", "leaf.example.com",
+		"--days", "30",
+		"--dns-names", "leaf.example.com,www.example.com",
+		"--ip-addresses", "192.0.2.1,2001:db8::1",
+		"--server",
+		"--client",
+	)
+
+	checkGolden(t, "sign-leaf", describeCertificate(t, output))
+
+	leaf, err := x509.ParseCertificate(decodePEM(t, output, "CERTIFICATE"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(readFile(t, chain.rootPath))
+
+	intermediates := x509.NewCertPool()
+	intermediates.AppendCertsFromPEM(readFile(t, chain.intermediatePath))
+
+	_, err = leaf.Verify(x509.VerifyOptions{
+		DNSName:       "www.example.com",
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+
+	if err != nil {
+		t.Errorf("Could not verify leaf certificate chain: %v", err)
+	}
+}
+
+func TestSignLeafSubjectAltNames(t *testing.T) {
+	chain := signTestChain(t)
+
+	csr := writeTemp(t, "leaf.csr", run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	))
+
+	signLeaf := func(extraArgs ...string) []string {
+		return append([]string{
+			"sign", "leaf",
+			"--kms-key", testKeyVersion("intermediate"),
+			"--parent-cert", chain.intermediatePath,
+			"--child-csr", csr,
+			"--common-name", "alice",
+			"--days", "30",
+		}, extraArgs...)
+	}
+
+	output := run(t, signLeaf(
+		"--email-addresses", "alice@example.com",
+		"--uris", "spiffe://example.org/ns/default/sa/alice",
+		"--upns", "alice@corp.example.com",
+		"--other-names", "1.3.6.1.4.1.99999.1=employee 42",
+		"--client",
+	)...)
+
+	checkGolden(t, "sign-leaf-sans", describeCertificate(t, output))
+
+	leaf, err := x509.ParseCertificate(decodePEM(t, output, "CERTIFICATE"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(leaf.EmailAddresses) != 1 || leaf.EmailAddresses[0] != "alice@example.com" ||
+		len(leaf.URIs) != 1 || leaf.URIs[0].String() != "spiffe://example.org/ns/default/sa/alice" {
+		t.Errorf("Unexpected names %v %v", leaf.EmailAddresses, leaf.URIs)
+	}
+
+	for _, test := range []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "display name",
+			args:    []string{"--email-addresses", "Alice <alice@example.com>"},
+			wantErr: "is not a bare ASCII address",
+		},
+		{
+			name:    "SPIFFE ID with a trailing slash",
+			args:    []string{"--uris", "spiffe://example.org/alice/"},
+			wantErr: "path cannot have empty",
+		},
+		{
+			name: "SPIFFE ID with other URIs",
+			args: []string{
+				"--uris", "spiffe://example.org/alice,https://example.com/alice",
+			},
+			wantErr: "cannot have other URIs",
+		},
+		{
+			name:    "UPN without a domain",
+			args:    []string{"--upns", "alice"},
+			wantErr: "is not of the form user@domain",
+		},
+		{
+			name:    "malformed other name",
+			args:    []string{"--other-names", "upn:alice"},
+			wantErr: "is not of the form OID=VALUE",
+		},
+		{
+			name:    "other name with an invalid OID",
+			args:    []string{"--other-names", "1.3.06=alice"},
+			wantErr: `Invalid OID "1.3.06"`,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stderr := runFailure(t, exitInvalidInput, signLeaf(test.args...)...)
+
+			if !strings.Contains(stderr, test.wantErr) {
+				t.Errorf("Unexpected error output:\n%s", stderr)
+			}
+		})
+	}
+}
+
+func TestIssuerURLs(t *testing.T) {
+	issuerDefaults := filepath.Join(t.TempDir(), "issuer-defaults.json")
+
+	root := run(t,
+		"generate", "root-ca",
+		"--kms-key", testKeyVersion("root"),
+		"--common-name", "Test Root CA",
+		"--days", "3650",
+		"--issuer-defaults", issuerDefaults,
+		"--child-ocsp-servers", "http://ocsp.example.com/root",
+		"--child-issuing-certificate-urls", "http://pki.example.com/root.crt",
+		"--child-crl-distribution-points", "http://pki.example.com/root.crl",
+	)
+
+	intermediate := run(t,
+		"sign", "intermediate-ca",
+		"--kms-key", testKeyVersion("root"),
+		"--parent-cert", writeTemp(t, "root.pem", root),
+		"--child-csr", writeTemp(t, "intermediate.csr", run(t,
+			"generate", "csr",
+			"--kms-key", testKeyVersion("intermediate"),
+			"--common-name", "ignored",
+		)),
+		"--common-name", "Test Intermediate CA",
+		"--days", "365",
+		"--issuer-defaults", issuerDefaults,
+		"--child-ocsp-servers", "http://ocsp.example.com/intermediate",
+		"--child-crl-distribution-points", "http://pki.example.com/intermediate.crl",
+	)
+
+	checkGolden(t, "issuer-urls-intermediate", describeCertificate(t, intermediate))
+
+	leafCSR := writeTemp(t, "leaf.csr", run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	))
+
+	signLeaf := func(extraArgs ...string) []string {
+		return append([]string{
+			"sign", "leaf",
+			"--kms-key", testKeyVersion("intermediate"),
+			"--parent-cert", writeTemp(t, "intermediate.pem", intermediate),
+			"--child-csr", leafCSR,
+			"--common-name", "leaf.example.com",
+			"--days", "30",
+			"--issuer-defaults", issuerDefaults,
+		}, extraArgs...)
+	}
+
+	for _, test := range []struct {
+		args        []string
+		ocspServers []string
+		caIssuers   []string
+		crls        []string
+	}{
+		{
+			args:        nil,
+			ocspServers: []string{"http://ocsp.example.com/intermediate"},
+			crls:        []string{"http://pki.example.com/intermediate.crl"},
+		},
+		{
+			args: []string{
+				"--ocsp-servers", "http://ocsp2.example.com",
+				"--issuing-certificate-urls", "http://pki.example.com/intermediate.crt",
+			},
+			ocspServers: []string{"http://ocsp2.example.com"},
+			caIssuers:   []string{"http://pki.example.com/intermediate.crt"},
+			crls:        []string{"http://pki.example.com/intermediate.crl"},
+		},
+	} {
+		leaf, err := x509.ParseCertificate(
+			decodePEM(t, run(t, signLeaf(test.args...)...), "CERTIFICATE"),
+		)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(leaf.OCSPServer, test.ocspServers) ||
+			!reflect.DeepEqual(leaf.IssuingCertificateURL, test.caIssuers) ||
+			!reflect.DeepEqual(leaf.CRLDistributionPoints, test.crls) {
+			t.Errorf(
+				"With %v, got OCSP %v, caIssuers %v and CRLs %v",
+				test.args,
+				leaf.OCSPServer,
+				leaf.IssuingCertificateURL,
+				leaf.CRLDistributionPoints,
+			)
+		}
+	}
+
+	stderr := runFailure(t, exitInvalidInput, signLeaf("--crl-distribution-points", "/root.crl")...)
+
+	if !strings.Contains(stderr, "is not an absolute URL") {
+		t.Errorf("Unexpected error output:\n%s", stderr)
+	}
+
+	stderr = runFailure(t, exitInvalidInput,
+		"generate", "root-ca",
+		"--kms-key", testKeyVersion("root"),
+		"--common-name", "Test Root CA",
+		"--days", "3650",
+		"--child-ocsp-servers", "http://ocsp.example.com/root",
+	)
+
+	if !strings.Contains(stderr, "issuer defaults file, which is required") {
+		t.Errorf("Unexpected error output:\n%s", stderr)
+	}
+}
+
+func TestSignPolicies(t *testing.T) {
+	chain := signTestChain(t)
+
+	intermediate := run(t,
+		"sign", "intermediate-ca",
+		"--kms-key", testKeyVersion("root"),
+		"--parent-cert", chain.rootPath,
+		"--child-csr", writeTemp(t, "intermediate.csr", run(t,
+			"generate", "csr",
+			"--kms-key", testKeyVersion("intermediate"),
+			"--common-name", "ignored",
+		)),
+		"--common-name", "Policy CA",
+		"--days", "365",
+		"--policies", "1.3.6.1.4.1.99999.1",
+		"--policy-cps", "1.3.6.1.4.1.99999.1=https://pki.example.com/cps",
+		"--policy-user-notice", "1.3.6.1.4.1.99999.1=Issued under the Example CP, section 4",
+		"--require-explicit-policy", "0",
+		"--inhibit-policy-mapping", "0",
+		"--inhibit-any-policy", "0",
+		"--policy-mappings", "1.3.6.1.4.1.99999.1=1.3.6.1.4.1.99999.2",
+	)
+
+	checkGolden(t, "sign-policies-intermediate", describeCertificate(t, intermediate))
+
+	leafCSR := writeTemp(t, "leaf.csr", run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	))
+
+	signLeaf := func(extraArgs ...string) []string {
+		return append([]string{
+			"sign", "leaf",
+			"--kms-key", testKeyVersion("intermediate"),
+			"--parent-cert", writeTemp(t, "intermediate.pem", intermediate),
+			"--child-csr", leafCSR,
+			"--common-name", "leaf.example.com",
+			"--days", "30",
+		}, extraArgs...)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(readFile(t, chain.rootPath))
+
+	intermediates := x509.NewCertPool()
+	intermediates.AppendCertsFromPEM(intermediate)
+
+	for _, test := range []struct {
+		policies string
+		valid    bool
+	}{
+		// the CA maps its issuer's policy 1.3.6.1.4.1.99999.1 to 1.3.6.1.4.1.99999.2 below it.
+		{"1.3.6.1.4.1.99999.2", true},
+		{"1.3.6.1.4.1.99999.1", false},
+		// requireExplicitPolicy is 0, so the leaf needs an acceptable policy.
+		{"", false},
+	} {
+		leaf, err := x509.ParseCertificate(
+			decodePEM(t, run(t, signLeaf("--policies", test.policies)...), "CERTIFICATE"),
+		)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = leaf.Verify(x509.VerifyOptions{Roots: roots, Intermediates: intermediates})
+
+		if test.valid && err != nil {
+			t.Errorf("Could not verify a leaf with policies %q: %v", test.policies, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("Verified a leaf with policies %q", test.policies)
+		}
+	}
+
+	for _, test := range []struct {
+		args    []string
+		wantErr string
+	}{
+		{
+			args:    []string{"--policies", "1.3.6.1.4.1.99999.1", "--policy-cps", "/cps"},
+			wantErr: "is not of the form OID=URI",
+		},
+		{
+			args:    []string{"--policy-cps", "1.3.6.1.4.1.99999.1=/cps"},
+			wantErr: "is not an absolute ASCII URI",
+		},
+		{
+			args: []string{
+				"--policy-user-notice", "1.3.6.1.4.1.99999.1=" + strings.Repeat("x", 201),
+			},
+			wantErr: "explicit text is longer than 200 characters",
+		},
+	} {
+		stderr := runFailure(t, exitInvalidInput, signLeaf(test.args...)...)
+
+		if !strings.Contains(stderr, test.wantErr) {
+			t.Errorf("Unexpected error output for %v:\n%s", test.args, stderr)
+		}
+	}
+}
+
+func TestSignKeyUsage(t *testing.T) {
+	chain := signTestChain(t)
+
+	leafCSR := writeTemp(t, "leaf.csr", run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	))
+
+	signLeaf := func(parentPath string, extraArgs ...string) []string {
+		return append([]string{
+			"sign", "leaf",
+			"--kms-key", testKeyVersion("intermediate"),
+			"--parent-cert", parentPath,
+			"--child-csr", leafCSR,
+			"--common-name", "Example Signer",
+			"--days", "30",
+		}, extraArgs...)
+	}
+
+	output := run(t, signLeaf(chain.intermediatePath,
+		"--key-usage", "digitalSignature",
+		"--ext-key-usage", "codeSigning,1.3.6.1.4.1.311.10.3.13",
+	)...)
+
+	checkGolden(t, "sign-leaf-code-signing", describeCertificate(t, output))
+
+	// An intermediate CA limited to S/MIME, whose leaves can only be used for email.
+	emailCA := run(t,
+		"sign", "intermediate-ca",
+		"--kms-key", testKeyVersion("root"),
+		"--parent-cert", chain.rootPath,
+		"--child-csr", writeTemp(t, "intermediate.csr", run(t,
+			"generate", "csr",
+			"--kms-key", testKeyVersion("intermediate"),
+			"--common-name", "ignored",
+		)),
+		"--common-name", "Email CA",
+		"--days", "365",
+		"--ext-key-usage", "emailProtection",
+	)
+
+	checkGolden(t, "sign-intermediate-ca-email", describeCertificate(t, emailCA))
+
+	emailCAPath := writeTemp(t, "email-ca.pem", emailCA)
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(readFile(t, chain.rootPath))
+
+	intermediates := x509.NewCertPool()
+	intermediates.AppendCertsFromPEM(emailCA)
+
+	for _, test := range []struct {
+		extKeyUsage string
+		valid       bool
+	}{
+		{"emailProtection", true},
+		{"serverAuth", false},
+	} {
+		leaf, err := x509.ParseCertificate(decodePEM(t, run(t, signLeaf(emailCAPath,
+			"--email-addresses", "signer@example.com",
+			"--ext-key-usage", test.extKeyUsage,
+		)...), "CERTIFICATE"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = leaf.Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     leaf.ExtKeyUsage,
+		})
+
+		if test.valid && err != nil {
+			t.Errorf("Could not verify a %s leaf of the email CA: %v", test.extKeyUsage, err)
+		} else if !test.valid && err == nil {
+			t.Errorf("Verified a %s leaf of the email CA", test.extKeyUsage)
+		}
+	}
+
+	for _, test := range []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "keyEncipherment for an ECDSA key",
+			args:    signLeaf(chain.intermediatePath, "--key-usage", "keyEncipherment"),
+			wantErr: "ECDSA keys cannot be used for keyEncipherment",
+		},
+		{
+			name:    "keyCertSign for a leaf",
+			args:    signLeaf(chain.intermediatePath, "--key-usage", "keyCertSign"),
+			wantErr: "Only CA certificates can have the keyCertSign key usage",
+		},
+		{
+			name:    "unknown extended key usage",
+			args:    signLeaf(chain.intermediatePath, "--ext-key-usage", "webAuth"),
+			wantErr: `Unknown extended key usage "webAuth"`,
+		},
+		{
+			name: "CA without keyCertSign",
+			args: []string{
+				"generate", "root-ca",
+				"--kms-key", testKeyVersion("root"),
+				"--common-name", "Test Root CA",
+				"--days", "3650",
+				"--key-usage", "digitalSignature,cRLSign",
+			},
+			wantErr: "A CA certificate needs the keyCertSign key usage",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stderr := runFailure(t, exitInvalidInput, test.args...)
+
+			if !strings.Contains(stderr, test.wantErr) {
+				t.Errorf("Unexpected error output:\n%s", stderr)
+			}
+		})
+	}
+}
+
+func TestSignValidity(t *testing.T) {
+	chain := signTestChain(t)
+
+	parent, err := x509.ParseCertificate(
+		decodePEM(t, readFile(t, chain.intermediatePath), "CERTIFICATE"),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafCSR := writeTemp(t, "leaf.csr", run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	))
+
+	signLeaf := func(extraArgs ...string) []string {
+		return append([]string{
+			"sign", "leaf",
+			"--kms-key", testKeyVersion("intermediate"),
+			"--parent-cert", chain.intermediatePath,
+			"--child-csr", leafCSR,
+			"--common-name", "leaf.example.com",
+		}, extraArgs...)
+	}
+
+	parseLeaf := func(args ...string) *x509.Certificate {
+		t.Helper()
+
+		leaf, err := x509.ParseCertificate(decodePEM(t, run(t, args...), "CERTIFICATE"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return leaf
+	}
+
+	start := time.Now().Truncate(time.Second)
+	leaf := parseLeaf(signLeaf("--validity", "15m", "--backdate", "5m")...)
+	end := time.Now()
+
+	if got := leaf.NotAfter.Sub(leaf.NotBefore); got != 20*time.Minute {
+		t.Errorf("Validity = %s, want 20m", got)
+	}
+
+	// NotBefore is truncated to the second, like start, and signing may take several seconds.
+	earliest := start.Add(-5 * time.Minute)
+	latest := end.Add(-5 * time.Minute)
+
+	if leaf.NotBefore.Before(earliest) || leaf.NotBefore.After(latest) {
+		t.Errorf("NotBefore = %s, want 5m before signing, between %s and %s", leaf.NotBefore, earliest, latest)
+	}
+
+	notBefore := start.Add(time.Hour).UTC()
+	notAfter := start.Add(48 * time.Hour).UTC()
+
+	leaf = parseLeaf(signLeaf(
+		"--not-before", notBefore.Format(time.RFC3339),
+		"--not-after", notAfter.Format(time.RFC3339),
+	)...)
+
+	if !leaf.NotBefore.Equal(notBefore) || !leaf.NotAfter.Equal(notAfter) {
+		t.Errorf(
+			"Validity = %s to %s, want %s to %s",
+			leaf.NotBefore,
+			leaf.NotAfter,
+			notBefore,
+			notAfter,
+		)
+	}
+
+	leaf = parseLeaf(signLeaf("--days", "400", "--clamp-to-parent")...)
+
+	if !leaf.NotAfter.Equal(parent.NotAfter) {
+		t.Errorf("NotAfter = %s, want the parent's %s", leaf.NotAfter, parent.NotAfter)
+	}
+
+	for _, test := range []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "past the parent's NotAfter",
+			args:    signLeaf("--days", "400"),
+			wantErr: "after its parent certificate",
+		},
+		{
+			name:    "both --days and --validity",
+			args:    signLeaf("--days", "30", "--validity", "1h"),
+			wantErr: "Only one of --days, --validity or --not-after can be used",
+		},
+		{
+			name: "a backdated --not-before",
+			args: signLeaf(
+				"--validity", "1h",
+				"--not-before", notBefore.Format(time.RFC3339),
+				"--backdate", "5m",
+			),
+			wantErr: "An explicit NotBefore cannot be backdated",
+		},
+		{
+			name: "--not-after before --not-before",
+			args: signLeaf(
+				"--not-before", notAfter.Format(time.RFC3339),
+				"--not-after", notBefore.Format(time.RFC3339),
+			),
+			wantErr: "before it starts",
+		},
+		{
+			name:    "an invalid --not-after",
+			args:    signLeaf("--not-after", "tomorrow"),
+			wantErr: "Invalid --not-after",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stderr := runFailure(t, exitInvalidInput, test.args...)
+
+			if !strings.Contains(stderr, test.wantErr) {
+				t.Errorf("Unexpected error output:\n%s", stderr)
+			}
+		})
+	}
+}
+
+func TestSignTrustCSR(t *testing.T) {
+	chain := signTestChain(t)
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	customOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+
+	// writeCSR writes a CSR like those made by other tools, with a requested extension and a
+	// basic constraints extension that must not be copied.
+	writeCSR := func(commonName string, dnsNames ...string) string {
+		csr, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+			Subject: pkix.Name{
+				CommonName:   commonName,
+				Organization: []string{"Requester"},
+				Locality:     []string{"Brooklyn"},
+			},
+			DNSNames:    dnsNames,
+			IPAddresses: []net.IP{net.ParseIP("192.0.2.10")},
+			ExtraExtensions: []pkix.Extension{
+				{Id: customOID, Value: []byte{0x05, 0x00}},
+				{Id: asn1.ObjectIdentifier{2, 5, 29, 19}, Value: []byte{0x30, 0x03, 0x01, 0x01, 0xff}},
+			},
+		}, key)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return writeTemp(t, "requested.csr", pem.EncodeToMemory(
+			&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csr},
+		))
+	}
+
+	requestedCSR := writeCSR("www.example.com", "www.example.com", "api.example.com")
+
+	// a subject with a second common name, that only the last one would be checked for.
+	twoCommonNamesCSR, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{ExtraNames: []pkix.AttributeTypeAndValue{
+			{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: "evil.org"},
+			{Type: asn1.ObjectIdentifier{2, 5, 4, 3}, Value: "www.example.com"},
+		}},
+		DNSNames: []string{"www.example.com"},
+	}, key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	twoCommonNamesCSRPath := writeTemp(t, "two-common-names.csr", pem.EncodeToMemory(
+		&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: twoCommonNamesCSR},
+	))
+
+	signLeaf := func(csrPath string, extraArgs ...string) []string {
+		return append([]string{
+			"sign", "leaf",
+			"--kms-key", testKeyVersion("intermediate"),
+			"--parent-cert", chain.intermediatePath,
+			"--child-csr", csrPath,
+			"--days", "30",
+			"--trust-csr",
+			"--csr-allowed-ip-ranges", "192.0.2.0/24",
+		}, extraArgs...)
+	}
+
+	output := run(t, signLeaf(requestedCSR,
+		"--csr-allowed-dns-names", "*.example.com",
+		"--csr-allowed-extensions", customOID.String(),
+		"--organization", "Example",
+		"--dns-names", "www.example.com,static.example.com",
+	)...)
+
+	checkGolden(t, "sign-leaf-trust-csr", describeCertificate(t, output))
+
+	// without overrides, the subject is copied in the order it is encoded in the CSR.
+	leaf, err := x509.ParseCertificate(decodePEM(t, run(t, signLeaf(requestedCSR,
+		"--csr-allowed-dns-names", "*.example.com",
+	)...), "CERTIFICATE"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	csr, err := x509.ParseCertificateRequest(
+		decodePEM(t, readFile(t, requestedCSR), "CERTIFICATE REQUEST"),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(leaf.RawSubject, csr.RawSubject) {
+		t.Errorf("Subject = %s, want the CSR's %s", leaf.Subject, csr.Subject)
+	}
+
+	for _, extension := range leaf.Extensions {
+		if extension.Id.Equal(customOID) {
+			t.Errorf("Copied CSR extension %s that is not allowed", customOID)
+		}
+	}
+
+	for _, test := range []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{
+			name:    "a DNS name that is not allowed",
+			args:    signLeaf(requestedCSR, "--csr-allowed-dns-names", "www.example.com"),
+			wantErr: "DNS name api.example.com is not allowed",
+		},
+		{
+			name:    "DNS names without --csr-allowed-dns-names",
+			args:    signLeaf(requestedCSR),
+			wantErr: "DNS name www.example.com is not allowed",
+		},
+		{
+			name: "a common name that is not allowed",
+			args: signLeaf(
+				writeCSR("www.example.org", "www.example.com"),
+				"--csr-allowed-dns-names", "*.example.com",
+			),
+			wantErr: "DNS name www.example.org is not allowed",
+		},
+		{
+			name: "a single-label common name that is not allowed",
+			args: signLeaf(
+				writeCSR("localhost", "www.example.com"),
+				"--csr-allowed-dns-names", "*.example.com",
+			),
+			wantErr: "DNS name localhost is not allowed",
+		},
+		{
+			name:    "a subject with two common names",
+			args:    signLeaf(twoCommonNamesCSRPath, "--csr-allowed-dns-names", "*.example.com"),
+			wantErr: "The CSR subject has 2 common names",
+		},
+		{
+			name: "copying an extension set by the CA",
+			args: signLeaf(requestedCSR,
+				"--csr-allowed-dns-names", "*.example.com",
+				"--csr-allowed-extensions", "2.5.29.19",
+			),
+			wantErr: "The basic constraints extension is set by the CA",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stderr := runFailure(t, exitInvalidInput, test.args...)
+
+			if !strings.Contains(stderr, test.wantErr) {
+				t.Errorf("Unexpected error output:\n%s", stderr)
+			}
+		})
+	}
+
+	stderr := runFailure(t, exitUsageError,
+		"sign", "leaf",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--parent-cert", chain.intermediatePath,
+		"--child-csr", requestedCSR,
+		"--days", "30",
+	)
+
+	if !strings.Contains(stderr, `"common-name" not set`) {
+		t.Errorf("Unexpected error output without --common-name or --trust-csr:\n%s", stderr)
+	}
+}
+
+func TestSignOCSPResponder(t *testing.T) {
+	chain := signTestChain(t)
+
+	csr := run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	)
+
+	output := run(t,
+		"sign", "ocsp-responder",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--parent-cert", chain.intermediatePath,
+		"--child-csr", writeTemp(t, "responder.csr", csr),
+		"--common-name", "Test OCSP Responder",
+	)
+
+	checkGolden(t, "sign-ocsp-responder", describeCertificate(t, output))
+
+	responder, err := x509.ParseCertificate(decodePEM(t, output, "CERTIFICATE"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(readFile(t, chain.rootPath))
+
+	intermediates := x509.NewCertPool()
+	intermediates.AppendCertsFromPEM(readFile(t, chain.intermediatePath))
+
+	_, err = responder.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	})
+
+	if err != nil {
+		t.Errorf("Could not verify OCSP responder certificate chain: %v", err)
+	}
+}
+
+func TestIssuanceDB(t *testing.T) {
+	issuanceDB := filepath.Join(t.TempDir(), "issued.db")
+
+	root := run(t,
+		"generate", "root-ca",
+		"--kms-key", testKeyVersion("root"),
+		"--common-name", "Test Root CA",
+		"--days", "3650",
+		"--issuance-db", issuanceDB,
+		"--requester", "alice",
+	)
+
+	csr := run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	)
+
+	leaf := run(t,
+		"sign", "leaf",
+		"--kms-key", testKeyVersion("root"),
+		"--parent-cert", writeTemp(t, "root.pem", root),
+		"--child-csr", writeTemp(t, "leaf.csr", csr),
+		"--common-name", "leaf.example.com",
+		"--days", "30",
+		"--dns-names", "leaf.example.com",
+		"--issuance-db", issuanceDB,
+		"--requester", "bob",
+	)
+
+	var records []issuancedb.Record
+
+	decoder := json.NewDecoder(bytes.NewReader(runLocal(t,
+		"list", "certificates",
+		"--issuance-db", issuanceDB,
+		"--json",
+	)))
+
+	for decoder.More() {
+		var record issuancedb.Record
+
+		if err := decoder.Decode(&record); err != nil {
+			t.Fatal(err)
+		}
+
+		records = append(records, record)
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("Listed %d certificates, want 2", len(records))
+	}
+
+	for _, record := range records {
+		var wantPEM []byte
+
+		switch record.Requester {
+		case "alice":
+			wantPEM = root
+
+		case "bob":
+			wantPEM = leaf
+
+			if len(record.DNSNames) != 1 || record.DNSNames[0] != "leaf.example.com" {
+				t.Errorf("Recorded DNS names %v, want leaf.example.com", record.DNSNames)
+			}
+
+		default:
+			t.Fatalf("Unexpected requester %q", record.Requester)
+		}
+
+		if record.PEM != string(wantPEM) {
+			t.Errorf("Recorded PEM for %s is not the issued certificate", record.Subject)
+		}
+
+		if record.Issuer != "CN=Test Root CA" || record.KeyVersionName != testKeyVersion("root") {
+			t.Errorf("Recorded issuer %s and key %s", record.Issuer, record.KeyVersionName)
+		}
+	}
+
+	table := runLocal(t,
+		"list", "certificates",
+		"--issuance-db", issuanceDB,
+		"--expiring-within", "744h",
+	)
+
+	lines := strings.Split(strings.TrimSpace(string(table)), "\n")
+
+	if len(lines) != 2 || !strings.Contains(lines[1], "CN=leaf.example.com") {
+		t.Errorf("Listed certificates expiring within 31 days:\n%s", table)
+	}
+}
+
+func TestSignProfile(t *testing.T) {
+	chain := signTestChain(t)
+
+	csr := writeTemp(t, "leaf.csr", run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	))
+
+	signProfile := func(profile string, extraArgs ...string) []string {
+		return append([]string{
+			"sign",
+			"--profile", profile,
+			"--profile-file", filepath.Join("testdata", "profiles.yaml"),
+			"--kms-key", testKeyVersion("intermediate"),
+			"--parent-cert", chain.intermediatePath,
+			"--child-csr", csr,
+		}, extraArgs...)
+	}
+
+	output := run(t, signProfile("web-server",
+		"--common-name", "www.example.com",
+		"--dns-names", "www.example.com",
+		"--ip-addresses", "192.0.2.1",
+	)...)
+
+	checkGolden(t, "sign-profile-web-server", describeCertificate(t, output))
+
+	output = run(t, signProfile("issuing-ca", "--common-name", "Issuing CA", "--days", "180")...)
+
+	checkGolden(t, "sign-profile-issuing-ca", describeCertificate(t, output))
+
+	for name, args := range map[string][]string{
+		"a DNS name that is not allowed": signProfile("web-server",
+			"--common-name", "www.example.org",
+			"--dns-names", "www.example.org",
+		),
+		"too long a validity": signProfile("web-server",
+			"--common-name", "www.example.com",
+			"--days", "398",
+		),
+		"no validity":        signProfile("issuing-ca", "--common-name", "Issuing CA"),
+		"an unknown profile": signProfile("code-signing", "--common-name", "signer"),
+	} {
+		t.Run(name, func(t *testing.T) {
+			runFailure(t, exitInvalidInput, args...)
+		})
+	}
+}
+
+func TestCADir(t *testing.T) {
+	chain := signTestChain(t)
+	caDir := t.TempDir()
+
+	// an entry revoked by 'openssl ca -revoke -crl_compromise'.
+	index := "R\t250101000000Z\t240101120000Z,keyTime,20231231000000Z\t0F\tunknown\t/CN=old\n"
+
+	for name, contents := range map[string]string{
+		"index.txt": index,
+		"serial":    "1000\n",
+		"crlnumber": "01\n",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(caDir, name), []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	csr := writeTemp(t, "leaf.csr", run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	))
+
+	signLeaf := []string{
+		"sign", "leaf",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--parent-cert", chain.intermediatePath,
+		"--child-csr", csr,
+		"--common-name", "leaf.example.com",
+		"--organization", "Example",
+		"--days", "30",
+		"--ca-dir", caDir,
+	}
+
+	leaf, err := x509.ParseCertificate(decodePEM(t, run(t, signLeaf...), "CERTIFICATE"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if leaf.SerialNumber.Int64() != 0x1000 {
+		t.Errorf("SerialNumber = %x, want 1000 from the serial file", leaf.SerialNumber)
+	}
+
+	for name, want := range map[string]string{
+		"serial":            "1001\n",
+		"serial.old":        "1000\n",
+		"index.txt.old":     index,
+		"newcerts/1000.pem": string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leaf.Raw})),
+		"index.txt": index + "V\t" + leaf.NotAfter.UTC().Format("060102150405Z") +
+			"\t\t1000\tunknown\t/O=Example/CN=leaf.example.com\n",
+	} {
+		if got := string(readFile(t, filepath.Join(caDir, name))); got != want {
+			t.Errorf("%s:\n%s\nwant:\n%s", name, got, want)
+		}
+	}
+
+	// replaced files keep their mode.
+	for _, name := range []string{"serial", "index.txt"} {
+		info, err := os.Stat(filepath.Join(caDir, name))
+
+		if err != nil || info.Mode().Perm() != 0600 {
+			t.Errorf("%s mode = %v, %v, want 0600", name, info.Mode(), err)
+		}
+	}
+
+	// the duplicate subject is refused before the certificate is signed and recorded anywhere.
+	issuanceDB := filepath.Join(t.TempDir(), "issuance.db")
+	stderr := runFailure(t, exitInvalidInput, append(signLeaf, "--issuance-db", issuanceDB)...)
+
+	if !strings.Contains(stderr, "valid certificate for /O=Example/CN=leaf.example.com") {
+		t.Errorf("Unexpected error for a duplicate subject:\n%s", stderr)
+	}
+
+	if _, err := os.Stat(issuanceDB); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("The duplicate subject was recorded in an issuance database: %v", err)
+	}
+
+	runLocal(t,
+		"revoke",
+		"--ca-dir", caDir,
+		"--serial", "0x1000",
+		"--reason", "superseded",
+		"--revocation-time", "2024-01-01T13:00:00Z",
+	)
+
+	output := run(t,
+		"sign", "crl",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--parent-cert", chain.intermediatePath,
+		"--this-update", "2024-01-02T00:00:00Z",
+		"--next-update", "2024-01-09T00:00:00Z",
+		"--ca-dir", caDir,
+	)
+
+	checkGolden(t, "sign-crl-ca-dir", describeRevocationList(t, output, chain.intermediatePath))
+
+	if got := string(readFile(t, filepath.Join(caDir, "crlnumber"))); got != "02\n" {
+		t.Errorf("crlnumber = %q after signing CRL 1, want 02", got)
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	chain := signTestChain(t)
+	caDir := t.TempDir()
+	issuanceDB := filepath.Join(t.TempDir(), "issued.db")
+
+	for name, contents := range map[string]string{"index.txt": "", "serial": "1000\n"} {
+		if err := ioutil.WriteFile(filepath.Join(caDir, name), []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	csr := writeTemp(t, "leaf.csr", run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	))
+
+	// two certificates for the same key, recorded in both stores.
+	var leafPaths []string
+
+	for _, commonName := range []string{"a.example.com", "b.example.com"} {
+		leafPaths = append(leafPaths, writeTemp(t, commonName+".pem", run(t,
+			"sign", "leaf",
+			"--kms-key", testKeyVersion("intermediate"),
+			"--parent-cert", chain.intermediatePath,
+			"--child-csr", csr,
+			"--common-name", commonName,
+			"--days", "30",
+			"--ca-dir", caDir,
+			"--issuance-db", issuanceDB,
+		)))
+	}
+
+	crl := run(t,
+		"revoke",
+		"--cert", leafPaths[0],
+		"--reason", "keyCompromise",
+		"--revocation-time", "2024-01-01T13:00:00Z",
+		"--invalidity-date", "2024-01-01T00:00:00Z",
+		"--issuance-db", issuanceDB,
+		"--ca-dir", caDir,
+		"--issuer-cert", chain.intermediatePath,
+		"--crl-out", "-",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--crl-number", "1",
+		"--this-update", "2024-01-02T00:00:00Z",
+		"--next-update", "2024-01-09T00:00:00Z",
+	)
+
+	checkGolden(t, "revoke-crl", describeRevocationList(t, crl, chain.intermediatePath))
+
+	leaf := decodePEM(t, readFile(t, leafPaths[0]), "CERTIFICATE")
+	certificate, err := x509.ParseCertificate(leaf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spkiHash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+
+	statePath := filepath.Join(t.TempDir(), "crl-state.json")
+
+	signCRL := func(args ...string) []byte {
+		return run(t, append([]string{
+			"sign", "crl",
+			"--kms-key", testKeyVersion("intermediate"),
+			"--parent-cert", chain.intermediatePath,
+			"--crl-state", statePath,
+			"--issuance-db", issuanceDB,
+			"--next-update", "2024-01-09T00:00:00Z",
+		}, args...)...)
+	}
+
+	signCRL("--this-update", "2024-01-01T13:30:00Z")
+
+	// only revokes b.example.com, a.example.com is already revoked.
+	runLocal(t,
+		"revoke",
+		"--spki-sha256", hex.EncodeToString(spkiHash[:]),
+		"--reason", "keyCompromise",
+		"--revocation-time", "2024-01-01T14:00:00Z",
+		"--issuance-db", issuanceDB,
+	)
+
+	stderr := runFailure(t, exitInvalidInput,
+		"revoke",
+		"--serial", "0x1000",
+		"--issuance-db", issuanceDB,
+	)
+
+	if !strings.Contains(stderr, "already revoked") {
+		t.Errorf("Unexpected error revoking a revoked certificate:\n%s", stderr)
+	}
+
+	stderr = runFailure(t, exitInvalidInput,
+		"revoke",
+		"--serial", "0x1000",
+		"--reason", "removeFromCRL",
+		"--issuance-db", issuanceDB,
+	)
+
+	if !strings.Contains(stderr, "removeFromCRL is only valid in delta CRLs") {
+		t.Errorf("Unexpected error revoking with removeFromCRL:\n%s", stderr)
+	}
+
+	crl = run(t,
+		"sign", "crl",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--parent-cert", chain.intermediatePath,
+		"--crl-number", "2",
+		"--this-update", "2024-01-02T00:00:00Z",
+		"--next-update", "2024-01-09T00:00:00Z",
+		"--issuance-db", issuanceDB,
+		"--ca-dir", caDir,
+	)
+
+	checkGolden(t, "revoke-sign-crl", describeRevocationList(t, crl, chain.intermediatePath))
+
+	// a delta CRL only lists the certificates revoked since the complete CRL.
+	delta, err := x509.ParseRevocationList(decodePEM(t,
+		signCRL("--delta", "--this-update", "2024-01-02T00:00:00Z"),
+		"X509 CRL",
+	))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(delta.RevokedCertificateEntries) != 1 ||
+		delta.RevokedCertificateEntries[0].SerialNumber.Int64() != 0x1001 {
+		t.Errorf("Delta CRL lists %v, want only b.example.com", delta.RevokedCertificateEntries)
+	}
+}
+
+func TestSignDeltaCRLWithBackdatedRevocation(t *testing.T) {
+	chain := signTestChain(t)
+	issuanceDB := filepath.Join(t.TempDir(), "issued.db")
+	statePath := filepath.Join(t.TempDir(), "crl-state.json")
+
+	leaf := run(t,
+		"sign", "leaf",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--parent-cert", chain.intermediatePath,
+		"--child-csr", writeTemp(t, "leaf.csr", run(t,
+			"generate", "csr",
+			"--kms-key", testKeyVersion("leaf"),
+			"--common-name", "ignored",
+		)),
+		"--common-name", "leaf.example.com",
+		"--days", "30",
+		"--issuance-db", issuanceDB,
+	)
+
+	signCRL := func(args ...string) *x509.RevocationList {
+		output := run(t, append([]string{
+			"sign", "crl",
+			"--kms-key", testKeyVersion("intermediate"),
+			"--parent-cert", chain.intermediatePath,
+			"--crl-state", statePath,
+			"--issuance-db", issuanceDB,
+			"--next-update", time.Now().Add(24 * time.Hour).Format(time.RFC3339),
+		}, args...)...)
+
+		revocationList, err := x509.ParseRevocationList(decodePEM(t, output, "X509 CRL"))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return revocationList
+	}
+
+	base := signCRL()
+
+	// a key compromise found after the complete CRL, backdated to before it was issued.
+	runLocal(t,
+		"revoke",
+		"--cert", writeTemp(t, "leaf.pem", leaf),
+		"--reason", "keyCompromise",
+		"--revocation-time", base.ThisUpdate.Add(-time.Hour).Format(time.RFC3339),
+		"--issuance-db", issuanceDB,
+	)
+
+	delta := signCRL("--delta")
+
+	if len(delta.RevokedCertificateEntries) != 1 {
+		t.Errorf(
+			"Delta CRL lists %d certificates, want the backdated revocation",
+			len(delta.RevokedCertificateEntries),
+		)
+	}
+}
+
+func TestEd25519AndSecp256k1Keys(t *testing.T) {
+	issuanceDB := filepath.Join(t.TempDir(), "issued.db")
+	caDir := t.TempDir()
+
+	for name, contents := range map[string]string{"index.txt": "", "serial": "1000\n"} {
+		if err := ioutil.WriteFile(filepath.Join(caDir, name), []byte(contents), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	root := run(t,
+		"generate", "root-ca",
+		"--kms-key", testKeyVersion("ed25519"),
+		"--common-name", "Test Ed25519 Root CA",
+		"--days", "3650",
+	)
+
+	checkGolden(t, "generate-root-ca-ed25519", describeCertificate(t, root))
+
+	csr := run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("secp256k1"),
+		"--common-name", "ignored",
+	)
+
+	checkGolden(t, "generate-csr-secp256k1", describeCertificateRequest(t, csr))
+
+	output := run(t,
+		"sign", "leaf",
+		"--kms-key", testKeyVersion("ed25519"),
+		"--parent-cert", writeTemp(t, "ed25519-root.pem", root),
+		"--child-csr", writeTemp(t, "secp256k1.csr", csr),
+		"--common-name", "secp256k1.example.com",
+		"--days", "30",
+		"--dns-names", "secp256k1.example.com",
+		"--client",
+		"--issuance-db", issuanceDB,
+		"--ca-dir", caDir,
+	)
+
+	checkGolden(t, "sign-leaf-secp256k1", describeCertificate(t, output))
+
+	rootCertificate, err := kmssign.ParseCertificate(decodePEM(t, root, "CERTIFICATE"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := kmssign.ParseCertificate(decodePEM(t, output, "CERTIFICATE"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := leaf.CheckSignatureFrom(rootCertificate); err != nil {
+		t.Errorf("Leaf certificate signature is invalid: %v", err)
+	}
+
+	// revoking by public key parses the recorded secp256k1 certificate.
+	spkiHash := sha256.Sum256(leaf.RawSubjectPublicKeyInfo)
+
+	runLocal(t,
+		"revoke",
+		"--spki-sha256", hex.EncodeToString(spkiHash[:]),
+		"--reason", "keyCompromise",
+		"--issuance-db", issuanceDB,
+		"--ca-dir", caDir,
+	)
+}
+
+func TestRawPKCS1SignatureHash(t *testing.T) {
+	output := run(t,
+		"generate", "root-ca",
+		"--kms-key", testKeyVersion("raw-pkcs1"),
+		"--common-name", "Test SHA-384 Root CA",
+		"--days", "3650",
+		"--signature-hash", "SHA384",
+	)
+
+	checkGolden(t, "generate-root-ca-sha384", describeCertificate(t, output))
+
+	output = run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("raw-pkcs1"),
+		"--common-name", "Test SHA-512 CSR",
+		"--signature-hash", "SHA512",
+	)
+
+	checkGolden(t, "generate-csr-sha512", describeCertificateRequest(t, output))
+}
+
+func TestCryptoKeyName(t *testing.T) {
+	output := run(t,
+		"generate", "csr",
+		"--kms-key", testCryptoKeys+"rotated",
+		"--common-name", "Rotated",
+	)
+
+	checkGolden(t, "generate-csr-rotated", describeCertificateRequest(t, output))
+
+	stderr := runFailure(t, exitUnusableKey,
+		"generate", "csr",
+		"--kms-key", testCryptoKeys+"rotated",
+		"--kms-version-selector", "highest-number",
+		"--common-name", "Rotated",
+	)
+
+	if !strings.Contains(stderr, "cryptoKeyVersions/3") || !strings.Contains(stderr, "DISABLED") {
+		t.Errorf("Unexpected error for a disabled version:\n%s", stderr)
+	}
+}
+
+func TestMinProtectionLevel(t *testing.T) {
+	run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--kms-min-protection-level", "SOFTWARE",
+		"--common-name", "Software",
+	)
+
+	stderr := runFailure(t, exitUnusableKey,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--kms-min-protection-level", "HSM",
+		"--common-name", "Software",
+	)
+
+	if !strings.Contains(stderr, "protection level SOFTWARE, at least HSM is required") {
+		t.Errorf("Unexpected error for a SOFTWARE key:\n%s", stderr)
+	}
+
+	// only external keys meet an EXTERNAL minimum, whether or not they are allowed to meet HSM.
+	stderr = runFailure(t, exitUnusableKey,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--kms-min-protection-level", "EXTERNAL",
+		"--kms-allow-external-keys",
+		"--common-name", "Software",
+	)
+
+	if !strings.Contains(stderr, "protection level SOFTWARE, at least EXTERNAL is required") {
+		t.Errorf("Unexpected error for a SOFTWARE key with an EXTERNAL minimum:\n%s", stderr)
+	}
+}
+
+func TestSignWithMismatchedParent(t *testing.T) {
+	chain := signTestChain(t)
+
+	csr := run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	)
+
+	stderr := runFailure(t, exitParentCannotSign,
+		"sign", "leaf",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--parent-cert", chain.rootPath,
+		"--child-csr", writeTemp(t, "leaf.csr", csr),
+		"--common-name", "leaf.example.com",
+		"--days", "30",
+	)
+
+	if !strings.Contains(stderr, "does not match the KMS key") {
+		t.Errorf("Unexpected error for a mismatched parent:\n%s", stderr)
+	}
+}
+
+func TestSignCRL(t *testing.T) {
+	chain := signTestChain(t)
+
+	output := run(t,
+		"sign", "crl",
+		"--kms-key", testKeyVersion("root"),
+		"--parent-cert", chain.rootPath,
+		"--crl-number", "7",
+		"--this-update", "2024-01-02T00:00:00Z",
+		"--next-update", "2024-01-09T00:00:00Z",
+		"--revoked", "1234",
+		"--revoked", "0x1f,2024-01-01T12:00:00Z,keyCompromise,2023-12-31T00:00:00Z",
+		"--revoked", "0a:0b,2024-01-01T13:00:00+01:00,superseded",
+	)
+
+	checkGolden(t, "sign-crl", describeRevocationList(t, output, chain.rootPath))
+
+	stderr := runFailure(t, exitInvalidInput,
+		"sign", "crl",
+		"--kms-key", testKeyVersion("root"),
+		"--parent-cert", chain.rootPath,
+		"--crl-number", "8",
+		"--next-update", "2030-01-09T00:00:00Z",
+		"--revoked", "1234,,notAReason",
+	)
+
+	if !strings.Contains(stderr, `Unknown revocation reason "notAReason"`) {
+		t.Errorf("Unexpected error for an unknown reason:\n%s", stderr)
+	}
+}
+
+func TestSignCRLWithState(t *testing.T) {
+	chain := signTestChain(t)
+	statePath := filepath.Join(t.TempDir(), "crl-state.json")
+
+	signCRL := func(args ...string) []byte {
+		return run(t, append([]string{
+			"sign", "crl",
+			"--kms-key", testKeyVersion("root"),
+			"--parent-cert", chain.rootPath,
+			"--crl-state", statePath,
+			"--this-update", "2024-01-02T00:00:00Z",
+			"--next-update", "2024-01-09T00:00:00Z",
+		}, args...)...)
+	}
+
+	signCRL()
+
+	if info, err := os.Stat(statePath); err != nil || info.Mode().Perm() != 0644 {
+		t.Errorf("CRL state mode = %v, %v, want 0644", info.Mode(), err)
+	}
+
+	signCRL("--freshest-crl", "http://crl.example.com/delta.crl")
+
+	output := signCRL("--delta", "--revoked", "0x1f,2024-01-01T12:00:00Z,keyCompromise")
+
+	checkGolden(t, "sign-crl-delta", describeRevocationList(t, output, chain.rootPath))
+
+	stderr := runFailure(t, exitInvalidInput,
+		"sign", "crl",
+		"--kms-key", testKeyVersion("root"),
+		"--parent-cert", chain.rootPath,
+		"--crl-state", statePath,
+		"--next-update", "2030-01-09T00:00:00Z",
+		"--delta",
+		"--freshest-crl", "http://crl.example.com/delta.crl",
+	)
+
+	if !strings.Contains(stderr, "Delta CRLs cannot have a Freshest CRL extension") {
+		t.Errorf("Unexpected error for a delta CRL with --freshest-crl:\n%s", stderr)
+	}
+
+	stderr = runFailure(t, exitInvalidInput,
+		"sign", "crl",
+		"--kms-key", testKeyVersion("root"),
+		"--parent-cert", chain.rootPath,
+		"--crl-state", statePath,
+		"--crl-number", "3",
+		"--next-update", "2030-01-09T00:00:00Z",
+	)
+
+	if !strings.Contains(stderr, "CRL number 3 is not greater than the last CRL number 3") {
+		t.Errorf("Unexpected error for a reused CRL number:\n%s", stderr)
+	}
+
+	// a different issuer has its own CRL numbers.
+	output = run(t,
+		"sign", "crl",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--parent-cert", chain.intermediatePath,
+		"--crl-state", statePath,
+		"--next-update", "2030-01-09T00:00:00Z",
+	)
+
+	revocationList, err := x509.ParseRevocationList(decodePEM(t, output, "X509 CRL"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if revocationList.Number.Int64() != 1 {
+		t.Errorf("Intermediate CA CRL number = %s, want 1", revocationList.Number)
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	chain := signTestChain(t)
+
+	leafCSR := writeTemp(t, "leaf.csr", run(t,
+		"generate", "csr",
+		"--kms-key", testKeyVersion("leaf"),
+		"--common-name", "ignored",
+	))
+
+	leaf := run(t,
+		"sign", "leaf",
+		"--kms-key", testKeyVersion("intermediate"),
+		"--parent-cert", chain.intermediatePath,
+		"--child-csr", leafCSR,
+		"--common-name", "leaf.example.com",
+		"--days", "30",
+	)
+
+	for _, test := range []struct {
+		name     string
+		args     []string
+		wantCode int
+		wantErr  string
+	}{
+		{
+			name: "missing required flag",
+			args: []string{
+				"generate", "root-ca",
+				"--kms-key", testKeyVersion("root"),
+				"--common-name", "Test Root CA",
+			},
+			wantCode: exitUsageError,
+			wantErr:  `required flag(s) "days", "validity" or "not-after" not set`,
+		},
+		{
+			name: "missing validity flags for a leaf",
+			args: []string{
+				"sign", "leaf",
+				"--kms-key", testKeyVersion("intermediate"),
+				"--parent-cert", chain.intermediatePath,
+				"--child-csr", leafCSR,
+				"--common-name", "leaf.example.com",
+			},
+			wantCode: exitUsageError,
+			wantErr:  `required flag(s) "days", "validity" or "not-after" not set`,
+		},
+		{
+			name: "missing validity flags for an intermediate CA",
+			args: []string{
+				"sign", "intermediate-ca",
+				"--kms-key", testKeyVersion("root"),
+				"--parent-cert", chain.rootPath,
+				"--child-csr", leafCSR,
+				"--common-name", "Test Intermediate CA",
+			},
+			wantCode: exitUsageError,
+			wantErr:  `required flag(s) "days", "validity" or "not-after" not set`,
+		},
+		{
+			name: "unreadable CSR",
+			args: []string{
+				"sign", "leaf",
+				"--kms-key", testKeyVersion("intermediate"),
+				"--parent-cert", chain.intermediatePath,
+				"--child-csr", chain.rootPath,
+				"--common-name", "leaf.example.com",
+				"--days", "30",
+			},
+			wantCode: exitInvalidInput,
+			wantErr:  "Failed to decode PEM-formatted child certificate request",
+		},
+		{
+			name: "unsupported signature hash",
+			args: []string{
+				"generate", "csr",
+				"--kms-key", testKeyVersion("raw-pkcs1"),
+				"--signature-hash", "MD5",
+				"--common-name", "Raw",
+			},
+			wantCode: exitInvalidInput,
+			wantErr:  `Unsupported signature hash "MD5"`,
+		},
+		{
+			name: "parent is not a CA",
+			args: []string{
+				"sign", "leaf",
+				"--kms-key", testKeyVersion("leaf"),
+				"--parent-cert", writeTemp(t, "leaf.pem", leaf),
+				"--child-csr", leafCSR,
+				"--common-name", "leaf.example.com",
+				"--days", "1",
+			},
+			wantCode: exitParentCannotSign,
+			wantErr:  "Cannot sign certificate with a non-CA certificate",
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			stderr := runFailure(t, test.wantCode, test.args...)
+
+			if !strings.Contains(stderr, "Error: ") || !strings.Contains(stderr, test.wantErr) {
+				t.Errorf("Unexpected error output:\n%s", stderr)
+			}
+		})
+	}
+}
+
+func readFile(t *testing.T, path string) []byte {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
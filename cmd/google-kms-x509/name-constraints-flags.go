@@ -0,0 +1,95 @@
+package main
+
+import (
+	"github.com/ericnorris/google-kms-x509/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var (
+	nameConstraintsCritical bool
+
+	permittedDNSDomains     []string
+	excludedDNSDomains      []string
+	permittedIPRanges       []string
+	excludedIPRanges        []string
+	permittedEmailAddresses []string
+	excludedEmailAddresses  []string
+	permittedURIDomains     []string
+	excludedURIDomains      []string
+)
+
+func addNameConstraintsFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(
+		&nameConstraintsCritical,
+		"name-constraints-critical",
+		true,
+		"mark the x509 Name Constraints extension critical, as RFC 5280 requires",
+	)
+
+	for _, flag := range []struct {
+		value       *[]string
+		name        string
+		description string
+	}{
+		{
+			&permittedDNSDomains,
+			"permitted-dns-domains",
+			"permitted DNS names for x509 Name Constraints extension",
+		},
+		{
+			&excludedDNSDomains,
+			"excluded-dns-domains",
+			"excluded DNS names for x509 Name Constraints extension",
+		},
+		{
+			&permittedIPRanges,
+			"permitted-ip-ranges",
+			"permitted IP ranges in CIDR form, e.g. 10.0.0.0/8, for x509 Name Constraints extension",
+		},
+		{
+			&excludedIPRanges,
+			"excluded-ip-ranges",
+			"excluded IP ranges in CIDR form, e.g. 192.168.0.0/16, for x509 Name Constraints extension",
+		},
+		{
+			&permittedEmailAddresses,
+			"permitted-email-addresses",
+			"permitted mailboxes, hosts (example.com) or domains (.example.com) of email addresses " +
+				"for x509 Name Constraints extension",
+		},
+		{
+			&excludedEmailAddresses,
+			"excluded-email-addresses",
+			"excluded mailboxes, hosts (example.com) or domains (.example.com) of email addresses " +
+				"for x509 Name Constraints extension",
+		},
+		{
+			&permittedURIDomains,
+			"permitted-uri-domains",
+			"permitted hosts (example.com) or domains (.example.com) of URIs, or SPIFFE trust " +
+				"domains (spiffe://example.org), for x509 Name Constraints extension",
+		},
+		{
+			&excludedURIDomains,
+			"excluded-uri-domains",
+			"excluded hosts (example.com) or domains (.example.com) of URIs, or SPIFFE trust " +
+				"domains (spiffe://example.org), for x509 Name Constraints extension",
+		},
+	} {
+		cmd.Flags().StringSliceVar(flag.value, flag.name, []string{}, flag.description)
+	}
+}
+
+func convertNameConstraintsFlagsToNameConstraints() profile.NameConstraints {
+	return profile.NameConstraints{
+		Critical:                nameConstraintsCritical,
+		PermittedDNSDomains:     permittedDNSDomains,
+		ExcludedDNSDomains:      excludedDNSDomains,
+		PermittedIPRanges:       permittedIPRanges,
+		ExcludedIPRanges:        excludedIPRanges,
+		PermittedEmailAddresses: permittedEmailAddresses,
+		ExcludedEmailAddresses:  excludedEmailAddresses,
+		PermittedURIDomains:     permittedURIDomains,
+		ExcludedURIDomains:      excludedURIDomains,
+	}
+}
@@ -14,16 +14,10 @@ func addOutFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVarP(&outFilePath, "out", "o", "-", "output file path, '-' for stdout")
 }
 
-func convertOutFlagsToFile() *os.File {
+func convertOutFlagsToFile() (*os.File, error) {
 	if outFilePath == "-" {
-		return os.Stdout
+		return os.Stdout, nil
 	}
 
-	out, err := os.Create(outFilePath)
-
-	if err != nil {
-		panic(err)
-	}
-
-	return out
+	return os.Create(outFilePath)
 }
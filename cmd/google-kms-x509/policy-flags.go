@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/ericnorris/google-kms-x509/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var (
+	policies          []string
+	policyCPS         []string
+	policyUserNotices []string
+
+	requireExplicitPolicy int
+	inhibitPolicyMapping  int
+	inhibitAnyPolicy      int
+	policyMappings        []string
+)
+
+func addPolicyFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(
+		&policies,
+		"policies",
+		[]string{},
+		"policy OIDs for x509 Certificate Policies extension",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&policyCPS,
+		"policy-cps",
+		[]string{},
+		"CPS URI qualifier for a policy, as OID=URI; repeat for more",
+	)
+
+	cmd.Flags().StringArrayVar(
+		&policyUserNotices,
+		"policy-user-notice",
+		[]string{},
+		"user notice explicit text qualifier for a policy, as OID=TEXT; repeat for more",
+	)
+}
+
+// addPolicyConstraintFlags adds the flags constraining the policies of the certificates below a
+// CA.
+func addPolicyConstraintFlags(cmd *cobra.Command) {
+	cmd.Flags().IntVar(
+		&requireExplicitPolicy,
+		"require-explicit-policy",
+		-1,
+		"certificates allowed below this CA before an acceptable policy is required, for x509 "+
+			"Policy Constraints extension (default none)",
+	)
+
+	cmd.Flags().IntVar(
+		&inhibitPolicyMapping,
+		"inhibit-policy-mapping",
+		-1,
+		"certificates allowed below this CA before policy mappings are ignored, for x509 Policy "+
+			"Constraints extension (default none)",
+	)
+
+	cmd.Flags().IntVar(
+		&inhibitAnyPolicy,
+		"inhibit-any-policy",
+		-1,
+		"certificates allowed below this CA before anyPolicy stops matching other policies, for "+
+			"x509 Inhibit anyPolicy extension (default none)",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&policyMappings,
+		"policy-mappings",
+		[]string{},
+		"ISSUER_OID=SUBJECT_OID pairs for x509 Policy Mappings extension",
+	)
+}
+
+// convertPolicyFlagsToCertificatePolicies returns the policies and constraints set by the flags.
+// A policy qualified with --policy-cps or --policy-user-notice is added to --policies if missing.
+func convertPolicyFlagsToCertificatePolicies() (profile.CertificatePolicies, error) {
+	var certificatePolicies profile.CertificatePolicies
+
+	policy := func(id string) *profile.Policy {
+		for i := range certificatePolicies.Policies {
+			if certificatePolicies.Policies[i].ID == id {
+				return &certificatePolicies.Policies[i]
+			}
+		}
+
+		certificatePolicies.Policies = append(certificatePolicies.Policies, profile.Policy{ID: id})
+
+		return &certificatePolicies.Policies[len(certificatePolicies.Policies)-1]
+	}
+
+	for _, id := range policies {
+		policy(id)
+	}
+
+	for _, value := range policyCPS {
+		id, cpsURI, found := strings.Cut(value, "=")
+
+		if !found {
+			return profile.CertificatePolicies{}, fmt.Errorf(
+				"%w: --policy-cps %q is not of the form OID=URI",
+				cli.ErrInvalidInput,
+				value,
+			)
+		}
+
+		qualified := policy(id)
+		qualified.CPS = append(qualified.CPS, cpsURI)
+	}
+
+	for _, value := range policyUserNotices {
+		id, explicitText, found := strings.Cut(value, "=")
+
+		if !found {
+			return profile.CertificatePolicies{}, fmt.Errorf(
+				"%w: --policy-user-notice %q is not of the form OID=TEXT",
+				cli.ErrInvalidInput,
+				value,
+			)
+		}
+
+		qualified := policy(id)
+		qualified.UserNotices = append(
+			qualified.UserNotices,
+			profile.UserNotice{ExplicitText: explicitText},
+		)
+	}
+
+	if requireExplicitPolicy >= 0 || inhibitPolicyMapping >= 0 {
+		certificatePolicies.PolicyConstraints = &profile.PolicyConstraints{}
+
+		if requireExplicitPolicy >= 0 {
+			certificatePolicies.PolicyConstraints.RequireExplicitPolicy = &requireExplicitPolicy
+		}
+
+		if inhibitPolicyMapping >= 0 {
+			certificatePolicies.PolicyConstraints.InhibitPolicyMapping = &inhibitPolicyMapping
+		}
+	}
+
+	if inhibitAnyPolicy >= 0 {
+		certificatePolicies.InhibitAnyPolicy = &inhibitAnyPolicy
+	}
+
+	for _, value := range policyMappings {
+		issuerDomainPolicy, subjectDomainPolicy, found := strings.Cut(value, "=")
+
+		if !found {
+			return profile.CertificatePolicies{}, fmt.Errorf(
+				"%w: --policy-mappings %q is not of the form ISSUER_OID=SUBJECT_OID",
+				cli.ErrInvalidInput,
+				value,
+			)
+		}
+
+		certificatePolicies.PolicyMappings = append(
+			certificatePolicies.PolicyMappings,
+			profile.PolicyMapping{
+				IssuerDomainPolicy:  issuerDomainPolicy,
+				SubjectDomainPolicy: subjectDomainPolicy,
+			},
+		)
+	}
+
+	return certificatePolicies, nil
+}
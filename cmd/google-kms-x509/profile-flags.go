@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/ericnorris/google-kms-x509/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var (
+	profileName     string
+	profileFilePath string
+)
+
+func addProfileFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&profileName, "profile", "", "name of the certificate profile to apply")
+	cmd.MarkFlagRequired("profile")
+
+	cmd.Flags().StringVar(
+		&profileFilePath,
+		"profile-file",
+		"",
+		"YAML or JSON file of certificate profiles; JSON if the name ends in .json",
+	)
+	cmd.MarkFlagRequired("profile-file")
+}
+
+func convertProfileFlagsToProfile() (*profile.Profile, error) {
+	certificateProfile, err := profile.Lookup(profileFilePath, profileName)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", cli.ErrInvalidInput, err)
+	}
+
+	return certificateProfile, nil
+}
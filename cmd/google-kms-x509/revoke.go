@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/ericnorris/google-kms-x509/kmssign"
+	"github.com/spf13/cobra"
+)
+
+var revokeCmd = &cobra.Command{
+	Use:   "revoke",
+	Short: "",
+	Long:  ``,
+	RunE: runE(func(cmd *cobra.Command, args []string) error {
+		options, err := convertRevokeFlagsToRevokeOptions()
+
+		if err != nil {
+			return err
+		}
+
+		if revokeCRLOut != "" && (options.IssuerCert == nil || kmsKey == "" || crlNextUpdate == "") {
+			return fmt.Errorf(
+				"%w: --crl-out requires --issuer-cert, --kms-key and --next-update to sign the CRL",
+				cli.ErrInvalidInput,
+			)
+		}
+
+		if revokeCRLOut == "" {
+			return cli.Revoke(options)
+		}
+
+		crlOptions, err := convertCRLFlagsToCRLOptions(cmd, time.Now())
+
+		if err != nil {
+			return err
+		}
+
+		if err := cli.Revoke(options); err != nil {
+			return err
+		}
+
+		out := os.Stdout
+
+		if revokeCRLOut != "-" {
+			if out, err = os.Create(revokeCRLOut); err != nil {
+				return err
+			}
+
+			defer out.Close()
+		}
+
+		return cli.SignCRL(convertKeyFlagsToKeyOptions(), options.IssuerCert, nil, crlOptions, out)
+	}),
+}
+
+var (
+	revokeSerial         string
+	revokeCertPath       string
+	revokeSPKIHash       string
+	revokeIssuerCertPath string
+
+	revokeReason         string
+	revokeTime           string
+	revokeInvalidityDate string
+
+	revokeCRLOut string
+)
+
+func init() {
+	revokeCmd.Flags().StringVar(
+		&revokeSerial,
+		"serial",
+		"",
+		"serial number of the certificate to revoke, decimal, 0x-prefixed or colon-separated hex",
+	)
+
+	revokeCmd.Flags().StringVar(
+		&revokeCertPath, "cert", "", "PEM certificate to revoke, instead of --serial",
+	)
+
+	revokeCmd.Flags().StringVar(
+		&revokeSPKIHash,
+		"spki-sha256",
+		"",
+		"revoke every certificate for the public key with this SHA-256 SubjectPublicKeyInfo hash, "+
+			"in hex or base64, instead of --serial",
+	)
+
+	revokeCmd.Flags().StringVar(
+		&revokeIssuerCertPath,
+		"issuer-cert",
+		"",
+		"only revoke certificates issued by this CA certificate; required by --crl-out",
+	)
+
+	revokeCmd.Flags().StringVar(
+		&revokeReason, "reason", "unspecified", "CRLReason name, such as keyCompromise",
+	)
+
+	revokeCmd.Flags().StringVar(
+		&revokeTime, "revocation-time", "", "revocation time in RFC 3339 format (default now)",
+	)
+
+	revokeCmd.Flags().StringVar(
+		&revokeInvalidityDate,
+		"invalidity-date",
+		"",
+		"time the key is known or suspected to have been compromised, in RFC 3339 format",
+	)
+
+	revokeCmd.Flags().StringVar(
+		&issuanceDBPath,
+		"issuance-db",
+		"",
+		"database of issued certificates, as written with --issuance-db by 'sign', "+
+			"to find and revoke the certificates in",
+	)
+
+	revokeCmd.Flags().StringVar(
+		&caDirPath,
+		"ca-dir",
+		"",
+		"'openssl ca' directory whose index.txt lists the certificates to revoke",
+	)
+
+	revokeCmd.Flags().StringVar(
+		&revokeCRLOut,
+		"crl-out",
+		"",
+		"sign a new CRL for --issuer-cert with --kms-key after revoking, and write it to this path, "+
+			"'-' for stdout",
+	)
+
+	addOptionalKeyFlags(revokeCmd)
+	addCRLUpdateFlags(revokeCmd)
+}
+
+func convertRevokeFlagsToRevokeOptions() (cli.RevokeOptions, error) {
+	options := cli.RevokeOptions{
+		RevokedAt:  time.Now(),
+		IssuanceDB: issuanceDBPath,
+		CADir:      caDirPath,
+	}
+
+	selectors := 0
+
+	for _, selector := range []string{revokeSerial, revokeCertPath, revokeSPKIHash} {
+		if selector != "" {
+			selectors++
+		}
+	}
+
+	if selectors != 1 {
+		return cli.RevokeOptions{}, fmt.Errorf(
+			"%w: Exactly one of --serial, --cert or --spki-sha256 is required",
+			cli.ErrInvalidInput,
+		)
+	}
+
+	var err error
+
+	switch {
+	case revokeSerial != "":
+		if options.SerialNumber, err = parseSerialNumber(revokeSerial); err != nil {
+			return cli.RevokeOptions{}, fmt.Errorf("%w: Invalid --serial: %v", cli.ErrInvalidInput, err)
+		}
+
+	case revokeCertPath != "":
+		if options.Certificate, err = readCertificate(revokeCertPath, "certificate"); err != nil {
+			return cli.RevokeOptions{}, err
+		}
+
+	default:
+		if options.SPKIHash, err = parseSPKIHash(revokeSPKIHash); err != nil {
+			return cli.RevokeOptions{}, fmt.Errorf(
+				"%w: Invalid --spki-sha256: %v",
+				cli.ErrInvalidInput,
+				err,
+			)
+		}
+	}
+
+	if revokeIssuerCertPath != "" {
+		options.IssuerCert, err = readCertificate(revokeIssuerCertPath, "issuer certificate")
+
+		if err != nil {
+			return cli.RevokeOptions{}, err
+		}
+	}
+
+	if options.Reason, err = kmssign.ParseRevocationReason(revokeReason); err != nil {
+		return cli.RevokeOptions{}, fmt.Errorf("%w: Invalid --reason: %v", cli.ErrInvalidInput, err)
+	}
+
+	// removeFromCRL only undoes a certificateHold in a delta CRL, see RFC 5280 section 5.3.1.
+	if options.Reason == kmssign.RevocationReasons["removeFromCRL"] {
+		return cli.RevokeOptions{}, fmt.Errorf(
+			"%w: Invalid --reason: removeFromCRL is only valid in delta CRLs",
+			cli.ErrInvalidInput,
+		)
+	}
+
+	if revokeTime != "" {
+		if options.RevokedAt, err = time.Parse(time.RFC3339, revokeTime); err != nil {
+			return cli.RevokeOptions{}, fmt.Errorf(
+				"%w: Invalid --revocation-time: %v",
+				cli.ErrInvalidInput,
+				err,
+			)
+		}
+	}
+
+	if revokeInvalidityDate != "" {
+		options.InvalidityDate, err = time.Parse(time.RFC3339, revokeInvalidityDate)
+
+		if err != nil {
+			return cli.RevokeOptions{}, fmt.Errorf(
+				"%w: Invalid --invalidity-date: %v",
+				cli.ErrInvalidInput,
+				err,
+			)
+		}
+	}
+
+	return options, nil
+}
+
+// parseSPKIHash accepts a SHA-256 hash in hex, optionally colon-separated as printed by openssl,
+// or in base64 as in HTTP public key pins.
+func parseSPKIHash(value string) ([]byte, error) {
+	hash, err := hex.DecodeString(strings.ReplaceAll(value, ":", ""))
+
+	if err != nil {
+		hash, err = base64.StdEncoding.DecodeString(value)
+	}
+
+	if err != nil || len(hash) != 32 {
+		return nil, fmt.Errorf("Not a SHA-256 hash in hex or base64: %q", value)
+	}
+
+	return hash, nil
+}
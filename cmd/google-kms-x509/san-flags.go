@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/ericnorris/google-kms-x509/internal/profile"
+	"github.com/ericnorris/google-kms-x509/kmssign"
+	"github.com/spf13/cobra"
+)
+
+var (
+	leafDNSNames       []string
+	leafIPAddresses    []net.IP
+	leafEmailAddresses []string
+	leafURIs           []string
+	leafUPNs           []string
+	leafOtherNames     []string
+)
+
+func addSANFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(
+		&leafDNSNames,
+		"dns-names",
+		[]string{},
+		"DNS names for x509 Subject Alternative Names extension",
+	)
+
+	cmd.Flags().IPSliceVar(
+		&leafIPAddresses,
+		"ip-addresses",
+		[]net.IP{},
+		"IP addresses for x509 Subject Alternative Names extension",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&leafEmailAddresses,
+		"email-addresses",
+		[]string{},
+		"email addresses for x509 Subject Alternative Names extension",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&leafURIs,
+		"uris",
+		[]string{},
+		"URIs for x509 Subject Alternative Names extension, such as a SPIFFE ID",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&leafUPNs,
+		"upns",
+		[]string{},
+		"Microsoft user principal names (user@domain) for x509 Subject Alternative Names extension",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&leafOtherNames,
+		"other-names",
+		[]string{},
+		"otherNames for x509 Subject Alternative Names extension, as OID=VALUE with a UTF8String "+
+			"value",
+	)
+}
+
+func convertSANFlagsToSubjectAltNames() (kmssign.SubjectAltNames, error) {
+	sans := kmssign.SubjectAltNames{
+		DNSNames:       leafDNSNames,
+		IPAddresses:    leafIPAddresses,
+		EmailAddresses: leafEmailAddresses,
+	}
+
+	for _, rawURI := range leafURIs {
+		uri, err := url.Parse(rawURI)
+
+		if err != nil {
+			return kmssign.SubjectAltNames{}, fmt.Errorf(
+				"%w: Invalid --uris: %v",
+				cli.ErrInvalidInput,
+				err,
+			)
+		}
+
+		sans.URIs = append(sans.URIs, uri)
+	}
+
+	for _, upn := range leafUPNs {
+		sans.OtherNames = append(
+			sans.OtherNames,
+			kmssign.OtherName{TypeID: kmssign.UPNOtherNameOID, Value: upn},
+		)
+	}
+
+	for _, otherName := range leafOtherNames {
+		parsed, err := parseOtherName(otherName)
+
+		if err != nil {
+			return kmssign.SubjectAltNames{}, fmt.Errorf(
+				"%w: Invalid --other-names: %v",
+				cli.ErrInvalidInput,
+				err,
+			)
+		}
+
+		sans.OtherNames = append(sans.OtherNames, parsed)
+	}
+
+	return sans, nil
+}
+
+// parseOtherName parses an otherName of the form OID=VALUE, e.g.
+// 1.3.6.1.4.1.311.20.2.3=alice@example.com, with the OID parsed as in profiles.
+func parseOtherName(value string) (kmssign.OtherName, error) {
+	rawOID, otherNameValue, found := strings.Cut(value, "=")
+
+	if !found {
+		return kmssign.OtherName{}, fmt.Errorf("%q is not of the form OID=VALUE", value)
+	}
+
+	oid, err := profile.ParseOID(rawOID)
+
+	if err != nil {
+		return kmssign.OtherName{}, err
+	}
+
+	return kmssign.OtherName{TypeID: oid, Value: otherNameValue}, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/x509"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+var serveCmd = &cobra.Command{
+	Use:   "serve",
+	Short: "",
+	Long:  ``,
+}
+
+var serveOCSPCmd = &cobra.Command{
+	Use:   "ocsp",
+	Short: "",
+	Long:  ``,
+	RunE: runE(func(cmd *cobra.Command, args []string) error {
+		issuerCert, err := readCertificate(ocspIssuerCertPath, "issuer certificate")
+
+		if err != nil {
+			return err
+		}
+
+		var responderCert *x509.Certificate
+
+		if ocspResponderCertPath != "" {
+			responderCert, err = readCertificate(ocspResponderCertPath, "responder certificate")
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return cli.ServeOCSP(
+			convertKeyFlagsToKeyOptions(),
+			issuerCert,
+			responderCert,
+			cli.OCSPOptions{
+				Listen:          ocspListen,
+				CRLPaths:        ocspCRLPaths,
+				IssuanceDB:      ocspIssuanceDBPath,
+				CADir:           ocspCADirPath,
+				Validity:        ocspValidity,
+				RefreshInterval: ocspRefreshInterval,
+			},
+		)
+	}),
+}
+
+var (
+	ocspIssuerCertPath    string
+	ocspResponderCertPath string
+	ocspCRLPaths          []string
+	ocspIssuanceDBPath    string
+	ocspCADirPath         string
+	ocspListen            string
+	ocspValidity          time.Duration
+	ocspRefreshInterval   time.Duration
+)
+
+func init() {
+	addKeyFlags(serveOCSPCmd)
+
+	serveOCSPCmd.Flags().StringVar(
+		&ocspIssuerCertPath, "issuer-cert", "", "certificate of the CA to answer OCSP requests for",
+	)
+	serveOCSPCmd.MarkFlagRequired("issuer-cert")
+
+	serveOCSPCmd.Flags().StringVar(
+		&ocspResponderCertPath,
+		"responder-cert",
+		"",
+		"delegated OCSP responder certificate issued by --issuer-cert for --kms-key; "+
+			"without it, --kms-key must be the issuer's key",
+	)
+
+	serveOCSPCmd.Flags().StringArrayVar(
+		&ocspCRLPaths,
+		"crl",
+		[]string{},
+		"PEM or DER CRL issued by --issuer-cert whose revocations are added to those of "+
+			"--issuance-db or --ca-dir, may be repeated",
+	)
+
+	serveOCSPCmd.Flags().StringVar(
+		&ocspIssuanceDBPath,
+		"issuance-db",
+		"",
+		"issuance database listing the certificates issued by --issuer-cert and their "+
+			"revocations; certificates that are not in it are unknown",
+	)
+
+	serveOCSPCmd.Flags().StringVar(
+		&ocspCADirPath,
+		"ca-dir",
+		"",
+		"'openssl ca' directory whose index.txt lists the certificates issued by --issuer-cert "+
+			"and their revocations; certificates that are not in it are unknown",
+	)
+
+	serveOCSPCmd.Flags().StringVar(&ocspListen, "listen", ":8080", "address to serve OCSP requests on")
+
+	serveOCSPCmd.Flags().DurationVar(
+		&ocspValidity, "validity", 24*time.Hour, "time between thisUpdate and nextUpdate in responses",
+	)
+
+	serveOCSPCmd.Flags().DurationVar(
+		&ocspRefreshInterval,
+		"refresh-interval",
+		time.Hour,
+		"how often the CRLs and issued certificates are read again and cached responses signed "+
+			"again, must be shorter than --validity",
+	)
+
+	serveCmd.AddCommand(serveOCSPCmd)
+}
@@ -3,10 +3,13 @@ package main
 import (
 	"crypto/x509"
 	"encoding/pem"
+	"fmt"
 	"io/ioutil"
-	"net"
+	"time"
 
 	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/ericnorris/google-kms-x509/internal/profile"
+	"github.com/ericnorris/google-kms-x509/kmssign"
 	"github.com/spf13/cobra"
 )
 
@@ -14,106 +17,331 @@ var signCmd = &cobra.Command{
 	Use:   "sign",
 	Short: "",
 	Long:  ``,
+	Args:  cobra.NoArgs,
+	RunE: runE(func(cmd *cobra.Command, args []string) error {
+		certificateProfile, err := convertProfileFlagsToProfile()
+
+		if err != nil {
+			return err
+		}
+
+		parentCert, err := convertParentCertFlagsToCertificate()
+
+		if err != nil {
+			return err
+		}
+
+		childCSR, err := convertChildCSRFlagsToCertificateRequest()
+
+		if err != nil {
+			return err
+		}
+
+		sans, err := convertSANFlagsToSubjectAltNames()
+
+		if err != nil {
+			return err
+		}
+
+		validityOptions, err := convertValidityFlagsToValidityOptions(cmd, 0)
+
+		if err != nil {
+			return err
+		}
+
+		out, err := convertOutFlagsToFile()
+
+		if err != nil {
+			return err
+		}
+
+		return cli.SignWithProfile(
+			convertKeyFlagsToKeyOptions(),
+			parentCert,
+			childCSR,
+			certificateProfile,
+			profile.Request{
+				Subject:        convertSubjectFlagsToName(),
+				DNSNames:       sans.DNSNames,
+				IPAddresses:    sans.IPAddresses,
+				EmailAddresses: sans.EmailAddresses,
+				URIs:           sans.URIs,
+				OtherNames:     sans.OtherNames,
+			},
+			validityOptions,
+			convertURLFlagsToURLOptions(),
+			out,
+		)
+	}),
 }
 
 var signIntermediateCACmd = &cobra.Command{
-	Use:   "intermediate-ca",
-	Short: "",
-	Long:  ``,
-	Run: func(cmd *cobra.Command, args []string) {
-		cli.SignIntermediateCA(
-			kmsKey,
-			generateComment,
-			convertParentCertFlagsToCertificate(),
-			convertChildCSRFlagsToCertificateRequest(),
+	Use:     "intermediate-ca",
+	Short:   "",
+	Long:    ``,
+	PreRunE: requireSubjectFlags,
+	RunE: runE(func(cmd *cobra.Command, args []string) error {
+		parentCert, err := convertParentCertFlagsToCertificate()
+
+		if err != nil {
+			return err
+		}
+
+		childCSR, err := convertChildCSRFlagsToCertificateRequest()
+
+		if err != nil {
+			return err
+		}
+
+		certificatePolicies, err := convertPolicyFlagsToCertificatePolicies()
+
+		if err != nil {
+			return err
+		}
+
+		validityOptions, err := convertValidityFlagsToValidityOptions(cmd, 0)
+
+		if err != nil {
+			return err
+		}
+
+		out, err := convertOutFlagsToFile()
+
+		if err != nil {
+			return err
+		}
+
+		return cli.SignIntermediateCA(
+			convertKeyFlagsToKeyOptions(),
+			parentCert,
+			childCSR,
 			convertSubjectFlagsToName(),
-			days,
+			convertTrustCSRFlagsToTrustCSROptions(),
+			validityOptions,
 			intermediateCAPathLen,
-			intermediateCAPermittedDNSDomains,
-			convertOutFlagsToFile(),
+			convertKeyUsageFlagsToKeyUsageOptions(),
+			convertNameConstraintsFlagsToNameConstraints(),
+			certificatePolicies,
+			convertURLFlagsToURLOptions(),
+			out,
 		)
-	},
+	}),
 }
 
 var signLeafCmd = &cobra.Command{
-	Use:   "leaf",
-	Short: "",
-	Long:  ``,
-	Run: func(cmd *cobra.Command, args []string) {
-		cli.SignLeaf(
-			kmsKey,
-			generateComment,
-			convertParentCertFlagsToCertificate(),
-			convertChildCSRFlagsToCertificateRequest(),
+	Use:     "leaf",
+	Short:   "",
+	Long:    ``,
+	PreRunE: requireSubjectFlags,
+	RunE: runE(func(cmd *cobra.Command, args []string) error {
+		parentCert, err := convertParentCertFlagsToCertificate()
+
+		if err != nil {
+			return err
+		}
+
+		childCSR, err := convertChildCSRFlagsToCertificateRequest()
+
+		if err != nil {
+			return err
+		}
+
+		sans, err := convertSANFlagsToSubjectAltNames()
+
+		if err != nil {
+			return err
+		}
+
+		certificatePolicies, err := convertPolicyFlagsToCertificatePolicies()
+
+		if err != nil {
+			return err
+		}
+
+		validityOptions, err := convertValidityFlagsToValidityOptions(cmd, 0)
+
+		if err != nil {
+			return err
+		}
+
+		out, err := convertOutFlagsToFile()
+
+		if err != nil {
+			return err
+		}
+
+		return cli.SignLeaf(
+			convertKeyFlagsToKeyOptions(),
+			parentCert,
+			childCSR,
 			convertSubjectFlagsToName(),
-			days,
-			leafDNSNames,
-			leafIPAddresses,
+			validityOptions,
+			sans,
+			convertTrustCSRFlagsToTrustCSROptions(),
 			leafIsServer,
 			leafIsClient,
-			convertOutFlagsToFile(),
+			convertKeyUsageFlagsToKeyUsageOptions(),
+			certificatePolicies,
+			convertURLFlagsToURLOptions(),
+			out,
 		)
-	},
+	}),
+}
+
+var signCRLCmd = &cobra.Command{
+	Use:   "crl",
+	Short: "",
+	Long:  ``,
+	RunE: runE(func(cmd *cobra.Command, args []string) error {
+		parentCert, err := convertParentCertFlagsToCertificate()
+
+		if err != nil {
+			return err
+		}
+
+		crlOptions, err := convertCRLFlagsToCRLOptions(cmd, time.Now())
+
+		if err != nil {
+			return err
+		}
+
+		revoked, err := convertCRLFlagsToRevokedCertificates(crlOptions.ThisUpdate)
+
+		if err != nil {
+			return err
+		}
+
+		out, err := convertOutFlagsToFile()
+
+		if err != nil {
+			return err
+		}
+
+		return cli.SignCRL(
+			convertKeyFlagsToKeyOptions(),
+			parentCert,
+			revoked,
+			crlOptions,
+			out,
+		)
+	}),
+}
+
+var signOCSPResponderCmd = &cobra.Command{
+	Use:   "ocsp-responder",
+	Short: "",
+	Long:  ``,
+	RunE: runE(func(cmd *cobra.Command, args []string) error {
+		parentCert, err := convertParentCertFlagsToCertificate()
+
+		if err != nil {
+			return err
+		}
+
+		childCSR, err := convertChildCSRFlagsToCertificateRequest()
+
+		if err != nil {
+			return err
+		}
+
+		validityOptions, err := convertValidityFlagsToValidityOptions(cmd, 7*24*time.Hour)
+
+		if err != nil {
+			return err
+		}
+
+		out, err := convertOutFlagsToFile()
+
+		if err != nil {
+			return err
+		}
+
+		return cli.SignOCSPResponder(
+			convertKeyFlagsToKeyOptions(),
+			parentCert,
+			childCSR,
+			convertSubjectFlagsToName(),
+			validityOptions,
+			convertKeyUsageFlagsToKeyUsageOptions(),
+			out,
+		)
+	}),
 }
 
 var (
 	parentCertPath string
 	childCSRPath   string
 
-	intermediateCAPathLen             int
-	intermediateCAPermittedDNSDomains []string
+	intermediateCAPathLen int
 
-	leafDNSNames    []string
-	leafIPAddresses []net.IP
-	leafIsServer    bool
-	leafIsClient    bool
+	leafIsServer bool
+	leafIsClient bool
 )
 
 func init() {
 	addKeyFlags(signIntermediateCACmd)
 	addKeyFlags(signLeafCmd)
+	addKeyFlags(signOCSPResponderCmd)
+	addKeyFlags(signCRLCmd)
 
 	addParentCertFlags(signIntermediateCACmd)
 	addParentCertFlags(signLeafCmd)
+	addParentCertFlags(signOCSPResponderCmd)
+	addParentCertFlags(signCRLCmd)
 
 	addChildCSRFlags(signIntermediateCACmd)
 	addChildCSRFlags(signLeafCmd)
+	addChildCSRFlags(signOCSPResponderCmd)
+
+	addOptionalSubjectFlags(signIntermediateCACmd)
+	addOptionalSubjectFlags(signLeafCmd)
+	addSubjectFlags(signOCSPResponderCmd)
 
-	addSubjectFlags(signIntermediateCACmd)
-	addSubjectFlags(signLeafCmd)
+	addValidityFlags(signIntermediateCACmd, "")
+	addValidityFlags(signLeafCmd, "")
+	addValidityFlags(
+		signOCSPResponderCmd,
+		"7, kept short as responder certificates are not checked for revocation",
+	)
+
+	addClampToParentFlags(signIntermediateCACmd)
+	addClampToParentFlags(signLeafCmd)
+	addClampToParentFlags(signOCSPResponderCmd)
 
-	addDaysFlags(signIntermediateCACmd)
-	addDaysFlags(signLeafCmd)
+	addTrustCSRFlags(signIntermediateCACmd)
+	addTrustCSRFlags(signLeafCmd)
 
 	addOutFlags(signIntermediateCACmd)
 	addOutFlags(signLeafCmd)
+	addOutFlags(signOCSPResponderCmd)
+	addOutFlags(signCRLCmd)
+
+	addIssuanceFlags(signIntermediateCACmd)
+	addIssuanceFlags(signLeafCmd)
+	addIssuanceFlags(signOCSPResponderCmd)
+
+	addCADirFlags(signIntermediateCACmd)
+	addCADirFlags(signLeafCmd)
+	addCADirFlags(signOCSPResponderCmd)
+	addCADirFlags(signCRLCmd)
 
 	// 'sign intermediate-ca' only flags
 	signIntermediateCACmd.Flags().IntVar(
 		&intermediateCAPathLen, "path-len", 0, "number of intermediate CAs allowed under this CA",
 	)
 
-	signIntermediateCACmd.Flags().StringSliceVar(
-		&intermediateCAPermittedDNSDomains,
-		"permitted-dns-domains",
-		[]string{},
-		"permitted DNS names for x509 Name Constraints extension",
-	)
+	addNameConstraintsFlags(signIntermediateCACmd)
+	addURLFlags(signIntermediateCACmd)
+	addChildURLFlags(signIntermediateCACmd)
+	addPolicyFlags(signIntermediateCACmd)
+	addPolicyConstraintFlags(signIntermediateCACmd)
+	addKeyUsageFlags(signIntermediateCACmd, "digitalSignature,keyCertSign,cRLSign")
 
 	// 'sign leaf' only flags
-	signLeafCmd.Flags().StringSliceVar(
-		&leafDNSNames,
-		"dns-names",
-		[]string{},
-		"DNS names for x509 Subject Alternative Names extension",
-	)
-
-	signLeafCmd.Flags().IPSliceVar(
-		&leafIPAddresses,
-		"ip-addresses",
-		[]net.IP{},
-		"IP addresses for x509 Subject Alternative Names extension",
-	)
+	addSANFlags(signLeafCmd)
+	addURLFlags(signLeafCmd)
+	addPolicyFlags(signLeafCmd)
+	addKeyUsageFlags(signLeafCmd, "digitalSignature, and keyEncipherment for RSA keys")
 
 	signLeafCmd.Flags().BoolVar(
 		&leafIsServer,
@@ -129,8 +357,41 @@ func init() {
 		"sign as a client certificate",
 	)
 
+	// 'sign ocsp-responder' only flags
+	addKeyUsageFlags(signOCSPResponderCmd, "digitalSignature")
+
+	// 'sign crl' only flags
+	addCRLFlags(signCRLCmd)
+
+	signCRLCmd.Flags().StringVar(
+		&issuanceDBPath,
+		"issuance-db",
+		"",
+		"database of issued certificates, as written with --issuance-db by 'sign', whose "+
+			"certificates revoked by 'revoke' are added to the CRL",
+	)
+
+	// 'sign --profile' flags
+	addProfileFlags(signCmd)
+	addKeyFlags(signCmd)
+	addParentCertFlags(signCmd)
+	addChildCSRFlags(signCmd)
+	addSubjectFlags(signCmd)
+	addOutFlags(signCmd)
+	addIssuanceFlags(signCmd)
+	addCADirFlags(signCmd)
+
+	addValidityFlags(signCmd, "from the profile")
+	addClampToParentFlags(signCmd)
+
+	addSANFlags(signCmd)
+	addURLFlags(signCmd)
+	addChildURLFlags(signCmd)
+
 	signCmd.AddCommand(signIntermediateCACmd)
 	signCmd.AddCommand(signLeafCmd)
+	signCmd.AddCommand(signOCSPResponderCmd)
+	signCmd.AddCommand(signCRLCmd)
 }
 
 func addParentCertFlags(cmd *cobra.Command) {
@@ -138,26 +399,31 @@ func addParentCertFlags(cmd *cobra.Command) {
 	cmd.MarkFlagRequired("parent-cert")
 }
 
-func convertParentCertFlagsToCertificate() *x509.Certificate {
-	parentCertBytes, err := ioutil.ReadFile(parentCertPath)
+func convertParentCertFlagsToCertificate() (*x509.Certificate, error) {
+	return readCertificate(parentCertPath, "parent certificate")
+}
+
+// readCertificate reads the PEM-formatted certificate at path, described as name in errors.
+func readCertificate(path, name string) (*x509.Certificate, error) {
+	certBytes, err := ioutil.ReadFile(path)
 
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: Could not read %s: %v", cli.ErrInvalidInput, name, err)
 	}
 
-	parentCertBlock, _ := pem.Decode(parentCertBytes)
+	certBlock, _ := pem.Decode(certBytes)
 
-	if parentCertBlock == nil || parentCertBlock.Type != "CERTIFICATE" {
-		panic("Failed to decode PEM-formatted parent certificate")
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%w: Failed to decode PEM-formatted %s", cli.ErrInvalidInput, name)
 	}
 
-	parentCert, err := x509.ParseCertificate(parentCertBlock.Bytes)
+	cert, err := kmssign.ParseCertificate(certBlock.Bytes)
 
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: Could not parse %s: %v", cli.ErrInvalidInput, name, err)
 	}
 
-	return parentCert
+	return cert, nil
 }
 
 func addChildCSRFlags(cmd *cobra.Command) {
@@ -165,24 +431,27 @@ func addChildCSRFlags(cmd *cobra.Command) {
 	cmd.MarkFlagRequired("child-csr")
 }
 
-func convertChildCSRFlagsToCertificateRequest() *x509.CertificateRequest {
+func convertChildCSRFlagsToCertificateRequest() (*x509.CertificateRequest, error) {
 	childCSRBytes, err := ioutil.ReadFile(childCSRPath)
 
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: Could not read child CSR: %v", cli.ErrInvalidInput, err)
 	}
 
 	childCSRBlock, _ := pem.Decode(childCSRBytes)
 
 	if childCSRBlock == nil || childCSRBlock.Type != "CERTIFICATE REQUEST" {
-		panic("Failed to decode PEM-formatted child certificate request")
+		return nil, fmt.Errorf(
+			"%w: Failed to decode PEM-formatted child certificate request",
+			cli.ErrInvalidInput,
+		)
 	}
 
-	childCSR, err := x509.ParseCertificateRequest(childCSRBlock.Bytes)
+	childCSR, err := kmssign.ParseCertificateRequest(childCSRBlock.Bytes)
 
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: Could not parse child CSR: %v", cli.ErrInvalidInput, err)
 	}
 
-	return childCSR
+	return childCSR, nil
 }
@@ -20,6 +20,12 @@ var (
 )
 
 func addSubjectFlags(cmd *cobra.Command) {
+	addOptionalSubjectFlags(cmd)
+	cmd.MarkFlagRequired("common-name")
+}
+
+// addOptionalSubjectFlags adds the subject flags to commands that can take the subject from a CSR.
+func addOptionalSubjectFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(
 		&commonName, "common-name", "", "x509 Distinguished Name (DN) field",
 	)
@@ -47,8 +53,6 @@ func addSubjectFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(
 		&emailAddress, "emailAddress", "", "x509 Distinguished Name (DN) field",
 	)
-
-	cmd.MarkFlagRequired("common-name")
 }
 
 func convertSubjectFlagsToName() pkix.Name {
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/ericnorris/google-kms-x509/internal/profile"
+	"github.com/spf13/cobra"
+)
+
+var (
+	trustCSR bool
+
+	csrAllowedDNSNames       []string
+	csrAllowedIPRanges       []string
+	csrAllowedEmailAddresses []string
+	csrAllowedURIs           []string
+	csrAllowedExtensions     []string
+)
+
+func addTrustCSRFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(
+		&trustCSR,
+		"trust-csr",
+		false,
+		"copy the subject, subject alternative names and --csr-allowed-extensions of the child "+
+			"CSR, after checking its names against the --csr-allowed-* patterns; DN and SAN flags "+
+			"are merged on top",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&csrAllowedDNSNames,
+		"csr-allowed-dns-names",
+		[]string{},
+		"patterns of the DNS names --trust-csr accepts, e.g. *.example.com",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&csrAllowedIPRanges,
+		"csr-allowed-ip-ranges",
+		[]string{},
+		"CIDR ranges of the IP addresses --trust-csr accepts, e.g. 10.0.0.0/8",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&csrAllowedEmailAddresses,
+		"csr-allowed-email-addresses",
+		[]string{},
+		"patterns of the email addresses --trust-csr accepts, e.g. *@example.com",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&csrAllowedURIs,
+		"csr-allowed-uris",
+		[]string{},
+		"patterns of the URIs --trust-csr accepts, e.g. spiffe://example.com/*",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&csrAllowedExtensions,
+		"csr-allowed-extensions",
+		[]string{},
+		"OIDs of the CSR extensions --trust-csr copies into the certificate",
+	)
+}
+
+// requireSubjectFlags is the PreRunE of commands with addOptionalSubjectFlags and
+// addTrustCSRFlags, which need a common name unless the subject is taken from the CSR.
+func requireSubjectFlags(cmd *cobra.Command, args []string) error {
+	if !trustCSR && !cmd.Flags().Changed("common-name") {
+		return errors.New(`required flag(s) "common-name" not set, or --trust-csr`)
+	}
+
+	return requireValidityFlags(cmd, args)
+}
+
+func convertTrustCSRFlagsToTrustCSROptions() cli.TrustCSROptions {
+	return cli.TrustCSROptions{
+		Enabled: trustCSR,
+		AllowedSANs: profile.AllowedSANs{
+			DNS:   csrAllowedDNSNames,
+			IP:    csrAllowedIPRanges,
+			Email: csrAllowedEmailAddresses,
+			URI:   csrAllowedURIs,
+		},
+		AllowedExtensions: csrAllowedExtensions,
+	}
+}
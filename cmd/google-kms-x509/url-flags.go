@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ocspServers            []string
+	issuingCertificateURLs []string
+	crlDistributionPoints  []string
+
+	issuerDefaultsPath string
+
+	childOCSPServers            []string
+	childIssuingCertificateURLs []string
+	childCRLDistributionPoints  []string
+)
+
+func addURLFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(
+		&ocspServers,
+		"ocsp-servers",
+		[]string{},
+		"OCSP responder URLs for x509 Authority Information Access extension",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&issuingCertificateURLs,
+		"issuing-certificate-urls",
+		[]string{},
+		"URLs of the parent certificate (caIssuers) for x509 Authority Information Access extension",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&crlDistributionPoints,
+		"crl-distribution-points",
+		[]string{},
+		"CRL URLs for x509 CRL Distribution Points extension",
+	)
+
+	cmd.Flags().StringVar(
+		&issuerDefaultsPath,
+		"issuer-defaults",
+		"",
+		"JSON file of the URLs each CA's certificates get when the flags above are not given, "+
+			"as recorded by the --child-* flags of 'generate root-ca' and 'sign intermediate-ca'",
+	)
+}
+
+// addChildURLFlags adds the flags recording the defaults of a CA in --issuer-defaults.
+func addChildURLFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(
+		&childOCSPServers,
+		"child-ocsp-servers",
+		[]string{},
+		"record these OCSP responder URLs in --issuer-defaults for the certificates this CA issues",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&childIssuingCertificateURLs,
+		"child-issuing-certificate-urls",
+		[]string{},
+		"record these URLs of this CA's certificate in --issuer-defaults for the certificates it "+
+			"issues",
+	)
+
+	cmd.Flags().StringSliceVar(
+		&childCRLDistributionPoints,
+		"child-crl-distribution-points",
+		[]string{},
+		"record these CRL URLs in --issuer-defaults for the certificates this CA issues",
+	)
+}
+
+func convertURLFlagsToURLOptions() cli.URLOptions {
+	return cli.URLOptions{
+		URLs: cli.IssuerURLs{
+			OCSPServers:            ocspServers,
+			IssuingCertificateURLs: issuingCertificateURLs,
+			CRLDistributionPoints:  crlDistributionPoints,
+		},
+		IssuerDefaults: issuerDefaultsPath,
+		ChildURLs: cli.IssuerURLs{
+			OCSPServers:            childOCSPServers,
+			IssuingCertificateURLs: childIssuingCertificateURLs,
+			CRLDistributionPoints:  childCRLDistributionPoints,
+		},
+	}
+}
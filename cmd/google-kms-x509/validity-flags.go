@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+var (
+	days          int
+	validity      time.Duration
+	notBefore     string
+	notAfter      string
+	backdate      time.Duration
+	clampToParent bool
+)
+
+// addValidityFlags adds the flags choosing the validity period. defaultDays describes the validity
+// used without --days, --validity or --not-after; empty requires one of them.
+func addValidityFlags(cmd *cobra.Command, defaultDays string) {
+	daysUsage := "days until expiration"
+
+	if defaultDays != "" {
+		daysUsage += " (default " + defaultDays + ")"
+	}
+
+	cmd.Flags().IntVar(&days, "days", 0, daysUsage)
+
+	cmd.Flags().DurationVar(
+		&validity,
+		"validity",
+		0,
+		"validity period as a duration such as 15m or 72h, instead of --days",
+	)
+
+	cmd.Flags().StringVar(
+		&notBefore,
+		"not-before",
+		"",
+		"start of the validity period in RFC 3339 format (default now)",
+	)
+
+	cmd.Flags().StringVar(
+		&notAfter,
+		"not-after",
+		"",
+		"end of the validity period in RFC 3339 format, instead of --days",
+	)
+
+	cmd.Flags().DurationVar(
+		&backdate,
+		"backdate",
+		0,
+		"start the validity period this long before now, e.g. 5m, for clients with slow clocks",
+	)
+}
+
+// addClampToParentFlags adds --clamp-to-parent to commands signing with a parent certificate.
+func addClampToParentFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(
+		&clampToParent,
+		"clamp-to-parent",
+		false,
+		"end the validity period with the parent certificate's if it would end after it, "+
+			"instead of refusing to sign",
+	)
+}
+
+// requireValidityFlags is the PreRunE of commands without a default validity, which fail like a
+// missing required flag without one.
+func requireValidityFlags(cmd *cobra.Command, args []string) error {
+	for _, name := range []string{"days", "validity", "not-after"} {
+		if cmd.Flags().Changed(name) {
+			return nil
+		}
+	}
+
+	return errors.New(`required flag(s) "days", "validity" or "not-after" not set`)
+}
+
+// convertValidityFlagsToValidityOptions returns the validity options of cmd, with defaultLifetime
+// if no validity period is chosen.
+func convertValidityFlagsToValidityOptions(
+	cmd *cobra.Command,
+	defaultLifetime time.Duration,
+) (cli.ValidityOptions, error) {
+	options := cli.ValidityOptions{
+		Backdate:      backdate,
+		ClampToParent: clampToParent,
+	}
+
+	lengths := 0
+
+	for _, name := range []string{"days", "validity", "not-after"} {
+		if cmd.Flags().Changed(name) {
+			lengths++
+		}
+	}
+
+	if lengths > 1 {
+		return cli.ValidityOptions{}, fmt.Errorf(
+			"%w: Only one of --days, --validity or --not-after can be used",
+			cli.ErrInvalidInput,
+		)
+	}
+
+	switch {
+	case cmd.Flags().Changed("days"):
+		if days <= 0 {
+			return cli.ValidityOptions{}, fmt.Errorf(
+				"%w: --days must be at least 1",
+				cli.ErrInvalidInput,
+			)
+		}
+
+		options.Lifetime = time.Duration(days) * 24 * time.Hour
+
+	case cmd.Flags().Changed("validity"):
+		if validity <= 0 {
+			return cli.ValidityOptions{}, fmt.Errorf(
+				"%w: --validity must be positive",
+				cli.ErrInvalidInput,
+			)
+		}
+
+		options.Lifetime = validity
+
+	case lengths == 0:
+		options.Lifetime = defaultLifetime
+	}
+
+	var err error
+
+	if notBefore != "" {
+		if options.NotBefore, err = time.Parse(time.RFC3339, notBefore); err != nil {
+			return cli.ValidityOptions{}, fmt.Errorf(
+				"%w: Invalid --not-before: %v",
+				cli.ErrInvalidInput,
+				err,
+			)
+		}
+	}
+
+	if notAfter != "" {
+		if options.NotAfter, err = time.Parse(time.RFC3339, notAfter); err != nil {
+			return cli.ValidityOptions{}, fmt.Errorf(
+				"%w: Invalid --not-after: %v",
+				cli.ErrInvalidInput,
+				err,
+			)
+		}
+	}
+
+	return options, nil
+}
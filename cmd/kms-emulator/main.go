@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/ericnorris/google-kms-x509/kmssign/kmsfake"
+	"github.com/spf13/cobra"
+)
+
+var (
+	listenAddress string
+	keySpecs      []string
+)
+
+var mainCmd = &cobra.Command{
+	Use:   "kms-emulator",
+	Short: "in-memory Cloud KMS emulator for testing google-kms-x509",
+	Long: `Serves the subset of the Cloud KMS gRPC API used by google-kms-x509, backed by
+software keys that only live as long as the process. Point google-kms-x509 at it with
+'--kms-endpoint <address> --kms-insecure'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		client := kmsfake.NewKeyManagementClient()
+
+		for _, keySpec := range keySpecs {
+			cryptoKeyName, algorithmName := splitKeySpec(keySpec)
+			algorithm, ok := kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm_value[algorithmName]
+
+			if !ok {
+				panic(fmt.Sprintf("Unknown algorithm %q in --key %s", algorithmName, keySpec))
+			}
+
+			version, err := client.AddSigningKey(
+				context.Background(),
+				cryptoKeyName,
+				kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm(algorithm),
+			)
+
+			if err != nil {
+				panic(err)
+			}
+
+			fmt.Println(version.Name)
+		}
+
+		listener, err := net.Listen("tcp", listenAddress)
+
+		if err != nil {
+			panic(err)
+		}
+
+		grpcServer := kmsfake.NewServer(client).Serve(listener)
+
+		fmt.Fprintf(os.Stderr, "listening on %s\n", listener.Addr())
+
+		interrupt := make(chan os.Signal, 1)
+		signal.Notify(interrupt, os.Interrupt)
+		<-interrupt
+
+		grpcServer.GracefulStop()
+	},
+}
+
+func main() {
+	mainCmd.Flags().StringVar(
+		&listenAddress, "listen", "127.0.0.1:9090", "address to serve the KMS gRPC API on",
+	)
+
+	mainCmd.Flags().StringArrayVar(
+		&keySpecs,
+		"key",
+		[]string{},
+		"key to create on startup, as <CryptoKey resource ID>=<algorithm>, e.g. "+
+			"projects/p/locations/global/keyRings/r/cryptoKeys/k=EC_SIGN_P256_SHA256",
+	)
+
+	mainCmd.Execute()
+}
+
+func splitKeySpec(keySpec string) (string, string) {
+	i := strings.LastIndex(keySpec, "=")
+
+	if i < 0 {
+		return keySpec, ""
+	}
+
+	return keySpec[:i], keySpec[i+1:]
+}
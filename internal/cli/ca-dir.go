@@ -0,0 +1,749 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/internal/ocspresponder"
+	"github.com/ericnorris/google-kms-x509/kmssign"
+)
+
+// caDir is a CA directory in the layout used by 'openssl ca': index.txt lists the certificates
+// issued, serial and crlnumber hold the next serial and CRL numbers in hex, and newcerts/ has a
+// copy of every certificate issued, named by serial number. Each update takes a lock on the
+// directory, and replaces files atomically after keeping the previous version as <file>.old, as
+// OpenSSL does.
+type caDir struct {
+	path string
+}
+
+var _ kmssign.IssuanceStore = (*caDir)(nil)
+
+// openSSLRevocationReasons are the CRLReason names used in index.txt. OpenSSL cannot read the
+// other reasons.
+var openSSLRevocationReasons = map[int]string{
+	0: "unspecified",
+	1: "keyCompromise",
+	2: "CACompromise",
+	3: "affiliationChanged",
+	4: "superseded",
+	5: "cessationOfOperation",
+	6: "certificateHold",
+	8: "removeFromCRL",
+}
+
+// openSSLKeyTimeReasons are the reasons written in index.txt for key compromises with an
+// invalidity date, which follows the reason.
+var openSSLKeyTimeReasons = map[int]string{
+	1: "keyTime",
+	2: "CAkeyTime",
+}
+
+// indexEntry is a line of index.txt.
+type indexEntry struct {
+	// Status is 'V' for valid, 'R' for revoked or 'E' for expired certificates.
+	Status    byte
+	ExpiresAt time.Time
+
+	// RevokedAt, RevocationReason and InvalidityDate are only set for revoked certificates.
+	// RevocationReason is -1 for entries without a reason.
+	RevokedAt        time.Time
+	RevocationReason int
+	InvalidityDate   time.Time
+
+	SerialNumber *big.Int
+	Filename     string
+	Subject      string
+}
+
+func openCADir(path string) (*caDir, error) {
+	for _, name := range []string{"index.txt", "serial"} {
+		if _, err := os.Stat(filepath.Join(path, name)); err != nil {
+			return nil, fmt.Errorf("%w: %s is not a CA directory: %v", ErrInvalidInput, path, err)
+		}
+	}
+
+	for _, name := range []string{"certs", "newcerts"} {
+		if err := os.MkdirAll(filepath.Join(path, name), 0755); err != nil {
+			return nil, fmt.Errorf("Could not create %s: %w", name, err)
+		}
+	}
+
+	return &caDir{path: path}, nil
+}
+
+func (dir *caDir) file(name string) string {
+	return filepath.Join(dir.path, name)
+}
+
+// lock locks the directory against other processes until unlock is called.
+func (dir *caDir) lock() (unlock func(), err error) {
+	return lockFile(dir.file("index.txt.lock"))
+}
+
+// replaceFile atomically replaces the file name with data, after copying its current contents to
+// name.old.
+func (dir *caDir) replaceFile(name string, data []byte) error {
+	current, err := os.ReadFile(dir.file(name))
+
+	if err == nil {
+		err = writeFileAtomically(dir.file(name+".old"), current)
+	} else if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+	}
+
+	if err == nil {
+		err = writeFileAtomically(dir.file(name), data)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Could not update %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// readNumber reads a hex number file, returning nil if it does not exist.
+func (dir *caDir) readNumber(name string) (*big.Int, error) {
+	data, err := os.ReadFile(dir.file(name))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read %s: %w", name, err)
+	}
+
+	number, ok := new(big.Int).SetString(strings.TrimSpace(string(data)), 16)
+
+	if !ok || number.Sign() < 0 {
+		return nil, fmt.Errorf("%w: %s does not contain a hex number", ErrInvalidInput, name)
+	}
+
+	return number, nil
+}
+
+func (dir *caDir) writeNumber(name string, number *big.Int) error {
+	return dir.replaceFile(name, []byte(formatOpenSSLHex(number)+"\n"))
+}
+
+// formatOpenSSLHex formats number as OpenSSL does in index.txt, serial and crlnumber: upper case
+// hex with an even number of digits.
+func formatOpenSSLHex(number *big.Int) string {
+	hex := fmt.Sprintf("%X", number)
+
+	if len(hex)%2 == 1 {
+		hex = "0" + hex
+	}
+
+	return hex
+}
+
+// nextSerialNumber returns the serial number in the serial file, for
+// kmssign.WithSerialNumberGenerator. The file is only updated once the certificate is recorded.
+func (dir *caDir) nextSerialNumber() (*big.Int, error) {
+	unlock, err := dir.lock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	serialNumber, err := dir.readNumber("serial")
+
+	if err == nil && serialNumber == nil {
+		err = fmt.Errorf("%w: The CA directory has no serial file", ErrInvalidInput)
+	}
+
+	return serialNumber, err
+}
+
+// CheckCertificate refuses a certificate for template before it is signed if index.txt already
+// has a valid certificate with the same subject, unless unique_subject is disabled.
+func (dir *caDir) CheckCertificate(ctx context.Context, template, _ *x509.Certificate) error {
+	uniqueSubject, err := dir.uniqueSubject()
+
+	if err != nil || !uniqueSubject {
+		return err
+	}
+
+	var subject pkix.Name
+	rdnSequence := template.Subject.ToRDNSequence()
+
+	if len(template.RawSubject) > 0 {
+		rdnSequence = nil
+
+		if _, err := asn1.Unmarshal(template.RawSubject, &rdnSequence); err != nil {
+			return fmt.Errorf("Could not parse the certificate subject: %w", err)
+		}
+	}
+
+	subject.FillFromRDNSequence(&rdnSequence)
+
+	unlock, err := dir.lock()
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	entries, err := dir.readIndex()
+
+	if err != nil {
+		return err
+	}
+
+	return checkUniqueSubject(entries, formatOpenSSLName(subject))
+}
+
+// checkUniqueSubject returns an error if entries has a valid certificate for subject.
+func checkUniqueSubject(entries []*indexEntry, subject string) error {
+	for _, entry := range entries {
+		if entry.Status == 'V' && entry.Subject == subject {
+			return fmt.Errorf(
+				"%w: index.txt already has a valid certificate for %s, with serial number %s; "+
+					"revoke it, or set unique_subject = no in index.txt.attr",
+				ErrInvalidInput,
+				subject,
+				formatOpenSSLHex(entry.SerialNumber),
+			)
+		}
+	}
+
+	return nil
+}
+
+// RecordCertificate adds an issued certificate to index.txt and newcerts/, and moves the serial
+// file past its serial number.
+func (dir *caDir) RecordCertificate(ctx context.Context, issued *kmssign.IssuedCertificate) error {
+	certificate := issued.Certificate
+
+	unlock, err := dir.lock()
+
+	if err != nil {
+		return err
+	}
+
+	defer unlock()
+
+	entries, err := dir.readIndex()
+
+	if err != nil {
+		return err
+	}
+
+	subject := formatOpenSSLName(certificate.Subject)
+	uniqueSubject, err := dir.uniqueSubject()
+
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.SerialNumber.Cmp(certificate.SerialNumber) == 0 {
+			if err := dir.advanceSerialNumber(certificate.SerialNumber); err != nil {
+				return err
+			}
+
+			return fmt.Errorf(
+				"%w: %s is already in index.txt",
+				kmssign.ErrSerialNumberCollision,
+				formatOpenSSLHex(certificate.SerialNumber),
+			)
+		}
+
+	}
+
+	// checked again, in case another process recorded the subject since CheckCertificate.
+	if uniqueSubject {
+		if err := checkUniqueSubject(entries, subject); err != nil {
+			return err
+		}
+	}
+
+	serialHex := formatOpenSSLHex(certificate.SerialNumber)
+	pemCertificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate.Raw})
+
+	err = writeFileAtomically(dir.file(filepath.Join("newcerts", serialHex+".pem")), pemCertificate)
+
+	if err != nil {
+		return fmt.Errorf("Could not write certificate to newcerts: %w", err)
+	}
+
+	entries = append(entries, &indexEntry{
+		Status:           'V',
+		ExpiresAt:        certificate.NotAfter,
+		RevocationReason: -1,
+		SerialNumber:     certificate.SerialNumber,
+		Filename:         "unknown",
+		Subject:          subject,
+	})
+
+	if err := dir.writeIndex(entries); err != nil {
+		return err
+	}
+
+	return dir.advanceSerialNumber(certificate.SerialNumber)
+}
+
+// advanceSerialNumber makes sure the serial file is past serialNumber.
+func (dir *caDir) advanceSerialNumber(serialNumber *big.Int) error {
+	next, err := dir.readNumber("serial")
+
+	if err != nil {
+		return err
+	}
+
+	if next != nil && next.Cmp(serialNumber) > 0 {
+		return nil
+	}
+
+	return dir.writeNumber("serial", new(big.Int).Add(serialNumber, big.NewInt(1)))
+}
+
+// uniqueSubject returns the unique_subject setting of index.txt.attr, which OpenSSL defaults to
+// yes.
+func (dir *caDir) uniqueSubject() (bool, error) {
+	data, err := os.ReadFile(dir.file("index.txt.attr"))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return true, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Could not read index.txt.attr: %w", err)
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		name, value, found := strings.Cut(line, "=")
+
+		if found && strings.TrimSpace(name) == "unique_subject" {
+			switch strings.ToLower(strings.TrimSpace(value)) {
+			case "no", "n", "false", "f", "off":
+				return false, nil
+			}
+		}
+	}
+
+	return true, nil
+}
+
+// certificate reads the copy of the certificate with serialNumber in newcerts/, which may have a
+// secp256k1 key, returning nil if there is none.
+func (dir *caDir) certificate(serialNumber *big.Int) (*x509.Certificate, error) {
+	name := filepath.Join("newcerts", formatOpenSSLHex(serialNumber)+".pem")
+	data, err := os.ReadFile(dir.file(name))
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read %s: %w", name, err)
+	}
+
+	block, _ := pem.Decode(data)
+
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("%w: %s is not a PEM certificate", ErrInvalidInput, name)
+	}
+
+	return kmssign.ParseCertificate(block.Bytes)
+}
+
+// revoke marks the certificate with serialNumber as revoked in index.txt. OpenSSL only records
+// the invalidity date, if not zero, of key compromises.
+func (dir *caDir) revoke(
+	serialNumber *big.Int,
+	revokedAt time.Time,
+	reason int,
+	invalidityDate time.Time,
+) (*indexEntry, error) {
+	if _, ok := openSSLRevocationReasons[reason]; !ok {
+		return nil, fmt.Errorf(
+			"%w: OpenSSL does not support revocation reason %d in index.txt",
+			ErrInvalidInput,
+			reason,
+		)
+	}
+
+	if _, ok := openSSLKeyTimeReasons[reason]; !ok && !invalidityDate.IsZero() {
+		return nil, fmt.Errorf(
+			"%w: OpenSSL only records invalidity dates for keyCompromise and cACompromise",
+			ErrInvalidInput,
+		)
+	}
+
+	unlock, err := dir.lock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	entries, err := dir.readIndex()
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if entry.SerialNumber.Cmp(serialNumber) != 0 {
+			continue
+		}
+
+		if entry.Status == 'R' {
+			return nil, fmt.Errorf(
+				"%w: %s is already revoked",
+				ErrInvalidInput,
+				formatOpenSSLHex(serialNumber),
+			)
+		}
+
+		entry.Status = 'R'
+		entry.RevokedAt = revokedAt
+		entry.RevocationReason = reason
+		entry.InvalidityDate = invalidityDate
+
+		return entry, dir.writeIndex(entries)
+	}
+
+	return nil, fmt.Errorf(
+		"%w: %s is not in index.txt",
+		ErrInvalidInput,
+		formatOpenSSLHex(serialNumber),
+	)
+}
+
+// CertificateStatuses returns the status of the certificates in index.txt, for an OCSP responder.
+// The directory only holds the certificates of a single issuer.
+func (dir *caDir) CertificateStatuses(
+	*x509.Certificate,
+) (map[string]ocspresponder.CertificateStatus, error) {
+	unlock, err := dir.lock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	entries, err := dir.readIndex()
+
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[string]ocspresponder.CertificateStatus, len(entries))
+
+	for _, entry := range entries {
+		status := ocspresponder.CertificateStatus{Status: kmssign.OCSPGood}
+
+		if entry.Status == 'R' {
+			status = ocspresponder.CertificateStatus{
+				Status:    kmssign.OCSPRevoked,
+				RevokedAt: entry.RevokedAt,
+			}
+
+			if entry.RevocationReason > 0 {
+				status.RevocationReason = entry.RevocationReason
+			}
+		}
+
+		statuses[entry.SerialNumber.String()] = status
+	}
+
+	return statuses, nil
+}
+
+// revokedCertificates returns the revoked certificates in index.txt, for a CRL.
+func (dir *caDir) revokedCertificates() ([]x509.RevocationListEntry, error) {
+	unlock, err := dir.lock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	entries, err := dir.readIndex()
+
+	if err != nil {
+		return nil, err
+	}
+
+	var revoked []x509.RevocationListEntry
+
+	for _, entry := range entries {
+		if entry.Status != 'R' {
+			continue
+		}
+
+		revokedCertificate := x509.RevocationListEntry{
+			SerialNumber:   entry.SerialNumber,
+			RevocationTime: entry.RevokedAt,
+		}
+
+		if entry.RevocationReason > 0 {
+			revokedCertificate.ReasonCode = entry.RevocationReason
+		}
+
+		if !entry.InvalidityDate.IsZero() {
+			invalidityDateExt, err := kmssign.InvalidityDateExtension(entry.InvalidityDate)
+
+			if err != nil {
+				return nil, err
+			}
+
+			revokedCertificate.ExtraExtensions = []pkix.Extension{invalidityDateExt}
+		}
+
+		revoked = append(revoked, revokedCertificate)
+	}
+
+	return revoked, nil
+}
+
+// allocateCRLNumber returns the number in the crlnumber file, or nil if there is none, and
+// increments it.
+func (dir *caDir) allocateCRLNumber() (*big.Int, error) {
+	unlock, err := dir.lock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer unlock()
+
+	number, err := dir.readNumber("crlnumber")
+
+	if err != nil || number == nil {
+		return nil, err
+	}
+
+	if err := dir.writeNumber("crlnumber", new(big.Int).Add(number, big.NewInt(1))); err != nil {
+		return nil, err
+	}
+
+	return number, nil
+}
+
+func (dir *caDir) readIndex() ([]*indexEntry, error) {
+	data, err := os.ReadFile(dir.file("index.txt"))
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not read index.txt: %w", err)
+	}
+
+	var entries []*indexEntry
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+
+	for line := 1; scanner.Scan(); line++ {
+		if scanner.Text() == "" {
+			continue
+		}
+
+		entry, err := parseIndexEntry(scanner.Text())
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: index.txt line %d: %v", ErrInvalidInput, line, err)
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, scanner.Err()
+}
+
+func (dir *caDir) writeIndex(entries []*indexEntry) error {
+	var index strings.Builder
+
+	for _, entry := range entries {
+		index.WriteString(entry.String() + "\n")
+	}
+
+	return dir.replaceFile("index.txt", []byte(index.String()))
+}
+
+func parseIndexEntry(line string) (*indexEntry, error) {
+	fields := strings.Split(line, "\t")
+
+	if len(fields) != 6 || len(fields[0]) != 1 {
+		return nil, fmt.Errorf("Expected 6 tab-separated fields")
+	}
+
+	entry := &indexEntry{
+		Status:           fields[0][0],
+		RevocationReason: -1,
+		Filename:         fields[4],
+		Subject:          fields[5],
+	}
+
+	var err error
+
+	if entry.ExpiresAt, err = parseOpenSSLTime(fields[1]); err != nil {
+		return nil, err
+	}
+
+	var ok bool
+
+	if entry.SerialNumber, ok = new(big.Int).SetString(fields[3], 16); !ok {
+		return nil, fmt.Errorf("Invalid serial number %q", fields[3])
+	}
+
+	switch entry.Status {
+	case 'V', 'E':
+		return entry, nil
+
+	case 'R':
+		return entry, entry.parseRevocation(fields[2])
+
+	default:
+		return nil, fmt.Errorf("Unknown status %q", entry.Status)
+	}
+}
+
+// parseRevocation parses the revocation field of index.txt: the revocation time, optionally
+// followed by a reason. The keyTime and CAkeyTime reasons are followed by the invalidity date of
+// a key compromise, and holdInstruction by the hold instruction.
+func (entry *indexEntry) parseRevocation(field string) error {
+	parts := strings.Split(field, ",")
+
+	var err error
+
+	if entry.RevokedAt, err = parseOpenSSLTime(parts[0]); err != nil {
+		return err
+	}
+
+	if len(parts) == 1 {
+		return nil
+	}
+
+	switch reason := parts[1]; reason {
+	case "keyTime", "CAkeyTime":
+		if len(parts) != 3 {
+			return fmt.Errorf("Revocation reason %s requires a time", reason)
+		}
+
+		if entry.InvalidityDate, err = parseOpenSSLTime(parts[2]); err != nil {
+			return err
+		}
+
+		entry.RevocationReason = kmssign.RevocationReasons["keyCompromise"]
+
+		if reason == "CAkeyTime" {
+			entry.RevocationReason = kmssign.RevocationReasons["cACompromise"]
+		}
+
+	case "holdInstruction":
+		entry.RevocationReason = kmssign.RevocationReasons["certificateHold"]
+
+	default:
+		if entry.RevocationReason, err = kmssign.ParseRevocationReason(reason); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (entry *indexEntry) String() string {
+	revocation := ""
+
+	if entry.Status == 'R' {
+		revocation = formatOpenSSLTime(entry.RevokedAt)
+
+		keyTime, isKeyTime := openSSLKeyTimeReasons[entry.RevocationReason]
+
+		if isKeyTime && !entry.InvalidityDate.IsZero() {
+			revocation += "," + keyTime + "," + entry.InvalidityDate.UTC().Format("20060102150405Z")
+		} else if entry.RevocationReason >= 0 {
+			revocation += "," + openSSLRevocationReasons[entry.RevocationReason]
+		}
+	}
+
+	return strings.Join([]string{
+		string(entry.Status),
+		formatOpenSSLTime(entry.ExpiresAt),
+		revocation,
+		formatOpenSSLHex(entry.SerialNumber),
+		entry.Filename,
+		entry.Subject,
+	}, "\t")
+}
+
+// parseOpenSSLTime parses an ASN.1 UTCTime or GeneralizedTime in the form used by index.txt.
+func parseOpenSSLTime(value string) (time.Time, error) {
+	switch len(value) {
+	case len("060102150405Z"):
+		century := "20"
+
+		if value[:2] >= "50" {
+			century = "19"
+		}
+
+		value = century + value
+
+	case len("20060102150405Z"):
+
+	default:
+		return time.Time{}, fmt.Errorf("Invalid time %q", value)
+	}
+
+	return time.Parse("20060102150405Z", value)
+}
+
+// formatOpenSSLTime formats a certificate or revocation time as an ASN.1 UTCTime, or a
+// GeneralizedTime from 2050 on, as in RFC 5280.
+func formatOpenSSLTime(t time.Time) string {
+	if t.UTC().Year() >= 2050 {
+		return t.UTC().Format("20060102150405Z")
+	}
+
+	return t.UTC().Format("060102150405Z")
+}
+
+var openSSLAttributeNames = map[string]string{
+	"2.5.4.3":                    "CN",
+	"2.5.4.5":                    "serialNumber",
+	"2.5.4.6":                    "C",
+	"2.5.4.7":                    "L",
+	"2.5.4.8":                    "ST",
+	"2.5.4.9":                    "street",
+	"2.5.4.10":                   "O",
+	"2.5.4.11":                   "OU",
+	"2.5.4.17":                   "postalCode",
+	"0.9.2342.19200300.100.1.1":  "UID",
+	"0.9.2342.19200300.100.1.25": "DC",
+	"1.2.840.113549.1.9.1":       "emailAddress",
+}
+
+// formatOpenSSLName formats a distinguished name as in index.txt, e.g. "/C=US/O=Example/CN=leaf",
+// with the attributes in the order they are encoded in the certificate.
+func formatOpenSSLName(name pkix.Name) string {
+	var oneline strings.Builder
+
+	for _, attribute := range name.Names {
+		attributeName, ok := openSSLAttributeNames[attribute.Type.String()]
+
+		if !ok {
+			attributeName = attribute.Type.String()
+		}
+
+		fmt.Fprintf(&oneline, "/%s=%v", attributeName, attribute.Value)
+	}
+
+	return oneline.String()
+}
@@ -0,0 +1,114 @@
+package cli
+
+import (
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math/big"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// crlState records the CRLs issued for each issuer certificate and KMS key, so that CRL numbers
+// keep increasing across runs and delta CRLs can refer to the last complete CRL.
+type crlState struct {
+	Issuers map[string]*issuerCRLState `json:"issuers"`
+}
+
+type issuerCRLState struct {
+	// CRLNumber is the number of the last CRL issued, complete or delta.
+	CRLNumber *big.Int `json:"crlNumber"`
+
+	// BaseCRLNumber is the number of the last complete CRL issued, and BaseRevocationsReadAt is
+	// when the revocations it lists were read from the issuance database.
+	BaseCRLNumber         *big.Int   `json:"baseCRLNumber,omitempty"`
+	BaseRevocationsReadAt *time.Time `json:"baseRevocationsReadAt,omitempty"`
+}
+
+func loadCRLState(path string) (*crlState, error) {
+	state := &crlState{Issuers: map[string]*issuerCRLState{}}
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return state, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read CRL state: %w", err)
+	}
+
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("%w: Could not parse CRL state %s: %v", ErrInvalidInput, path, err)
+	}
+
+	if state.Issuers == nil {
+		state.Issuers = map[string]*issuerCRLState{}
+	}
+
+	return state, nil
+}
+
+func (state *crlState) save(path string) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomically(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("Could not write CRL state: %w", err)
+	}
+
+	return nil
+}
+
+// writeFileAtomically replaces the file at path with data, so that readers never see it partially
+// written. The file keeps its mode, or gets mode 0644 if it is new.
+func writeFileAtomically(path string, data []byte) error {
+	mode := fs.FileMode(0644)
+
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(temp.Name())
+
+	// os.CreateTemp creates the file with mode 0600.
+	if err = temp.Chmod(mode); err == nil {
+		if _, err = temp.Write(data); err == nil {
+			err = temp.Sync()
+		}
+	}
+
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(temp.Name(), path)
+}
+
+// issuer returns the state for CRLs issued by issuerCert with the given KMS key version.
+func (state *crlState) issuer(issuerCert *x509.Certificate, keyVersionName string) *issuerCRLState {
+	key := hex.EncodeToString(issuerCert.SubjectKeyId) + " " + keyVersionName
+
+	if state.Issuers[key] == nil {
+		state.Issuers[key] = &issuerCRLState{}
+	}
+
+	return state.Issuers[key]
+}
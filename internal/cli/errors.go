@@ -0,0 +1,7 @@
+package cli
+
+import "errors"
+
+// ErrInvalidInput is returned for invalid command line input, such as an unreadable or wrongly
+// signed CSR, or an unsupported option value.
+var ErrInvalidInput = errors.New("Invalid input")
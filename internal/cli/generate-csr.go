@@ -6,34 +6,32 @@ import (
 	"crypto/x509/pkix"
 	"encoding/pem"
 	"os"
-
-	cloudkms "cloud.google.com/go/kms/apiv1"
-	"github.com/ericnorris/google-kms-x509/kmssign"
 )
 
-func GenerateCSR(kmsKey string, generateComment bool, subject pkix.Name, out *os.File) {
+func GenerateCSR(key KeyOptions, subject pkix.Name, out *os.File) error {
 	ctx := context.Background()
-	client, err := cloudkms.NewKeyManagementClient(ctx)
+	kmsSigner, err := key.newSigner(ctx, nil)
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	kmsSigner, err := kmssign.NewGoogleKMSSigner(ctx, client, kmsKey)
+	signatureAlgorithm, err := key.signatureAlgorithm()
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	template := &x509.CertificateRequest{
-		Subject: subject,
+		Subject:            subject,
+		SignatureAlgorithm: signatureAlgorithm,
 	}
 
-	csrBytes, err := kmsSigner.CreateCertificateRequest(template, generateComment)
+	csrBytes, err := kmsSigner.CreateCertificateRequest(template, key.GenerateComment)
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	pem.Encode(out, &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes})
+	return pem.Encode(out, &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrBytes})
 }
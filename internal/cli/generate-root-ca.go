@@ -7,55 +7,68 @@ import (
 	"encoding/pem"
 	"os"
 	"time"
-
-	cloudkms "cloud.google.com/go/kms/apiv1"
-	"github.com/ericnorris/google-kms-x509/kmssign"
 )
 
 func GenerateRootCA(
-	kmsKey string,
-	generateComment bool,
+	key KeyOptions,
 	subject pkix.Name,
-	days int,
+	validity ValidityOptions,
+	usages KeyUsageOptions,
+	urlOptions URLOptions,
 	out *os.File,
-) {
+) error {
 	ctx := context.Background()
-	client, err := cloudkms.NewKeyManagementClient(ctx)
+	kmsSigner, err := key.newSigner(ctx, nil)
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	kmsSigner, err := kmssign.NewGoogleKMSSigner(ctx, client, kmsKey)
+	signatureAlgorithm, err := key.signatureAlgorithm()
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	now := time.Now()
+	if err := urlOptions.checkChildURLs(); err != nil {
+		return err
+	}
 
 	rootCertificateTemplate := &x509.Certificate{
 		Subject:               subject,
+		SignatureAlgorithm:    signatureAlgorithm,
 		BasicConstraintsValid: true,
 		IsCA:                  true,
 		MaxPathLen:            0,
 		MaxPathLenZero:        false,
-		NotBefore:             now,
-		NotAfter:              now.AddDate(0, 0, days),
+	}
 
-		KeyUsage: x509.KeyUsageDigitalSignature |
-			x509.KeyUsageCRLSign |
-			x509.KeyUsageCertSign,
+	if err := validity.apply(rootCertificateTemplate, nil, time.Now()); err != nil {
+		return err
+	}
+
+	err = usages.apply(
+		rootCertificateTemplate,
+		x509.KeyUsageDigitalSignature|x509.KeyUsageCRLSign|x509.KeyUsageCertSign,
+		kmsSigner.Public(),
+	)
+
+	if err != nil {
+		return err
 	}
 
 	certificateBytes, err := kmsSigner.CreateSelfSignedCertificate(
 		rootCertificateTemplate,
-		generateComment,
+		key.GenerateComment,
 	)
 
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	if err := urlOptions.saveChildURLs(certificateBytes); err != nil {
+		return err
 	}
 
-	pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: certificateBytes})
+	return pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: certificateBytes})
 }
@@ -0,0 +1,205 @@
+package cli
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+
+	"github.com/ericnorris/google-kms-x509/internal/issuancedb"
+	"github.com/ericnorris/google-kms-x509/kmssign"
+)
+
+// IssuerURLs are where clients find the revocation status and certificate of an issuer, which the
+// certificates it issues point to in their Authority Information Access and CRL distribution
+// points extensions.
+type IssuerURLs struct {
+	OCSPServers            []string `json:"ocspServers,omitempty"`
+	IssuingCertificateURLs []string `json:"issuingCertificateURLs,omitempty"`
+	CRLDistributionPoints  []string `json:"crlDistributionPoints,omitempty"`
+}
+
+// URLOptions sets the Authority Information Access and CRL distribution points extensions of the
+// certificates signed.
+type URLOptions struct {
+	// URLs are set in the certificate. Empty fields are taken from the profile, if any, and then
+	// from the parent's defaults in IssuerDefaults.
+	URLs IssuerURLs
+
+	// IssuerDefaults is a JSON file of the URLs set in the certificates each CA issues. Empty
+	// disables it.
+	IssuerDefaults string
+
+	// ChildURLs, when signing a CA, are recorded in IssuerDefaults as that CA's defaults.
+	ChildURLs IssuerURLs
+}
+
+// issuerDefaults is the format of IssuerDefaults files, mapping issuancedb.IssuerID to the
+// defaults of each issuer.
+type issuerDefaults struct {
+	Issuers map[string]*issuerDefaultsEntry `json:"issuers"`
+}
+
+type issuerDefaultsEntry struct {
+	// Subject identifies the issuer to readers of the file.
+	Subject string     `json:"subject"`
+	URLs    IssuerURLs `json:"urls"`
+}
+
+func (urls IssuerURLs) empty() bool {
+	return len(urls.OCSPServers) == 0 &&
+		len(urls.IssuingCertificateURLs) == 0 &&
+		len(urls.CRLDistributionPoints) == 0
+}
+
+// or returns urls, with each empty field taken from defaults.
+func (urls IssuerURLs) or(defaults IssuerURLs) IssuerURLs {
+	if len(urls.OCSPServers) == 0 {
+		urls.OCSPServers = defaults.OCSPServers
+	}
+
+	if len(urls.IssuingCertificateURLs) == 0 {
+		urls.IssuingCertificateURLs = defaults.IssuingCertificateURLs
+	}
+
+	if len(urls.CRLDistributionPoints) == 0 {
+		urls.CRLDistributionPoints = defaults.CRLDistributionPoints
+	}
+
+	return urls
+}
+
+func (urls IssuerURLs) validate() error {
+	for _, urlList := range [][]string{
+		urls.OCSPServers,
+		urls.IssuingCertificateURLs,
+		urls.CRLDistributionPoints,
+	} {
+		for _, rawURL := range urlList {
+			parsed, err := url.Parse(rawURL)
+
+			if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+				return fmt.Errorf("%w: %q is not an absolute URL", ErrInvalidInput, rawURL)
+			}
+		}
+	}
+
+	return nil
+}
+
+// apply sets the URLs of template.
+func (urls IssuerURLs) apply(template *x509.Certificate) {
+	template.OCSPServer = urls.OCSPServers
+	template.IssuingCertificateURL = urls.IssuingCertificateURLs
+	template.CRLDistributionPoints = urls.CRLDistributionPoints
+}
+
+// urls returns the URLs for a certificate issued by parentCert, given the URLs set by a profile.
+func (options URLOptions) urls(
+	parentCert *x509.Certificate,
+	profileURLs IssuerURLs,
+) (IssuerURLs, error) {
+	if err := options.URLs.validate(); err != nil {
+		return IssuerURLs{}, err
+	}
+
+	urls := options.URLs.or(profileURLs)
+
+	if options.IssuerDefaults == "" {
+		return urls, nil
+	}
+
+	defaults, err := loadIssuerDefaults(options.IssuerDefaults)
+
+	if err != nil {
+		return IssuerURLs{}, err
+	}
+
+	if entry := defaults.Issuers[issuancedb.IssuerID(parentCert)]; entry != nil {
+		urls = urls.or(entry.URLs)
+	}
+
+	return urls, nil
+}
+
+// checkChildURLs returns an error if ChildURLs cannot be recorded, before signing the CA.
+func (options URLOptions) checkChildURLs() error {
+	if options.ChildURLs.empty() {
+		return nil
+	}
+
+	if options.IssuerDefaults == "" {
+		return fmt.Errorf(
+			"%w: Child URLs are recorded in an issuer defaults file, which is required",
+			ErrInvalidInput,
+		)
+	}
+
+	return options.ChildURLs.validate()
+}
+
+// saveChildURLs records ChildURLs as the defaults of the DER-encoded CA certificate rawCA.
+func (options URLOptions) saveChildURLs(rawCA []byte) error {
+	if options.ChildURLs.empty() {
+		return nil
+	}
+
+	ca, err := kmssign.ParseCertificate(rawCA)
+
+	if err != nil {
+		return err
+	}
+
+	defaults, err := loadIssuerDefaults(options.IssuerDefaults)
+
+	if err != nil {
+		return err
+	}
+
+	defaults.Issuers[issuancedb.IssuerID(ca)] = &issuerDefaultsEntry{
+		Subject: ca.Subject.String(),
+		URLs:    options.ChildURLs,
+	}
+
+	data, err := json.MarshalIndent(defaults, "", "  ")
+
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomically(options.IssuerDefaults, append(data, '\n')); err != nil {
+		return fmt.Errorf("Could not write issuer defaults: %w", err)
+	}
+
+	return nil
+}
+
+func loadIssuerDefaults(path string) (*issuerDefaults, error) {
+	defaults := &issuerDefaults{Issuers: map[string]*issuerDefaultsEntry{}}
+
+	data, err := os.ReadFile(path)
+
+	if errors.Is(err, fs.ErrNotExist) {
+		return defaults, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("Could not read issuer defaults: %w", err)
+	}
+
+	if err := json.Unmarshal(data, defaults); err != nil {
+		return nil, fmt.Errorf(
+			"%w: Could not parse issuer defaults %s: %v",
+			ErrInvalidInput,
+			path,
+			err,
+		)
+	}
+
+	if defaults.Issuers == nil {
+		defaults.Issuers = map[string]*issuerDefaultsEntry{}
+	}
+
+	return defaults, nil
+}
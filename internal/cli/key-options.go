@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"context"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"os/user"
+	"strings"
+
+	cloudkms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/ericnorris/google-kms-x509/internal/issuancedb"
+	"github.com/ericnorris/google-kms-x509/kmssign"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+type KeyOptions struct {
+	// Name is the KMS key version resource ID, or a CryptoKey resource ID whose version is chosen
+	// by VersionSelector.
+	Name            string
+	GenerateComment bool
+
+	// Endpoint overrides the Cloud KMS API endpoint, e.g. to use a local emulator.
+	Endpoint string
+
+	// Insecure connects to Endpoint without TLS or credentials.
+	Insecure bool
+
+	// MaxAttempts is the number of attempts made for each Cloud KMS call before giving up on
+	// retryable errors, see kmssign.RetryPolicy.
+	MaxAttempts int
+
+	// VersionSelector chooses the version of a CryptoKey: "newest-enabled" (the default),
+	// "highest-number", or "label=<name>" for the version named by a label on the CryptoKey.
+	VersionSelector string
+
+	// MinProtectionLevel refuses key versions with a weaker protection level: SOFTWARE, HSM or
+	// EXTERNAL, see kmssign.WithMinimumProtectionLevel. Empty allows any.
+	MinProtectionLevel string
+
+	// AllowExternalKeys lets EXTERNAL and EXTERNAL_VPC key versions meet an HSM
+	// MinProtectionLevel.
+	AllowExternalKeys bool
+
+	// SignatureHash is the hash used with RSA_SIGN_RAW_PKCS1_* keys: SHA256, SHA384 or SHA512.
+	// Empty uses the key's default.
+	SignatureHash string
+
+	// IssuanceDB is a database recording every certificate issued, see package issuancedb. Empty
+	// disables it.
+	IssuanceDB string
+
+	// Requester is recorded in IssuanceDB as the requester of each certificate. Empty uses the
+	// name of the current user.
+	Requester string
+
+	// CADir is an 'openssl ca' directory whose serial file numbers the certificates issued, and
+	// whose index.txt records them. Empty disables it.
+	CADir string
+}
+
+func (options KeyOptions) newKeyManagementClient(
+	ctx context.Context,
+) (*cloudkms.KeyManagementClient, error) {
+	var clientOptions []option.ClientOption
+
+	if options.Insecure {
+		if options.Endpoint == "" {
+			return nil, fmt.Errorf("%w: An endpoint is required for an insecure connection", ErrInvalidInput)
+		}
+
+		conn, err := grpc.NewClient(
+			options.Endpoint,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("Could not connect to %s: %w", options.Endpoint, err)
+		}
+
+		clientOptions = append(clientOptions, option.WithGRPCConn(conn))
+	} else if options.Endpoint != "" {
+		clientOptions = append(clientOptions, option.WithEndpoint(options.Endpoint))
+	}
+
+	return cloudkms.NewKeyManagementClient(ctx, clientOptions...)
+}
+
+func (options KeyOptions) newSigner(
+	ctx context.Context,
+	parentCert *x509.Certificate,
+) (*kmssign.GoogleKMSSigner, error) {
+	client, err := options.newKeyManagementClient(ctx)
+
+	if err != nil {
+		return nil, err
+	}
+
+	versionSelector, err := options.versionSelector()
+
+	if err != nil {
+		return nil, err
+	}
+
+	minProtectionLevel, err := options.minProtectionLevel()
+
+	if err != nil {
+		return nil, err
+	}
+
+	retryPolicy := kmssign.DefaultRetryPolicy
+	retryPolicy.MaxAttempts = options.MaxAttempts
+
+	signerOptions := []kmssign.Option{
+		kmssign.WithRetryPolicy(retryPolicy),
+		kmssign.WithVersionSelector(versionSelector),
+		kmssign.WithMinimumProtectionLevel(minProtectionLevel),
+	}
+
+	if options.AllowExternalKeys {
+		signerOptions = append(signerOptions, kmssign.WithExternalKeysAllowed())
+	}
+
+	if options.CADir != "" {
+		caDir, err := openCADir(options.CADir)
+
+		if err != nil {
+			return nil, err
+		}
+
+		signerOptions = append(
+			signerOptions,
+			kmssign.WithSerialNumberGenerator(caDir.nextSerialNumber),
+			kmssign.WithIssuanceStore(caDir, options.requester()),
+		)
+	}
+
+	if options.IssuanceDB != "" {
+		signerOptions = append(
+			signerOptions,
+			kmssign.WithIssuanceStore(issuancedb.New(options.IssuanceDB), options.requester()),
+		)
+	}
+
+	signer, err := kmssign.NewGoogleKMSSignerWithCertificate(
+		ctx,
+		client,
+		options.Name,
+		parentCert,
+		signerOptions...,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if signer.KeyVersionName() != options.Name {
+		fmt.Fprintf(os.Stderr, "Using key version %s\n", signer.KeyVersionName())
+	}
+
+	return signer, nil
+}
+
+// requester returns the Requester, or the name of the current user.
+func (options KeyOptions) requester() string {
+	if options.Requester != "" {
+		return options.Requester
+	}
+
+	if currentUser, err := user.Current(); err == nil {
+		return currentUser.Username
+	}
+
+	return os.Getenv("USER")
+}
+
+func (options KeyOptions) minProtectionLevel() (kmspb.ProtectionLevel, error) {
+	switch level := strings.ToUpper(options.MinProtectionLevel); level {
+	case "":
+		return kmspb.ProtectionLevel_PROTECTION_LEVEL_UNSPECIFIED, nil
+
+	case "SOFTWARE", "HSM", "EXTERNAL":
+		return kmspb.ProtectionLevel(kmspb.ProtectionLevel_value[level]), nil
+
+	default:
+		return kmspb.ProtectionLevel_PROTECTION_LEVEL_UNSPECIFIED, fmt.Errorf(
+			"%w: Unsupported protection level %q, must be SOFTWARE, HSM or EXTERNAL",
+			ErrInvalidInput,
+			options.MinProtectionLevel,
+		)
+	}
+}
+
+func (options KeyOptions) versionSelector() (kmssign.VersionSelector, error) {
+	switch selector := options.VersionSelector; {
+	case selector == "" || selector == "newest-enabled":
+		return kmssign.NewestEnabledVersion, nil
+
+	case selector == "highest-number":
+		return kmssign.HighestNumberedVersion, nil
+
+	case strings.HasPrefix(selector, "label="):
+		return kmssign.VersionFromLabel(strings.TrimPrefix(selector, "label=")), nil
+
+	default:
+		return nil, fmt.Errorf(
+			"%w: Unsupported version selector %q, must be newest-enabled, highest-number or label=<name>",
+			ErrInvalidInput,
+			selector,
+		)
+	}
+}
+
+// signatureAlgorithm returns the signature algorithm to put in certificate and CSR templates, or
+// x509.UnknownSignatureAlgorithm to let the signer use the key's default.
+func (options KeyOptions) signatureAlgorithm() (x509.SignatureAlgorithm, error) {
+	switch strings.ToUpper(strings.ReplaceAll(options.SignatureHash, "-", "")) {
+	case "":
+		return x509.UnknownSignatureAlgorithm, nil
+
+	case "SHA256":
+		return x509.SHA256WithRSA, nil
+
+	case "SHA384":
+		return x509.SHA384WithRSA, nil
+
+	case "SHA512":
+		return x509.SHA512WithRSA, nil
+
+	default:
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf(
+			"%w: Unsupported signature hash %q, must be SHA256, SHA384 or SHA512",
+			ErrInvalidInput, options.SignatureHash,
+		)
+	}
+}
@@ -0,0 +1,80 @@
+package cli
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+
+	"github.com/ericnorris/google-kms-x509/internal/profile"
+)
+
+// KeyUsageOptions chooses the key usages and extended key usages of a certificate.
+type KeyUsageOptions struct {
+	// KeyUsage lists key usage names, see profile.ParseKeyUsage. Empty uses the command's default.
+	KeyUsage []string
+
+	// ExtKeyUsage lists extended key usage names or OIDs, see profile.ParseExtKeyUsage. They are
+	// added to those set by the command. On a CA, they constrain the certificates below it.
+	ExtKeyUsage []string
+}
+
+// apply sets the key usages of template, whose IsCA must already be set, and checks that they fit
+// publicKey, the subject's key.
+func (options KeyUsageOptions) apply(
+	template *x509.Certificate,
+	defaultKeyUsage x509.KeyUsage,
+	publicKey crypto.PublicKey,
+) error {
+	keyUsage, err := profile.ParseKeyUsage(options.KeyUsage)
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	if keyUsage == 0 {
+		keyUsage = defaultKeyUsage
+	}
+
+	extKeyUsage, unknownExtKeyUsage, err := profile.ParseExtKeyUsage(options.ExtKeyUsage)
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	template.KeyUsage = keyUsage
+
+	for _, usage := range extKeyUsage {
+		if !containsExtKeyUsage(template.ExtKeyUsage, usage) {
+			template.ExtKeyUsage = append(template.ExtKeyUsage, usage)
+		}
+	}
+
+	template.UnknownExtKeyUsage = append(template.UnknownExtKeyUsage, unknownExtKeyUsage...)
+
+	if err := profile.CheckKeyUsage(keyUsage, template.IsCA, publicKey); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	return nil
+}
+
+// defaultLeafKeyUsage is the key usage of leaf certificates for publicKey: digitalSignature, and
+// keyEncipherment for RSA keys, which TLS 1.2 RSA key exchange needs.
+func defaultLeafKeyUsage(publicKey crypto.PublicKey) x509.KeyUsage {
+	if _, ok := publicKey.(*rsa.PublicKey); ok {
+		return x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment
+	}
+
+	return x509.KeyUsageDigitalSignature
+}
+
+func containsExtKeyUsage(usages []x509.ExtKeyUsage, usage x509.ExtKeyUsage) bool {
+	for _, existing := range usages {
+		if existing == usage {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/internal/issuancedb"
+)
+
+type ListOptions struct {
+	// ExpiringWithin only lists certificates that expire within this duration from now, including
+	// those that have already expired. Zero lists every certificate.
+	ExpiringWithin time.Duration
+
+	// JSON writes one JSON record per line, including the PEM-encoded certificate, instead of a
+	// table.
+	JSON bool
+}
+
+// ListCertificates writes the certificates recorded in the issuance database at dbPath.
+func ListCertificates(dbPath string, options ListOptions, out *os.File) error {
+	deadline := time.Now().Add(options.ExpiringWithin)
+	encoder := json.NewEncoder(out)
+	table := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	if !options.JSON {
+		fmt.Fprintln(table, "SERIAL\tSUBJECT\tISSUER\tNOT AFTER\tREQUESTER\tKEY VERSION")
+	}
+
+	err := issuancedb.New(dbPath).ForEach(func(record *issuancedb.Record) error {
+		if options.ExpiringWithin > 0 && record.NotAfter.After(deadline) {
+			return nil
+		}
+
+		if options.JSON {
+			return encoder.Encode(record)
+		}
+
+		_, err := fmt.Fprintf(
+			table,
+			"0x%x\t%s\t%s\t%s\t%s\t%s\n",
+			record.SerialNumber,
+			record.Subject,
+			record.Issuer,
+			record.NotAfter.UTC().Format(time.RFC3339),
+			record.Requester,
+			record.KeyVersionName,
+		)
+
+		return err
+	})
+
+	if err != nil {
+		return err
+	}
+
+	return table.Flush()
+}
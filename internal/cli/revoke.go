@@ -0,0 +1,315 @@
+package cli
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/internal/issuancedb"
+	"github.com/ericnorris/google-kms-x509/kmssign"
+)
+
+type RevokeOptions struct {
+	// SerialNumber, Certificate and SPKIHash select the certificates to revoke, and exactly one of
+	// them must be set: the certificate with SerialNumber, the Certificate itself, or every
+	// certificate whose SubjectPublicKeyInfo has the SHA-256 hash SPKIHash.
+	SerialNumber *big.Int
+	Certificate  *x509.Certificate
+	SPKIHash     []byte
+
+	// IssuerCert, if set, only revokes certificates it issued.
+	IssuerCert *x509.Certificate
+
+	// Reason is the CRLReason code, see kmssign.RevocationReasons.
+	Reason    int
+	RevokedAt time.Time
+
+	// InvalidityDate is when the key is known or suspected to have been compromised. Zero omits
+	// it.
+	InvalidityDate time.Time
+
+	// IssuanceDB and CADir are the stores the certificates are found and revoked in. At least one
+	// is required, and certificates are revoked in both if both are set.
+	IssuanceDB string
+	CADir      string
+}
+
+// Revoke marks the selected certificates as revoked in the issuance database and CA directory,
+// for the next CRL signed with them.
+func Revoke(options RevokeOptions) error {
+	if options.IssuanceDB == "" && options.CADir == "" {
+		return fmt.Errorf(
+			"%w: An issuance database or CA directory is required to revoke certificates",
+			ErrInvalidInput,
+		)
+	}
+
+	if options.IssuanceDB != "" {
+		if err := options.revokeInIssuanceDB(); err != nil {
+			return err
+		}
+	}
+
+	if options.CADir != "" {
+		if err := options.revokeInCADir(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether the certificate with serialNumber is selected. certificate may be nil
+// if it is unknown, in which case only SerialNumber can select it.
+func (options RevokeOptions) matches(serialNumber *big.Int, certificate *x509.Certificate) bool {
+	switch {
+	case options.SerialNumber != nil:
+		return serialNumber.Cmp(options.SerialNumber) == 0
+
+	case options.Certificate != nil:
+		return certificate != nil && bytes.Equal(certificate.Raw, options.Certificate.Raw)
+
+	default:
+		if certificate == nil {
+			return false
+		}
+
+		hash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+
+		return bytes.Equal(hash[:], options.SPKIHash)
+	}
+}
+
+// description describes the selected certificates in errors.
+func (options RevokeOptions) description() string {
+	switch {
+	case options.SerialNumber != nil:
+		return fmt.Sprintf("serial number 0x%x", options.SerialNumber)
+
+	case options.Certificate != nil:
+		return fmt.Sprintf("certificate %s", options.Certificate.Subject)
+
+	default:
+		return fmt.Sprintf("SPKI hash %x", options.SPKIHash)
+	}
+}
+
+func (options RevokeOptions) revokeInIssuanceDB() error {
+	db := issuancedb.New(options.IssuanceDB)
+
+	var matching []*issuancedb.Record
+
+	err := db.ForEach(func(record *issuancedb.Record) error {
+		if options.IssuerCert != nil && record.IssuerID != issuancedb.IssuerID(options.IssuerCert) {
+			return nil
+		}
+
+		var certificate *x509.Certificate
+
+		if options.SerialNumber == nil {
+			var err error
+
+			if certificate, err = record.Certificate(); err != nil {
+				return err
+			}
+		}
+
+		if options.matches(record.SerialNumber, certificate) {
+			matching = append(matching, record)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if len(matching) == 0 {
+		return fmt.Errorf(
+			"%w: No certificate with %s in %s",
+			ErrInvalidInput,
+			options.description(),
+			options.IssuanceDB,
+		)
+	}
+
+	if options.SerialNumber != nil && len(matching) > 1 {
+		return fmt.Errorf(
+			"%w: %d issuers have issued a certificate with %s; choose one by its certificate",
+			ErrInvalidInput,
+			len(matching),
+			options.description(),
+		)
+	}
+
+	revocation := &issuancedb.Revocation{
+		RevokedAt: options.RevokedAt.UTC(),
+		Reason:    options.Reason,
+	}
+
+	if !options.InvalidityDate.IsZero() {
+		invalidityDate := options.InvalidityDate.UTC()
+		revocation.InvalidityDate = &invalidityDate
+	}
+
+	for _, record := range matching {
+		// a compromised key may have been certified several times, and some of them revoked
+		// already.
+		if options.SPKIHash != nil && record.Revocation != nil {
+			continue
+		}
+
+		_, err := db.Revoke(record.IssuerID, record.SerialNumber, revocation)
+
+		if errors.Is(err, issuancedb.ErrAlreadyRevoked) {
+			return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		} else if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(
+			os.Stderr,
+			"Revoked 0x%x %s, issued by %s, in %s\n",
+			record.SerialNumber,
+			record.Subject,
+			record.Issuer,
+			options.IssuanceDB,
+		)
+	}
+
+	return nil
+}
+
+func (options RevokeOptions) revokeInCADir() error {
+	caDir, err := openCADir(options.CADir)
+
+	if err != nil {
+		return err
+	}
+
+	entries, err := caDir.readIndex()
+
+	if err != nil {
+		return err
+	}
+
+	var matching []*indexEntry
+
+	for _, entry := range entries {
+		certificate, err := caDir.certificate(entry.SerialNumber)
+
+		if err != nil {
+			return err
+		}
+
+		if !options.matches(entry.SerialNumber, certificate) {
+			continue
+		}
+
+		if options.IssuerCert != nil && certificate != nil &&
+			certificate.CheckSignatureFrom(options.IssuerCert) != nil {
+			return fmt.Errorf(
+				"%w: %s in %s is not issued by %s",
+				ErrInvalidInput,
+				formatOpenSSLHex(entry.SerialNumber),
+				options.CADir,
+				options.IssuerCert.Subject,
+			)
+		}
+
+		matching = append(matching, entry)
+	}
+
+	if len(matching) == 0 {
+		return fmt.Errorf(
+			"%w: No certificate with %s in %s",
+			ErrInvalidInput,
+			options.description(),
+			options.CADir,
+		)
+	}
+
+	for _, entry := range matching {
+		if options.SPKIHash != nil && entry.Status == 'R' {
+			continue
+		}
+
+		_, err := caDir.revoke(
+			entry.SerialNumber,
+			options.RevokedAt,
+			options.Reason,
+			options.InvalidityDate,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(
+			os.Stderr,
+			"Revoked %s %s in %s\n",
+			formatOpenSSLHex(entry.SerialNumber),
+			entry.Subject,
+			options.CADir,
+		)
+	}
+
+	return nil
+}
+
+// issuanceDBRevocations returns the certificates issued by issuerCert that are revoked in the
+// issuance database at path, for a CRL. Unless recordedSince is zero, revocations recorded before
+// it are left out, for a delta CRL.
+func issuanceDBRevocations(
+	path string,
+	issuerCert *x509.Certificate,
+	recordedSince time.Time,
+) ([]x509.RevocationListEntry, error) {
+	var revoked []x509.RevocationListEntry
+
+	issuerID := issuancedb.IssuerID(issuerCert)
+
+	err := issuancedb.New(path).ForEach(func(record *issuancedb.Record) error {
+		if record.IssuerID != issuerID || record.Revocation == nil {
+			return nil
+		}
+
+		// revocations recorded by earlier versions have no time, and are always included.
+		recordedAt := record.Revocation.RecordedAt
+
+		if !recordedSince.IsZero() && !recordedAt.IsZero() && recordedAt.Before(recordedSince) {
+			return nil
+		}
+
+		entry := x509.RevocationListEntry{
+			SerialNumber:   record.SerialNumber,
+			RevocationTime: record.Revocation.RevokedAt,
+			ReasonCode:     record.Revocation.Reason,
+		}
+
+		if record.Revocation.InvalidityDate != nil {
+			invalidityDateExt, err := kmssign.InvalidityDateExtension(
+				*record.Revocation.InvalidityDate,
+			)
+
+			if err != nil {
+				return err
+			}
+
+			entry.ExtraExtensions = []pkix.Extension{invalidityDateExt}
+		}
+
+		revoked = append(revoked, entry)
+
+		return nil
+	})
+
+	return revoked, err
+}
@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/internal/issuancedb"
+	"github.com/ericnorris/google-kms-x509/internal/ocspresponder"
+)
+
+type OCSPOptions struct {
+	// Listen is the TCP address to serve OCSP requests on, e.g. ":8080".
+	Listen string
+
+	// CRLPaths are CRLs of the issuer whose revoked certificates are reported as revoked, in
+	// addition to those revoked in IssuanceDB or CADir.
+	CRLPaths []string
+
+	// IssuanceDB or CADir lists the certificates issued by the issuer, and which of them are
+	// revoked. Other certificates are reported as unknown.
+	IssuanceDB string
+	CADir      string
+
+	// Validity is the time between thisUpdate and nextUpdate in each response.
+	Validity time.Duration
+
+	// RefreshInterval is how often the issued certificates and CRLs are read again and pre-signed
+	// responses re-signed.
+	RefreshInterval time.Duration
+}
+
+// ServeOCSP answers OCSP requests for certificates issued by issuerCert until interrupted. The KMS
+// key is the issuer's key, or the key of responderCert when it is not nil.
+func ServeOCSP(
+	key KeyOptions,
+	issuerCert *x509.Certificate,
+	responderCert *x509.Certificate,
+	options OCSPOptions,
+) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	signerCert := issuerCert
+
+	if responderCert != nil {
+		signerCert = responderCert
+	}
+
+	kmsSigner, err := key.newSigner(ctx, signerCert)
+
+	if err != nil {
+		return err
+	}
+
+	var issued ocspresponder.IssuedCertificates
+
+	switch {
+	case options.IssuanceDB != "" && options.CADir != "":
+		return fmt.Errorf("%w: Only one of an issuance database or a CA directory", ErrInvalidInput)
+
+	case options.IssuanceDB != "":
+		issued = issuancedb.New(options.IssuanceDB)
+
+	case options.CADir != "":
+		if issued, err = openCADir(options.CADir); err != nil {
+			return err
+		}
+
+	default:
+		return fmt.Errorf(
+			"%w: An issuance database or a CA directory is required to tell which certificates "+
+				"were issued",
+			ErrInvalidInput,
+		)
+	}
+
+	store, err := ocspresponder.NewCRLStore(issuerCert, issued, options.CRLPaths...)
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	responder, err := ocspresponder.New(ocspresponder.Config{
+		Signer:               kmsSigner,
+		Issuer:               issuerCert,
+		ResponderCertificate: responderCert,
+		Store:                store,
+		Validity:             options.Validity,
+		RefreshInterval:      options.RefreshInterval,
+	})
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	go responder.Run(ctx)
+
+	server := &http.Server{
+		Addr:              options.Listen,
+		Handler:           responder,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		server.Shutdown(shutdownCtx)
+	}()
+
+	fmt.Fprintf(os.Stderr, "Serving OCSP requests on %s\n", options.Listen)
+
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("Could not serve OCSP requests: %w", err)
+	}
+
+	return nil
+}
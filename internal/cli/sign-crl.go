@@ -0,0 +1,309 @@
+package cli
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/kmssign"
+)
+
+type CRLOptions struct {
+	// Number is the CRL number. Nil uses the number after the last one recorded in StatePath.
+	Number *big.Int
+
+	ThisUpdate time.Time
+	NextUpdate time.Time
+
+	// StatePath is a file recording the CRL numbers issued for each issuer and KMS key. Empty
+	// disables it.
+	StatePath string
+
+	// Delta issues a delta CRL against the complete CRL numbered BaseNumber. Nil uses the last
+	// complete CRL recorded in StatePath.
+	Delta      bool
+	BaseNumber *big.Int
+
+	// FreshestCRL lists the URLs where delta CRLs are published, for the Freshest CRL extension of
+	// complete CRLs.
+	FreshestCRL []string
+
+	// CADir is an 'openssl ca' directory whose revoked certificates are added to the CRL. Its
+	// crlnumber file, if any, numbers the CRL when Number is nil. Empty disables it.
+	CADir string
+
+	// IssuanceDB is an issuance database whose revoked certificates, issued by the issuer, are
+	// added to the CRL. Delta CRLs only get the revocations recorded since the base CRL recorded
+	// in StatePath was issued, whatever their revocation time. Empty disables it.
+	IssuanceDB string
+}
+
+func SignCRL(
+	key KeyOptions,
+	issuerCert *x509.Certificate,
+	revoked []x509.RevocationListEntry,
+	options CRLOptions,
+	out *os.File,
+) error {
+	if options.Delta && len(options.FreshestCRL) > 0 {
+		return fmt.Errorf(
+			"%w: Delta CRLs cannot have a Freshest CRL extension (RFC 5280 section 5.2.6)",
+			ErrInvalidInput,
+		)
+	}
+
+	ctx := context.Background()
+	kmsSigner, err := key.newSigner(ctx, issuerCert)
+
+	if err != nil {
+		return err
+	}
+
+	signatureAlgorithm, err := key.signatureAlgorithm()
+
+	if err != nil {
+		return err
+	}
+
+	if options.CADir != "" {
+		revoked, options.Number, err = options.readCADir(revoked)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	// the next delta CRL includes the revocations recorded from now on, as reading the issuance
+	// database below may miss them.
+	revocationsReadAt := time.Now().UTC()
+
+	number, baseNumber := options.Number, options.BaseNumber
+	var baseRevocationsReadAt *time.Time
+
+	if options.StatePath != "" {
+		number, baseNumber, baseRevocationsReadAt, err = options.recordCRL(
+			issuerCert,
+			kmsSigner.KeyVersionName(),
+			revocationsReadAt,
+		)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	if options.IssuanceDB != "" {
+		var recordedSince time.Time
+
+		if options.Delta {
+			if baseRevocationsReadAt == nil {
+				return fmt.Errorf(
+					"%w: Delta CRLs from an issuance database require the base CRL to be "+
+						"recorded in the CRL state",
+					ErrInvalidInput,
+				)
+			}
+
+			recordedSince = *baseRevocationsReadAt
+		}
+
+		issuanceDBRevoked, err := issuanceDBRevocations(
+			options.IssuanceDB,
+			issuerCert,
+			recordedSince,
+		)
+
+		if err != nil {
+			return err
+		}
+
+		revoked = appendRevoked(revoked, issuanceDBRevoked)
+	}
+
+	if number == nil {
+		return fmt.Errorf(
+			"%w: A CRL number is required without CRL state or a crlnumber file",
+			ErrInvalidInput,
+		)
+	}
+
+	if options.Delta && baseNumber == nil {
+		return fmt.Errorf("%w: A base CRL number is required for a delta CRL", ErrInvalidInput)
+	}
+
+	template := &x509.RevocationList{
+		SignatureAlgorithm:        signatureAlgorithm,
+		RevokedCertificateEntries: revoked,
+		Number:                    number,
+		ThisUpdate:                options.ThisUpdate,
+		NextUpdate:                options.NextUpdate,
+	}
+
+	if len(options.FreshestCRL) > 0 {
+		freshestCRLExt, err := kmssign.FreshestCRLExtension(options.FreshestCRL...)
+
+		if err != nil {
+			return err
+		}
+
+		template.ExtraExtensions = []pkix.Extension{freshestCRLExt}
+	}
+
+	var crlBytes []byte
+
+	if options.Delta {
+		crlBytes, err = kmsSigner.CreateDeltaRevocationList(template, baseNumber)
+	} else {
+		crlBytes, err = kmsSigner.CreateRevocationList(template)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return pem.Encode(out, &pem.Block{Type: "X509 CRL", Bytes: crlBytes})
+}
+
+// recordCRL allocates the CRL number, and for delta CRLs the base CRL number and, if it is the
+// recorded one, when the base CRL's revocations were read, from the state in StatePath. For
+// complete CRLs, revocationsReadAt is recorded. The state is saved before
+// the CRL is signed, so that a failure leaves a gap in the CRL numbers rather than reusing one,
+// and is locked while it is updated, so that concurrent runs never allocate the same number.
+func (options CRLOptions) recordCRL(
+	issuerCert *x509.Certificate,
+	keyVersionName string,
+	revocationsReadAt time.Time,
+) (*big.Int, *big.Int, *time.Time, error) {
+	unlock, err := lockFile(options.StatePath + ".lock")
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	defer unlock()
+
+	state, err := loadCRLState(options.StatePath)
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	issuerState := state.issuer(issuerCert, keyVersionName)
+	number, baseNumber := options.Number, options.BaseNumber
+
+	if number == nil {
+		number = big.NewInt(1)
+
+		if issuerState.CRLNumber != nil {
+			number.Add(issuerState.CRLNumber, number)
+		}
+
+		fmt.Fprintf(os.Stderr, "Using CRL number %s\n", number)
+	} else if issuerState.CRLNumber != nil && number.Cmp(issuerState.CRLNumber) <= 0 {
+		return nil, nil, nil, fmt.Errorf(
+			"%w: CRL number %s is not greater than the last CRL number %s",
+			ErrInvalidInput,
+			number,
+			issuerState.CRLNumber,
+		)
+	}
+
+	if options.Delta && baseNumber == nil {
+		if issuerState.BaseCRLNumber == nil {
+			return nil, nil, nil, fmt.Errorf(
+				"%w: No complete CRL has been recorded to issue a delta CRL against",
+				ErrInvalidInput,
+			)
+		}
+
+		baseNumber = issuerState.BaseCRLNumber
+	}
+
+	var baseRevocationsReadAt *time.Time
+
+	if options.Delta && issuerState.BaseCRLNumber != nil &&
+		baseNumber.Cmp(issuerState.BaseCRLNumber) == 0 {
+		baseRevocationsReadAt = issuerState.BaseRevocationsReadAt
+	}
+
+	issuerState.CRLNumber = number
+
+	if !options.Delta {
+		issuerState.BaseCRLNumber = number
+		issuerState.BaseRevocationsReadAt = &revocationsReadAt
+	}
+
+	if err := state.save(options.StatePath); err != nil {
+		return nil, nil, nil, err
+	}
+
+	return number, baseNumber, baseRevocationsReadAt, nil
+}
+
+// readCADir adds the revoked certificates in the CA directory to revoked, and returns the CRL
+// number, allocated from its crlnumber file unless Number is set.
+func (options CRLOptions) readCADir(
+	revoked []x509.RevocationListEntry,
+) ([]x509.RevocationListEntry, *big.Int, error) {
+	if options.Delta {
+		return nil, nil, fmt.Errorf(
+			"%w: Delta CRLs cannot be issued from a CA directory",
+			ErrInvalidInput,
+		)
+	}
+
+	caDir, err := openCADir(options.CADir)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	caDirRevoked, err := caDir.revokedCertificates()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	number := options.Number
+
+	if number == nil {
+		number, err = caDir.allocateCRLNumber()
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if number != nil {
+			fmt.Fprintf(os.Stderr, "Using CRL number %s\n", number)
+		}
+	}
+
+	return appendRevoked(revoked, caDirRevoked), number, nil
+}
+
+// appendRevoked appends the entries of more to revoked, except for the serial numbers already in
+// revoked, e.g. for certificates revoked in both a CA directory and an issuance database.
+func appendRevoked(
+	revoked []x509.RevocationListEntry,
+	more []x509.RevocationListEntry,
+) []x509.RevocationListEntry {
+	serialNumbers := make(map[string]bool)
+
+	for _, entry := range revoked {
+		serialNumbers[entry.SerialNumber.String()] = true
+	}
+
+	for _, entry := range more {
+		if !serialNumbers[entry.SerialNumber.String()] {
+			serialNumbers[entry.SerialNumber.String()] = true
+			revoked = append(revoked, entry)
+		}
+	}
+
+	return revoked
+}
@@ -5,71 +5,121 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
+	"fmt"
 	"os"
 	"time"
 
-	cloudkms "cloud.google.com/go/kms/apiv1"
+	"github.com/ericnorris/google-kms-x509/internal/profile"
 	"github.com/ericnorris/google-kms-x509/kmssign"
 )
 
 func SignIntermediateCA(
-	kmsKey string,
-	generateComment bool,
+	key KeyOptions,
 	parentCert *x509.Certificate,
 	childCSR *x509.CertificateRequest,
 	subject pkix.Name,
-	days int,
+	trustCSR TrustCSROptions,
+	validity ValidityOptions,
 	pathLen int,
-	permittedDNSDomains []string,
+	usages KeyUsageOptions,
+	nameConstraints profile.NameConstraints,
+	policies profile.CertificatePolicies,
+	urlOptions URLOptions,
 	out *os.File,
-) {
+) error {
 	ctx := context.Background()
-	client, err := cloudkms.NewKeyManagementClient(ctx)
+	kmsSigner, err := key.newSigner(ctx, parentCert)
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	kmsSigner, err := kmssign.NewGoogleKMSSignerWithCertificate(ctx, client, kmsKey, parentCert)
+	signatureAlgorithm, err := key.signatureAlgorithm()
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	now := time.Now()
-
 	if err := childCSR.CheckSignature(); err != nil {
-		panic(err)
+		return fmt.Errorf("%w: Child CSR signature is invalid: %v", ErrInvalidInput, err)
+	}
+
+	urls, err := urlOptions.urls(parentCert, IssuerURLs{})
+
+	if err != nil {
+		return err
+	}
+
+	if err := urlOptions.checkChildURLs(); err != nil {
+		return err
 	}
 
 	intermediateCertificateTemplate := &x509.Certificate{
 		Subject:               subject,
+		SignatureAlgorithm:    signatureAlgorithm,
 		BasicConstraintsValid: true,
 		IsCA:                  true,
 		MaxPathLen:            pathLen,
 		MaxPathLenZero:        true,
-		NotBefore:             now,
-		NotAfter:              now.AddDate(0, 0, days),
+	}
+
+	err = validity.apply(intermediateCertificateTemplate, parentCert, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	sans, err := trustCSR.apply(
+		intermediateCertificateTemplate,
+		childCSR,
+		kmssign.SubjectAltNames{},
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if err := sans.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	if err := sans.Apply(intermediateCertificateTemplate); err != nil {
+		return err
+	}
+
+	err = usages.apply(
+		intermediateCertificateTemplate,
+		x509.KeyUsageDigitalSignature|x509.KeyUsageCRLSign|x509.KeyUsageCertSign,
+		childCSR.PublicKey,
+	)
+
+	if err != nil {
+		return err
+	}
 
-		KeyUsage: x509.KeyUsageDigitalSignature |
-			x509.KeyUsageCRLSign |
-			x509.KeyUsageCertSign,
+	if err := nameConstraints.Apply(intermediateCertificateTemplate); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
 	}
 
-	if len(permittedDNSDomains) > 0 {
-		intermediateCertificateTemplate.PermittedDNSDomainsCritical = true
-		intermediateCertificateTemplate.PermittedDNSDomains = permittedDNSDomains
+	if err := policies.Apply(intermediateCertificateTemplate); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
 	}
 
+	urls.apply(intermediateCertificateTemplate)
+
 	certificateBytes, err := kmsSigner.CreateCertificate(
 		intermediateCertificateTemplate,
 		childCSR.PublicKey,
-		generateComment,
+		key.GenerateComment,
 	)
 
 	if err != nil {
-		panic(err)
+		return err
+	}
+
+	if err := urlOptions.saveChildURLs(certificateBytes); err != nil {
+		return err
 	}
 
-	pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: certificateBytes})
+	return pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: certificateBytes})
 }
@@ -5,57 +5,79 @@ import (
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"encoding/pem"
-	"net"
+	"fmt"
 	"os"
 	"time"
 
-	cloudkms "cloud.google.com/go/kms/apiv1"
+	"github.com/ericnorris/google-kms-x509/internal/profile"
 	"github.com/ericnorris/google-kms-x509/kmssign"
 )
 
 func SignLeaf(
-	kmsKey string,
-	generateComment bool,
+	key KeyOptions,
 	parentCert *x509.Certificate,
 	childCSR *x509.CertificateRequest,
 	subject pkix.Name,
-	days int,
-	dnsNames []string,
-	ipAddresses []net.IP,
+	validity ValidityOptions,
+	sans kmssign.SubjectAltNames,
+	trustCSR TrustCSROptions,
 	isServer bool,
 	isClient bool,
+	usages KeyUsageOptions,
+	policies profile.CertificatePolicies,
+	urlOptions URLOptions,
 	out *os.File,
-) {
+) error {
 	ctx := context.Background()
-	client, err := cloudkms.NewKeyManagementClient(ctx)
+	kmsSigner, err := key.newSigner(ctx, parentCert)
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	kmsSigner, err := kmssign.NewGoogleKMSSignerWithCertificate(ctx, client, kmsKey, parentCert)
+	signatureAlgorithm, err := key.signatureAlgorithm()
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	now := time.Now()
+	urls, err := urlOptions.urls(parentCert, IssuerURLs{})
+
+	if err != nil {
+		return err
+	}
 
 	if err := childCSR.CheckSignature(); err != nil {
-		panic(err)
+		return fmt.Errorf("%w: Child CSR signature is invalid: %v", ErrInvalidInput, err)
 	}
 
 	leafCertificateTemplate := &x509.Certificate{
 		Subject:               subject,
+		SignatureAlgorithm:    signatureAlgorithm,
 		BasicConstraintsValid: true,
 		IsCA:                  false,
-		NotBefore:             now,
-		NotAfter:              now.AddDate(0, 0, days),
+	}
+
+	if err := validity.apply(leafCertificateTemplate, parentCert, time.Now()); err != nil {
+		return err
+	}
 
-		KeyUsage: x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	if sans, err = trustCSR.apply(leafCertificateTemplate, childCSR, sans); err != nil {
+		return err
+	}
 
-		DNSNames:    dnsNames,
-		IPAddresses: ipAddresses,
+	if err := sans.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	if err := sans.Apply(leafCertificateTemplate); err != nil {
+		return err
+	}
+
+	urls.apply(leafCertificateTemplate)
+
+	if err := policies.Apply(leafCertificateTemplate); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
 	}
 
 	if isServer {
@@ -72,15 +94,25 @@ func SignLeaf(
 		)
 	}
 
+	err = usages.apply(
+		leafCertificateTemplate,
+		defaultLeafKeyUsage(childCSR.PublicKey),
+		childCSR.PublicKey,
+	)
+
+	if err != nil {
+		return err
+	}
+
 	certificateBytes, err := kmsSigner.CreateCertificate(
 		leafCertificateTemplate,
 		childCSR.PublicKey,
-		generateComment,
+		key.GenerateComment,
 	)
 
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: certificateBytes})
+	return pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: certificateBytes})
 }
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"context"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/kmssign"
+)
+
+// SignOCSPResponder signs a delegated OCSP responder certificate, which lets 'serve ocsp' sign
+// responses with the responder's key instead of the CA's. The certificate cannot be checked for
+// revocation itself, so it should be short-lived.
+func SignOCSPResponder(
+	key KeyOptions,
+	parentCert *x509.Certificate,
+	childCSR *x509.CertificateRequest,
+	subject pkix.Name,
+	validity ValidityOptions,
+	usages KeyUsageOptions,
+	out *os.File,
+) error {
+	ctx := context.Background()
+	kmsSigner, err := key.newSigner(ctx, parentCert)
+
+	if err != nil {
+		return err
+	}
+
+	signatureAlgorithm, err := key.signatureAlgorithm()
+
+	if err != nil {
+		return err
+	}
+
+	if err := childCSR.CheckSignature(); err != nil {
+		return fmt.Errorf("%w: Child CSR signature is invalid: %v", ErrInvalidInput, err)
+	}
+
+	responderCertificateTemplate := &x509.Certificate{
+		Subject:               subject,
+		SignatureAlgorithm:    signatureAlgorithm,
+		BasicConstraintsValid: true,
+		IsCA:                  false,
+
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+
+		ExtraExtensions: []pkix.Extension{kmssign.OCSPNoCheckExtension()},
+	}
+
+	err = validity.apply(responderCertificateTemplate, parentCert, time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	err = usages.apply(
+		responderCertificateTemplate,
+		x509.KeyUsageDigitalSignature,
+		childCSR.PublicKey,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	certificateBytes, err := kmsSigner.CreateCertificate(
+		responderCertificateTemplate,
+		childCSR.PublicKey,
+		key.GenerateComment,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	return pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: certificateBytes})
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/internal/profile"
+)
+
+// SignWithProfile signs a certificate for childCSR as described by certificateProfile, for the
+// subject and names in request. Without a lifetime or NotAfter in validity, the profile's default
+// validity is used.
+func SignWithProfile(
+	key KeyOptions,
+	parentCert *x509.Certificate,
+	childCSR *x509.CertificateRequest,
+	certificateProfile *profile.Profile,
+	request profile.Request,
+	validity ValidityOptions,
+	urlOptions URLOptions,
+	out *os.File,
+) error {
+	ctx := context.Background()
+	kmsSigner, err := key.newSigner(ctx, parentCert)
+
+	if err != nil {
+		return err
+	}
+
+	signatureAlgorithm, err := key.signatureAlgorithm()
+
+	if err != nil {
+		return err
+	}
+
+	if err := childCSR.CheckSignature(); err != nil {
+		return fmt.Errorf("%w: Child CSR signature is invalid: %v", ErrInvalidInput, err)
+	}
+
+	request.NotBefore, request.NotAfter, err = validity.period(time.Now())
+
+	if err != nil {
+		return err
+	}
+
+	template, err := certificateProfile.Template(request)
+
+	if errors.Is(err, profile.ErrInvalidProfile) {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	} else if err != nil {
+		return err
+	}
+
+	template.SignatureAlgorithm = signatureAlgorithm
+
+	if err := validity.checkParent(template, parentCert); err != nil {
+		return err
+	}
+
+	err = profile.CheckKeyUsage(template.KeyUsage, template.IsCA, childCSR.PublicKey)
+
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	urls, err := urlOptions.urls(parentCert, IssuerURLs{
+		OCSPServers:            template.OCSPServer,
+		IssuingCertificateURLs: template.IssuingCertificateURL,
+		CRLDistributionPoints:  template.CRLDistributionPoints,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	if !template.IsCA && !urlOptions.ChildURLs.empty() {
+		return fmt.Errorf("%w: Only CA profiles can record child URLs", ErrInvalidInput)
+	}
+
+	if err := urlOptions.checkChildURLs(); err != nil {
+		return err
+	}
+
+	urls.apply(template)
+
+	certificateBytes, err := kmsSigner.CreateCertificate(
+		template,
+		childCSR.PublicKey,
+		key.GenerateComment,
+	)
+
+	if err != nil {
+		return err
+	}
+
+	if err := urlOptions.saveChildURLs(certificateBytes); err != nil {
+		return err
+	}
+
+	return pem.Encode(out, &pem.Block{Type: "CERTIFICATE", Bytes: certificateBytes})
+}
@@ -0,0 +1,252 @@
+package cli
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/ericnorris/google-kms-x509/internal/profile"
+	"github.com/ericnorris/google-kms-x509/kmssign"
+)
+
+// TrustCSROptions copies the subject, subject alternative names and extensions requested in the
+// child CSR into the certificate, after checking them against a policy. Without it, the CSR only
+// provides the public key.
+type TrustCSROptions struct {
+	Enabled bool
+
+	// AllowedSANs lists the patterns the CSR's subject alternative names must match. Names of a
+	// type without patterns are refused. The common name of a leaf certificate must match them
+	// too, as an IP address, an email address or otherwise a DNS name, as some clients still use
+	// it.
+	AllowedSANs profile.AllowedSANs
+
+	// AllowedExtensions lists the OIDs of the CSR extensions copied into the certificate. Other
+	// extensions are left out. Extensions set by the CA, such as basic constraints and key
+	// usages, cannot be allowed.
+	AllowedExtensions []string
+}
+
+var (
+	subjectAltNameOID = asn1.ObjectIdentifier{2, 5, 29, 17}
+	commonNameOID     = asn1.ObjectIdentifier{2, 5, 4, 3}
+)
+
+// caExtensions are the extensions the CA decides on, which a CSR cannot set.
+var caExtensions = map[string]string{
+	"2.5.29.14":         "subject key identifier",
+	"2.5.29.15":         "key usage",
+	"2.5.29.17":         "subject alternative name",
+	"2.5.29.19":         "basic constraints",
+	"2.5.29.30":         "name constraints",
+	"2.5.29.31":         "CRL distribution points",
+	"2.5.29.32":         "certificate policies",
+	"2.5.29.33":         "policy mappings",
+	"2.5.29.35":         "authority key identifier",
+	"2.5.29.36":         "policy constraints",
+	"2.5.29.37":         "extended key usage",
+	"2.5.29.54":         "inhibit anyPolicy",
+	"1.3.6.1.5.5.7.1.1": "authority information access",
+}
+
+// The subject attributes pkix.Name has fields for.
+var nameFieldOIDs = map[string]bool{
+	"2.5.4.3":  true,
+	"2.5.4.5":  true,
+	"2.5.4.6":  true,
+	"2.5.4.7":  true,
+	"2.5.4.8":  true,
+	"2.5.4.9":  true,
+	"2.5.4.10": true,
+	"2.5.4.11": true,
+	"2.5.4.17": true,
+}
+
+// apply copies the subject, names and allowed extensions of childCSR into template, whose Subject
+// and IsCA must already be set, and returns sans merged on top of the CSR's names. Attributes of
+// template.Subject override those of the CSR.
+func (options TrustCSROptions) apply(
+	template *x509.Certificate,
+	childCSR *x509.CertificateRequest,
+	sans kmssign.SubjectAltNames,
+) (kmssign.SubjectAltNames, error) {
+	if !options.Enabled {
+		return sans, nil
+	}
+
+	allowedExtensions := map[string]bool{}
+
+	for _, rawOID := range options.AllowedExtensions {
+		oid, err := profile.ParseOID(rawOID)
+
+		if err != nil {
+			return sans, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+
+		if name, ok := caExtensions[oid.String()]; ok {
+			return sans, fmt.Errorf(
+				"%w: The %s extension is set by the CA and cannot be copied from the CSR",
+				ErrInvalidInput,
+				name,
+			)
+		}
+
+		allowedExtensions[oid.String()] = true
+	}
+
+	// clients that match the common name may use any of them, but only the last is checked.
+	commonNames := 0
+
+	for _, attribute := range childCSR.Subject.Names {
+		if attribute.Type.Equal(commonNameOID) {
+			commonNames++
+		}
+	}
+
+	if commonNames > 1 {
+		return sans, fmt.Errorf(
+			"%w: The CSR subject has %d common names, at most one is allowed",
+			ErrInvalidInput,
+			commonNames,
+		)
+	}
+
+	// the names to check, which include the common name below.
+	csrSANs := kmssign.SubjectAltNames{
+		DNSNames:       append([]string{}, childCSR.DNSNames...),
+		IPAddresses:    append([]net.IP{}, childCSR.IPAddresses...),
+		EmailAddresses: append([]string{}, childCSR.EmailAddresses...),
+		URIs:           childCSR.URIs,
+	}
+
+	if commonName := childCSR.Subject.CommonName; template.Subject.CommonName == "" &&
+		!template.IsCA && commonName != "" {
+		switch ip := net.ParseIP(commonName); {
+		case ip != nil:
+			csrSANs.IPAddresses = append(csrSANs.IPAddresses, ip)
+
+		case strings.Contains(commonName, "@"):
+			csrSANs.EmailAddresses = append(csrSANs.EmailAddresses, commonName)
+
+		default:
+			csrSANs.DNSNames = append(csrSANs.DNSNames, commonName)
+		}
+	}
+
+	if err := options.AllowedSANs.Check(csrSANs); err != nil {
+		return sans, fmt.Errorf(
+			"%w: The CSR requests a name that is not allowed: %v",
+			ErrInvalidInput,
+			err,
+		)
+	}
+
+	if len(template.Subject.ToRDNSequence()) == 0 {
+		// the subject is encoded again from the checked attributes, in the CSR's order.
+		template.Subject = childCSR.Subject
+		template.Subject.ExtraNames = childCSR.Subject.Names
+	} else {
+		template.Subject = mergeName(childCSR.Subject, template.Subject)
+	}
+
+	for _, extension := range childCSR.Extensions {
+		switch {
+		case extension.Id.Equal(subjectAltNameOID):
+			continue
+
+		case allowedExtensions[extension.Id.String()]:
+			template.ExtraExtensions = append(template.ExtraExtensions, extension)
+
+		default:
+			fmt.Fprintf(
+				os.Stderr,
+				"Not copying CSR extension %s, which is not allowed\n",
+				extension.Id,
+			)
+		}
+	}
+
+	return kmssign.SubjectAltNames{
+		DNSNames:       mergeNames(childCSR.DNSNames, sans.DNSNames),
+		IPAddresses:    mergeNames(childCSR.IPAddresses, sans.IPAddresses),
+		EmailAddresses: mergeNames(childCSR.EmailAddresses, sans.EmailAddresses),
+		URIs:           mergeNames(childCSR.URIs, sans.URIs),
+		OtherNames:     sans.OtherNames,
+	}, nil
+}
+
+// mergeNames returns the requested names followed by the added ones not among them.
+func mergeNames[T any](requested, added []T) []T {
+	merged := append([]T{}, requested...)
+	seen := map[string]bool{}
+
+	for _, name := range requested {
+		seen[fmt.Sprint(name)] = true
+	}
+
+	for _, name := range added {
+		if !seen[fmt.Sprint(name)] {
+			merged = append(merged, name)
+			seen[fmt.Sprint(name)] = true
+		}
+	}
+
+	return merged
+}
+
+// mergeName returns name with the attributes set in overrides replaced.
+func mergeName(name, overrides pkix.Name) pkix.Name {
+	merged := name
+	merged.Names = nil
+	merged.ExtraNames = nil
+
+	// attributes without a pkix.Name field are only in Names after parsing.
+	for _, attribute := range name.Names {
+		if !nameFieldOIDs[attribute.Type.String()] {
+			merged.ExtraNames = append(merged.ExtraNames, attribute)
+		}
+	}
+
+	if overrides.CommonName != "" {
+		merged.CommonName = overrides.CommonName
+	}
+
+	if overrides.SerialNumber != "" {
+		merged.SerialNumber = overrides.SerialNumber
+	}
+
+	for _, field := range []struct {
+		merged    *[]string
+		overrides []string
+	}{
+		{&merged.Country, overrides.Country},
+		{&merged.Organization, overrides.Organization},
+		{&merged.OrganizationalUnit, overrides.OrganizationalUnit},
+		{&merged.Locality, overrides.Locality},
+		{&merged.Province, overrides.Province},
+		{&merged.StreetAddress, overrides.StreetAddress},
+		{&merged.PostalCode, overrides.PostalCode},
+	} {
+		if len(field.overrides) > 0 {
+			*field.merged = field.overrides
+		}
+	}
+
+	for _, override := range overrides.ExtraNames {
+		var extraNames []pkix.AttributeTypeAndValue
+
+		for _, attribute := range merged.ExtraNames {
+			if !attribute.Type.Equal(override.Type) {
+				extraNames = append(extraNames, attribute)
+			}
+		}
+
+		merged.ExtraNames = append(extraNames, override)
+	}
+
+	return merged
+}
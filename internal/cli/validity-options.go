@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+)
+
+// ValidityOptions chooses the validity period of a certificate.
+type ValidityOptions struct {
+	// Lifetime is the length of the validity period, from NotBefore. At most one of Lifetime and
+	// NotAfter can be set.
+	Lifetime time.Duration
+
+	// NotBefore and NotAfter are explicit bounds of the validity period. A zero NotBefore is the
+	// signing time.
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// Backdate moves a NotBefore of the signing time back, for relying parties whose clocks are
+	// behind. Lifetime still counts from the signing time, so the period ends as requested.
+	Backdate time.Duration
+
+	// ClampToParent shortens a validity period that ends after the parent certificate's instead of
+	// refusing it.
+	ClampToParent bool
+}
+
+// period returns the validity period of a certificate signed at now. notAfter is zero if neither
+// Lifetime nor NotAfter is set.
+func (options ValidityOptions) period(now time.Time) (time.Time, time.Time, error) {
+	switch {
+	case options.Lifetime < 0 || options.Backdate < 0:
+		return time.Time{}, time.Time{}, fmt.Errorf(
+			"%w: The validity and backdate cannot be negative",
+			ErrInvalidInput,
+		)
+
+	case options.Lifetime > 0 && !options.NotAfter.IsZero():
+		return time.Time{}, time.Time{}, fmt.Errorf(
+			"%w: A certificate cannot have both a lifetime and an explicit NotAfter",
+			ErrInvalidInput,
+		)
+
+	case options.Backdate > 0 && !options.NotBefore.IsZero():
+		return time.Time{}, time.Time{}, fmt.Errorf(
+			"%w: An explicit NotBefore cannot be backdated",
+			ErrInvalidInput,
+		)
+	}
+
+	start := options.NotBefore
+
+	if start.IsZero() {
+		start = now
+	}
+
+	notBefore := start.Add(-options.Backdate)
+	notAfter := options.NotAfter
+
+	if options.Lifetime > 0 {
+		notAfter = start.Add(options.Lifetime)
+	}
+
+	if !notAfter.IsZero() && !notAfter.After(notBefore) {
+		return time.Time{}, time.Time{}, fmt.Errorf(
+			"%w: The validity period ends at %s, before it starts at %s",
+			ErrInvalidInput,
+			notAfter.UTC().Format(time.RFC3339),
+			notBefore.UTC().Format(time.RFC3339),
+		)
+	}
+
+	return notBefore, notAfter, nil
+}
+
+// apply sets the validity period of template, signed at now, and checks it against parentCert, if
+// any.
+func (options ValidityOptions) apply(
+	template *x509.Certificate,
+	parentCert *x509.Certificate,
+	now time.Time,
+) error {
+	notBefore, notAfter, err := options.period(now)
+
+	if err != nil {
+		return err
+	}
+
+	if notAfter.IsZero() {
+		return fmt.Errorf("%w: A validity period is required", ErrInvalidInput)
+	}
+
+	template.NotBefore = notBefore
+	template.NotAfter = notAfter
+
+	if parentCert == nil {
+		return nil
+	}
+
+	return options.checkParent(template, parentCert)
+}
+
+// checkParent refuses a validity period of template that ends after parentCert's, as the
+// certificate could not be validated for the rest of it, or shortens it if ClampToParent is set.
+func (options ValidityOptions) checkParent(
+	template *x509.Certificate,
+	parentCert *x509.Certificate,
+) error {
+	// certificates only encode whole seconds.
+	if !template.NotAfter.Truncate(time.Second).After(parentCert.NotAfter) {
+		return nil
+	}
+
+	if !options.ClampToParent {
+		return fmt.Errorf(
+			"%w: The certificate would expire at %s, after its parent certificate at %s",
+			ErrInvalidInput,
+			template.NotAfter.UTC().Format(time.RFC3339),
+			parentCert.NotAfter.UTC().Format(time.RFC3339),
+		)
+	}
+
+	if !parentCert.NotAfter.After(template.NotBefore) {
+		return fmt.Errorf(
+			"%w: The parent certificate expires at %s, before the validity period starts at %s",
+			ErrInvalidInput,
+			parentCert.NotAfter.UTC().Format(time.RFC3339),
+			template.NotBefore.UTC().Format(time.RFC3339),
+		)
+	}
+
+	template.NotAfter = parentCert.NotAfter
+
+	fmt.Fprintf(
+		os.Stderr,
+		"Clamped the validity period to end with the parent certificate's, at %s\n",
+		template.NotAfter.UTC().Format(time.RFC3339),
+	)
+
+	return nil
+}
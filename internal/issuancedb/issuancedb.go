@@ -0,0 +1,385 @@
+// Package issuancedb records the certificates issued by google-kms-x509 in a bbolt database, as a
+// kmssign.IssuanceStore.
+package issuancedb
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/internal/ocspresponder"
+	"github.com/ericnorris/google-kms-x509/kmssign"
+	bolt "go.etcd.io/bbolt"
+)
+
+// openTimeout is how long to wait for another process to close the database.
+const openTimeout = 10 * time.Second
+
+// certificatesBucket holds a bucket per issuer, see IssuerID, mapping serial numbers to Records.
+var certificatesBucket = []byte("certificates")
+
+// serialNumberKeySize is the maximum size of a serial number, from RFC 5280 section 4.1.2.2. Keys
+// are padded to it so that bbolt orders them by serial number.
+const serialNumberKeySize = 20
+
+// ErrNotFound is returned for certificates that are not in the database.
+var ErrNotFound = errors.New("certificate not found")
+
+// ErrAlreadyRevoked is returned when revoking a certificate that has already been revoked.
+var ErrAlreadyRevoked = errors.New("certificate is already revoked")
+
+// Record is an issued certificate.
+type Record struct {
+	SerialNumber *big.Int
+	Subject      string
+
+	DNSNames       []string `json:",omitempty"`
+	IPAddresses    []net.IP `json:",omitempty"`
+	EmailAddresses []string `json:",omitempty"`
+	URIs           []string `json:",omitempty"`
+
+	Issuer   string
+	IssuerID string
+
+	// KeyVersionName is the KMS key version that signed the certificate.
+	KeyVersionName string
+
+	NotBefore time.Time
+	NotAfter  time.Time
+
+	// PEM is the PEM-encoded certificate.
+	PEM string
+
+	Requester string
+	IssuedAt  time.Time
+
+	// Revocation is set once the certificate has been revoked.
+	Revocation *Revocation `json:",omitempty"`
+}
+
+// Revocation records the revocation of a certificate.
+type Revocation struct {
+	RevokedAt time.Time
+
+	// Reason is the CRLReason code, see kmssign.RevocationReasons.
+	Reason int
+
+	// InvalidityDate is when the certificate's key is known or suspected to have been compromised,
+	// if known.
+	InvalidityDate *time.Time `json:",omitempty"`
+
+	// RecordedAt is when the revocation was recorded, which RevokedAt may precede. It is zero for
+	// revocations recorded by earlier versions.
+	RecordedAt time.Time `json:",omitempty"`
+}
+
+// Certificate parses the recorded certificate, which may have a secp256k1 key.
+func (record *Record) Certificate() (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(record.PEM))
+
+	if block == nil {
+		return nil, fmt.Errorf("Could not decode the certificate recorded for %s", record.Subject)
+	}
+
+	return kmssign.ParseCertificate(block.Bytes)
+}
+
+// DB is a bbolt database of issued certificates. The database file is only opened, and locked,
+// while it is being read or written, so that several processes can share it.
+type DB struct {
+	path string
+}
+
+var _ kmssign.IssuanceStore = (*DB)(nil)
+
+// New returns a DB for the database file at path, which is created on first use.
+func New(path string) *DB {
+	return &DB{path: path}
+}
+
+// IssuerID identifies an issuer in the database by its subject key identifier, or, for
+// certificates without one, by the SHA-1 hash of its SubjectPublicKeyInfo.
+func IssuerID(issuer *x509.Certificate) string {
+	if len(issuer.SubjectKeyId) > 0 {
+		return hex.EncodeToString(issuer.SubjectKeyId)
+	}
+
+	hash := sha1.Sum(issuer.RawSubjectPublicKeyInfo)
+
+	return hex.EncodeToString(hash[:])
+}
+
+func (db *DB) update(fn func(tx *bolt.Tx) error) error {
+	boltDB, err := bolt.Open(db.path, 0600, &bolt.Options{Timeout: openTimeout})
+
+	if err != nil {
+		return fmt.Errorf("Could not open issuance database %s: %w", db.path, err)
+	}
+
+	defer boltDB.Close()
+
+	return boltDB.Update(fn)
+}
+
+func (db *DB) view(fn func(tx *bolt.Tx) error) error {
+	// bbolt cannot create a missing file when opening it read-only, and fails with EBADF.
+	if _, err := os.Stat(db.path); err != nil {
+		return fmt.Errorf("Could not open issuance database: %w", err)
+	}
+
+	boltDB, err := bolt.Open(db.path, 0600, &bolt.Options{Timeout: openTimeout, ReadOnly: true})
+
+	if err != nil {
+		return fmt.Errorf("Could not open issuance database %s: %w", db.path, err)
+	}
+
+	defer boltDB.Close()
+
+	return boltDB.View(fn)
+}
+
+// RecordCertificate records an issued certificate, unless its issuer has already issued a
+// certificate with the same serial number.
+func (db *DB) RecordCertificate(ctx context.Context, issued *kmssign.IssuedCertificate) error {
+	certificate := issued.Certificate
+	issuerID := IssuerID(issued.Issuer)
+
+	record := &Record{
+		SerialNumber:   certificate.SerialNumber,
+		Subject:        certificate.Subject.String(),
+		DNSNames:       certificate.DNSNames,
+		IPAddresses:    certificate.IPAddresses,
+		EmailAddresses: certificate.EmailAddresses,
+		Issuer:         issued.Issuer.Subject.String(),
+		IssuerID:       issuerID,
+		KeyVersionName: issued.KeyVersionName,
+		NotBefore:      certificate.NotBefore,
+		NotAfter:       certificate.NotAfter,
+		PEM: string(pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: certificate.Raw,
+		})),
+		Requester: issued.Requester,
+		IssuedAt:  time.Now().UTC(),
+	}
+
+	for _, uri := range certificate.URIs {
+		record.URIs = append(record.URIs, uri.String())
+	}
+
+	value, err := json.Marshal(record)
+
+	if err != nil {
+		return err
+	}
+
+	return db.update(func(tx *bolt.Tx) error {
+		certificates, err := tx.CreateBucketIfNotExists(certificatesBucket)
+
+		if err != nil {
+			return err
+		}
+
+		issuerCertificates, err := certificates.CreateBucketIfNotExists([]byte(issuerID))
+
+		if err != nil {
+			return err
+		}
+
+		key, err := serialNumberKey(certificate.SerialNumber)
+
+		if err != nil {
+			return err
+		}
+
+		if issuerCertificates.Get(key) != nil {
+			return fmt.Errorf(
+				"%w: %s by %s",
+				kmssign.ErrSerialNumberCollision,
+				certificate.SerialNumber,
+				record.Issuer,
+			)
+		}
+
+		return issuerCertificates.Put(key, value)
+	})
+}
+
+// Certificate returns the record of the certificate with serialNumber issued by issuer, or an
+// error wrapping ErrNotFound.
+func (db *DB) Certificate(issuer *x509.Certificate, serialNumber *big.Int) (*Record, error) {
+	var record *Record
+
+	err := db.view(func(tx *bolt.Tx) error {
+		issuerCertificates := issuerBucket(tx, IssuerID(issuer))
+
+		if issuerCertificates == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, serialNumber)
+		}
+
+		key, err := serialNumberKey(serialNumber)
+
+		if err != nil {
+			return err
+		}
+
+		value := issuerCertificates.Get(key)
+
+		if value == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, serialNumber)
+		}
+
+		record = &Record{}
+
+		return json.Unmarshal(value, record)
+	})
+
+	return record, err
+}
+
+// CertificateStatuses returns the status of the certificates issued by issuer, keyed by their
+// decimal serial numbers, for an OCSP responder.
+func (db *DB) CertificateStatuses(
+	issuer *x509.Certificate,
+) (map[string]ocspresponder.CertificateStatus, error) {
+	statuses := map[string]ocspresponder.CertificateStatus{}
+
+	err := db.view(func(tx *bolt.Tx) error {
+		issuerCertificates := issuerBucket(tx, IssuerID(issuer))
+
+		if issuerCertificates == nil {
+			return nil
+		}
+
+		return issuerCertificates.ForEach(func(_, value []byte) error {
+			record := &Record{}
+
+			if err := json.Unmarshal(value, record); err != nil {
+				return err
+			}
+
+			status := ocspresponder.CertificateStatus{Status: kmssign.OCSPGood}
+
+			if record.Revocation != nil {
+				status = ocspresponder.CertificateStatus{
+					Status:           kmssign.OCSPRevoked,
+					RevokedAt:        record.Revocation.RevokedAt,
+					RevocationReason: record.Revocation.Reason,
+				}
+			}
+
+			statuses[record.SerialNumber.String()] = status
+
+			return nil
+		})
+	})
+
+	return statuses, err
+}
+
+// Revoke records the revocation of the certificate with serialNumber issued by the issuer with
+// issuerID, see IssuerID, and returns its updated record. It returns an error wrapping ErrNotFound
+// or ErrAlreadyRevoked, and changes nothing, if the certificate is unknown or already revoked.
+func (db *DB) Revoke(
+	issuerID string,
+	serialNumber *big.Int,
+	revocation *Revocation,
+) (*Record, error) {
+	var record *Record
+
+	err := db.update(func(tx *bolt.Tx) error {
+		issuerCertificates := issuerBucket(tx, issuerID)
+
+		if issuerCertificates == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, serialNumber)
+		}
+
+		key, err := serialNumberKey(serialNumber)
+
+		if err != nil {
+			return err
+		}
+
+		value := issuerCertificates.Get(key)
+
+		if value == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, serialNumber)
+		}
+
+		record = &Record{}
+
+		if err := json.Unmarshal(value, record); err != nil {
+			return err
+		}
+
+		if record.Revocation != nil {
+			return fmt.Errorf("%w: %s", ErrAlreadyRevoked, serialNumber)
+		}
+
+		revocation.RecordedAt = time.Now().UTC()
+		record.Revocation = revocation
+
+		if value, err = json.Marshal(record); err != nil {
+			return err
+		}
+
+		return issuerCertificates.Put(key, value)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// ForEach calls fn with the record of every issued certificate, grouped by issuer and in order of
+// serial number, until fn returns an error.
+func (db *DB) ForEach(fn func(record *Record) error) error {
+	return db.view(func(tx *bolt.Tx) error {
+		certificates := tx.Bucket(certificatesBucket)
+
+		if certificates == nil {
+			return nil
+		}
+
+		return certificates.ForEachBucket(func(issuerID []byte) error {
+			return certificates.Bucket(issuerID).ForEach(func(_, value []byte) error {
+				var record Record
+
+				if err := json.Unmarshal(value, &record); err != nil {
+					return err
+				}
+
+				return fn(&record)
+			})
+		})
+	})
+}
+
+func issuerBucket(tx *bolt.Tx, issuerID string) *bolt.Bucket {
+	certificates := tx.Bucket(certificatesBucket)
+
+	if certificates == nil {
+		return nil
+	}
+
+	return certificates.Bucket([]byte(issuerID))
+}
+
+func serialNumberKey(serialNumber *big.Int) ([]byte, error) {
+	if serialNumber.Sign() < 0 || len(serialNumber.Bytes()) > serialNumberKeySize {
+		return nil, fmt.Errorf("Serial number %s is out of range", serialNumber)
+	}
+
+	return serialNumber.FillBytes(make([]byte, serialNumberKeySize)), nil
+}
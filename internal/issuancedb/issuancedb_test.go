@@ -0,0 +1,172 @@
+package issuancedb
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/kmssign"
+)
+
+// testCertificate returns a self-signed certificate with the given serial number.
+func testCertificate(t *testing.T, commonName string, serialNumber int64) *x509.Certificate {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serialNumber),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{commonName},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	raw, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := x509.ParseCertificate(raw)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certificate
+}
+
+func TestDB(t *testing.T) {
+	db := New(filepath.Join(t.TempDir(), "issued.db"))
+	ctx := context.Background()
+
+	issuer := testCertificate(t, "issuer.example.com", 1)
+	otherIssuer := testCertificate(t, "other.example.com", 1)
+
+	for _, issued := range []*kmssign.IssuedCertificate{
+		{Certificate: testCertificate(t, "b.example.com", 256), Issuer: issuer},
+		{Certificate: testCertificate(t, "a.example.com", 2), Issuer: issuer, Requester: "alice"},
+		{Certificate: testCertificate(t, "c.example.com", 2), Issuer: otherIssuer},
+	} {
+		if err := db.RecordCertificate(ctx, issued); err != nil {
+			t.Fatalf("RecordCertificate(%s) failed: %v", issued.Certificate.Subject, err)
+		}
+	}
+
+	err := db.RecordCertificate(ctx, &kmssign.IssuedCertificate{
+		Certificate: testCertificate(t, "d.example.com", 2),
+		Issuer:      issuer,
+	})
+
+	if !errors.Is(err, kmssign.ErrSerialNumberCollision) {
+		t.Errorf("RecordCertificate() with a used serial number = %v, want a collision", err)
+	}
+
+	record, err := db.Certificate(issuer, big.NewInt(2))
+
+	if err != nil {
+		t.Fatalf("Certificate() failed: %v", err)
+	}
+
+	if record.Subject != "CN=a.example.com" || record.Requester != "alice" ||
+		record.Issuer != "CN=issuer.example.com" || len(record.DNSNames) != 1 {
+		t.Errorf("Certificate() = %+v", record)
+	}
+
+	if _, err := db.Certificate(issuer, big.NewInt(3)); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Certificate() for an unknown serial number = %v, want ErrNotFound", err)
+	}
+
+	var subjects []string
+
+	err = db.ForEach(func(record *Record) error {
+		if record.IssuerID == IssuerID(issuer) {
+			subjects = append(subjects, record.Subject)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("ForEach() failed: %v", err)
+	}
+
+	if len(subjects) != 2 || subjects[0] != "CN=a.example.com" {
+		t.Errorf("ForEach() visited %v, want a.example.com then b.example.com", subjects)
+	}
+
+	revokedAt := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	record, err = db.Revoke(IssuerID(issuer), big.NewInt(2), &Revocation{
+		RevokedAt: revokedAt,
+		Reason:    1,
+	})
+
+	if err != nil {
+		t.Fatalf("Revoke() failed: %v", err)
+	}
+
+	if record.Subject != "CN=a.example.com" {
+		t.Errorf("Revoke() revoked %s, want a.example.com", record.Subject)
+	}
+
+	_, err = db.Revoke(IssuerID(issuer), big.NewInt(2), &Revocation{RevokedAt: revokedAt})
+
+	if !errors.Is(err, ErrAlreadyRevoked) {
+		t.Errorf("Revoke() of a revoked certificate = %v, want ErrAlreadyRevoked", err)
+	}
+
+	_, err = db.Revoke(IssuerID(issuer), big.NewInt(3), &Revocation{RevokedAt: revokedAt})
+
+	if !errors.Is(err, ErrNotFound) {
+		t.Errorf("Revoke() of an unknown certificate = %v, want ErrNotFound", err)
+	}
+
+	if record, err = db.Certificate(issuer, big.NewInt(2)); err != nil {
+		t.Fatalf("Certificate() failed: %v", err)
+	}
+
+	if record.Revocation == nil || !record.Revocation.RevokedAt.Equal(revokedAt) ||
+		record.Revocation.Reason != 1 || record.Revocation.RecordedAt.IsZero() {
+		t.Errorf("Certificate().Revocation = %+v", record.Revocation)
+	}
+
+	statuses, err := db.CertificateStatuses(issuer)
+
+	if err != nil {
+		t.Fatalf("CertificateStatuses() failed: %v", err)
+	}
+
+	if len(statuses) != 2 || statuses["256"].Status != kmssign.OCSPGood ||
+		statuses["2"].Status != kmssign.OCSPRevoked || !statuses["2"].RevokedAt.Equal(revokedAt) ||
+		statuses["2"].RevocationReason != 1 {
+		t.Errorf("CertificateStatuses() = %+v, want 2 revoked and 256 good", statuses)
+	}
+
+	if record, err = db.Certificate(otherIssuer, big.NewInt(2)); err != nil {
+		t.Fatalf("Certificate() failed: %v", err)
+	}
+
+	if record.Revocation != nil {
+		t.Errorf("Revoke() revoked the certificate of another issuer")
+	}
+
+	certificate, err := record.Certificate()
+
+	if err != nil || certificate.Subject.CommonName != "c.example.com" {
+		t.Errorf("Record.Certificate() = %v, %v", certificate, err)
+	}
+}
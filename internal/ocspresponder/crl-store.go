@@ -0,0 +1,180 @@
+package ocspresponder
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/kmssign"
+)
+
+// ErrCRLExpired is returned by CRLStore once one of its CRLs has passed its nextUpdate, until a
+// newer CRL is loaded.
+var ErrCRLExpired = errors.New("CRL has passed its nextUpdate")
+
+// IssuedCertificates reports the status of the certificates issued by an issuer, such as an
+// issuance database, keyed by their decimal serial numbers.
+type IssuedCertificates interface {
+	CertificateStatuses(issuer *x509.Certificate) (map[string]CertificateStatus, error)
+}
+
+// CRLStore is a Store backed by the certificates issued by the responder's issuer and, optionally,
+// CRL files it issued, such as those written by 'google-kms-x509 sign crl'. Certificates revoked in
+// either are reported as revoked, and certificates that were never issued as unknown, as required
+// by RFC 6960 section 2.2.
+type CRLStore struct {
+	issuer *x509.Certificate
+	issued IssuedCertificates
+	paths  []string
+	now    func() time.Time
+
+	mu         sync.RWMutex
+	statuses   map[string]CertificateStatus
+	nextUpdate time.Time
+}
+
+// NewCRLStore returns a CRLStore reading the certificates issued by issuer from issued, and the
+// PEM or DER-encoded CRLs at paths, which may include delta CRLs.
+func NewCRLStore(
+	issuer *x509.Certificate,
+	issued IssuedCertificates,
+	paths ...string,
+) (*CRLStore, error) {
+	store := &CRLStore{issuer: issuer, issued: issued, paths: paths, now: time.Now}
+
+	if err := store.Reload(); err != nil {
+		return nil, err
+	}
+
+	return store, nil
+}
+
+func (store *CRLStore) CertificateStatus(serialNumber *big.Int) (CertificateStatus, error) {
+	store.mu.RLock()
+	defer store.mu.RUnlock()
+
+	if !store.nextUpdate.IsZero() && store.now().After(store.nextUpdate) {
+		return CertificateStatus{}, fmt.Errorf("%w: %s", ErrCRLExpired, store.nextUpdate)
+	}
+
+	if status, ok := store.statuses[serialNumber.String()]; ok {
+		return status, nil
+	}
+
+	return CertificateStatus{Status: kmssign.OCSPUnknown}, nil
+}
+
+// Reload reads the issued certificates and the CRLs again. Certificates revoked on the CRLs but
+// not in the issued certificates are reported as revoked too. CRLs are applied in order of their
+// CRL numbers, so that certificates a later delta CRL lists with the removeFromCRL reason are no
+// longer revoked by the CRLs. The store expires at the earliest nextUpdate of the CRLs.
+func (store *CRLStore) Reload() error {
+	statuses, err := store.issued.CertificateStatuses(store.issuer)
+
+	if err != nil {
+		return fmt.Errorf("Could not read the issued certificates: %w", err)
+	}
+
+	if statuses == nil {
+		statuses = map[string]CertificateStatus{}
+	}
+
+	var revocationLists []*x509.RevocationList
+	var nextUpdate time.Time
+
+	for _, path := range store.paths {
+		revocationList, err := store.readCRL(path)
+
+		if err != nil {
+			return err
+		}
+
+		revocationLists = append(revocationLists, revocationList)
+
+		if revocationList.NextUpdate.IsZero() {
+			continue
+		}
+
+		if nextUpdate.IsZero() || revocationList.NextUpdate.Before(nextUpdate) {
+			nextUpdate = revocationList.NextUpdate
+		}
+	}
+
+	sort.SliceStable(revocationLists, func(i, j int) bool {
+		return crlNumber(revocationLists[i]).Cmp(crlNumber(revocationLists[j])) < 0
+	})
+
+	revoked := map[string]CertificateStatus{}
+
+	for _, revocationList := range revocationLists {
+		for _, entry := range revocationList.RevokedCertificateEntries {
+			if entry.ReasonCode == kmssign.RevocationReasons["removeFromCRL"] {
+				delete(revoked, entry.SerialNumber.String())
+
+				continue
+			}
+
+			revoked[entry.SerialNumber.String()] = CertificateStatus{
+				Status:           kmssign.OCSPRevoked,
+				RevokedAt:        entry.RevocationTime,
+				RevocationReason: entry.ReasonCode,
+			}
+		}
+	}
+
+	for serialNumber, status := range revoked {
+		if statuses[serialNumber].Status != kmssign.OCSPRevoked {
+			statuses[serialNumber] = status
+		}
+	}
+
+	store.mu.Lock()
+	store.statuses = statuses
+	store.nextUpdate = nextUpdate
+	store.mu.Unlock()
+
+	return nil
+}
+
+func (store *CRLStore) readCRL(path string) (*x509.RevocationList, error) {
+	data, err := os.ReadFile(path)
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not read CRL: %w", err)
+	}
+
+	if block, _ := pem.Decode(data); block != nil {
+		if block.Type != "X509 CRL" {
+			return nil, fmt.Errorf("Failed to decode PEM-formatted CRL %s", path)
+		}
+
+		data = block.Bytes
+	}
+
+	revocationList, err := x509.ParseRevocationList(data)
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse CRL %s: %w", path, err)
+	}
+
+	if err := revocationList.CheckSignatureFrom(store.issuer); err != nil {
+		return nil, fmt.Errorf("CRL %s was not issued by %s: %w", path, store.issuer.Subject, err)
+	}
+
+	return revocationList, nil
+}
+
+// crlNumber returns the CRL number of revocationList, or zero for CRLs without one.
+func crlNumber(revocationList *x509.RevocationList) *big.Int {
+	if revocationList.Number == nil {
+		return new(big.Int)
+	}
+
+	return revocationList.Number
+}
@@ -0,0 +1,481 @@
+// Package ocspresponder answers RFC 6960 OCSP requests over HTTP for the certificates of a single
+// issuer, with responses signed by a kmssign.GoogleKMSSigner.
+package ocspresponder
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/kmssign"
+)
+
+// maxRequestSize bounds the size of POSTed OCSP requests.
+const maxRequestSize = 64 * 1024
+
+// defaultMaxCachedResponses is the number of pre-signed responses kept when
+// Config.MaxCachedResponses is not set.
+const defaultMaxCachedResponses = 10000
+
+// CertificateStatus is the revocation status of a certificate.
+type CertificateStatus struct {
+	Status kmssign.OCSPCertStatus
+
+	// RevokedAt and RevocationReason are only set for revoked certificates.
+	RevokedAt        time.Time
+	RevocationReason int
+}
+
+// Store looks up the status of certificates issued by the responder's issuer. Requests are answered
+// with tryLater while CertificateStatus returns an error wrapping ErrCRLExpired.
+type Store interface {
+	CertificateStatus(serialNumber *big.Int) (CertificateStatus, error)
+
+	// Reload re-reads the store's source, and is called before pre-signed responses are
+	// refreshed.
+	Reload() error
+}
+
+// Config configures a Responder.
+type Config struct {
+	// Signer signs responses. Its key is either the issuer's key, or the key of
+	// ResponderCertificate.
+	Signer *kmssign.GoogleKMSSigner
+
+	// Issuer is the CA whose certificates the responder answers for. Requests for other issuers
+	// get the unauthorized response.
+	Issuer *x509.Certificate
+
+	// ResponderCertificate is a delegated OCSP responder certificate issued by Issuer, included in
+	// every response. Nil when Signer uses the issuer's key.
+	ResponderCertificate *x509.Certificate
+
+	Store Store
+
+	// Validity is the time between thisUpdate and nextUpdate in each response.
+	Validity time.Duration
+
+	// RefreshInterval is how often pre-signed responses are signed again. It must be shorter than
+	// Validity, so that cached responses never expire.
+	RefreshInterval time.Duration
+
+	// MaxCachedResponses bounds the number of pre-signed responses. Once it is reached, the oldest
+	// response is evicted. Zero uses a default of 10000.
+	MaxCachedResponses int
+}
+
+type cacheKey struct {
+	hashAlgorithm crypto.Hash
+	serialNumber  string
+}
+
+type cachedResponse struct {
+	certID   kmssign.OCSPCertID
+	response []byte
+	signedAt time.Time
+}
+
+// Responder is an http.Handler answering OCSP requests.
+type Responder struct {
+	config Config
+	now    func() time.Time
+
+	mu    sync.Mutex
+	cache map[cacheKey]*cachedResponse
+}
+
+// New returns a Responder for config, after checking the delegated responder certificate if any,
+// which must be valid now.
+func New(config Config) (*Responder, error) {
+	if config.Validity <= 0 || config.RefreshInterval <= 0 {
+		return nil, fmt.Errorf("The response validity and refresh interval must be positive")
+	}
+
+	if config.RefreshInterval >= config.Validity {
+		return nil, fmt.Errorf(
+			"The refresh interval %s must be shorter than the response validity %s",
+			config.RefreshInterval,
+			config.Validity,
+		)
+	}
+
+	if config.MaxCachedResponses <= 0 {
+		config.MaxCachedResponses = defaultMaxCachedResponses
+	}
+
+	if config.ResponderCertificate != nil {
+		err := checkResponderCertificate(config.ResponderCertificate, config.Issuer, time.Now())
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Responder{
+		config: config,
+		now:    time.Now,
+		cache:  map[cacheKey]*cachedResponse{},
+	}, nil
+}
+
+// checkResponderCertificate returns an error unless responderCert is a delegated OCSP responder
+// certificate issued by issuer, as described in RFC 6960 section 4.2.2.2, that is valid at now.
+func checkResponderCertificate(responderCert, issuer *x509.Certificate, now time.Time) error {
+	if err := checkResponderValidity(responderCert, now); err != nil {
+		return err
+	}
+
+	if err := responderCert.CheckSignatureFrom(issuer); err != nil {
+		return fmt.Errorf("The responder certificate was not issued by the issuer: %w", err)
+	}
+
+	for _, extKeyUsage := range responderCert.ExtKeyUsage {
+		if extKeyUsage == x509.ExtKeyUsageOCSPSigning {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("The responder certificate does not have the OCSPSigning extended key usage")
+}
+
+var errResponderCertificateInvalid = errors.New("the responder certificate is not valid")
+
+// checkResponderValidity returns an error wrapping errResponderCertificateInvalid if responderCert
+// is not valid at now, as clients refuse the responses it signs.
+func checkResponderValidity(responderCert *x509.Certificate, now time.Time) error {
+	if now.Before(responderCert.NotBefore) || now.After(responderCert.NotAfter) {
+		return fmt.Errorf(
+			"%w: it is valid from %s to %s",
+			errResponderCertificateInvalid,
+			responderCert.NotBefore,
+			responderCert.NotAfter,
+		)
+	}
+
+	return nil
+}
+
+// Run refreshes pre-signed responses every RefreshInterval until ctx is done.
+func (responder *Responder) Run(ctx context.Context) {
+	ticker := time.NewTicker(responder.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case <-ticker.C:
+			if err := responder.Refresh(ctx); err != nil {
+				log.Printf("Could not refresh OCSP responses: %v", err)
+			}
+		}
+	}
+}
+
+// Refresh reloads the store, and signs every cached response again. Responses that cannot be
+// signed are logged and left in the cache, to be signed again when they are next requested. Once
+// the responder certificate has expired, the cache is emptied and nothing is signed.
+func (responder *Responder) Refresh(ctx context.Context) error {
+	if responderCert := responder.config.ResponderCertificate; responderCert != nil {
+		if err := checkResponderValidity(responderCert, responder.now()); err != nil {
+			responder.mu.Lock()
+			responder.cache = map[cacheKey]*cachedResponse{}
+			responder.mu.Unlock()
+
+			return err
+		}
+	}
+
+	if err := responder.config.Store.Reload(); err != nil {
+		return err
+	}
+
+	responder.mu.Lock()
+	var certIDs []kmssign.OCSPCertID
+
+	for _, cached := range responder.cache {
+		certIDs = append(certIDs, cached.certID)
+	}
+
+	responder.mu.Unlock()
+
+	for _, certID := range certIDs {
+		if _, err := responder.presign(ctx, certID); err != nil {
+			log.Printf("Could not refresh the OCSP response for %s: %v", certID.SerialNumber, err)
+		}
+	}
+
+	return nil
+}
+
+func (responder *Responder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var der []byte
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		der, err = decodeGetRequest(r.URL)
+
+	case http.MethodPost:
+		der, err = io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+
+		return
+	}
+
+	if err != nil {
+		responder.writeResponse(w, kmssign.OCSPErrorResponse(kmssign.OCSPMalformedRequest), 0)
+
+		return
+	}
+
+	request, err := kmssign.ParseOCSPRequest(der)
+
+	if err != nil {
+		responder.writeResponse(w, kmssign.OCSPErrorResponse(kmssign.OCSPMalformedRequest), 0)
+
+		return
+	}
+
+	response, maxAge, err := responder.respond(r.Context(), request)
+
+	if errors.Is(err, errUnauthorized) {
+		responder.writeResponse(w, kmssign.OCSPErrorResponse(kmssign.OCSPUnauthorized), 0)
+	} else if errors.Is(err, ErrCRLExpired) {
+		log.Printf("Could not answer OCSP request: %v", err)
+		responder.writeResponse(w, kmssign.OCSPErrorResponse(kmssign.OCSPTryLater), 0)
+	} else if err != nil {
+		log.Printf("Could not answer OCSP request: %v", err)
+		responder.writeResponse(w, kmssign.OCSPErrorResponse(kmssign.OCSPInternalError), 0)
+	} else if r.Method == http.MethodGet {
+		responder.writeResponse(w, response, maxAge)
+	} else {
+		responder.writeResponse(w, response, 0)
+	}
+}
+
+// decodeGetRequest returns the OCSP request in the path of a GET request, which is base64-encoded
+// and then URL-encoded.
+func decodeGetRequest(requestURL *url.URL) ([]byte, error) {
+	encoded := strings.TrimPrefix(requestURL.Path, "/")
+
+	der, err := base64.StdEncoding.DecodeString(encoded)
+
+	if err != nil {
+		der, err = base64.RawURLEncoding.DecodeString(strings.TrimRight(encoded, "="))
+	}
+
+	return der, err
+}
+
+func (responder *Responder) writeResponse(
+	w http.ResponseWriter,
+	response []byte,
+	maxAge time.Duration,
+) {
+	w.Header().Set("Content-Type", "application/ocsp-response")
+
+	if maxAge > 0 {
+		w.Header().Set(
+			"Cache-Control",
+			fmt.Sprintf("max-age=%d, public, no-transform, must-revalidate", int(maxAge.Seconds())),
+		)
+	}
+
+	w.Write(response)
+}
+
+var errUnauthorized = errors.New("request for an unknown issuer")
+
+// respond returns a signed response for the request, and how long it may be cached. Requests for a
+// single certificate without a nonce are answered from the pre-signed cache.
+func (responder *Responder) respond(
+	ctx context.Context,
+	request *kmssign.OCSPRequest,
+) ([]byte, time.Duration, error) {
+	for _, certID := range request.CertIDs {
+		if !certID.IssuedBy(responder.config.Issuer) {
+			return nil, 0, errUnauthorized
+		}
+	}
+
+	// responses cached before the responder certificate expired are not served either.
+	if responderCert := responder.config.ResponderCertificate; responderCert != nil {
+		if err := checkResponderValidity(responderCert, responder.now()); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	if len(request.CertIDs) == 1 && request.Nonce == nil {
+		cached, err := responder.cached(ctx, request.CertIDs[0])
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		maxAge := cached.signedAt.Add(responder.config.Validity).Sub(responder.now())
+
+		return cached.response, maxAge, nil
+	}
+
+	now := responder.now()
+	singleResponses := make([]kmssign.OCSPSingleResponse, 0, len(request.CertIDs))
+
+	for _, certID := range request.CertIDs {
+		singleResponse, err := responder.singleResponse(certID, now)
+
+		if err != nil {
+			return nil, 0, err
+		}
+
+		singleResponses = append(singleResponses, singleResponse)
+	}
+
+	response, err := responder.sign(ctx, singleResponses, request.Nonce, now)
+
+	return response, 0, err
+}
+
+func (responder *Responder) cached(
+	ctx context.Context,
+	certID kmssign.OCSPCertID,
+) (*cachedResponse, error) {
+	responder.mu.Lock()
+	cached := responder.cache[newCacheKey(certID)]
+	responder.mu.Unlock()
+
+	if cached != nil && responder.now().Sub(cached.signedAt) < responder.config.RefreshInterval {
+		return cached, nil
+	}
+
+	return responder.presign(ctx, certID)
+}
+
+// presign signs a response for certID without a nonce, and caches it if the certificate was
+// issued. Responses for unknown certificates are not cached, so that requests for arbitrary serial
+// numbers cannot fill the cache.
+func (responder *Responder) presign(
+	ctx context.Context,
+	certID kmssign.OCSPCertID,
+) (*cachedResponse, error) {
+	now := responder.now()
+
+	singleResponse, err := responder.singleResponse(certID, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := responder.sign(ctx, []kmssign.OCSPSingleResponse{singleResponse}, nil, now)
+
+	if err != nil {
+		return nil, err
+	}
+
+	cached := &cachedResponse{certID: certID, response: response, signedAt: now}
+	key := newCacheKey(certID)
+
+	responder.mu.Lock()
+	defer responder.mu.Unlock()
+
+	if singleResponse.Status == kmssign.OCSPUnknown {
+		delete(responder.cache, key)
+
+		return cached, nil
+	}
+
+	_, replacing := responder.cache[key]
+
+	if !replacing && len(responder.cache) >= responder.config.MaxCachedResponses {
+		responder.evictOldest()
+	}
+
+	responder.cache[key] = cached
+
+	return cached, nil
+}
+
+// evictOldest removes the response signed the longest time ago from the cache. The caller must
+// hold mu.
+func (responder *Responder) evictOldest() {
+	var oldestKey cacheKey
+	var oldest *cachedResponse
+
+	for key, cached := range responder.cache {
+		if oldest == nil || cached.signedAt.Before(oldest.signedAt) {
+			oldestKey, oldest = key, cached
+		}
+	}
+
+	delete(responder.cache, oldestKey)
+}
+
+func newCacheKey(certID kmssign.OCSPCertID) cacheKey {
+	return cacheKey{
+		hashAlgorithm: certID.HashAlgorithm,
+		serialNumber:  certID.SerialNumber.String(),
+	}
+}
+
+// singleResponse looks up the status of the certificate identified by certID.
+func (responder *Responder) singleResponse(
+	certID kmssign.OCSPCertID,
+	now time.Time,
+) (kmssign.OCSPSingleResponse, error) {
+	status, err := responder.config.Store.CertificateStatus(certID.SerialNumber)
+
+	if err != nil {
+		return kmssign.OCSPSingleResponse{}, fmt.Errorf(
+			"Could not look up certificate %s: %w",
+			certID.SerialNumber,
+			err,
+		)
+	}
+
+	return kmssign.OCSPSingleResponse{
+		CertID:           certID,
+		Status:           status.Status,
+		RevokedAt:        status.RevokedAt,
+		RevocationReason: status.RevocationReason,
+		ThisUpdate:       now,
+		NextUpdate:       now.Add(responder.config.Validity),
+	}, nil
+}
+
+func (responder *Responder) sign(
+	ctx context.Context,
+	singleResponses []kmssign.OCSPSingleResponse,
+	nonce []byte,
+	now time.Time,
+) ([]byte, error) {
+	template := &kmssign.OCSPResponse{
+		ProducedAt: now,
+		Nonce:      nonce,
+		Responses:  singleResponses,
+	}
+
+	if responderCert := responder.config.ResponderCertificate; responderCert != nil {
+		if err := checkResponderValidity(responderCert, now); err != nil {
+			return nil, err
+		}
+
+		template.Certificates = []*x509.Certificate{responderCert}
+	}
+
+	return responder.config.Signer.CreateOCSPResponseContext(ctx, template)
+}
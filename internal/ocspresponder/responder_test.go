@@ -0,0 +1,717 @@
+package ocspresponder
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/ericnorris/google-kms-x509/kmssign"
+	"github.com/ericnorris/google-kms-x509/kmssign/kmsfake"
+	"golang.org/x/crypto/ocsp"
+)
+
+const testCryptoKeys = "projects/test/locations/global/keyRings/test/cryptoKeys/"
+
+type testPKI struct {
+	client *kmsfake.KeyManagementClient
+	signer *kmssign.GoogleKMSSigner
+	root   *x509.Certificate
+	good   *x509.Certificate
+	bad    *x509.Certificate
+	crl    string
+
+	// issued holds good and bad as good, the latter only being revoked by the CRL.
+	issued issuedStatuses
+
+	// unissued is signed by the root, but not in the issued certificates.
+	unissued *x509.Certificate
+}
+
+// issuedStatuses is an IssuedCertificates with fixed statuses.
+type issuedStatuses map[string]CertificateStatus
+
+func (issued issuedStatuses) CertificateStatuses(
+	*x509.Certificate,
+) (map[string]CertificateStatus, error) {
+	statuses := make(map[string]CertificateStatus, len(issued))
+
+	for serialNumber, status := range issued {
+		statuses[serialNumber] = status
+	}
+
+	return statuses, nil
+}
+
+func newTestSigner(
+	t *testing.T,
+	client *kmsfake.KeyManagementClient,
+	name string,
+	certificate *x509.Certificate,
+) *kmssign.GoogleKMSSigner {
+	t.Helper()
+
+	version, err := client.AddSigningKey(
+		context.Background(),
+		testCryptoKeys+name,
+		kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := kmssign.NewGoogleKMSSignerWithCertificate(
+		context.Background(),
+		client,
+		version.Name,
+		certificate,
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return signer
+}
+
+func issue(
+	t *testing.T,
+	signer *kmssign.GoogleKMSSigner,
+	template *x509.Certificate,
+	publicKey crypto.PublicKey,
+) *x509.Certificate {
+	t.Helper()
+
+	if template.NotAfter.IsZero() {
+		template.NotBefore = time.Now()
+		template.NotAfter = time.Now().Add(time.Hour)
+	}
+
+	var raw []byte
+	var err error
+
+	if publicKey == nil {
+		raw, err = signer.CreateSelfSignedCertificate(template, false)
+	} else {
+		raw, err = signer.CreateCertificate(template, publicKey, false)
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certificate, err := kmssign.ParseCertificate(raw)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return certificate
+}
+
+// newTestPKI creates a root CA with two issued leaf certificates, one of which is on the root's
+// CRL, and a leaf certificate that is not in the issued certificates.
+func newTestPKI(t *testing.T) *testPKI {
+	t.Helper()
+
+	pki := &testPKI{client: kmsfake.NewKeyManagementClient()}
+
+	rootSigner := newTestSigner(t, pki.client, "root", nil)
+
+	pki.root = issue(t, rootSigner, &x509.Certificate{
+		Subject:               pkix.Name{CommonName: "root"},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}, nil)
+
+	signer, err := kmssign.NewGoogleKMSSignerWithCertificate(
+		context.Background(),
+		pki.client,
+		rootSigner.KeyVersionName(),
+		pki.root,
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pki.signer = signer
+
+	leafKey := newTestSigner(t, pki.client, "leaf", nil).Public()
+
+	pki.good = issue(t, pki.signer, &x509.Certificate{Subject: pkix.Name{CommonName: "good"}}, leafKey)
+	pki.bad = issue(t, pki.signer, &x509.Certificate{Subject: pkix.Name{CommonName: "bad"}}, leafKey)
+
+	pki.unissued = issue(
+		t,
+		pki.signer,
+		&x509.Certificate{Subject: pkix.Name{CommonName: "unissued"}},
+		leafKey,
+	)
+
+	pki.issued = issuedStatuses{
+		pki.good.SerialNumber.String(): {Status: kmssign.OCSPGood},
+		pki.bad.SerialNumber.String():  {Status: kmssign.OCSPGood},
+	}
+
+	crl, err := pki.signer.CreateRevocationList(&x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{{
+			SerialNumber:   pki.bad.SerialNumber,
+			RevocationTime: time.Now().Add(-time.Minute),
+			ReasonCode:     kmssign.RevocationReasons["keyCompromise"],
+		}},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pki.crl = filepath.Join(t.TempDir(), "root.crl")
+
+	crlPEM := pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: crl})
+
+	if err := os.WriteFile(pki.crl, crlPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return pki
+}
+
+func (pki *testPKI) responder(t *testing.T, config Config) *Responder {
+	t.Helper()
+
+	store, err := NewCRLStore(pki.root, pki.issued, pki.crl)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if config.Signer == nil {
+		config.Signer = pki.signer
+	}
+
+	config.Issuer = pki.root
+	config.Store = store
+	config.Validity = time.Hour
+	config.RefreshInterval = time.Minute
+
+	responder, err := New(config)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return responder
+}
+
+func post(t *testing.T, server *httptest.Server, request []byte) []byte {
+	t.Helper()
+
+	response, err := http.Post(server.URL, "application/ocsp-request", bytes.NewReader(request))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer response.Body.Close()
+
+	if contentType := response.Header.Get("Content-Type"); contentType != "application/ocsp-response" {
+		t.Errorf("Content-Type = %q", contentType)
+	}
+
+	body, err := io.ReadAll(response.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return body
+}
+
+func get(t *testing.T, server *httptest.Server, request []byte) ([]byte, http.Header) {
+	t.Helper()
+
+	response, err := http.Get(server.URL + "/" + base64.StdEncoding.EncodeToString(request))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer response.Body.Close()
+
+	body, err := io.ReadAll(response.Body)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return body, response.Header
+}
+
+func createRequest(t *testing.T, certificate, issuer *x509.Certificate) []byte {
+	t.Helper()
+
+	request, err := ocsp.CreateRequest(certificate, issuer, nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return request
+}
+
+// addNonce adds a nonce extension to an OCSP request created by ocsp.CreateRequest, which does not
+// support them.
+func addNonce(t *testing.T, request []byte, nonce []byte) []byte {
+	t.Helper()
+
+	var outer struct{ TBSRequest asn1.RawValue }
+
+	if _, err := asn1.Unmarshal(request, &outer); err != nil {
+		t.Fatal(err)
+	}
+
+	nonceValue, err := asn1.Marshal(nonce)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	extensions, err := asn1.Marshal([]pkix.Extension{
+		{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}, Value: nonceValue},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	explicitExtensions, err := asn1.Marshal(asn1.RawValue{
+		Class:      asn1.ClassContextSpecific,
+		Tag:        2,
+		IsCompound: true,
+		Bytes:      extensions,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tbsRequest := append(outer.TBSRequest.Bytes, explicitExtensions...)
+	tbs, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: tbsRequest})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagSequence, IsCompound: true, Bytes: tbs})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return der
+}
+
+func TestResponder(t *testing.T) {
+	pki := newTestPKI(t)
+	server := httptest.NewServer(pki.responder(t, Config{}))
+	defer server.Close()
+
+	for _, test := range []struct {
+		certificate *x509.Certificate
+		wantStatus  int
+	}{
+		{pki.good, ocsp.Good},
+		{pki.bad, ocsp.Revoked},
+		{pki.unissued, ocsp.Unknown},
+	} {
+		request := createRequest(t, test.certificate, pki.root)
+		getBody, _ := get(t, server, request)
+
+		for method, body := range map[string][]byte{
+			"POST": post(t, server, request),
+			"GET":  getBody,
+		} {
+			response, err := ocsp.ParseResponseForCert(body, test.certificate, pki.root)
+
+			if err != nil {
+				t.Fatalf("%s: ocsp.ParseResponseForCert() failed: %v", method, err)
+			}
+
+			if response.Status != test.wantStatus {
+				t.Errorf(
+					"%s %s: Status = %d, want %d",
+					method,
+					test.certificate.Subject,
+					response.Status,
+					test.wantStatus,
+				)
+			}
+
+			if response.NextUpdate.Sub(response.ThisUpdate) != time.Hour {
+				t.Errorf("%s: validity = %s, want 1h", method, response.NextUpdate.Sub(response.ThisUpdate))
+			}
+		}
+	}
+}
+
+func TestResponderIssuedRevocation(t *testing.T) {
+	pki := newTestPKI(t)
+	revokedAt := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	pki.issued[pki.good.SerialNumber.String()] = CertificateStatus{
+		Status:           kmssign.OCSPRevoked,
+		RevokedAt:        revokedAt,
+		RevocationReason: kmssign.RevocationReasons["superseded"],
+	}
+
+	server := httptest.NewServer(pki.responder(t, Config{}))
+	defer server.Close()
+
+	body, _ := get(t, server, createRequest(t, pki.good, pki.root))
+	response, err := ocsp.ParseResponseForCert(body, pki.good, pki.root)
+
+	if err != nil {
+		t.Fatalf("ocsp.ParseResponseForCert() failed: %v", err)
+	}
+
+	if response.Status != ocsp.Revoked {
+		t.Fatalf("Status = %d, want %d", response.Status, ocsp.Revoked)
+	}
+
+	if !response.RevokedAt.Equal(revokedAt) || response.RevocationReason != ocsp.Superseded {
+		t.Errorf(
+			"Revocation = %s %d, want %s %d",
+			response.RevokedAt,
+			response.RevocationReason,
+			revokedAt,
+			ocsp.Superseded,
+		)
+	}
+}
+
+func TestResponderUnauthorized(t *testing.T) {
+	pki := newTestPKI(t)
+	other := newTestPKI(t)
+
+	server := httptest.NewServer(pki.responder(t, Config{}))
+	defer server.Close()
+
+	for _, test := range []struct {
+		name       string
+		request    []byte
+		wantStatus ocsp.ResponseStatus
+	}{
+		{"another issuer", createRequest(t, other.good, other.root), ocsp.Unauthorized},
+		{"a malformed request", []byte("garbage"), ocsp.Malformed},
+	} {
+		_, err := ocsp.ParseResponse(post(t, server, test.request), nil)
+
+		var responseError ocsp.ResponseError
+
+		if !errors.As(err, &responseError) || responseError.Status != test.wantStatus {
+			t.Errorf("Response for %s = %v, want %s", test.name, err, test.wantStatus)
+		}
+	}
+}
+
+func TestResponderCache(t *testing.T) {
+	pki := newTestPKI(t)
+	responder := pki.responder(t, Config{})
+
+	now := time.Now()
+	responder.now = func() time.Time { return now }
+
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	request := createRequest(t, pki.good, pki.root)
+
+	first, header := get(t, server, request)
+
+	if !strings.HasPrefix(header.Get("Cache-Control"), "max-age=3600,") {
+		t.Errorf("Cache-Control = %q", header.Get("Cache-Control"))
+	}
+
+	now = now.Add(30 * time.Second)
+
+	second, header := get(t, server, request)
+
+	if !bytes.Equal(first, second) {
+		t.Error("Response was not served from the cache")
+	}
+
+	if !strings.HasPrefix(header.Get("Cache-Control"), "max-age=3570,") {
+		t.Errorf("Cache-Control = %q", header.Get("Cache-Control"))
+	}
+
+	now = now.Add(time.Minute)
+
+	if third, _ := get(t, server, request); bytes.Equal(first, third) {
+		t.Error("Response was not signed again after the refresh interval")
+	}
+
+	// revoking the certificate takes effect on the next refresh.
+	crl, err := pki.signer.CreateRevocationList(&x509.RevocationList{
+		Number:     big.NewInt(2),
+		ThisUpdate: now,
+		NextUpdate: now.Add(time.Hour),
+		RevokedCertificateEntries: []x509.RevocationListEntry{
+			{SerialNumber: pki.good.SerialNumber, RevocationTime: now},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(pki.crl, crl, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(time.Second)
+
+	if err := responder.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := get(t, server, request)
+	response, err := ocsp.ParseResponseForCert(body, pki.good, pki.root)
+
+	if err != nil || response.Status != ocsp.Revoked {
+		t.Errorf("Response after refresh = %v, %v, want revoked", response, err)
+	}
+}
+
+func TestResponderNonce(t *testing.T) {
+	pki := newTestPKI(t)
+	server := httptest.NewServer(pki.responder(t, Config{}))
+	defer server.Close()
+
+	nonce := []byte("0123456789abcdef")
+
+	body := post(t, server, addNonce(t, createRequest(t, pki.good, pki.root), nonce))
+
+	if _, err := ocsp.ParseResponseForCert(body, pki.good, pki.root); err != nil {
+		t.Fatalf("ocsp.ParseResponseForCert() failed: %v", err)
+	}
+
+	encodedNonce, _ := asn1.Marshal(nonce)
+
+	if !bytes.Contains(body, encodedNonce) {
+		t.Error("Response does not include the request nonce")
+	}
+
+	other := post(t, server, addNonce(t, createRequest(t, pki.good, pki.root), nonce))
+
+	if bytes.Equal(body, other) {
+		t.Error("Response to a request with a nonce was served from the cache")
+	}
+}
+
+func TestResponderDelegated(t *testing.T) {
+	pki := newTestPKI(t)
+
+	responderSigner := newTestSigner(t, pki.client, "responder", nil)
+
+	responderCert := issue(t, pki.signer, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "OCSP responder"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}, responderSigner.Public())
+
+	delegatedSigner, err := kmssign.NewGoogleKMSSignerWithCertificate(
+		context.Background(),
+		pki.client,
+		responderSigner.KeyVersionName(),
+		responderCert,
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(pki.responder(t, Config{
+		Signer:               delegatedSigner,
+		ResponderCertificate: responderCert,
+	}))
+	defer server.Close()
+
+	response, err := ocsp.ParseResponseForCert(
+		post(t, server, createRequest(t, pki.bad, pki.root)),
+		pki.bad,
+		pki.root,
+	)
+
+	if err != nil {
+		t.Fatalf("ocsp.ParseResponseForCert() failed: %v", err)
+	}
+
+	if response.Status != ocsp.Revoked || !response.Certificate.Equal(responderCert) {
+		t.Errorf(
+			"Unexpected delegated response: status %d, certificate %v",
+			response.Status,
+			response.Certificate,
+		)
+	}
+
+	// a responder certificate without the OCSPSigning extended key usage is refused.
+	_, err = New(Config{
+		Signer:               delegatedSigner,
+		Issuer:               pki.root,
+		ResponderCertificate: pki.good,
+		Validity:             time.Hour,
+		RefreshInterval:      time.Minute,
+	})
+
+	if err == nil {
+		t.Error("New() with a responder certificate without OCSPSigning succeeded")
+	}
+
+	expiredCert := issue(t, pki.signer, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "expired OCSP responder"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+		NotBefore:   time.Now().Add(-2 * time.Hour),
+		NotAfter:    time.Now().Add(-time.Hour),
+	}, responderSigner.Public())
+
+	_, err = New(Config{
+		Signer:               delegatedSigner,
+		Issuer:               pki.root,
+		ResponderCertificate: expiredCert,
+		Validity:             time.Hour,
+		RefreshInterval:      time.Minute,
+	})
+
+	if !errors.Is(err, errResponderCertificateInvalid) {
+		t.Errorf("New() with an expired responder certificate = %v, want it refused", err)
+	}
+}
+
+func TestResponderDelegatedExpiry(t *testing.T) {
+	pki := newTestPKI(t)
+
+	responderSigner := newTestSigner(t, pki.client, "responder", nil)
+
+	responderCert := issue(t, pki.signer, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "OCSP responder"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}, responderSigner.Public())
+
+	delegatedSigner, err := kmssign.NewGoogleKMSSignerWithCertificate(
+		context.Background(),
+		pki.client,
+		responderSigner.KeyVersionName(),
+		responderCert,
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	responder := pki.responder(t, Config{
+		Signer:               delegatedSigner,
+		ResponderCertificate: responderCert,
+	})
+
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	request := createRequest(t, pki.good, pki.root)
+	get(t, server, request)
+
+	if len(responder.cache) != 1 {
+		t.Fatalf("Cache has %d responses, want 1", len(responder.cache))
+	}
+
+	responder.now = func() time.Time { return responderCert.NotAfter.Add(time.Second) }
+
+	err = responder.Refresh(context.Background())
+
+	if !errors.Is(err, errResponderCertificateInvalid) {
+		t.Errorf("Refresh() after the responder certificate expired = %v", err)
+	}
+
+	if len(responder.cache) != 0 {
+		t.Errorf("Cache has %d responses after the responder expired", len(responder.cache))
+	}
+
+	body, _ := get(t, server, request)
+	_, err = ocsp.ParseResponse(body, nil)
+
+	var responseError ocsp.ResponseError
+
+	if !errors.As(err, &responseError) || responseError.Status != ocsp.InternalError {
+		t.Errorf("Response after the responder certificate expired = %v, want an error", err)
+	}
+}
+
+func TestResponderCacheLimit(t *testing.T) {
+	pki := newTestPKI(t)
+	responder := pki.responder(t, Config{MaxCachedResponses: 1})
+
+	now := time.Now()
+	responder.now = func() time.Time { return now }
+
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	// responses for certificates that were never issued are not cached.
+	get(t, server, createRequest(t, pki.unissued, pki.root))
+
+	if len(responder.cache) != 0 {
+		t.Errorf("Cache has %d responses for an unissued certificate", len(responder.cache))
+	}
+
+	get(t, server, createRequest(t, pki.good, pki.root))
+
+	now = now.Add(time.Second)
+
+	get(t, server, createRequest(t, pki.bad, pki.root))
+
+	if len(responder.cache) != 1 || responder.cache[newCacheKey(kmssign.OCSPCertID{
+		HashAlgorithm: crypto.SHA1,
+		SerialNumber:  pki.bad.SerialNumber,
+	})] == nil {
+		t.Errorf("Cache was not limited to the newest response: %v", responder.cache)
+	}
+}
+
+func TestResponderExpiredCRL(t *testing.T) {
+	pki := newTestPKI(t)
+	responder := pki.responder(t, Config{})
+	store := responder.config.Store.(*CRLStore)
+
+	server := httptest.NewServer(responder)
+	defer server.Close()
+
+	store.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	body, _ := get(t, server, createRequest(t, pki.good, pki.root))
+	_, err := ocsp.ParseResponse(body, nil)
+
+	var responseError ocsp.ResponseError
+
+	if !errors.As(err, &responseError) || responseError.Status != ocsp.TryLater {
+		t.Errorf("Response after the CRL's nextUpdate = %v, want %s", err, ocsp.TryLater)
+	}
+}
@@ -0,0 +1,172 @@
+package profile
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"strings"
+)
+
+// keyUsages maps the RFC 5280 key usage names, and the OpenSSL names where they differ, to key
+// usages.
+var keyUsages = map[string]x509.KeyUsage{
+	"digitalSignature":  x509.KeyUsageDigitalSignature,
+	"contentCommitment": x509.KeyUsageContentCommitment,
+	"nonRepudiation":    x509.KeyUsageContentCommitment,
+	"keyEncipherment":   x509.KeyUsageKeyEncipherment,
+	"dataEncipherment":  x509.KeyUsageDataEncipherment,
+	"keyAgreement":      x509.KeyUsageKeyAgreement,
+	"keyCertSign":       x509.KeyUsageCertSign,
+	"cRLSign":           x509.KeyUsageCRLSign,
+	"encipherOnly":      x509.KeyUsageEncipherOnly,
+	"decipherOnly":      x509.KeyUsageDecipherOnly,
+}
+
+// extKeyUsages maps extended key usage names, as used by OpenSSL, to extended key usages.
+var extKeyUsages = map[string]x509.ExtKeyUsage{
+	"anyExtendedKeyUsage": x509.ExtKeyUsageAny,
+	"serverAuth":          x509.ExtKeyUsageServerAuth,
+	"clientAuth":          x509.ExtKeyUsageClientAuth,
+	"codeSigning":         x509.ExtKeyUsageCodeSigning,
+	"emailProtection":     x509.ExtKeyUsageEmailProtection,
+	"ipsecEndSystem":      x509.ExtKeyUsageIPSECEndSystem,
+	"ipsecTunnel":         x509.ExtKeyUsageIPSECTunnel,
+	"ipsecUser":           x509.ExtKeyUsageIPSECUser,
+	"timeStamping":        x509.ExtKeyUsageTimeStamping,
+	"OCSPSigning":         x509.ExtKeyUsageOCSPSigning,
+}
+
+// ParseKeyUsage combines key usage names, such as digitalSignature or keyCertSign, matched
+// without regard to case.
+func ParseKeyUsage(names []string) (x509.KeyUsage, error) {
+	var keyUsage x509.KeyUsage
+
+	for _, name := range names {
+		usage, ok := lookup(keyUsages, name)
+
+		if !ok {
+			return 0, fmt.Errorf("%w: Unknown key usage %q", ErrInvalidProfile, name)
+		}
+
+		keyUsage |= usage
+	}
+
+	return keyUsage, nil
+}
+
+// ParseExtKeyUsage parses extended key usage names, such as serverAuth, matched without regard to
+// case, or dotted OIDs. OIDs that crypto/x509 does not know are returned separately, for
+// x509.Certificate.UnknownExtKeyUsage.
+func ParseExtKeyUsage(names []string) ([]x509.ExtKeyUsage, []asn1.ObjectIdentifier, error) {
+	var (
+		extKeyUsage        []x509.ExtKeyUsage
+		unknownExtKeyUsage []asn1.ObjectIdentifier
+	)
+
+	for _, name := range names {
+		if usage, ok := lookup(extKeyUsages, name); ok {
+			extKeyUsage = append(extKeyUsage, usage)
+
+			continue
+		}
+
+		oid, err := ParseOID(name)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: Unknown extended key usage %q", ErrInvalidProfile, name)
+		}
+
+		unknownExtKeyUsage = append(unknownExtKeyUsage, oid)
+	}
+
+	return extKeyUsage, unknownExtKeyUsage, nil
+}
+
+// keyUsagesByKeyType are the key usages each type of public key can be used for: RSA keys cannot
+// agree on keys, ECDSA keys cannot encrypt, and Ed25519 keys can only sign, as in RFC 8410.
+var keyUsagesByKeyType = map[string]x509.KeyUsage{
+	"RSA": x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment |
+		x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment |
+		x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	"ECDSA": x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment |
+		x509.KeyUsageKeyAgreement | x509.KeyUsageEncipherOnly | x509.KeyUsageDecipherOnly |
+		x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	"Ed25519": x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment |
+		x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+}
+
+// CheckKeyUsage returns an error if keyUsage does not fit a certificate for publicKey: CAs must
+// have keyCertSign and other certificates cannot, encipherOnly and decipherOnly require
+// keyAgreement, and each key usage must be possible with the type of publicKey.
+func CheckKeyUsage(keyUsage x509.KeyUsage, isCA bool, publicKey crypto.PublicKey) error {
+	switch {
+	case isCA && keyUsage&x509.KeyUsageCertSign == 0:
+		return fmt.Errorf("%w: A CA certificate needs the keyCertSign key usage", ErrInvalidProfile)
+
+	case !isCA && keyUsage&x509.KeyUsageCertSign != 0:
+		return fmt.Errorf(
+			"%w: Only CA certificates can have the keyCertSign key usage",
+			ErrInvalidProfile,
+		)
+
+	case keyUsage&(x509.KeyUsageEncipherOnly|x509.KeyUsageDecipherOnly) != 0 &&
+		keyUsage&x509.KeyUsageKeyAgreement == 0:
+		return fmt.Errorf(
+			"%w: encipherOnly and decipherOnly require the keyAgreement key usage",
+			ErrInvalidProfile,
+		)
+	}
+
+	var keyType string
+
+	switch publicKey.(type) {
+	case *rsa.PublicKey:
+		keyType = "RSA"
+
+	case *ecdsa.PublicKey:
+		keyType = "ECDSA"
+
+	case ed25519.PublicKey:
+		keyType = "Ed25519"
+
+	default:
+		return nil
+	}
+
+	if unsupported := keyUsage &^ keyUsagesByKeyType[keyType]; unsupported != 0 {
+		var names []string
+
+		for _, name := range []string{
+			"keyEncipherment", "dataEncipherment", "keyAgreement", "encipherOnly", "decipherOnly",
+		} {
+			if unsupported&keyUsages[name] != 0 {
+				names = append(names, name)
+			}
+		}
+
+		return fmt.Errorf(
+			"%w: %s keys cannot be used for %s",
+			ErrInvalidProfile,
+			keyType,
+			strings.Join(names, ", "),
+		)
+	}
+
+	return nil
+}
+
+func lookup[T any](values map[string]T, name string) (T, bool) {
+	for key, value := range values {
+		if strings.EqualFold(key, name) {
+			return value, true
+		}
+	}
+
+	var zero T
+
+	return zero, false
+}
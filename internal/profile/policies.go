@@ -0,0 +1,236 @@
+package profile
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ericnorris/google-kms-x509/kmssign"
+	"gopkg.in/yaml.v3"
+)
+
+// CertificatePolicies sets the certificate policies extension and, for CAs, the extensions
+// constraining the policies of the certificates below them.
+type CertificatePolicies struct {
+	// Policies lists the certificate policies, see Policy.
+	Policies []Policy `json:"policies" yaml:"policies"`
+
+	// PolicyConstraints, InhibitAnyPolicy and PolicyMappings can only be set for CAs.
+	PolicyConstraints *PolicyConstraints `json:"policyConstraints" yaml:"policyConstraints"`
+	InhibitAnyPolicy  *int               `json:"inhibitAnyPolicy" yaml:"inhibitAnyPolicy"`
+	PolicyMappings    []PolicyMapping    `json:"policyMappings" yaml:"policyMappings"`
+}
+
+// Policy is a certificate policy OID with its qualifiers. In profile files, a policy without
+// qualifiers can also be given as its OID alone.
+type Policy struct {
+	ID string `json:"id" yaml:"id"`
+
+	// CPS lists the URIs of the certification practice statement.
+	CPS []string `json:"cps" yaml:"cps"`
+
+	UserNotices []UserNotice `json:"userNotices" yaml:"userNotices"`
+}
+
+// UserNotice is a notice to display to relying parties, with explicit text, a reference to a
+// numbered notice of an organization, or both.
+type UserNotice struct {
+	Organization  string `json:"organization" yaml:"organization"`
+	NoticeNumbers []int  `json:"noticeNumbers" yaml:"noticeNumbers"`
+	ExplicitText  string `json:"explicitText" yaml:"explicitText"`
+}
+
+// PolicyConstraints sets the policy constraints extension. Each field is the number of further
+// certificates in a path after which the constraint applies. Nil omits it.
+type PolicyConstraints struct {
+	RequireExplicitPolicy *int `json:"requireExplicitPolicy" yaml:"requireExplicitPolicy"`
+	InhibitPolicyMapping  *int `json:"inhibitPolicyMapping" yaml:"inhibitPolicyMapping"`
+}
+
+// PolicyMapping declares the issuer's IssuerDomainPolicy equivalent to the subject CA's
+// SubjectDomainPolicy.
+type PolicyMapping struct {
+	IssuerDomainPolicy  string `json:"issuerDomainPolicy" yaml:"issuerDomainPolicy"`
+	SubjectDomainPolicy string `json:"subjectDomainPolicy" yaml:"subjectDomainPolicy"`
+}
+
+// policyFields are the fields of Policy, which UnmarshalYAML checks for itself as yaml.v3 does not
+// pass KnownFields on to custom unmarshalers.
+var policyFields = map[string]bool{"id": true, "cps": true, "userNotices": true}
+
+// UnmarshalYAML accepts a policy OID, or a policy with qualifiers.
+func (policy *Policy) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*policy = Policy{ID: value.Value}
+
+		return nil
+	}
+
+	if value.Kind == yaml.MappingNode {
+		for i := 0; i < len(value.Content); i += 2 {
+			if key := value.Content[i].Value; !policyFields[key] {
+				return fmt.Errorf("line %d: field %s not found in policy", value.Content[i].Line, key)
+			}
+		}
+	}
+
+	type plainPolicy Policy
+
+	return value.Decode((*plainPolicy)(policy))
+}
+
+// UnmarshalJSON accepts a policy OID, or a policy with qualifiers.
+func (policy *Policy) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(`"`)) {
+		*policy = Policy{}
+
+		return json.Unmarshal(data, &policy.ID)
+	}
+
+	type plainPolicy Policy
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+
+	return decoder.Decode((*plainPolicy)(policy))
+}
+
+// Apply adds the policy extensions to template, whose IsCA must already be set.
+func (policies *CertificatePolicies) Apply(template *x509.Certificate) error {
+	if !template.IsCA && (policies.PolicyConstraints != nil || policies.InhibitAnyPolicy != nil ||
+		len(policies.PolicyMappings) > 0) {
+		return fmt.Errorf(
+			"%w: Policy constraints, inhibitAnyPolicy and policy mappings require a CA",
+			ErrInvalidProfile,
+		)
+	}
+
+	extensions, err := policies.extensions()
+
+	if err != nil {
+		return err
+	}
+
+	template.ExtraExtensions = append(template.ExtraExtensions, extensions...)
+
+	return nil
+}
+
+func (policies *CertificatePolicies) extensions() ([]pkix.Extension, error) {
+	var extensions []pkix.Extension
+
+	if len(policies.Policies) > 0 {
+		var information []kmssign.PolicyInformation
+
+		for _, policy := range policies.Policies {
+			id, err := ParseOID(policy.ID)
+
+			if err != nil {
+				return nil, fmt.Errorf("%w: Invalid policy OID %q", ErrInvalidProfile, policy.ID)
+			}
+
+			policyInformation := kmssign.PolicyInformation{ID: id, CPSURIs: policy.CPS}
+
+			for _, notice := range policy.UserNotices {
+				policyInformation.UserNotices = append(
+					policyInformation.UserNotices,
+					kmssign.UserNotice(notice),
+				)
+			}
+
+			information = append(information, policyInformation)
+		}
+
+		certificatePoliciesExt, err := kmssign.CertificatePoliciesExtension(information)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+
+		extensions = append(extensions, certificatePoliciesExt)
+	}
+
+	if constraints := policies.PolicyConstraints; constraints != nil {
+		requireExplicitPolicy, err := skipCerts(constraints.RequireExplicitPolicy)
+
+		if err != nil {
+			return nil, err
+		}
+
+		inhibitPolicyMapping, err := skipCerts(constraints.InhibitPolicyMapping)
+
+		if err != nil {
+			return nil, err
+		}
+
+		policyConstraintsExt, err := kmssign.PolicyConstraintsExtension(
+			requireExplicitPolicy,
+			inhibitPolicyMapping,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+
+		extensions = append(extensions, policyConstraintsExt)
+	}
+
+	if policies.InhibitAnyPolicy != nil {
+		inhibitAnyPolicyExt, err := kmssign.InhibitAnyPolicyExtension(*policies.InhibitAnyPolicy)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+
+		extensions = append(extensions, inhibitAnyPolicyExt)
+	}
+
+	if len(policies.PolicyMappings) > 0 {
+		var mappings []kmssign.PolicyMapping
+
+		for _, mapping := range policies.PolicyMappings {
+			issuerDomainPolicy, err := ParseOID(mapping.IssuerDomainPolicy)
+
+			if err != nil {
+				return nil, err
+			}
+
+			subjectDomainPolicy, err := ParseOID(mapping.SubjectDomainPolicy)
+
+			if err != nil {
+				return nil, err
+			}
+
+			mappings = append(mappings, kmssign.PolicyMapping{
+				IssuerDomainPolicy:  issuerDomainPolicy,
+				SubjectDomainPolicy: subjectDomainPolicy,
+			})
+		}
+
+		policyMappingsExt, err := kmssign.PolicyMappingsExtension(mappings)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+		}
+
+		extensions = append(extensions, policyMappingsExt)
+	}
+
+	return extensions, nil
+}
+
+// skipCerts returns the SkipCerts value of a policy constraint for
+// kmssign.PolicyConstraintsExtension, -1 to omit it.
+func skipCerts(value *int) (int, error) {
+	if value == nil {
+		return -1, nil
+	}
+
+	if *value < 0 {
+		return 0, fmt.Errorf("%w: Policy constraints cannot be negative", ErrInvalidProfile)
+	}
+
+	return *value, nil
+}
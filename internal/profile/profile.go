@@ -0,0 +1,553 @@
+// Package profile loads declarative certificate profiles from YAML or JSON files, and turns them
+// into x509 certificate templates, so that new kinds of certificates only need a configuration
+// change.
+//
+// A profile file maps profile names to profiles:
+//
+//	profiles:
+//	  web-server:
+//	    validity:
+//	      defaultDays: 90
+//	      maxDays: 397
+//	    keyUsage: [digitalSignature, keyEncipherment]
+//	    extKeyUsage: [serverAuth]
+//	    allowedSANs:
+//	      dns: ["*.example.com"]
+package profile
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/kmssign"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrInvalidProfile is returned for profiles that cannot be loaded or applied.
+var ErrInvalidProfile = errors.New("invalid profile")
+
+// Profile describes a kind of certificate. Every field is optional.
+type Profile struct {
+	Validity Validity `json:"validity" yaml:"validity"`
+
+	// KeyUsage lists RFC 5280 key usage names, see ParseKeyUsage.
+	KeyUsage []string `json:"keyUsage" yaml:"keyUsage"`
+
+	// ExtKeyUsage lists extended key usage names or dotted OIDs, see ParseExtKeyUsage.
+	ExtKeyUsage []string `json:"extKeyUsage" yaml:"extKeyUsage"`
+
+	BasicConstraints BasicConstraints `json:"basicConstraints" yaml:"basicConstraints"`
+
+	// NameConstraints can only be set for CAs.
+	NameConstraints *NameConstraints `json:"nameConstraints" yaml:"nameConstraints"`
+
+	// CertificatePolicies sets policies, policyConstraints, inhibitAnyPolicy and policyMappings.
+	CertificatePolicies `yaml:",inline"`
+
+	// OCSPServers and IssuingCertificateURLs are the Authority Information Access URLs.
+	OCSPServers            []string `json:"ocspServers" yaml:"ocspServers"`
+	IssuingCertificateURLs []string `json:"issuingCertificateURLs" yaml:"issuingCertificateURLs"`
+
+	CRLDistributionPoints []string `json:"crlDistributionPoints" yaml:"crlDistributionPoints"`
+
+	// OCSPNoCheck adds the id-pkix-ocsp-nocheck extension, for delegated OCSP responders.
+	OCSPNoCheck bool `json:"ocspNoCheck" yaml:"ocspNoCheck"`
+
+	// AllowedSANs restricts the subject alternative names of the certificates. Nil allows any.
+	AllowedSANs *AllowedSANs `json:"allowedSANs" yaml:"allowedSANs"`
+}
+
+// Validity limits the validity period of the certificates.
+type Validity struct {
+	// DefaultDays is used when no validity is requested. Zero requires one.
+	DefaultDays int `json:"defaultDays" yaml:"defaultDays"`
+
+	// MaxDays is the longest validity allowed. Zero allows any.
+	MaxDays int `json:"maxDays" yaml:"maxDays"`
+}
+
+// BasicConstraints sets the basic constraints extension.
+type BasicConstraints struct {
+	CA bool `json:"ca" yaml:"ca"`
+
+	// PathLen limits the number of intermediate CAs below a CA. Nil leaves it unlimited.
+	PathLen *int `json:"pathLen" yaml:"pathLen"`
+}
+
+// NameConstraints sets the name constraints extension of a CA.
+type NameConstraints struct {
+	Critical bool `json:"critical" yaml:"critical"`
+
+	PermittedDNSDomains []string `json:"permittedDNSDomains" yaml:"permittedDNSDomains"`
+	ExcludedDNSDomains  []string `json:"excludedDNSDomains" yaml:"excludedDNSDomains"`
+
+	// PermittedIPRanges and ExcludedIPRanges are CIDRs.
+	PermittedIPRanges []string `json:"permittedIPRanges" yaml:"permittedIPRanges"`
+	ExcludedIPRanges  []string `json:"excludedIPRanges" yaml:"excludedIPRanges"`
+
+	PermittedEmailAddresses []string `json:"permittedEmailAddresses" yaml:"permittedEmailAddresses"`
+	ExcludedEmailAddresses  []string `json:"excludedEmailAddresses" yaml:"excludedEmailAddresses"`
+
+	// PermittedURIDomains and ExcludedURIDomains are domains, or URIs without a path such as
+	// SPIFFE trust domains, see Apply.
+	PermittedURIDomains []string `json:"permittedURIDomains" yaml:"permittedURIDomains"`
+	ExcludedURIDomains  []string `json:"excludedURIDomains" yaml:"excludedURIDomains"`
+}
+
+// AllowedSANs lists the patterns subject alternative names must match, as in path.Match, where
+// '*' also matches dots, e.g. "*.example.com". IP addresses must be in one of the IP CIDRs. Names
+// of a type without patterns are not allowed.
+type AllowedSANs struct {
+	DNS   []string `json:"dns" yaml:"dns"`
+	IP    []string `json:"ip" yaml:"ip"`
+	Email []string `json:"email" yaml:"email"`
+	URI   []string `json:"uri" yaml:"uri"`
+
+	// OtherName patterns match "OID=value", e.g. "1.3.6.1.4.1.311.20.2.3=*@example.com" for UPNs.
+	OtherName []string `json:"otherName" yaml:"otherName"`
+}
+
+// file is the format of profile files.
+type file struct {
+	Profiles map[string]*Profile `json:"profiles" yaml:"profiles"`
+}
+
+// Load reads the profiles in the YAML or JSON file at filePath, by name. Files ending in .json are
+// read as JSON, and any other file as YAML. Unknown fields are rejected.
+func Load(filePath string) (map[string]*Profile, error) {
+	data, err := os.ReadFile(filePath)
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not read profiles: %w", err)
+	}
+
+	var profiles file
+
+	if strings.EqualFold(filepath.Ext(filePath), ".json") {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+
+		err = decoder.Decode(&profiles)
+	} else {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+
+		err = decoder.Decode(&profiles)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: Could not parse %s: %v", ErrInvalidProfile, filePath, err)
+	}
+
+	for name, profile := range profiles.Profiles {
+		if profile == nil {
+			profile = &Profile{}
+			profiles.Profiles[name] = profile
+		}
+
+		if err := profile.Validate(); err != nil {
+			return nil, fmt.Errorf("Profile %s in %s: %w", name, filePath, err)
+		}
+	}
+
+	return profiles.Profiles, nil
+}
+
+// Lookup loads the profile called name from the file at filePath.
+func Lookup(filePath, name string) (*Profile, error) {
+	profiles, err := Load(filePath)
+
+	if err != nil {
+		return nil, err
+	}
+
+	profile, ok := profiles[name]
+
+	if !ok {
+		var names []string
+
+		for name := range profiles {
+			names = append(names, name)
+		}
+
+		sort.Strings(names)
+
+		return nil, fmt.Errorf(
+			"%w: No profile %q in %s, it has %s",
+			ErrInvalidProfile,
+			name,
+			filePath,
+			strings.Join(names, ", "),
+		)
+	}
+
+	return profile, nil
+}
+
+// Validate checks that the profile can be applied.
+func (profile *Profile) Validate() error {
+	_, err := profile.template()
+
+	if err != nil {
+		return err
+	}
+
+	if profile.Validity.DefaultDays < 0 || profile.Validity.MaxDays < 0 {
+		return fmt.Errorf("%w: Validity days cannot be negative", ErrInvalidProfile)
+	}
+
+	if profile.Validity.MaxDays > 0 && profile.Validity.DefaultDays > profile.Validity.MaxDays {
+		return fmt.Errorf(
+			"%w: Default validity of %d days exceeds the maximum of %d days",
+			ErrInvalidProfile,
+			profile.Validity.DefaultDays,
+			profile.Validity.MaxDays,
+		)
+	}
+
+	if sans := profile.AllowedSANs; sans != nil {
+		patterns := append(append(append([]string{}, sans.DNS...), sans.Email...), sans.URI...)
+		patterns = append(patterns, sans.OtherName...)
+
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("%w: Invalid SAN pattern %q", ErrInvalidProfile, pattern)
+			}
+		}
+
+		if _, err := parseCIDRs(sans.IP); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Request holds the values a profile is applied to.
+type Request struct {
+	Subject pkix.Name
+
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+	URIs           []*url.URL
+	OtherNames     []kmssign.OtherName
+
+	// NotBefore is the start of the validity period.
+	NotBefore time.Time
+
+	// NotAfter is the end of the validity period. Zero uses the profile's default validity.
+	NotAfter time.Time
+}
+
+// Template returns the certificate template for request, or an error wrapping ErrInvalidProfile if
+// the request is not allowed by the profile.
+func (profile *Profile) Template(request Request) (*x509.Certificate, error) {
+	template, err := profile.template()
+
+	if err != nil {
+		return nil, err
+	}
+
+	sans := kmssign.SubjectAltNames{
+		DNSNames:       request.DNSNames,
+		IPAddresses:    request.IPAddresses,
+		EmailAddresses: request.EmailAddresses,
+		URIs:           request.URIs,
+		OtherNames:     request.OtherNames,
+	}
+
+	if err := sans.Validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidProfile, err)
+	}
+
+	if err := profile.AllowedSANs.Check(sans); err != nil {
+		return nil, err
+	}
+
+	notAfter := request.NotAfter
+
+	if notAfter.IsZero() {
+		if profile.Validity.DefaultDays == 0 {
+			return nil, fmt.Errorf("%w: The profile has no default validity", ErrInvalidProfile)
+		}
+
+		notAfter = request.NotBefore.AddDate(0, 0, profile.Validity.DefaultDays)
+	}
+
+	if !notAfter.After(request.NotBefore) {
+		return nil, fmt.Errorf("%w: The validity period ends before it starts", ErrInvalidProfile)
+	}
+
+	maxNotAfter := request.NotBefore.AddDate(0, 0, profile.Validity.MaxDays)
+
+	if profile.Validity.MaxDays > 0 && notAfter.After(maxNotAfter) {
+		return nil, fmt.Errorf(
+			"%w: A validity of %s exceeds the maximum of %d days",
+			ErrInvalidProfile,
+			notAfter.Sub(request.NotBefore),
+			profile.Validity.MaxDays,
+		)
+	}
+
+	template.Subject = request.Subject
+	template.NotBefore = request.NotBefore
+	template.NotAfter = notAfter
+
+	if err := sans.Apply(template); err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// template returns the parts of the certificate template set by the profile.
+func (profile *Profile) template() (*x509.Certificate, error) {
+	template := &x509.Certificate{
+		BasicConstraintsValid: true,
+		IsCA:                  profile.BasicConstraints.CA,
+
+		OCSPServer:            profile.OCSPServers,
+		IssuingCertificateURL: profile.IssuingCertificateURLs,
+		CRLDistributionPoints: profile.CRLDistributionPoints,
+	}
+
+	var err error
+
+	if template.KeyUsage, err = ParseKeyUsage(profile.KeyUsage); err != nil {
+		return nil, err
+	}
+
+	if template.ExtKeyUsage, template.UnknownExtKeyUsage, err = ParseExtKeyUsage(
+		profile.ExtKeyUsage,
+	); err != nil {
+		return nil, err
+	}
+
+	if pathLen := profile.BasicConstraints.PathLen; pathLen != nil {
+		if !template.IsCA || *pathLen < 0 {
+			return nil, fmt.Errorf(
+				"%w: A path length requires a CA, and cannot be negative",
+				ErrInvalidProfile,
+			)
+		}
+
+		template.MaxPathLen = *pathLen
+		template.MaxPathLenZero = *pathLen == 0
+	}
+
+	if err := profile.CertificatePolicies.Apply(template); err != nil {
+		return nil, err
+	}
+
+	if profile.NameConstraints != nil {
+		if !template.IsCA {
+			return nil, fmt.Errorf("%w: Name constraints require a CA", ErrInvalidProfile)
+		}
+
+		if err := profile.NameConstraints.Apply(template); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, rawURL := range append(
+		append(append([]string{}, profile.OCSPServers...), profile.IssuingCertificateURLs...),
+		profile.CRLDistributionPoints...,
+	) {
+		if parsed, err := url.Parse(rawURL); err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			return nil, fmt.Errorf("%w: %q is not an absolute URL", ErrInvalidProfile, rawURL)
+		}
+	}
+
+	if profile.OCSPNoCheck {
+		template.ExtraExtensions = append(template.ExtraExtensions, kmssign.OCSPNoCheckExtension())
+	}
+
+	return template, nil
+}
+
+// Apply sets the name constraints extension of template. URI domains may also be given as URIs,
+// such as SPIFFE trust domains like spiffe://example.org, of which only the host is kept.
+func (constraints *NameConstraints) Apply(template *x509.Certificate) error {
+	template.PermittedDNSDomainsCritical = constraints.Critical
+	template.PermittedDNSDomains = constraints.PermittedDNSDomains
+	template.ExcludedDNSDomains = constraints.ExcludedDNSDomains
+	template.PermittedEmailAddresses = constraints.PermittedEmailAddresses
+	template.ExcludedEmailAddresses = constraints.ExcludedEmailAddresses
+
+	var err error
+
+	if template.PermittedIPRanges, err = parseCIDRs(constraints.PermittedIPRanges); err != nil {
+		return err
+	}
+
+	if template.ExcludedIPRanges, err = parseCIDRs(constraints.ExcludedIPRanges); err != nil {
+		return err
+	}
+
+	template.PermittedURIDomains, err = parseURIDomains(constraints.PermittedURIDomains)
+
+	if err != nil {
+		return err
+	}
+
+	template.ExcludedURIDomains, err = parseURIDomains(constraints.ExcludedURIDomains)
+
+	return err
+}
+
+// parseURIDomains returns the domains of URI name constraints, which are either domains, or URIs
+// without a path, such as spiffe://example.org.
+func parseURIDomains(values []string) ([]string, error) {
+	var domains []string
+
+	for _, value := range values {
+		if strings.Contains(value, "://") {
+			parsed, err := url.Parse(value)
+
+			if err != nil || parsed.Host == "" || strings.Trim(parsed.Path, "/") != "" {
+				return nil, fmt.Errorf(
+					"%w: URI name constraint %q must be a domain or a URI without a path",
+					ErrInvalidProfile,
+					value,
+				)
+			}
+
+			value = parsed.Host
+		}
+
+		domains = append(domains, value)
+	}
+
+	return domains, nil
+}
+
+// Check returns an error wrapping ErrInvalidProfile if one of sans is not allowed. A nil
+// AllowedSANs allows any names.
+func (allowed *AllowedSANs) Check(sans kmssign.SubjectAltNames) error {
+	if allowed == nil {
+		return nil
+	}
+
+	for _, dnsName := range sans.DNSNames {
+		if !matchAny(allowed.DNS, strings.ToLower(dnsName), true) {
+			return fmt.Errorf("%w: DNS name %s is not allowed", ErrInvalidProfile, dnsName)
+		}
+	}
+
+	for _, emailAddress := range sans.EmailAddresses {
+		if !matchAny(allowed.Email, emailAddress, true) {
+			return fmt.Errorf("%w: Email address %s is not allowed", ErrInvalidProfile, emailAddress)
+		}
+	}
+
+	for _, uri := range sans.URIs {
+		if !matchAny(allowed.URI, uri.String(), false) {
+			return fmt.Errorf("%w: URI %s is not allowed", ErrInvalidProfile, uri)
+		}
+	}
+
+	for _, otherName := range sans.OtherNames {
+		if !matchAny(allowed.OtherName, fmt.Sprintf("%s=%s", otherName.TypeID, otherName.Value), true) {
+			return fmt.Errorf(
+				"%w: otherName %s=%s is not allowed",
+				ErrInvalidProfile,
+				otherName.TypeID,
+				otherName.Value,
+			)
+		}
+	}
+
+	ranges, err := parseCIDRs(allowed.IP)
+
+	if err != nil {
+		return err
+	}
+
+	for _, ip := range sans.IPAddresses {
+		allowed := false
+
+		for _, ipRange := range ranges {
+			allowed = allowed || ipRange.Contains(ip)
+		}
+
+		if !allowed {
+			return fmt.Errorf("%w: IP address %s is not allowed", ErrInvalidProfile, ip)
+		}
+	}
+
+	return nil
+}
+
+// matchAny reports whether name matches one of patterns. Slashes in name, e.g. in URIs, are
+// replaced so that '*' matches them too.
+func matchAny(patterns []string, name string, ignoreCase bool) bool {
+	for _, pattern := range patterns {
+		if ignoreCase {
+			pattern = strings.ToLower(pattern)
+			name = strings.ToLower(name)
+		}
+
+		matched, _ := path.Match(
+			strings.ReplaceAll(pattern, "/", "\x00"),
+			strings.ReplaceAll(name, "/", "\x00"),
+		)
+
+		if matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var ranges []*net.IPNet
+
+	for _, cidr := range cidrs {
+		_, ipRange, err := net.ParseCIDR(cidr)
+
+		if err != nil {
+			return nil, fmt.Errorf("%w: Invalid CIDR %q", ErrInvalidProfile, cidr)
+		}
+
+		ranges = append(ranges, ipRange)
+	}
+
+	return ranges, nil
+}
+
+// ParseOID parses a dotted OID such as "1.3.6.1.4.1.11129.2.4.3".
+func ParseOID(value string) (asn1.ObjectIdentifier, error) {
+	var oid asn1.ObjectIdentifier
+
+	for _, component := range strings.Split(value, ".") {
+		var number int
+
+		if _, err := fmt.Sscanf(component, "%d", &number); err != nil || number < 0 ||
+			fmt.Sprint(number) != component {
+			return nil, fmt.Errorf("%w: Invalid OID %q", ErrInvalidProfile, value)
+		}
+
+		oid = append(oid, number)
+	}
+
+	if len(oid) < 2 {
+		return nil, fmt.Errorf("%w: Invalid OID %q", ErrInvalidProfile, value)
+	}
+
+	return oid, nil
+}
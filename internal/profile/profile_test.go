@@ -0,0 +1,363 @@
+package profile
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ericnorris/google-kms-x509/kmssign"
+)
+
+func writeProfiles(t *testing.T, name, contents string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+
+	if err := os.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestLoad(t *testing.T) {
+	yamlPath := writeProfiles(t, "profiles.yaml", `
+profiles:
+  client:
+    validity: {defaultDays: 30}
+    keyUsage: [DigitalSignature]
+    extKeyUsage: [clientAuth, 1.2.3.4]
+`)
+
+	jsonPath := writeProfiles(t, "profiles.json", `{
+  "profiles": {
+    "client": {
+      "validity": {"defaultDays": 30},
+      "keyUsage": ["DigitalSignature"],
+      "extKeyUsage": ["clientAuth", "1.2.3.4"]
+    }
+  }
+}`)
+
+	for _, path := range []string{yamlPath, jsonPath} {
+		profile, err := Lookup(path, "client")
+
+		if err != nil {
+			t.Fatalf("Lookup(%s) failed: %v", path, err)
+		}
+
+		template, err := profile.Template(Request{
+			Subject:   pkix.Name{CommonName: "client"},
+			NotBefore: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		})
+
+		if err != nil {
+			t.Fatalf("Template() failed: %v", err)
+		}
+
+		if template.KeyUsage != x509.KeyUsageDigitalSignature ||
+			len(template.ExtKeyUsage) != 1 || template.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth ||
+			len(template.UnknownExtKeyUsage) != 1 || template.UnknownExtKeyUsage[0].String() != "1.2.3.4" {
+			t.Errorf("Unexpected usages from %s: %v %v %v", path,
+				template.KeyUsage, template.ExtKeyUsage, template.UnknownExtKeyUsage)
+		}
+
+		if want := time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC); !template.NotAfter.Equal(want) {
+			t.Errorf("NotAfter = %v, want %v", template.NotAfter, want)
+		}
+	}
+
+	if _, err := Lookup(yamlPath, "server"); !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("Lookup() of an unknown profile = %v, want ErrInvalidProfile", err)
+	}
+}
+
+func TestCertificatePolicies(t *testing.T) {
+	yamlPath := writeProfiles(t, "profiles.yaml", `
+profiles:
+  ca:
+    validity: {defaultDays: 30}
+    basicConstraints: {ca: true}
+    policies:
+      - 2.23.140.1.2.1
+      - id: 1.3.6.1.4.1.99999.1
+        cps: [https://pki.example.com/cps]
+        userNotices:
+          - {organization: Example, noticeNumbers: [1], explicitText: Notice}
+    policyConstraints: {requireExplicitPolicy: 0}
+    inhibitAnyPolicy: 1
+    policyMappings:
+      - {issuerDomainPolicy: 1.3.6.1.4.1.99999.1, subjectDomainPolicy: 1.3.6.1.4.1.99999.2}
+`)
+
+	jsonPath := writeProfiles(t, "profiles.json", `{
+  "profiles": {
+    "ca": {
+      "validity": {"defaultDays": 30},
+      "basicConstraints": {"ca": true},
+      "policies": [
+        "2.23.140.1.2.1",
+        {
+          "id": "1.3.6.1.4.1.99999.1",
+          "cps": ["https://pki.example.com/cps"],
+          "userNotices": [
+            {"organization": "Example", "noticeNumbers": [1], "explicitText": "Notice"}
+          ]
+        }
+      ],
+      "policyConstraints": {"requireExplicitPolicy": 0},
+      "inhibitAnyPolicy": 1,
+      "policyMappings": [
+        {"issuerDomainPolicy": "1.3.6.1.4.1.99999.1", "subjectDomainPolicy": "1.3.6.1.4.1.99999.2"}
+      ]
+    }
+  }
+}`)
+
+	policyID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+
+	wantPolicies, err := kmssign.CertificatePoliciesExtension([]kmssign.PolicyInformation{
+		{ID: asn1.ObjectIdentifier{2, 23, 140, 1, 2, 1}},
+		{
+			ID:      policyID,
+			CPSURIs: []string{"https://pki.example.com/cps"},
+			UserNotices: []kmssign.UserNotice{
+				{Organization: "Example", NoticeNumbers: []int{1}, ExplicitText: "Notice"},
+			},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{yamlPath, jsonPath} {
+		profile, err := Lookup(path, "ca")
+
+		if err != nil {
+			t.Fatalf("Lookup(%s) failed: %v", path, err)
+		}
+
+		template, err := profile.Template(Request{})
+
+		if err != nil {
+			t.Fatalf("Template() failed: %v", err)
+		}
+
+		var oids []string
+
+		for _, extension := range template.ExtraExtensions {
+			oids = append(oids, extension.Id.String())
+
+			if extension.Id.Equal(wantPolicies.Id) && !bytes.Equal(extension.Value, wantPolicies.Value) {
+				t.Errorf("Certificate policies from %s = %x, want %x",
+					path, extension.Value, wantPolicies.Value)
+			}
+		}
+
+		if want := "[2.5.29.32 2.5.29.36 2.5.29.54 2.5.29.33]"; fmt.Sprint(oids) != want {
+			t.Errorf("Extensions from %s = %v, want %s", path, oids, want)
+		}
+	}
+}
+
+func TestCheckKeyUsage(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ed25519Key, _, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const (
+		sign         = x509.KeyUsageDigitalSignature
+		commit       = x509.KeyUsageContentCommitment
+		encipher     = x509.KeyUsageKeyEncipherment
+		dataEncipher = x509.KeyUsageDataEncipherment
+		agree        = x509.KeyUsageKeyAgreement
+		certSign     = x509.KeyUsageCertSign
+		crlSign      = x509.KeyUsageCRLSign
+		decipherOnly = x509.KeyUsageDecipherOnly
+	)
+
+	for _, test := range []struct {
+		keyUsage  x509.KeyUsage
+		isCA      bool
+		publicKey any
+		valid     bool
+	}{
+		{sign | encipher, false, &rsaKey.PublicKey, true},
+		{sign | agree, false, &rsaKey.PublicKey, false},
+		{sign | certSign | crlSign, true, &rsaKey.PublicKey, true},
+		{sign, false, &ecdsaKey.PublicKey, true},
+		{sign | encipher, false, &ecdsaKey.PublicKey, false},
+		{dataEncipher, false, &ecdsaKey.PublicKey, false},
+		{agree | decipherOnly, false, &ecdsaKey.PublicKey, true},
+		{decipherOnly, false, &ecdsaKey.PublicKey, false},
+		{sign | commit, false, ed25519Key, true},
+		{sign | agree, false, ed25519Key, false},
+		{sign | crlSign, true, &ecdsaKey.PublicKey, false},
+		{sign | certSign, false, &ecdsaKey.PublicKey, false},
+	} {
+		err := CheckKeyUsage(test.keyUsage, test.isCA, test.publicKey)
+
+		if test.valid && err != nil {
+			t.Errorf("CheckKeyUsage(%b, %t, %T) failed: %v",
+				test.keyUsage, test.isCA, test.publicKey, err)
+		} else if !test.valid && !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("CheckKeyUsage(%b, %t, %T) = %v, want ErrInvalidProfile",
+				test.keyUsage, test.isCA, test.publicKey, err)
+		}
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	for name, contents := range map[string]string{
+		"unknown field":              "profiles: {a: {keyUsages: [digitalSignature]}}",
+		"unknown key usage":          "profiles: {a: {keyUsage: [signEverything]}}",
+		"unknown extended key usage": "profiles: {a: {extKeyUsage: [webAuth]}}",
+		"path length without a CA":   "profiles: {a: {basicConstraints: {pathLen: 1}}}",
+		"name constraints without a CA": "profiles: {a: {nameConstraints: " +
+			"{permittedDNSDomains: [example.com]}}}",
+		"URI constraint with a path": "profiles: {a: {basicConstraints: {ca: true}, " +
+			"nameConstraints: {permittedURIDomains: [spiffe://example.org/ns]}}}",
+		"invalid CIDR":   "profiles: {a: {allowedSANs: {ip: [10.0.0.0]}}}",
+		"invalid policy": "profiles: {a: {policies: [policy]}}",
+		"unknown policy field": "profiles: {a: {policies: [{id: 1.2.3, cpsURIs: " +
+			"[https://example.com/cps]}]}}",
+		"relative CPS URI": "profiles: {a: {policies: [{id: 1.2.3, cps: [/cps]}]}}",
+		"policy constraints without a CA": "profiles: {a: {policyConstraints: " +
+			"{requireExplicitPolicy: 0}}}",
+		"empty policy constraints": "profiles: {a: {basicConstraints: {ca: true}, " +
+			"policyConstraints: {}}}",
+		"mapped anyPolicy": "profiles: {a: {basicConstraints: {ca: true}, policyMappings: " +
+			"[{issuerDomainPolicy: 2.5.29.32.0, subjectDomainPolicy: 1.2.3}]}}",
+		"relative URL":     "profiles: {a: {crlDistributionPoints: [/ca.crl]}}",
+		"default over max": "profiles: {a: {validity: {defaultDays: 30, maxDays: 7}}}",
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := Load(writeProfiles(t, "profiles.yaml", contents))
+
+			if !errors.Is(err, ErrInvalidProfile) {
+				t.Errorf("Load() = %v, want ErrInvalidProfile", err)
+			}
+		})
+	}
+}
+
+func TestTemplateValidity(t *testing.T) {
+	profile := &Profile{Validity: Validity{MaxDays: 7}}
+	notBefore := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		notAfter time.Time
+		valid    bool
+	}{
+		{notBefore.Add(15 * time.Minute), true},
+		{notBefore.AddDate(0, 0, 7), true},
+		{notBefore.AddDate(0, 0, 7).Add(time.Second), false},
+		{notBefore, false},
+		{time.Time{}, false},
+	} {
+		template, err := profile.Template(Request{NotBefore: notBefore, NotAfter: test.notAfter})
+
+		switch {
+		case test.valid && err != nil:
+			t.Errorf("Template() with NotAfter %s failed: %v", test.notAfter, err)
+
+		case test.valid && !template.NotAfter.Equal(test.notAfter):
+			t.Errorf("NotAfter = %s, want %s", template.NotAfter, test.notAfter)
+
+		case !test.valid && !errors.Is(err, ErrInvalidProfile):
+			t.Errorf("Template() with NotAfter %s = %v, want ErrInvalidProfile", test.notAfter, err)
+		}
+	}
+}
+
+func TestAllowedSANs(t *testing.T) {
+	profile := &Profile{
+		Validity: Validity{DefaultDays: 1},
+		AllowedSANs: &AllowedSANs{
+			DNS:   []string{"*.example.com"},
+			IP:    []string{"192.0.2.0/24"},
+			Email: []string{"*@example.com"},
+			URI:   []string{"spiffe://example.com/*"},
+
+			OtherName: []string{"1.3.6.1.4.1.311.20.2.3=*@corp.example.com"},
+		},
+	}
+
+	mustParseURL := func(rawURL string) *url.URL {
+		parsed, err := url.Parse(rawURL)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return parsed
+	}
+
+	upn := func(value string) kmssign.OtherName {
+		return kmssign.OtherName{TypeID: kmssign.UPNOtherNameOID, Value: value}
+	}
+
+	for _, test := range []struct {
+		request Request
+		allowed bool
+	}{
+		{Request{DNSNames: []string{"WWW.example.com", "a.b.example.com"}}, true},
+		{Request{DNSNames: []string{"example.com"}}, false},
+		{Request{DNSNames: []string{"www.example.org"}}, false},
+		{Request{IPAddresses: []net.IP{net.ParseIP("192.0.2.1")}}, true},
+		{Request{IPAddresses: []net.IP{net.ParseIP("198.51.100.1")}}, false},
+		{Request{EmailAddresses: []string{"alice@example.com"}}, true},
+		{Request{EmailAddresses: []string{"alice@example.org"}}, false},
+		{Request{URIs: []*url.URL{mustParseURL("spiffe://example.com/ns/web")}}, true},
+		{Request{URIs: []*url.URL{mustParseURL("spiffe://example.org/web")}}, false},
+		{Request{URIs: []*url.URL{mustParseURL("spiffe://example.com/web/")}}, false},
+		{Request{OtherNames: []kmssign.OtherName{upn("alice@corp.example.com")}}, true},
+		{Request{OtherNames: []kmssign.OtherName{upn("alice@example.com")}}, false},
+		{Request{OtherNames: []kmssign.OtherName{upn("alice")}}, false},
+	} {
+		_, err := profile.Template(test.request)
+
+		if test.allowed && err != nil {
+			t.Errorf("Template(%+v) failed: %v", test.request, err)
+		} else if !test.allowed && !errors.Is(err, ErrInvalidProfile) {
+			t.Errorf("Template(%+v) = %v, want ErrInvalidProfile", test.request, err)
+		}
+	}
+
+	profile.AllowedSANs = &AllowedSANs{DNS: []string{"*.example.com"}}
+
+	_, err := profile.Template(Request{IPAddresses: []net.IP{net.ParseIP("192.0.2.1")}})
+
+	if !errors.Is(err, ErrInvalidProfile) {
+		t.Errorf("Template() with an IP address and no IP patterns = %v, want an error", err)
+	}
+}
@@ -0,0 +1,238 @@
+package kmssign
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// https://tools.ietf.org/html/rfc5280#section-5.3.2
+	invalidityDateOID = asn1.ObjectIdentifier{2, 5, 29, 24}
+
+	// https://tools.ietf.org/html/rfc5280#section-5.2.4
+	deltaCRLIndicatorOID = asn1.ObjectIdentifier{2, 5, 29, 27}
+
+	// https://tools.ietf.org/html/rfc5280#section-5.2.6
+	freshestCRLOID = asn1.ObjectIdentifier{2, 5, 29, 46}
+)
+
+// distributionPoint and distributionPointName are the CRLDistributionPoints syntax used by the
+// Freshest CRL extension, as in crypto/x509.
+type distributionPoint struct {
+	DistributionPoint distributionPointName `asn1:"optional,tag:0"`
+}
+
+type distributionPointName struct {
+	FullName []asn1.RawValue `asn1:"optional,tag:0"`
+}
+
+// RevocationReasons maps the CRLReason names from RFC 5280 to their reason codes, for use as
+// x509.RevocationListEntry.ReasonCode.
+var RevocationReasons = map[string]int{
+	"unspecified":          0,
+	"keyCompromise":        1,
+	"cACompromise":         2,
+	"affiliationChanged":   3,
+	"superseded":           4,
+	"cessationOfOperation": 5,
+	"certificateHold":      6,
+	"removeFromCRL":        8,
+	"privilegeWithdrawn":   9,
+	"aACompromise":         10,
+}
+
+// ParseRevocationReason returns the reason code for a CRLReason name, matched case-insensitively,
+// or for its decimal value.
+func ParseRevocationReason(reason string) (int, error) {
+	for name, code := range RevocationReasons {
+		if strings.EqualFold(name, reason) {
+			return code, nil
+		}
+	}
+
+	if code, err := strconv.Atoi(reason); err == nil {
+		for _, knownCode := range RevocationReasons {
+			if code == knownCode {
+				return code, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("Unknown revocation reason %q", reason)
+}
+
+// InvalidityDateExtension returns the CRL entry extension recording the time a revoked
+// certificate's key is known or suspected to have been compromised, for use in
+// x509.RevocationListEntry.ExtraExtensions.
+func InvalidityDateExtension(invalidityDate time.Time) (pkix.Extension, error) {
+	value, err := asn1.MarshalWithParams(invalidityDate.UTC(), "generalized")
+
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{Id: invalidityDateOID, Value: value}, nil
+}
+
+// FreshestCRLExtension returns the CRL extension pointing relying parties at the delta CRLs for a
+// base CRL, published at urls, for use in x509.RevocationList.ExtraExtensions.
+func FreshestCRLExtension(urls ...string) (pkix.Extension, error) {
+	var distributionPoints []distributionPoint
+
+	for _, url := range urls {
+		distributionPoints = append(distributionPoints, distributionPoint{
+			DistributionPoint: distributionPointName{
+				FullName: []asn1.RawValue{
+					{Tag: 6, Class: asn1.ClassContextSpecific, Bytes: []byte(url)},
+				},
+			},
+		})
+	}
+
+	value, err := asn1.Marshal(distributionPoints)
+
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{Id: freshestCRLOID, Value: value}, nil
+}
+
+// CreateRevocationList returns a DER-encoded v2 CRL issued by the signer's certificate, which must
+// be a CA with the cRLSign key usage and a subject key identifier. The template must set Number,
+// ThisUpdate and NextUpdate; its RevokedCertificateEntries list the revoked serial numbers.
+func (signer *GoogleKMSSigner) CreateRevocationList(template *x509.RevocationList) ([]byte, error) {
+	return signer.CreateRevocationListContext(signer.ctx, template)
+}
+
+// CreateRevocationListContext is like CreateRevocationList, but uses ctx for the call to Cloud
+// KMS.
+func (signer *GoogleKMSSigner) CreateRevocationListContext(
+	ctx context.Context,
+	template *x509.RevocationList,
+) ([]byte, error) {
+	if signer.certificate == nil {
+		return nil, fmt.Errorf("Cannot sign revocation list without an issuer certificate")
+	}
+
+	if signer.certificate.IsCA == false {
+		return nil, fmt.Errorf(
+			"Cannot sign revocation list with a non-CA certificate: %w",
+			ErrParentNotCA,
+		)
+	}
+
+	signatureAlgorithm, _, err := signer.operationSignatureAlgorithm(template.SignatureAlgorithm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	template.SignatureAlgorithm = signatureAlgorithm
+
+	var rawRevocationList []byte
+
+	if signer.needsStandIn(nil) {
+		rawRevocationList, err = signer.createRevocationListWithStandIn(ctx, template)
+	} else {
+		rawRevocationList, err = x509.CreateRevocationList(
+			rand.Reader,
+			template,
+			signer.certificate,
+			signer.SignerWithContext(ctx),
+		)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not create revocation list: %w", err)
+	}
+
+	revocationList, err := x509.ParseRevocationList(rawRevocationList)
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse revocation list: %w", err)
+	}
+
+	err = signer.certificate.CheckSignature(
+		revocationList.SignatureAlgorithm,
+		revocationList.RawTBSRevocationList,
+		revocationList.Signature,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: revocation list: %v", ErrSignatureVerificationFailed, err)
+	}
+
+	return rawRevocationList, nil
+}
+
+// CreateDeltaRevocationList is like CreateRevocationList, but returns a delta CRL listing the
+// changes since the complete CRL numbered baseCRLNumber, which must be lower than the template's
+// Number.
+func (signer *GoogleKMSSigner) CreateDeltaRevocationList(
+	template *x509.RevocationList,
+	baseCRLNumber *big.Int,
+) ([]byte, error) {
+	return signer.CreateDeltaRevocationListContext(signer.ctx, template, baseCRLNumber)
+}
+
+// CreateDeltaRevocationListContext is like CreateDeltaRevocationList, but uses ctx for the call to
+// Cloud KMS.
+func (signer *GoogleKMSSigner) CreateDeltaRevocationListContext(
+	ctx context.Context,
+	template *x509.RevocationList,
+	baseCRLNumber *big.Int,
+) ([]byte, error) {
+	if template.Number == nil || baseCRLNumber == nil || baseCRLNumber.Cmp(template.Number) >= 0 {
+		return nil, fmt.Errorf(
+			"Base CRL number %v must be lower than the delta CRL number %v",
+			baseCRLNumber,
+			template.Number,
+		)
+	}
+
+	value, err := asn1.Marshal(baseCRLNumber)
+
+	if err != nil {
+		return nil, err
+	}
+
+	deltaCRLIndicatorExt := pkix.Extension{Id: deltaCRLIndicatorOID, Critical: true, Value: value}
+
+	template.ExtraExtensions = append(template.ExtraExtensions, deltaCRLIndicatorExt)
+
+	return signer.CreateRevocationListContext(ctx, template)
+}
+
+func (signer *GoogleKMSSigner) createRevocationListWithStandIn(
+	ctx context.Context,
+	template *x509.RevocationList,
+) ([]byte, error) {
+	standInSigner, err := newStandInSigner(template.SignatureAlgorithm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rawRevocationList, err := x509.CreateRevocationList(
+		rand.Reader,
+		template,
+		signer.certificate,
+		standInSigner,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// a CRL has no public key to replace, only the signature.
+	return signer.resign(ctx, rawRevocationList, nil, nil, template.SignatureAlgorithm)
+}
@@ -0,0 +1,237 @@
+package kmssign
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/ericnorris/google-kms-x509/kmssign/kmsfake"
+)
+
+func TestCreateRevocationList(t *testing.T) {
+	thisUpdate := time.Now().UTC().Truncate(time.Second)
+	revocationTime := thisUpdate.Add(-time.Hour)
+	invalidityDate := thisUpdate.Add(-24 * time.Hour)
+
+	for _, algorithm := range kmsfake.SigningAlgorithms() {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			signer, root := testRootCA(t, algorithm)
+
+			invalidityDateExt, err := InvalidityDateExtension(invalidityDate)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rawRevocationList, err := signer.CreateRevocationList(&x509.RevocationList{
+				Number:     big.NewInt(42),
+				ThisUpdate: thisUpdate,
+				NextUpdate: thisUpdate.AddDate(0, 0, 7),
+				RevokedCertificateEntries: []x509.RevocationListEntry{
+					{
+						SerialNumber:    big.NewInt(1),
+						RevocationTime:  revocationTime,
+						ReasonCode:      RevocationReasons["keyCompromise"],
+						ExtraExtensions: []pkix.Extension{invalidityDateExt},
+					},
+					{
+						SerialNumber:   big.NewInt(2),
+						RevocationTime: revocationTime,
+					},
+				},
+			})
+
+			if err != nil {
+				t.Fatalf("CreateRevocationList() failed: %v", err)
+			}
+
+			revocationList, err := x509.ParseRevocationList(rawRevocationList)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = root.CheckSignature(
+				revocationList.SignatureAlgorithm,
+				revocationList.RawTBSRevocationList,
+				revocationList.Signature,
+			)
+
+			if err != nil {
+				t.Errorf("Revocation list signature does not verify: %v", err)
+			}
+
+			if revocationList.Number.Int64() != 42 {
+				t.Errorf("Number = %v, want 42", revocationList.Number)
+			}
+
+			if !revocationList.ThisUpdate.Equal(thisUpdate) {
+				t.Errorf("ThisUpdate = %v, want %v", revocationList.ThisUpdate, thisUpdate)
+			}
+
+			if !bytes.Equal(revocationList.AuthorityKeyId, root.SubjectKeyId) {
+				t.Errorf("AuthorityKeyId = %x, want %x", revocationList.AuthorityKeyId, root.SubjectKeyId)
+			}
+
+			entries := revocationList.RevokedCertificateEntries
+
+			if len(entries) != 2 {
+				t.Fatalf("Got %d revoked certificates, want 2", len(entries))
+			}
+
+			if entries[0].ReasonCode != 1 || entries[1].ReasonCode != 0 {
+				t.Errorf("Reason codes = %d, %d, want 1, 0", entries[0].ReasonCode, entries[1].ReasonCode)
+			}
+
+			if !entries[0].RevocationTime.Equal(revocationTime) {
+				t.Errorf("RevocationTime = %v, want %v", entries[0].RevocationTime, revocationTime)
+			}
+
+			var gotInvalidityDate time.Time
+
+			for _, extension := range entries[0].Extensions {
+				if extension.Id.Equal(invalidityDateOID) {
+					_, err = asn1.UnmarshalWithParams(extension.Value, &gotInvalidityDate, "generalized")
+				}
+			}
+
+			if err != nil || !gotInvalidityDate.Equal(invalidityDate) {
+				t.Errorf("Invalidity date = %v (%v), want %v", gotInvalidityDate, err, invalidityDate)
+			}
+		})
+	}
+}
+
+func TestCreateRevocationListErrors(t *testing.T) {
+	template := func() *x509.RevocationList {
+		return &x509.RevocationList{
+			Number:     big.NewInt(1),
+			ThisUpdate: time.Now(),
+			NextUpdate: time.Now().Add(time.Hour),
+		}
+	}
+
+	signer := testSigner(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, nil)
+
+	if _, err := signer.CreateRevocationList(template()); err == nil {
+		t.Error("CreateRevocationList() without an issuer succeeded")
+	}
+
+	root, _ := testRootCA(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+
+	leafTemplate := testCATemplate("leaf")
+	leafTemplate.IsCA = false
+
+	rawLeaf, err := root.CreateCertificate(leafTemplate, signer.Public(), false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := ParseCertificate(rawLeaf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leafSigner := testSigner(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, leaf)
+
+	if _, err := leafSigner.CreateRevocationList(template()); !errors.Is(err, ErrParentNotCA) {
+		t.Errorf("CreateRevocationList() with a non-CA issuer = %v, want ErrParentNotCA", err)
+	}
+}
+
+func TestParseRevocationReason(t *testing.T) {
+	for reason, want := range map[string]int{
+		"keyCompromise":  1,
+		"KEYCOMPROMISE":  1,
+		"superseded":     4,
+		"10":             10,
+		"0":              0,
+		"removeFromCRL":  8,
+		"privilegeWithd": -1,
+		"7":              -1,
+	} {
+		got, err := ParseRevocationReason(reason)
+
+		if want == -1 {
+			if err == nil {
+				t.Errorf("ParseRevocationReason(%q) = %d, want an error", reason, got)
+			}
+		} else if err != nil || got != want {
+			t.Errorf("ParseRevocationReason(%q) = %d, %v, want %d", reason, got, err, want)
+		}
+	}
+}
+
+func TestCreateDeltaRevocationList(t *testing.T) {
+	signer, _ := testRootCA(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+
+	freshestCRLExt, err := FreshestCRLExtension("http://crl.example.com/delta.crl")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := func(number int64) *x509.RevocationList {
+		return &x509.RevocationList{
+			Number:          big.NewInt(number),
+			ThisUpdate:      time.Now(),
+			NextUpdate:      time.Now().Add(time.Hour),
+			ExtraExtensions: []pkix.Extension{freshestCRLExt},
+		}
+	}
+
+	rawRevocationList, err := signer.CreateDeltaRevocationList(template(6), big.NewInt(5))
+
+	if err != nil {
+		t.Fatalf("CreateDeltaRevocationList() failed: %v", err)
+	}
+
+	revocationList, err := x509.ParseRevocationList(rawRevocationList)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var baseCRLNumber *big.Int
+	var distributionPoints []distributionPoint
+
+	for _, extension := range revocationList.Extensions {
+		switch {
+		case extension.Id.Equal(deltaCRLIndicatorOID):
+			if !extension.Critical {
+				t.Error("Delta CRL indicator is not critical")
+			}
+
+			_, err = asn1.Unmarshal(extension.Value, &baseCRLNumber)
+
+		case extension.Id.Equal(freshestCRLOID):
+			_, err = asn1.Unmarshal(extension.Value, &distributionPoints)
+		}
+
+		if err != nil {
+			t.Fatalf("Could not parse extension %s: %v", extension.Id, err)
+		}
+	}
+
+	if baseCRLNumber == nil || baseCRLNumber.Int64() != 5 {
+		t.Errorf("Base CRL number = %v, want 5", baseCRLNumber)
+	}
+
+	if len(distributionPoints) != 1 ||
+		string(distributionPoints[0].DistributionPoint.FullName[0].Bytes) !=
+			"http://crl.example.com/delta.crl" {
+		t.Errorf("Unexpected freshest CRL distribution points: %+v", distributionPoints)
+	}
+
+	if _, err := signer.CreateDeltaRevocationList(template(5), big.NewInt(5)); err == nil {
+		t.Error("CreateDeltaRevocationList() with base CRL number 5 for CRL number 5 succeeded")
+	}
+}
@@ -0,0 +1,44 @@
+package kmssign
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"fmt"
+)
+
+// digestInfoPrefixes are the DER encodings of a DigestInfo up to the digest, see RFC 8017 section
+// 9.2, note 1. Raw PKCS#1 keys in Cloud KMS sign a DigestInfo built by the caller.
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256: {
+		0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01,
+		0x05, 0x00, 0x04, 0x20,
+	},
+	crypto.SHA384: {
+		0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02,
+		0x05, 0x00, 0x04, 0x30,
+	},
+	crypto.SHA512: {
+		0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03,
+		0x05, 0x00, 0x04, 0x40,
+	},
+}
+
+func encodeDigestInfo(digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, fmt.Errorf("Raw PKCS#1 keys cannot make RSA-PSS signatures")
+	}
+
+	prefix, ok := digestInfoPrefixes[opts.HashFunc()]
+
+	if !ok {
+		return nil, fmt.Errorf("Unsupported hash function for raw PKCS#1 key: %v", opts.HashFunc())
+	}
+
+	if len(digest) != opts.HashFunc().Size() {
+		return nil, fmt.Errorf(
+			"Digest is %d bytes, wanted %d for %v", len(digest), opts.HashFunc().Size(), opts.HashFunc(),
+		)
+	}
+
+	return append(append([]byte{}, prefix...), digest...), nil
+}
@@ -0,0 +1,50 @@
+package kmssign
+
+import (
+	"errors"
+	"fmt"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	// ErrUnsupportedAlgorithm is returned by NewGoogleKMSSigner for key versions whose algorithm
+	// cannot be used to sign certificates.
+	ErrUnsupportedAlgorithm = errors.New("unsupported key algorithm")
+
+	// ErrParentNotCA is returned when asked to sign a certificate with a parent certificate that is
+	// not a CA.
+	ErrParentNotCA = errors.New("parent certificate is not a CA")
+
+	// ErrInvalidSubjectAltName is returned by SubjectAltNames.Validate for names with an invalid
+	// syntax.
+	ErrInvalidSubjectAltName = errors.New("invalid subject alternative name")
+
+	// ErrInvalidCertificatePolicy is returned for certificate policies and policy constraints
+	// that cannot be encoded.
+	ErrInvalidCertificatePolicy = errors.New("invalid certificate policy")
+
+	// ErrKMSUnavailable wraps errors from Cloud KMS calls that failed because the service was
+	// unavailable, overloaded or too slow, after any retries.
+	ErrKMSUnavailable = errors.New("Cloud KMS is unavailable")
+
+	// ErrPermissionDenied wraps errors from Cloud KMS calls that failed because the caller is not
+	// authenticated, or not allowed to use the key.
+	ErrPermissionDenied = errors.New("Cloud KMS permission denied")
+)
+
+// classifyError wraps errors from Cloud KMS calls with ErrKMSUnavailable or ErrPermissionDenied,
+// according to their gRPC status code.
+func classifyError(err error) error {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return fmt.Errorf("%w: %w", ErrKMSUnavailable, err)
+
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return fmt.Errorf("%w: %w", ErrPermissionDenied, err)
+
+	default:
+		return err
+	}
+}
@@ -1,6 +1,7 @@
 package kmssign
 
 import (
+	"bytes"
 	"context"
 	"crypto"
 	"crypto/rand"
@@ -9,40 +10,109 @@ import (
 	"crypto/x509/pkix"
 	"encoding/asn1"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"math/big"
 
 	cloudkms "cloud.google.com/go/kms/apiv1"
-	kmspb "google.golang.org/genproto/googleapis/cloud/kms/v1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	gax "github.com/googleapis/gax-go/v2"
 )
 
 var nsCommentOID = asn1.ObjectIdentifier{2, 16, 840, 1, 113730, 1, 13}
 
+var (
+	// ErrParentKeyMismatch is returned by NewGoogleKMSSignerWithCertificate when the certificate's
+	// public key is not the Cloud KMS key's public key.
+	ErrParentKeyMismatch = errors.New("parent certificate public key does not match the KMS key")
+
+	// ErrSignatureVerificationFailed is returned when a certificate or CSR signed by Cloud KMS does
+	// not verify against the parent's public key.
+	ErrSignatureVerificationFailed = errors.New("signature verification failed")
+)
+
+// KeyManagementClient is the subset of the Cloud KMS API used by GoogleKMSSigner. It is
+// satisfied by *cloudkms.KeyManagementClient, and by kmsfake.KeyManagementClient in tests.
+type KeyManagementClient interface {
+	GetCryptoKeyVersion(
+		ctx context.Context,
+		req *kmspb.GetCryptoKeyVersionRequest,
+		opts ...gax.CallOption,
+	) (*kmspb.CryptoKeyVersion, error)
+
+	GetPublicKey(
+		ctx context.Context,
+		req *kmspb.GetPublicKeyRequest,
+		opts ...gax.CallOption,
+	) (*kmspb.PublicKey, error)
+
+	AsymmetricSign(
+		ctx context.Context,
+		req *kmspb.AsymmetricSignRequest,
+		opts ...gax.CallOption,
+	) (*kmspb.AsymmetricSignResponse, error)
+
+	GetCryptoKey(
+		ctx context.Context,
+		req *kmspb.GetCryptoKeyRequest,
+		opts ...gax.CallOption,
+	) (*kmspb.CryptoKey, error)
+
+	ListCryptoKeyVersions(
+		ctx context.Context,
+		req *kmspb.ListCryptoKeyVersionsRequest,
+		opts ...gax.CallOption,
+	) *cloudkms.CryptoKeyVersionIterator
+}
+
+var _ KeyManagementClient = (*cloudkms.KeyManagementClient)(nil)
+
 type GoogleKMSSigner struct {
 	// not ideal, but crypto.Signer doesn't have an obvious way to pass in a context.
 	// see https://github.com/golang/go/issues/28427
+	//
+	// this is the context given to the constructor, and is only used by the methods that don't
+	// take a context; see SignContext and SignerWithContext.
 	ctx context.Context
 
-	client             *cloudkms.KeyManagementClient
+	client             KeyManagementClient
 	keyVersion         *kmspb.CryptoKeyVersion
 	signatureAlgorithm x509.SignatureAlgorithm
 	hashFunction       crypto.Hash
 	publicKey          crypto.PublicKey
 	certificate        *x509.Certificate
+	options            signerOptions
 }
 
+// NewGoogleKMSSigner returns a signer for keyName, which is either a CryptoKeyVersion name, or a
+// CryptoKey name whose version is chosen as described by WithVersionSelector. The key must be an
+// ASYMMETRIC_SIGN key, and the chosen version must be ENABLED and meet the protection level set by
+// WithMinimumProtectionLevel. Its name is available from KeyVersionName.
 func NewGoogleKMSSigner(
 	ctx context.Context,
-	client *cloudkms.KeyManagementClient,
+	client KeyManagementClient,
 	keyName string,
+	opts ...Option,
 ) (*GoogleKMSSigner, error) {
-	keyVersion, err := client.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{
-		Name: keyName,
-	})
+	options := defaultSignerOptions()
+
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	cryptoKey, keyVersion, err := resolveKeyVersion(ctx, client, keyName, options)
 
 	if err != nil {
-		return nil, fmt.Errorf("Could not get key version information: %w", err)
+		return nil, err
+	}
+
+	if err := checkKeyVersionState(keyVersion); err != nil {
+		return nil, err
+	}
+
+	if err := checkKeyPolicy(cryptoKey, keyVersion, options); err != nil {
+		return nil, err
 	}
 
 	signatureAlgorithm, hashFunction, err := determineSignatureAlgorithm(keyVersion)
@@ -51,7 +121,7 @@ func NewGoogleKMSSigner(
 		return nil, err
 	}
 
-	publicKey, err := getPublicKey(ctx, client, keyVersion)
+	publicKey, err := getPublicKey(ctx, client, keyVersion, options.retryPolicy)
 
 	if err != nil {
 		return nil, err
@@ -65,6 +135,7 @@ func NewGoogleKMSSigner(
 		hashFunction,
 		publicKey,
 		nil,
+		options,
 	}
 
 	return signer, nil
@@ -72,32 +143,75 @@ func NewGoogleKMSSigner(
 
 func NewGoogleKMSSignerWithCertificate(
 	ctx context.Context,
-	client *cloudkms.KeyManagementClient,
+	client KeyManagementClient,
 	keyName string,
 	certificate *x509.Certificate,
+	opts ...Option,
 ) (*GoogleKMSSigner, error) {
-	signer, err := NewGoogleKMSSigner(ctx, client, keyName)
+	signer, err := NewGoogleKMSSigner(ctx, client, keyName, opts...)
 
 	if err != nil {
 		return nil, err
 	}
 
+	if certificate != nil {
+		if err := checkParentPublicKey(certificate, signer.publicKey); err != nil {
+			return nil, err
+		}
+	}
+
 	signer.certificate = certificate
 
 	return signer, nil
 }
 
+// checkParentPublicKey returns an error unless the certificate's SubjectPublicKeyInfo is the same
+// as publicKey's.
+func checkParentPublicKey(certificate *x509.Certificate, publicKey crypto.PublicKey) error {
+	parentSPKI := certificate.RawSubjectPublicKeyInfo
+
+	if len(parentSPKI) == 0 && certificate.PublicKey != nil {
+		var err error
+
+		if parentSPKI, err = marshalPKIXPublicKey(certificate.PublicKey); err != nil {
+			return fmt.Errorf("Could not marshal parent certificate public key: %w", err)
+		}
+	}
+
+	spki, err := marshalPKIXPublicKey(publicKey)
+
+	if err != nil {
+		return fmt.Errorf("Could not marshal KMS public key: %w", err)
+	}
+
+	if !bytes.Equal(parentSPKI, spki) {
+		return fmt.Errorf("%w: %s", ErrParentKeyMismatch, certificate.Subject)
+	}
+
+	return nil
+}
+
 func (signer *GoogleKMSSigner) CreateCertificate(
 	template *x509.Certificate,
 	signee crypto.PublicKey,
 	generateComment bool,
+) (cert []byte, err error) {
+	return signer.CreateCertificateContext(signer.ctx, template, signee, generateComment)
+}
+
+// CreateCertificateContext is like CreateCertificate, but uses ctx for the call to Cloud KMS.
+func (signer *GoogleKMSSigner) CreateCertificateContext(
+	ctx context.Context,
+	template *x509.Certificate,
+	signee crypto.PublicKey,
+	generateComment bool,
 ) (cert []byte, err error) {
 	if signer.certificate == nil {
 		return nil, fmt.Errorf("Cannot sign child certificate without a parent")
 	}
 
 	if signer.certificate.IsCA == false {
-		return nil, fmt.Errorf("Cannot sign certificate with a non-CA certificate")
+		return nil, fmt.Errorf("Cannot sign certificate with a non-CA certificate: %w", ErrParentNotCA)
 	}
 
 	subjectKeyId, err := computeSubjectKeyIdentifier(signee)
@@ -106,15 +220,14 @@ func (signer *GoogleKMSSigner) CreateCertificate(
 		return nil, fmt.Errorf("Could not compute subject key identifier: %w", err)
 	}
 
-	serialNumber, err := generateSerialNumber()
+	signatureAlgorithm, _, err := signer.operationSignatureAlgorithm(template.SignatureAlgorithm)
 
 	if err != nil {
-		return nil, fmt.Errorf("Could not generate serial number: %w", err)
+		return nil, err
 	}
 
-	template.SignatureAlgorithm = signer.signatureAlgorithm
+	template.SignatureAlgorithm = signatureAlgorithm
 	template.SubjectKeyId = subjectKeyId
-	template.SerialNumber = serialNumber
 
 	if generateComment {
 		nsCommentExt := pkix.Extension{
@@ -125,24 +238,111 @@ func (signer *GoogleKMSSigner) CreateCertificate(
 		template.ExtraExtensions = append(template.ExtraExtensions, nsCommentExt)
 	}
 
-	rawCertificate, err := x509.CreateCertificate(
-		rand.Reader,
-		template,
-		signer.certificate,
-		signee,
-		signer,
-	)
+	if err := signer.checkCertificate(ctx, template); err != nil {
+		return nil, fmt.Errorf("Could not issue certificate: %w", err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		certificate, err := signer.createCertificate(ctx, template, signee)
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = signer.recordCertificate(ctx, template, certificate)
+
+		if errors.Is(err, ErrSerialNumberCollision) && attempt < maxSerialNumberAttempts {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("Could not record issued certificate: %w", err)
+		}
+
+		return certificate.Raw, nil
+	}
+}
+
+// createCertificate signs template with a new serial number, and returns the verified
+// certificate.
+func (signer *GoogleKMSSigner) createCertificate(
+	ctx context.Context,
+	template *x509.Certificate,
+	signee crypto.PublicKey,
+) (*x509.Certificate, error) {
+	serialNumber, err := signer.options.serialNumberGenerator()
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not generate serial number: %w", err)
+	}
+
+	template.SerialNumber = serialNumber
+
+	var rawCertificate []byte
+
+	if signer.needsStandIn(signee) {
+		rawCertificate, err = signer.createCertificateWithStandIn(ctx, template, signee)
+	} else {
+		rawCertificate, err = x509.CreateCertificate(
+			rand.Reader,
+			template,
+			signer.certificate,
+			signee,
+			signer.SignerWithContext(ctx),
+		)
+	}
 
 	if err != nil {
 		return nil, fmt.Errorf("Could not create certificate: %w", err)
 	}
 
-	return rawCertificate, nil
+	return signer.verifyCertificate(rawCertificate)
+}
+
+// verifyCertificate checks the signature of a certificate issued by the signer against the
+// parent's public key, which is the signer's own for self-signed certificates, and returns the
+// parsed certificate.
+func (signer *GoogleKMSSigner) verifyCertificate(
+	rawCertificate []byte,
+) (*x509.Certificate, error) {
+	certificate, err := ParseCertificate(rawCertificate)
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse issued certificate: %w", err)
+	}
+
+	parent := signer.certificate
+
+	if parent.PublicKey == nil {
+		parent = &x509.Certificate{PublicKey: signer.publicKey}
+	}
+
+	err = parent.CheckSignature(
+		certificate.SignatureAlgorithm,
+		certificate.RawTBSCertificate,
+		certificate.Signature,
+	)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: issued certificate: %v", ErrSignatureVerificationFailed, err)
+	}
+
+	return certificate, nil
 }
 
 func (signer *GoogleKMSSigner) CreateSelfSignedCertificate(
 	template *x509.Certificate,
 	generateComment bool,
+) (cert []byte, err error) {
+	return signer.CreateSelfSignedCertificateContext(signer.ctx, template, generateComment)
+}
+
+// CreateSelfSignedCertificateContext is like CreateSelfSignedCertificate, but uses ctx for the
+// call to Cloud KMS.
+func (signer *GoogleKMSSigner) CreateSelfSignedCertificateContext(
+	ctx context.Context,
+	template *x509.Certificate,
+	generateComment bool,
 ) (cert []byte, err error) {
 	if signer.certificate != nil {
 		return nil, fmt.Errorf("Cannot create self signed certificate with a parent")
@@ -150,7 +350,12 @@ func (signer *GoogleKMSSigner) CreateSelfSignedCertificate(
 
 	signer.certificate = template
 
-	rawCertificate, err := signer.CreateCertificate(template, signer.publicKey, generateComment)
+	rawCertificate, err := signer.CreateCertificateContext(
+		ctx,
+		template,
+		signer.publicKey,
+		generateComment,
+	)
 
 	if err != nil {
 		signer.certificate = nil
@@ -163,7 +368,23 @@ func (signer *GoogleKMSSigner) CreateCertificateRequest(
 	template *x509.CertificateRequest,
 	generateComment bool,
 ) (cert []byte, err error) {
-	template.SignatureAlgorithm = signer.signatureAlgorithm
+	return signer.CreateCertificateRequestContext(signer.ctx, template, generateComment)
+}
+
+// CreateCertificateRequestContext is like CreateCertificateRequest, but uses ctx for the call to
+// Cloud KMS.
+func (signer *GoogleKMSSigner) CreateCertificateRequestContext(
+	ctx context.Context,
+	template *x509.CertificateRequest,
+	generateComment bool,
+) (cert []byte, err error) {
+	signatureAlgorithm, _, err := signer.operationSignatureAlgorithm(template.SignatureAlgorithm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	template.SignatureAlgorithm = signatureAlgorithm
 
 	if generateComment {
 		nsCommentExt := pkix.Extension{
@@ -174,56 +395,120 @@ func (signer *GoogleKMSSigner) CreateCertificateRequest(
 		template.ExtraExtensions = append(template.ExtraExtensions, nsCommentExt)
 	}
 
-	rawCertificateRequest, err := x509.CreateCertificateRequest(
-		rand.Reader,
-		template,
-		signer,
-	)
+	var rawCertificateRequest []byte
+
+	if signer.needsStandIn(signer.publicKey) {
+		rawCertificateRequest, err = signer.createCertificateRequestWithStandIn(ctx, template)
+	} else {
+		rawCertificateRequest, err = x509.CreateCertificateRequest(
+			rand.Reader,
+			template,
+			signer.SignerWithContext(ctx),
+		)
+	}
 
 	if err != nil {
 		return nil, fmt.Errorf("Could not create certificate request: %w", err)
 	}
 
+	certificateRequest, err := ParseCertificateRequest(rawCertificateRequest)
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse certificate request: %w", err)
+	}
+
+	if err := certificateRequest.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("%w: certificate request: %v", ErrSignatureVerificationFailed, err)
+	}
+
 	return rawCertificateRequest, nil
 }
 
+// KeyVersionName returns the name of the CryptoKeyVersion the signer uses.
+func (signer *GoogleKMSSigner) KeyVersionName() string {
+	return signer.keyVersion.Name
+}
+
 func (signer *GoogleKMSSigner) Public() crypto.PublicKey {
 	return signer.publicKey
 }
 
+// SignerWithContext returns a crypto.Signer for the same key, whose Sign method uses ctx instead of
+// the context given to the constructor. It can be passed to functions like x509.CreateCertificate
+// to bound a single operation with a deadline or cancellation.
+func (signer *GoogleKMSSigner) SignerWithContext(ctx context.Context) crypto.Signer {
+	return &contextSigner{signer, ctx}
+}
+
 func (signer *GoogleKMSSigner) Sign(
 	rand io.Reader,
 	digest []byte,
 	opts crypto.SignerOpts,
 ) (signature []byte, err error) {
-	if opts.HashFunc() != signer.hashFunction {
-		return nil, fmt.Errorf(
-			"Unexpected hash function, got: %v, wanted %v", opts.HashFunc(), signer.hashFunction,
-		)
+	return signer.SignContext(signer.ctx, rand, digest, opts)
+}
+
+// SignContext is like Sign, but uses ctx for the call to Cloud KMS.
+func (signer *GoogleKMSSigner) SignContext(
+	ctx context.Context,
+	rand io.Reader,
+	digest []byte,
+	opts crypto.SignerOpts,
+) (signature []byte, err error) {
+	signRequest := &kmspb.AsymmetricSignRequest{
+		Name: signer.keyVersion.Name,
 	}
 
-	var kmspbDigest kmspb.Digest
+	if isRawPKCS1(signer.keyVersion.Algorithm) {
+		digestInfo, err := encodeDigestInfo(digest, opts)
 
-	switch opts.HashFunc() {
-	case crypto.SHA256:
-		kmspbDigest = kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: digest}}
+		if err != nil {
+			return nil, err
+		}
 
-	case crypto.SHA384:
-		kmspbDigest = kmspb.Digest{Digest: &kmspb.Digest_Sha384{Sha384: digest}}
+		signRequest.Data = digestInfo
+		signRequest.DataCrc32C = crc32c(digestInfo)
+	} else {
+		if opts.HashFunc() != signer.hashFunction {
+			return nil, fmt.Errorf(
+				"Unexpected hash function, got: %v, wanted %v", opts.HashFunc(), signer.hashFunction,
+			)
+		}
 
-	case crypto.SHA512:
-		kmspbDigest = kmspb.Digest{Digest: &kmspb.Digest_Sha512{Sha512: digest}}
+		switch opts.HashFunc() {
+		case 0:
+			// Ed25519 keys sign the whole message, which crypto.Signer passes in place of a digest.
+			signRequest.Data = digest
+			signRequest.DataCrc32C = crc32c(digest)
 
-	default:
-		return nil, fmt.Errorf("Cannot convert hash function %v to KMS digest", opts.HashFunc())
-	}
+		case crypto.SHA256:
+			signRequest.Digest = &kmspb.Digest{Digest: &kmspb.Digest_Sha256{Sha256: digest}}
+			signRequest.DigestCrc32C = crc32c(digest)
 
-	signRequest := &kmspb.AsymmetricSignRequest{
-		Name:   signer.keyVersion.Name,
-		Digest: &kmspbDigest,
+		case crypto.SHA384:
+			signRequest.Digest = &kmspb.Digest{Digest: &kmspb.Digest_Sha384{Sha384: digest}}
+			signRequest.DigestCrc32C = crc32c(digest)
+
+		case crypto.SHA512:
+			signRequest.Digest = &kmspb.Digest{Digest: &kmspb.Digest_Sha512{Sha512: digest}}
+			signRequest.DigestCrc32C = crc32c(digest)
+
+		default:
+			return nil, fmt.Errorf("Cannot convert hash function %v to KMS digest", opts.HashFunc())
+		}
 	}
 
-	signResponse, err := signer.client.AsymmetricSign(signer.ctx, signRequest)
+	var signResponse *kmspb.AsymmetricSignResponse
+
+	err = signer.options.retryPolicy.retry(ctx, func() (err error) {
+		signResponse, err = signer.client.AsymmetricSign(ctx, signRequest)
+
+		if err != nil {
+			return err
+		}
+
+		return verifyAsymmetricSignResponse(signRequest, signResponse)
+	})
 
 	if err != nil {
 		return nil, fmt.Errorf("Error in AsymmetricSign(): %w", err)
@@ -232,6 +517,48 @@ func (signer *GoogleKMSSigner) Sign(
 	return signResponse.Signature, nil
 }
 
+func verifyAsymmetricSignResponse(
+	request *kmspb.AsymmetricSignRequest,
+	response *kmspb.AsymmetricSignResponse,
+) error {
+	if request.Data != nil && !response.VerifiedDataCrc32C {
+		return fmt.Errorf("%w: request data was not verified", ErrIntegrityCheckFailed)
+	}
+
+	if request.Digest != nil && !response.VerifiedDigestCrc32C {
+		return fmt.Errorf("%w: request digest was not verified", ErrIntegrityCheckFailed)
+	}
+
+	if response.Name != request.Name {
+		return fmt.Errorf(
+			"%w: response is for key %q, not %q", ErrIntegrityCheckFailed, response.Name, request.Name,
+		)
+	}
+
+	if !verifyCRC32C(response.Signature, response.SignatureCrc32C) {
+		return fmt.Errorf("%w: signature checksum mismatch", ErrIntegrityCheckFailed)
+	}
+
+	return nil
+}
+
+type contextSigner struct {
+	signer *GoogleKMSSigner
+	ctx    context.Context
+}
+
+func (signer *contextSigner) Public() crypto.PublicKey {
+	return signer.signer.Public()
+}
+
+func (signer *contextSigner) Sign(
+	rand io.Reader,
+	digest []byte,
+	opts crypto.SignerOpts,
+) (signature []byte, err error) {
+	return signer.signer.SignContext(signer.ctx, rand, digest, opts)
+}
+
 func determineSignatureAlgorithm(
 	keyVersion *kmspb.CryptoKeyVersion,
 ) (x509.SignatureAlgorithm, crypto.Hash, error) {
@@ -246,6 +573,14 @@ func determineSignatureAlgorithm(
 	case kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA512:
 		return x509.SHA512WithRSA, crypto.SHA512, nil
 
+	case kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_2048:
+		fallthrough
+	case kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_3072:
+		fallthrough
+	case kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_4096:
+		// the hash is chosen per operation, see operationSignatureAlgorithm.
+		return x509.SHA256WithRSA, crypto.SHA256, nil
+
 	case kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256:
 		fallthrough
 	case kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256:
@@ -262,21 +597,93 @@ func determineSignatureAlgorithm(
 	case kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384:
 		return x509.ECDSAWithSHA384, crypto.SHA384, nil
 
+	case kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256:
+		return x509.ECDSAWithSHA256, crypto.SHA256, nil
+
+	case kmspb.CryptoKeyVersion_EC_SIGN_ED25519:
+		return x509.PureEd25519, 0, nil
+
 	default:
 		return x509.UnknownSignatureAlgorithm, 0, fmt.Errorf(
-			"Key version has unsupported algorithm: %s",
+			"%w: key version %s has algorithm %s",
+			ErrUnsupportedAlgorithm,
+			keyVersion.Name,
 			keyVersion.Algorithm,
 		)
 	}
 }
 
+func isRawPKCS1(algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm) bool {
+	switch algorithm {
+	case kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_2048,
+		kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_3072,
+		kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_4096:
+		return true
+
+	default:
+		return false
+	}
+}
+
+// operationSignatureAlgorithm returns the signature algorithm and hash function to use for a
+// certificate, CSR or CRL whose template asks for requested. Most keys only support a single
+// algorithm; raw PKCS#1 keys can use any of the PKCS#1 v1.5 RSA algorithms. An unknown requested
+// algorithm selects the key's default.
+func (signer *GoogleKMSSigner) operationSignatureAlgorithm(
+	requested x509.SignatureAlgorithm,
+) (x509.SignatureAlgorithm, crypto.Hash, error) {
+	if requested == x509.UnknownSignatureAlgorithm || requested == signer.signatureAlgorithm {
+		return signer.signatureAlgorithm, signer.hashFunction, nil
+	}
+
+	if isRawPKCS1(signer.keyVersion.Algorithm) {
+		switch requested {
+		case x509.SHA384WithRSA:
+			return requested, crypto.SHA384, nil
+
+		case x509.SHA512WithRSA:
+			return requested, crypto.SHA512, nil
+		}
+	}
+
+	return x509.UnknownSignatureAlgorithm, 0, fmt.Errorf(
+		"Key version with algorithm %s cannot sign with %v",
+		signer.keyVersion.Algorithm,
+		requested,
+	)
+}
+
 func getPublicKey(
 	ctx context.Context,
-	client *cloudkms.KeyManagementClient,
+	client KeyManagementClient,
 	keyVersion *kmspb.CryptoKeyVersion,
+	retryPolicy RetryPolicy,
 ) (crypto.PublicKey, error) {
-	publicKeyResponse, err := client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{
-		Name: keyVersion.Name,
+	var publicKeyResponse *kmspb.PublicKey
+
+	err := retryPolicy.retry(ctx, func() (err error) {
+		publicKeyResponse, err = client.GetPublicKey(ctx, &kmspb.GetPublicKeyRequest{
+			Name: keyVersion.Name,
+		})
+
+		if err != nil {
+			return err
+		}
+
+		if publicKeyResponse.Name != keyVersion.Name {
+			return fmt.Errorf(
+				"%w: response is for key %q, not %q",
+				ErrIntegrityCheckFailed,
+				publicKeyResponse.Name,
+				keyVersion.Name,
+			)
+		}
+
+		if !verifyCRC32C([]byte(publicKeyResponse.Pem), publicKeyResponse.PemCrc32C) {
+			return fmt.Errorf("%w: public key checksum mismatch", ErrIntegrityCheckFailed)
+		}
+
+		return nil
 	})
 
 	if err != nil {
@@ -289,7 +696,7 @@ func getPublicKey(
 		return nil, fmt.Errorf("Invalid PEM data in GetPublicKey() response")
 	}
 
-	publicKey, err := x509.ParsePKIXPublicKey(pemBlock.Bytes)
+	publicKey, err := parsePKIXPublicKey(pemBlock.Bytes)
 
 	if err != nil {
 		return nil, fmt.Errorf("Could not parse public key: %w", err)
@@ -300,7 +707,7 @@ func getPublicKey(
 
 // https://tools.ietf.org/html/rfc3280#section-4.2.1.2
 func computeSubjectKeyIdentifier(subjectPublicKey crypto.PublicKey) ([]byte, error) {
-	derEncodedPublicKey, err := x509.MarshalPKIXPublicKey(subjectPublicKey)
+	derEncodedPublicKey, err := marshalPKIXPublicKey(subjectPublicKey)
 
 	if err != nil {
 		return nil, err
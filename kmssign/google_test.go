@@ -1,9 +1,620 @@
 package kmssign
 
 import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/ericnorris/google-kms-x509/kmssign/kmsfake"
+)
+
+const testKeyRing = "projects/test/locations/global/keyRings/test"
+
+var (
+	testClient     *kmsfake.KeyManagementClient
+	testClientOnce sync.Once
+	testKeyNames   = map[kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm]string{}
+	testKeyNamesMu sync.Mutex
 )
 
-func TestDummy(t *testing.T) {
-	t.Skip("TODO")
+// testKey returns the name of a key version with the given algorithm, creating it on first use.
+// Keys are shared between tests since RSA key generation is slow.
+func testKey(
+	t *testing.T,
+	algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm,
+) (*kmsfake.KeyManagementClient, string) {
+	t.Helper()
+
+	testClientOnce.Do(func() {
+		testClient = kmsfake.NewKeyManagementClient()
+
+		_, err := testClient.CreateKeyRing(context.Background(), &kmspb.CreateKeyRingRequest{
+			Parent:    "projects/test/locations/global",
+			KeyRingId: "test",
+		})
+
+		if err != nil {
+			panic(err)
+		}
+	})
+
+	testKeyNamesMu.Lock()
+	defer testKeyNamesMu.Unlock()
+
+	if name, ok := testKeyNames[algorithm]; ok {
+		return testClient, name
+	}
+
+	purpose := kmspb.CryptoKey_ASYMMETRIC_SIGN
+
+	if strings.Contains(algorithm.String(), "DECRYPT") {
+		purpose = kmspb.CryptoKey_ASYMMETRIC_DECRYPT
+	}
+
+	cryptoKey, err := testClient.CreateCryptoKey(context.Background(), &kmspb.CreateCryptoKeyRequest{
+		Parent:      testKeyRing,
+		CryptoKeyId: strings.ToLower(algorithm.String()),
+		CryptoKey: &kmspb.CryptoKey{
+			Purpose: purpose,
+			VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+				Algorithm: algorithm,
+			},
+		},
+	})
+
+	if err != nil {
+		t.Fatalf("Could not create test key: %v", err)
+	}
+
+	name := cryptoKey.Name + "/cryptoKeyVersions/1"
+	testKeyNames[algorithm] = name
+
+	return testClient, name
+}
+
+func testSigner(
+	t *testing.T,
+	algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm,
+	parent *x509.Certificate,
+) *GoogleKMSSigner {
+	t.Helper()
+
+	client, keyName := testKey(t, algorithm)
+
+	signer, err := NewGoogleKMSSignerWithCertificate(context.Background(), client, keyName, parent)
+
+	if err != nil {
+		t.Fatalf("NewGoogleKMSSigner(%s) failed: %v", algorithm, err)
+	}
+
+	return signer
+}
+
+func testCATemplate(commonName string) *x509.Certificate {
+	now := time.Now()
+
+	return &x509.Certificate{
+		Subject:               pkix.Name{CommonName: commonName},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		NotBefore:             now,
+		NotAfter:              now.AddDate(0, 0, 1),
+		KeyUsage: x509.KeyUsageDigitalSignature |
+			x509.KeyUsageCRLSign |
+			x509.KeyUsageCertSign,
+	}
+}
+
+func testRootCA(
+	t *testing.T,
+	algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm,
+) (*GoogleKMSSigner, *x509.Certificate) {
+	t.Helper()
+
+	signer := testSigner(t, algorithm, nil)
+
+	rawCertificate, err := signer.CreateSelfSignedCertificate(testCATemplate("root"), true)
+
+	if err != nil {
+		t.Fatalf("CreateSelfSignedCertificate() failed: %v", err)
+	}
+
+	certificate, err := ParseCertificate(rawCertificate)
+
+	if err != nil {
+		t.Fatalf("Could not parse root certificate: %v", err)
+	}
+
+	return testSigner(t, algorithm, certificate), certificate
+}
+
+func TestNewGoogleKMSSigner(t *testing.T) {
+	for _, algorithm := range kmsfake.SigningAlgorithms() {
+		algorithm := algorithm
+
+		t.Run(algorithm.String(), func(t *testing.T) {
+			signer := testSigner(t, algorithm, nil)
+
+			switch publicKey := signer.Public().(type) {
+			case *rsa.PublicKey:
+				if !strings.HasPrefix(algorithm.String(), "RSA_") {
+					t.Errorf("Got RSA public key for %s", algorithm)
+				}
+
+			case *ecdsa.PublicKey:
+				if !strings.HasPrefix(algorithm.String(), "EC_") {
+					t.Errorf("Got EC public key for %s", algorithm)
+				}
+
+			case ed25519.PublicKey:
+				if algorithm != kmspb.CryptoKeyVersion_EC_SIGN_ED25519 {
+					t.Errorf("Got Ed25519 public key for %s", algorithm)
+				}
+
+			default:
+				t.Errorf("Unexpected public key type %T", publicKey)
+			}
+		})
+	}
+}
+
+func TestNewGoogleKMSSignerErrors(t *testing.T) {
+	client, decryptKeyName := testKey(t, kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_2048_SHA256)
+
+	tests := []struct {
+		keyName string
+		wantErr string
+	}{
+		{decryptKeyName, "not an ASYMMETRIC_SIGN key"},
+		{testKeyRing + "/cryptoKeys/missing/cryptoKeyVersions/1", "Could not get key information"},
+	}
+
+	for _, test := range tests {
+		_, err := NewGoogleKMSSigner(context.Background(), client, test.keyName)
+
+		if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+			t.Errorf("NewGoogleKMSSigner(%s) = %v, want error containing %q", test.keyName, err, test.wantErr)
+		}
+	}
+}
+
+func TestDetermineSignatureAlgorithmUnsupported(t *testing.T) {
+	_, _, err := determineSignatureAlgorithm(&kmspb.CryptoKeyVersion{
+		Name:      testKeyRing + "/cryptoKeys/hmac/cryptoKeyVersions/1",
+		Algorithm: kmspb.CryptoKeyVersion_HMAC_SHA256,
+	})
+
+	if !errors.Is(err, ErrUnsupportedAlgorithm) {
+		t.Errorf("determineSignatureAlgorithm(HMAC_SHA256) = %v, want ErrUnsupportedAlgorithm", err)
+	}
+}
+
+func TestCreateSelfSignedCertificate(t *testing.T) {
+	for _, algorithm := range kmsfake.SigningAlgorithms() {
+		algorithm := algorithm
+
+		t.Run(algorithm.String(), func(t *testing.T) {
+			signer, root := testRootCA(t, algorithm)
+
+			if err := root.CheckSignatureFrom(root); err != nil {
+				t.Fatalf("Root certificate signature is invalid: %v", err)
+			}
+
+			if root.SignatureAlgorithm != signer.signatureAlgorithm {
+				t.Errorf("SignatureAlgorithm = %v, want %v", root.SignatureAlgorithm, signer.signatureAlgorithm)
+			}
+
+			if len(root.SubjectKeyId) == 0 {
+				t.Errorf("Root certificate has no subject key identifier")
+			}
+
+			spki, err := marshalPKIXPublicKey(signer.Public())
+
+			if err != nil {
+				t.Fatalf("Could not marshal public key: %v", err)
+			}
+
+			if !bytes.Equal(root.RawSubjectPublicKeyInfo, spki) {
+				t.Errorf("Root certificate does not contain the signer's public key")
+			}
+
+			wantComment := "Signed with Google KMS key: " + signer.keyVersion.Name
+
+			if !hasExtension(root, nsCommentOID, wantComment) {
+				t.Errorf("Root certificate is missing comment %q", wantComment)
+			}
+
+			if _, err := signer.CreateSelfSignedCertificate(testCATemplate("root"), false); err == nil {
+				t.Errorf("CreateSelfSignedCertificate() with a parent succeeded, want error")
+			}
+		})
+	}
+}
+
+func TestCreateCertificateChain(t *testing.T) {
+	for _, algorithm := range kmsfake.SigningAlgorithms() {
+		algorithm := algorithm
+
+		t.Run(algorithm.String(), func(t *testing.T) {
+			rootSigner, root := testRootCA(t, algorithm)
+
+			intermediateKey := testSigner(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, nil)
+			intermediateTemplate := testCATemplate("intermediate")
+			intermediateTemplate.MaxPathLenZero = true
+
+			rawIntermediate, err := rootSigner.CreateCertificate(
+				intermediateTemplate,
+				intermediateKey.Public(),
+				false,
+			)
+
+			if err != nil {
+				t.Fatalf("CreateCertificate(intermediate) failed: %v", err)
+			}
+
+			intermediate, err := ParseCertificate(rawIntermediate)
+
+			if err != nil {
+				t.Fatalf("Could not parse intermediate certificate: %v", err)
+			}
+
+			intermediateSigner := testSigner(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, intermediate)
+			leafKey := testSigner(t, algorithm, nil)
+
+			rawLeaf, err := intermediateSigner.CreateCertificate(
+				&x509.Certificate{
+					Subject:     pkix.Name{CommonName: "leaf"},
+					NotBefore:   time.Now(),
+					NotAfter:    time.Now().AddDate(0, 0, 1),
+					KeyUsage:    x509.KeyUsageDigitalSignature,
+					ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+					DNSNames:    []string{"example.com"},
+				},
+				leafKey.Public(),
+				false,
+			)
+
+			if err != nil {
+				t.Fatalf("CreateCertificate(leaf) failed: %v", err)
+			}
+
+			leaf, err := ParseCertificate(rawLeaf)
+
+			if err != nil {
+				t.Fatalf("Could not parse leaf certificate: %v", err)
+			}
+
+			roots := x509.NewCertPool()
+			roots.AddCert(root)
+
+			intermediates := x509.NewCertPool()
+			intermediates.AddCert(intermediate)
+
+			_, err = leaf.Verify(x509.VerifyOptions{
+				DNSName:       "example.com",
+				Roots:         roots,
+				Intermediates: intermediates,
+			})
+
+			if err != nil {
+				t.Errorf("Could not verify leaf certificate chain: %v", err)
+			}
+
+			if leaf.SerialNumber.Cmp(intermediate.SerialNumber) == 0 {
+				t.Errorf("Leaf and intermediate share serial number %v", leaf.SerialNumber)
+			}
+		})
+	}
+}
+
+func TestCreateCertificateErrors(t *testing.T) {
+	algorithm := kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256
+	signee := testSigner(t, algorithm, nil).Public()
+
+	leafTemplate := &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "not a CA"},
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().AddDate(0, 0, 1),
+	}
+
+	if _, err := testSigner(t, algorithm, nil).CreateCertificate(leafTemplate, signee, false); err == nil {
+		t.Errorf("CreateCertificate() without a parent succeeded, want error")
+	}
+
+	rootSigner, _ := testRootCA(t, algorithm)
+
+	rawLeaf, err := rootSigner.CreateCertificate(leafTemplate, signee, false)
+
+	if err != nil {
+		t.Fatalf("CreateCertificate(leaf) failed: %v", err)
+	}
+
+	leaf, err := ParseCertificate(rawLeaf)
+
+	if err != nil {
+		t.Fatalf("Could not parse leaf certificate: %v", err)
+	}
+
+	_, err = testSigner(t, algorithm, leaf).CreateCertificate(leafTemplate, signee, false)
+
+	if !errors.Is(err, ErrParentNotCA) {
+		t.Errorf("CreateCertificate() with a non-CA parent = %v, want ErrParentNotCA", err)
+	}
+}
+
+func TestNewGoogleKMSSignerWithCertificateRejectsOtherKey(t *testing.T) {
+	_, root := testRootCA(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+	client, keyName := testKey(t, kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384)
+
+	_, err := NewGoogleKMSSignerWithCertificate(context.Background(), client, keyName, root)
+
+	if !errors.Is(err, ErrParentKeyMismatch) {
+		t.Errorf("NewGoogleKMSSignerWithCertificate() = %v, want ErrParentKeyMismatch", err)
+	}
+}
+
+func TestCreateCertificateVerifiesSignature(t *testing.T) {
+	_, root := testRootCA(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+
+	// bypass the constructor's parent check, so that the certificate is signed by a key other
+	// than the parent's. A secp256k1 signee makes the signer re-sign the certificate itself,
+	// rather than relying on crypto/x509's own check.
+	signer := testSigner(t, kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256, nil)
+	signer.certificate = root
+
+	signee := testSigner(t, kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256, nil).Public()
+
+	leafTemplate := &x509.Certificate{
+		Subject:   pkix.Name{CommonName: "leaf"},
+		NotBefore: time.Now(),
+		NotAfter:  time.Now().AddDate(0, 0, 1),
+	}
+
+	_, err := signer.CreateCertificate(leafTemplate, signee, false)
+
+	if !errors.Is(err, ErrSignatureVerificationFailed) {
+		t.Errorf("CreateCertificate() = %v, want ErrSignatureVerificationFailed", err)
+	}
+}
+
+func TestCreateCertificateRequest(t *testing.T) {
+	for _, algorithm := range kmsfake.SigningAlgorithms() {
+		algorithm := algorithm
+
+		t.Run(algorithm.String(), func(t *testing.T) {
+			signer := testSigner(t, algorithm, nil)
+
+			rawCSR, err := signer.CreateCertificateRequest(
+				&x509.CertificateRequest{Subject: pkix.Name{CommonName: "csr"}},
+				true,
+			)
+
+			if err != nil {
+				t.Fatalf("CreateCertificateRequest() failed: %v", err)
+			}
+
+			csr, err := ParseCertificateRequest(rawCSR)
+
+			if err != nil {
+				t.Fatalf("Could not parse CSR: %v", err)
+			}
+
+			if err := csr.CheckSignature(); err != nil {
+				t.Errorf("CSR signature is invalid: %v", err)
+			}
+
+			if csr.Subject.CommonName != "csr" {
+				t.Errorf("CSR common name = %q, want %q", csr.Subject.CommonName, "csr")
+			}
+		})
+	}
+}
+
+func TestSignRejectsWrongHash(t *testing.T) {
+	signer := testSigner(t, kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384, nil)
+	digest := make([]byte, crypto.SHA256.Size())
+
+	if _, err := signer.Sign(nil, digest, crypto.SHA256); err == nil {
+		t.Errorf("Sign() with SHA-256 digest for a SHA-384 key succeeded, want error")
+	}
+}
+
+func TestSignEd25519SendsMessage(t *testing.T) {
+	signer := testSigner(t, kmspb.CryptoKeyVersion_EC_SIGN_ED25519, nil)
+	message := []byte("a message that is not a digest")
+
+	signature, err := signer.Sign(nil, message, crypto.Hash(0))
+
+	if err != nil {
+		t.Fatalf("Sign() failed: %v", err)
+	}
+
+	if !ed25519.Verify(signer.Public().(ed25519.PublicKey), message, signature) {
+		t.Errorf("Signature does not verify over the message")
+	}
+}
+
+func TestRawPKCS1HashPerOperation(t *testing.T) {
+	algorithm := kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_2048
+
+	for _, signatureAlgorithm := range []x509.SignatureAlgorithm{
+		x509.SHA256WithRSA,
+		x509.SHA384WithRSA,
+		x509.SHA512WithRSA,
+	} {
+		signatureAlgorithm := signatureAlgorithm
+
+		t.Run(signatureAlgorithm.String(), func(t *testing.T) {
+			signer := testSigner(t, algorithm, nil)
+
+			template := testCATemplate("root")
+			template.SignatureAlgorithm = signatureAlgorithm
+
+			rawCertificate, err := signer.CreateSelfSignedCertificate(template, false)
+
+			if err != nil {
+				t.Fatalf("CreateSelfSignedCertificate() failed: %v", err)
+			}
+
+			root, err := ParseCertificate(rawCertificate)
+
+			if err != nil {
+				t.Fatalf("Could not parse root certificate: %v", err)
+			}
+
+			if root.SignatureAlgorithm != signatureAlgorithm {
+				t.Errorf("SignatureAlgorithm = %v, want %v", root.SignatureAlgorithm, signatureAlgorithm)
+			}
+
+			if err := root.CheckSignatureFrom(root); err != nil {
+				t.Errorf("Root certificate signature is invalid: %v", err)
+			}
+
+			rawCSR, err := signer.CreateCertificateRequest(
+				&x509.CertificateRequest{
+					Subject:            pkix.Name{CommonName: "csr"},
+					SignatureAlgorithm: signatureAlgorithm,
+				},
+				false,
+			)
+
+			if err != nil {
+				t.Fatalf("CreateCertificateRequest() failed: %v", err)
+			}
+
+			csr, err := ParseCertificateRequest(rawCSR)
+
+			if err != nil {
+				t.Fatalf("Could not parse CSR: %v", err)
+			}
+
+			if err := csr.CheckSignature(); err != nil {
+				t.Errorf("CSR signature is invalid: %v", err)
+			}
+		})
+	}
+
+	signer := testSigner(t, algorithm, nil)
+
+	pssOptions := &rsa.PSSOptions{Hash: crypto.SHA256}
+
+	if _, err := signer.Sign(nil, make([]byte, crypto.SHA256.Size()), pssOptions); err == nil {
+		t.Errorf("Sign() with PSS options for a raw PKCS#1 key succeeded, want error")
+	}
+
+	fixedSigner := testSigner(t, kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256, nil)
+
+	template := testCATemplate("root")
+	template.SignatureAlgorithm = x509.SHA384WithRSA
+
+	if _, err := fixedSigner.CreateSelfSignedCertificate(template, false); err == nil {
+		t.Errorf("CreateSelfSignedCertificate(SHA384WithRSA) with a SHA-256 key succeeded, want error")
+	}
+}
+
+func TestContextVariants(t *testing.T) {
+	rootSigner, _ := testRootCA(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+	signee := rootSigner.Public()
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	leafTemplate := func() *x509.Certificate {
+		return &x509.Certificate{
+			Subject:   pkix.Name{CommonName: "leaf"},
+			NotBefore: time.Now(),
+			NotAfter:  time.Now().AddDate(0, 0, 1),
+		}
+	}
+
+	digest := make([]byte, crypto.SHA256.Size())
+
+	if _, err := rootSigner.SignContext(cancelled, nil, digest, crypto.SHA256); err == nil {
+		t.Errorf("SignContext() with a cancelled context succeeded, want error")
+	}
+
+	if _, err := rootSigner.SignerWithContext(cancelled).Sign(nil, digest, crypto.SHA256); err == nil {
+		t.Errorf("SignerWithContext().Sign() with a cancelled context succeeded, want error")
+	}
+
+	if _, err := rootSigner.CreateCertificateContext(cancelled, leafTemplate(), signee, false); err == nil {
+		t.Errorf("CreateCertificateContext() with a cancelled context succeeded, want error")
+	}
+
+	_, err := rootSigner.CreateCertificateRequestContext(
+		cancelled,
+		&x509.CertificateRequest{Subject: pkix.Name{CommonName: "csr"}},
+		false,
+	)
+
+	if err == nil {
+		t.Errorf("CreateCertificateRequestContext() with a cancelled context succeeded, want error")
+	}
+
+	// the signer itself is unaffected by the cancelled operations.
+	if _, err := rootSigner.Sign(nil, digest, crypto.SHA256); err != nil {
+		t.Errorf("Sign() failed after cancelled operations: %v", err)
+	}
+
+	if _, err := rootSigner.CreateCertificate(leafTemplate(), signee, false); err != nil {
+		t.Errorf("CreateCertificate() failed after cancelled operations: %v", err)
+	}
+
+	deadline, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	rawLeaf, err := x509.CreateCertificate(
+		rand.Reader,
+		leafTemplate(),
+		testCATemplate("root"),
+		signee,
+		rootSigner.SignerWithContext(deadline),
+	)
+
+	if err != nil {
+		t.Fatalf("x509.CreateCertificate() with SignerWithContext() failed: %v", err)
+	}
+
+	if _, err := ParseCertificate(rawLeaf); err != nil {
+		t.Errorf("Could not parse certificate: %v", err)
+	}
+}
+
+func TestCreateSelfSignedCertificateContextCancelled(t *testing.T) {
+	signer := testSigner(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256, nil)
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := signer.CreateSelfSignedCertificateContext(cancelled, testCATemplate("root"), false); err == nil {
+		t.Fatalf("CreateSelfSignedCertificateContext() with a cancelled context succeeded, want error")
+	}
+
+	// a failed self-signed certificate must not leave the signer with a parent.
+	if _, err := signer.CreateSelfSignedCertificate(testCATemplate("root"), false); err != nil {
+		t.Errorf("CreateSelfSignedCertificate() after a cancelled attempt failed: %v", err)
+	}
+}
+
+func hasExtension(certificate *x509.Certificate, oid asn1.ObjectIdentifier, value string) bool {
+	for _, extension := range certificate.Extensions {
+		if extension.Id.Equal(oid) && string(extension.Value) == value {
+			return true
+		}
+	}
+
+	return false
 }
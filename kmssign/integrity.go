@@ -0,0 +1,23 @@
+package kmssign
+
+import (
+	"errors"
+	"hash/crc32"
+
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// ErrIntegrityCheckFailed is returned when a request to or response from Cloud KMS was corrupted
+// in transit, according to the CRC32C checksums Cloud KMS sends and verifies. See
+// https://cloud.google.com/kms/docs/data-integrity-guidelines
+var ErrIntegrityCheckFailed = errors.New("Cloud KMS integrity check failed")
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+func crc32c(data []byte) *wrapperspb.Int64Value {
+	return wrapperspb.Int64(int64(crc32.Checksum(data, crc32cTable)))
+}
+
+func verifyCRC32C(data []byte, checksum *wrapperspb.Int64Value) bool {
+	return checksum != nil && checksum.GetValue() == crc32c(data).GetValue()
+}
@@ -0,0 +1,125 @@
+package kmssign
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"math/big"
+)
+
+// maxSerialNumberAttempts bounds how many serial numbers CreateCertificate tries when an
+// IssuanceStore reports collisions.
+const maxSerialNumberAttempts = 3
+
+// ErrSerialNumberCollision is returned by an IssuanceStore when the issuer has already issued a
+// certificate with the same serial number.
+var ErrSerialNumberCollision = errors.New("serial number has already been issued")
+
+// IssuedCertificate is a certificate issued by a GoogleKMSSigner, as given to an IssuanceStore.
+type IssuedCertificate struct {
+	Certificate *x509.Certificate
+
+	// Issuer is the signer's certificate, which is Certificate itself for self-signed
+	// certificates.
+	Issuer *x509.Certificate
+
+	// KeyVersionName is the KMS key version that signed Certificate.
+	KeyVersionName string
+
+	// Requester is the requester set with WithIssuanceStore.
+	Requester string
+}
+
+// IssuanceStore records the certificates issued by a GoogleKMSSigner.
+type IssuanceStore interface {
+	// RecordCertificate records an issued certificate. It returns an error wrapping
+	// ErrSerialNumberCollision, and records nothing, if the issuer has already issued a certificate
+	// with the same serial number.
+	RecordCertificate(ctx context.Context, issued *IssuedCertificate) error
+}
+
+// IssuanceChecker is implemented by IssuanceStores that refuse some certificates, e.g. those
+// duplicating the subject of a certificate already issued, so that they are refused before they
+// are signed and recorded in any store.
+type IssuanceChecker interface {
+	// CheckCertificate returns an error if the certificate for template must not be issued by
+	// issuer, which is nil for self-signed certificates.
+	CheckCertificate(ctx context.Context, template, issuer *x509.Certificate) error
+}
+
+// WithIssuanceStore makes CreateCertificate and CreateSelfSignedCertificate record every
+// certificate they issue in store, on behalf of requester. A certificate is only returned once it
+// has been recorded; serial number collisions are retried with a new serial number.
+//
+// WithIssuanceStore may be given more than once, and certificates are recorded in each store in
+// turn. A collision in a later store leaves the discarded certificate recorded in the earlier ones.
+func WithIssuanceStore(store IssuanceStore, requester string) Option {
+	return func(options *signerOptions) {
+		options.issuanceStores = append(options.issuanceStores, store)
+		options.requester = requester
+	}
+}
+
+// SerialNumberGenerator returns the serial number for the next certificate.
+type SerialNumberGenerator func() (*big.Int, error)
+
+// WithSerialNumberGenerator replaces the random 64-bit serial numbers of CreateCertificate and
+// CreateSelfSignedCertificate, e.g. with sequential ones. Serial numbers must be positive, and
+// unique for the issuer; see WithIssuanceStore for detecting collisions.
+func WithSerialNumberGenerator(generator SerialNumberGenerator) Option {
+	return func(options *signerOptions) {
+		options.serialNumberGenerator = generator
+	}
+}
+
+// checkCertificate asks the signer's IssuanceStores that are IssuanceCheckers whether template
+// may be issued.
+func (signer *GoogleKMSSigner) checkCertificate(
+	ctx context.Context,
+	template *x509.Certificate,
+) error {
+	issuer := signer.certificate
+
+	if issuer == template {
+		issuer = nil
+	}
+
+	for _, store := range signer.options.issuanceStores {
+		if checker, ok := store.(IssuanceChecker); ok {
+			if err := checker.CheckCertificate(ctx, template, issuer); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// recordCertificate records certificate, issued from template, in the signer's IssuanceStores.
+func (signer *GoogleKMSSigner) recordCertificate(
+	ctx context.Context,
+	template *x509.Certificate,
+	certificate *x509.Certificate,
+) error {
+	issuer := signer.certificate
+
+	if issuer == template {
+		// self-signed, see CreateSelfSignedCertificateContext.
+		issuer = certificate
+	}
+
+	issued := &IssuedCertificate{
+		Certificate:    certificate,
+		Issuer:         issuer,
+		KeyVersionName: signer.keyVersion.Name,
+		Requester:      signer.options.requester,
+	}
+
+	for _, store := range signer.options.issuanceStores {
+		if err := store.RecordCertificate(ctx, issued); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
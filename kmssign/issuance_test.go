@@ -0,0 +1,187 @@
+package kmssign
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"math/big"
+	"testing"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+)
+
+// fakeIssuanceStore records certificates in memory, and reports the first collisions calls as
+// serial number collisions.
+type fakeIssuanceStore struct {
+	collisions int
+	recorded   []*IssuedCertificate
+}
+
+func (store *fakeIssuanceStore) RecordCertificate(
+	ctx context.Context,
+	issued *IssuedCertificate,
+) error {
+	if store.collisions > 0 {
+		store.collisions--
+
+		return ErrSerialNumberCollision
+	}
+
+	store.recorded = append(store.recorded, issued)
+
+	return nil
+}
+
+// refusingIssuanceStore is a fakeIssuanceStore that refuses certificates for a common name
+// before they are signed.
+type refusingIssuanceStore struct {
+	fakeIssuanceStore
+	refusedCommonName string
+}
+
+func (store *refusingIssuanceStore) CheckCertificate(
+	ctx context.Context,
+	template *x509.Certificate,
+	issuer *x509.Certificate,
+) error {
+	if template.Subject.CommonName == store.refusedCommonName {
+		return errors.New("refused")
+	}
+
+	return nil
+}
+
+func TestIssuanceChecker(t *testing.T) {
+	store := &fakeIssuanceStore{}
+	refusing := &refusingIssuanceStore{refusedCommonName: "refused"}
+	client, keyName := testKey(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+
+	signer, err := NewGoogleKMSSigner(
+		context.Background(),
+		client,
+		keyName,
+		WithIssuanceStore(store, ""),
+		WithIssuanceStore(refusing, ""),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := signer.CreateSelfSignedCertificate(testCATemplate("root"), false); err != nil {
+		t.Fatalf("CreateSelfSignedCertificate() failed: %v", err)
+	}
+
+	_, err = signer.CreateCertificate(testCATemplate("refused"), signer.Public(), false)
+
+	if err == nil {
+		t.Fatal("CreateCertificate() of a refused certificate succeeded")
+	}
+
+	// refused before the first store recorded it.
+	if len(store.recorded) != 1 || len(refusing.recorded) != 1 {
+		t.Errorf(
+			"Recorded %d and %d certificates, want only the root",
+			len(store.recorded),
+			len(refusing.recorded),
+		)
+	}
+}
+
+func TestWithIssuanceStore(t *testing.T) {
+	store := &fakeIssuanceStore{}
+	client, keyName := testKey(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+
+	signer, err := NewGoogleKMSSigner(
+		context.Background(),
+		client,
+		keyName,
+		WithIssuanceStore(store, "alice"),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawRoot, err := signer.CreateSelfSignedCertificate(testCATemplate("root"), false)
+
+	if err != nil {
+		t.Fatalf("CreateSelfSignedCertificate() failed: %v", err)
+	}
+
+	store.collisions = 2
+
+	rawLeaf, err := signer.CreateCertificate(testCATemplate("leaf"), signer.Public(), false)
+
+	if err != nil {
+		t.Fatalf("CreateCertificate() with 2 collisions failed: %v", err)
+	}
+
+	if len(store.recorded) != 2 {
+		t.Fatalf("Recorded %d certificates, want 2", len(store.recorded))
+	}
+
+	for i, raw := range [][]byte{rawRoot, rawLeaf} {
+		issued := store.recorded[i]
+
+		if string(issued.Certificate.Raw) != string(raw) {
+			t.Errorf("Recorded certificate %d is not the issued certificate", i)
+		}
+
+		if issued.Issuer.Subject.CommonName != "root" {
+			t.Errorf("Recorded issuer %d is %s, want the root", i, issued.Issuer.Subject)
+		}
+
+		if issued.KeyVersionName != keyName || issued.Requester != "alice" {
+			t.Errorf("Recorded key %q for %q", issued.KeyVersionName, issued.Requester)
+		}
+	}
+
+	store.collisions = maxSerialNumberAttempts
+
+	_, err = signer.CreateCertificate(testCATemplate("leaf"), signer.Public(), false)
+
+	if !errors.Is(err, ErrSerialNumberCollision) {
+		t.Errorf("CreateCertificate() = %v, want ErrSerialNumberCollision", err)
+	}
+}
+
+func TestWithSerialNumberGenerator(t *testing.T) {
+	store := &fakeIssuanceStore{collisions: 1}
+	next := big.NewInt(0x1000)
+	client, keyName := testKey(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+
+	signer, err := NewGoogleKMSSigner(
+		context.Background(),
+		client,
+		keyName,
+		WithIssuanceStore(store, ""),
+		WithSerialNumberGenerator(func() (*big.Int, error) {
+			serialNumber := new(big.Int).Set(next)
+			next.Add(next, big.NewInt(1))
+
+			return serialNumber, nil
+		}),
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawRoot, err := signer.CreateSelfSignedCertificate(testCATemplate("root"), false)
+
+	if err != nil {
+		t.Fatalf("CreateSelfSignedCertificate() failed: %v", err)
+	}
+
+	root, err := ParseCertificate(rawRoot)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the first serial number collided.
+	if root.SerialNumber.Cmp(big.NewInt(0x1001)) != 0 {
+		t.Errorf("SerialNumber = %x, want 1001", root.SerialNumber)
+	}
+}
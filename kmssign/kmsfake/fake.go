@@ -0,0 +1,643 @@
+// Package kmsfake is an in-memory stand-in for the Cloud KMS API, backed by locally generated
+// keys. It implements the methods used by kmssign with the same signatures as
+// *cloudkms.KeyManagementClient, so it can be passed anywhere a kmssign.KeyManagementClient is
+// expected.
+package kmsfake
+
+import (
+	"context"
+	"crypto"
+	"encoding/pem"
+	"fmt"
+	"hash/crc32"
+	"strconv"
+	"strings"
+	"sync"
+
+	cloudkms "cloud.google.com/go/kms/apiv1"
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type KeyManagementClient struct {
+	mu sync.Mutex
+
+	keyRings   map[string]*kmspb.KeyRing
+	cryptoKeys map[string]*cryptoKey
+	versions   map[string]*cryptoKeyVersion
+
+	faults map[string][]fault
+	calls  map[string]int
+
+	loopbackOnce sync.Once
+	loopback     *cloudkms.KeyManagementClient
+}
+
+type cryptoKey struct {
+	proto    *kmspb.CryptoKey
+	versions []*cryptoKeyVersion
+}
+
+type cryptoKeyVersion struct {
+	proto      *kmspb.CryptoKeyVersion
+	parameters algorithmParameters
+	privateKey crypto.Signer
+}
+
+func NewKeyManagementClient() *KeyManagementClient {
+	return &KeyManagementClient{
+		keyRings:   map[string]*kmspb.KeyRing{},
+		cryptoKeys: map[string]*cryptoKey{},
+		versions:   map[string]*cryptoKeyVersion{},
+		faults:     map[string][]fault{},
+		calls:      map[string]int{},
+	}
+}
+
+// AddSigningKey creates a key version with the given algorithm under cryptoKeyName, which is in
+// the form projects/*/locations/*/keyRings/*/cryptoKeys/*. The key ring and crypto key are
+// created if they do not already exist.
+func (client *KeyManagementClient) AddSigningKey(
+	ctx context.Context,
+	cryptoKeyName string,
+	algorithm kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm,
+) (*kmspb.CryptoKeyVersion, error) {
+	keyRingName, cryptoKeyID, ok := cut(cryptoKeyName, "/cryptoKeys/")
+
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid CryptoKey name %s", cryptoKeyName)
+	}
+
+	parent, keyRingID, ok := cut(keyRingName, "/keyRings/")
+
+	if !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "Invalid KeyRing name %s", keyRingName)
+	}
+
+	_, err := client.CreateKeyRing(ctx, &kmspb.CreateKeyRingRequest{
+		Parent:    parent,
+		KeyRingId: keyRingID,
+	})
+
+	if err != nil && status.Code(err) != codes.AlreadyExists {
+		return nil, err
+	}
+
+	_, err = client.CreateCryptoKey(ctx, &kmspb.CreateCryptoKeyRequest{
+		Parent:                     keyRingName,
+		CryptoKeyId:                cryptoKeyID,
+		SkipInitialVersionCreation: true,
+		CryptoKey: &kmspb.CryptoKey{
+			Purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN,
+			VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+				Algorithm: algorithm,
+			},
+		},
+	})
+
+	if err != nil && status.Code(err) != codes.AlreadyExists {
+		return nil, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	key := client.cryptoKeys[cryptoKeyName]
+
+	if key.proto.GetVersionTemplate().GetAlgorithm() != algorithm {
+		return nil, status.Errorf(
+			codes.FailedPrecondition,
+			"CryptoKey %s already exists with algorithm %s",
+			cryptoKeyName,
+			key.proto.GetVersionTemplate().GetAlgorithm(),
+		)
+	}
+
+	version, err := client.createVersion(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Clone(version.proto).(*kmspb.CryptoKeyVersion), nil
+}
+
+func (client *KeyManagementClient) CreateKeyRing(
+	ctx context.Context,
+	req *kmspb.CreateKeyRingRequest,
+	opts ...gax.CallOption,
+) (*kmspb.KeyRing, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if req.GetParent() == "" || req.GetKeyRingId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "parent and key_ring_id are required")
+	}
+
+	name := fmt.Sprintf("%s/keyRings/%s", req.GetParent(), req.GetKeyRingId())
+
+	if _, ok := client.keyRings[name]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "KeyRing %s already exists", name)
+	}
+
+	keyRing := &kmspb.KeyRing{
+		Name:       name,
+		CreateTime: timestamppb.Now(),
+	}
+
+	client.keyRings[name] = keyRing
+
+	return proto.Clone(keyRing).(*kmspb.KeyRing), nil
+}
+
+func (client *KeyManagementClient) CreateCryptoKey(
+	ctx context.Context,
+	req *kmspb.CreateCryptoKeyRequest,
+	opts ...gax.CallOption,
+) (*kmspb.CryptoKey, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	if _, ok := client.keyRings[req.GetParent()]; !ok {
+		return nil, status.Errorf(codes.NotFound, "KeyRing %s not found", req.GetParent())
+	}
+
+	if req.GetCryptoKeyId() == "" || req.GetCryptoKey() == nil {
+		return nil, status.Error(codes.InvalidArgument, "crypto_key_id and crypto_key are required")
+	}
+
+	name := fmt.Sprintf("%s/cryptoKeys/%s", req.GetParent(), req.GetCryptoKeyId())
+
+	if _, ok := client.cryptoKeys[name]; ok {
+		return nil, status.Errorf(codes.AlreadyExists, "CryptoKey %s already exists", name)
+	}
+
+	template := req.GetCryptoKey().GetVersionTemplate()
+	parameters, ok := algorithms[template.GetAlgorithm()]
+
+	if !ok {
+		return nil, status.Errorf(
+			codes.InvalidArgument, "Unsupported algorithm %s", template.GetAlgorithm(),
+		)
+	}
+
+	if parameters.purpose != req.GetCryptoKey().GetPurpose() {
+		return nil, status.Errorf(
+			codes.InvalidArgument,
+			"Algorithm %s is not valid for purpose %s",
+			template.GetAlgorithm(),
+			req.GetCryptoKey().GetPurpose(),
+		)
+	}
+
+	key := &cryptoKey{proto: proto.Clone(req.GetCryptoKey()).(*kmspb.CryptoKey)}
+
+	key.proto.Name = name
+	key.proto.CreateTime = timestamppb.Now()
+
+	if key.proto.VersionTemplate.ProtectionLevel == kmspb.ProtectionLevel_PROTECTION_LEVEL_UNSPECIFIED {
+		key.proto.VersionTemplate.ProtectionLevel = kmspb.ProtectionLevel_SOFTWARE
+	}
+
+	client.cryptoKeys[name] = key
+
+	if !req.GetSkipInitialVersionCreation() {
+		if _, err := client.createVersion(key); err != nil {
+			delete(client.cryptoKeys, name)
+
+			return nil, err
+		}
+	}
+
+	return proto.Clone(key.proto).(*kmspb.CryptoKey), nil
+}
+
+func (client *KeyManagementClient) CreateCryptoKeyVersion(
+	ctx context.Context,
+	req *kmspb.CreateCryptoKeyVersionRequest,
+	opts ...gax.CallOption,
+) (*kmspb.CryptoKeyVersion, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	key, ok := client.cryptoKeys[req.GetParent()]
+
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "CryptoKey %s not found", req.GetParent())
+	}
+
+	version, err := client.createVersion(key)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Clone(version.proto).(*kmspb.CryptoKeyVersion), nil
+}
+
+func (client *KeyManagementClient) GetCryptoKey(
+	ctx context.Context,
+	req *kmspb.GetCryptoKeyRequest,
+	opts ...gax.CallOption,
+) (*kmspb.CryptoKey, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	fault := client.takeFault("GetCryptoKey")
+
+	if fault.err != nil {
+		return nil, fault.err
+	}
+
+	key, ok := client.cryptoKeys[req.GetName()]
+
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "CryptoKey %s not found", req.GetName())
+	}
+
+	return proto.Clone(key.proto).(*kmspb.CryptoKey), nil
+}
+
+// ListCryptoKeyVersions returns the same iterator type as *cloudkms.KeyManagementClient, which can
+// only be created by a real client, so the request goes through a real client connected to the
+// fake over an in-memory gRPC connection.
+func (client *KeyManagementClient) ListCryptoKeyVersions(
+	ctx context.Context,
+	req *kmspb.ListCryptoKeyVersionsRequest,
+	opts ...gax.CallOption,
+) *cloudkms.CryptoKeyVersionIterator {
+	return client.loopbackClient().ListCryptoKeyVersions(ctx, req, opts...)
+}
+
+// listCryptoKeyVersions serves a page of ListCryptoKeyVersions results. Page tokens are the index
+// of the first version in the page.
+func (client *KeyManagementClient) listCryptoKeyVersions(
+	ctx context.Context,
+	req *kmspb.ListCryptoKeyVersionsRequest,
+) (*kmspb.ListCryptoKeyVersionsResponse, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	fault := client.takeFault("ListCryptoKeyVersions")
+
+	if fault.err != nil {
+		return nil, fault.err
+	}
+
+	if req.GetFilter() != "" || req.GetOrderBy() != "" {
+		return nil, status.Error(codes.Unimplemented, "filter and order_by are not supported")
+	}
+
+	key, ok := client.cryptoKeys[req.GetParent()]
+
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "CryptoKey %s not found", req.GetParent())
+	}
+
+	start := 0
+
+	if req.GetPageToken() != "" {
+		var err error
+
+		if start, err = strconv.Atoi(req.GetPageToken()); err != nil || start > len(key.versions) {
+			return nil, status.Errorf(codes.InvalidArgument, "Invalid page token %q", req.GetPageToken())
+		}
+	}
+
+	end := len(key.versions)
+
+	if pageSize := int(req.GetPageSize()); pageSize > 0 && start+pageSize < end {
+		end = start + pageSize
+	}
+
+	response := &kmspb.ListCryptoKeyVersionsResponse{
+		TotalSize: int32(len(key.versions)),
+	}
+
+	for _, version := range key.versions[start:end] {
+		response.CryptoKeyVersions = append(
+			response.CryptoKeyVersions,
+			proto.Clone(version.proto).(*kmspb.CryptoKeyVersion),
+		)
+	}
+
+	if end < len(key.versions) {
+		response.NextPageToken = strconv.Itoa(end)
+	}
+
+	return response, nil
+}
+
+// SetVersionState changes the state of a key version, e.g. to DISABLED or DESTROYED, without the
+// transitions and delays of the real API.
+func (client *KeyManagementClient) SetVersionState(
+	name string,
+	state kmspb.CryptoKeyVersion_CryptoKeyVersionState,
+) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	version, err := client.getVersion(name)
+
+	if err != nil {
+		return err
+	}
+
+	version.proto.State = state
+
+	return nil
+}
+
+func (client *KeyManagementClient) GetCryptoKeyVersion(
+	ctx context.Context,
+	req *kmspb.GetCryptoKeyVersionRequest,
+	opts ...gax.CallOption,
+) (*kmspb.CryptoKeyVersion, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	fault := client.takeFault("GetCryptoKeyVersion")
+
+	if fault.err != nil {
+		return nil, fault.err
+	}
+
+	version, err := client.getVersion(req.GetName())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return proto.Clone(version.proto).(*kmspb.CryptoKeyVersion), nil
+}
+
+func (client *KeyManagementClient) GetPublicKey(
+	ctx context.Context,
+	req *kmspb.GetPublicKeyRequest,
+	opts ...gax.CallOption,
+) (*kmspb.PublicKey, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	fault := client.takeFault("GetPublicKey")
+
+	if fault.err != nil {
+		return nil, fault.err
+	}
+
+	version, err := client.getUsableVersion(req.GetName())
+
+	if err != nil {
+		return nil, err
+	}
+
+	derEncodedPublicKey, err := marshalPublicKey(version.privateKey.Public())
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not marshal public key: %v", err)
+	}
+
+	pemEncodedPublicKey := pem.EncodeToMemory(&pem.Block{
+		Type:  "PUBLIC KEY",
+		Bytes: derEncodedPublicKey,
+	})
+
+	response := &kmspb.PublicKey{
+		Pem:             string(pemEncodedPublicKey),
+		PemCrc32C:       crc32c(pemEncodedPublicKey),
+		Algorithm:       version.proto.Algorithm,
+		Name:            version.proto.Name,
+		ProtectionLevel: version.proto.ProtectionLevel,
+	}
+
+	if fault.corrupt {
+		response.Pem = strings.Replace(response.Pem, "PUBLIC KEY", "PUBLIC KEZ", 1)
+	}
+
+	return response, nil
+}
+
+func (client *KeyManagementClient) AsymmetricSign(
+	ctx context.Context,
+	req *kmspb.AsymmetricSignRequest,
+	opts ...gax.CallOption,
+) (*kmspb.AsymmetricSignResponse, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	fault := client.takeFault("AsymmetricSign")
+
+	if fault.err != nil {
+		return nil, fault.err
+	}
+
+	version, err := client.getUsableVersion(req.GetName())
+
+	if err != nil {
+		return nil, err
+	}
+
+	if version.parameters.purpose != kmspb.CryptoKey_ASYMMETRIC_SIGN {
+		return nil, status.Errorf(
+			codes.FailedPrecondition,
+			"CryptoKeyVersion %s is not an ASYMMETRIC_SIGN key",
+			version.proto.Name,
+		)
+	}
+
+	var digest []byte
+
+	switch version.parameters.hash {
+	case crypto.SHA256:
+		digest = req.GetDigest().GetSha256()
+
+	case crypto.SHA384:
+		digest = req.GetDigest().GetSha384()
+
+	case crypto.SHA512:
+		digest = req.GetDigest().GetSha512()
+	}
+
+	verifiedDigestCrc32C := false
+	verifiedDataCrc32C := false
+
+	if version.parameters.ed25519 || version.parameters.rawPKCS1 {
+		if req.GetDigest() != nil || req.GetData() == nil {
+			return nil, status.Errorf(
+				codes.InvalidArgument,
+				"%s keys must sign data, not a digest",
+				version.proto.Algorithm,
+			)
+		}
+
+		digest = req.GetData()
+
+		if req.GetDataCrc32C() != nil {
+			if req.GetDataCrc32C().GetValue() != crc32c(digest).GetValue() {
+				return nil, status.Error(codes.InvalidArgument, "Data checksum mismatch")
+			}
+
+			verifiedDataCrc32C = true
+		}
+	} else {
+		if len(digest) != version.parameters.hash.Size() {
+			return nil, status.Errorf(
+				codes.InvalidArgument,
+				"Digest does not match the %v digest expected by %s",
+				version.parameters.hash,
+				version.proto.Algorithm,
+			)
+		}
+
+		if req.GetDigestCrc32C() != nil {
+			if req.GetDigestCrc32C().GetValue() != crc32c(digest).GetValue() {
+				return nil, status.Error(codes.InvalidArgument, "Digest checksum mismatch")
+			}
+
+			verifiedDigestCrc32C = true
+		}
+	}
+
+	signature, err := sign(version.parameters, version.privateKey, digest)
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not sign digest: %v", err)
+	}
+
+	response := &kmspb.AsymmetricSignResponse{
+		Signature:            signature,
+		SignatureCrc32C:      crc32c(signature),
+		VerifiedDigestCrc32C: verifiedDigestCrc32C,
+		VerifiedDataCrc32C:   verifiedDataCrc32C,
+		Name:                 version.proto.Name,
+		ProtectionLevel:      version.proto.ProtectionLevel,
+	}
+
+	if fault.corrupt {
+		response.Signature[0] ^= 0xff
+	}
+
+	return response, nil
+}
+
+func (client *KeyManagementClient) createVersion(key *cryptoKey) (*cryptoKeyVersion, error) {
+	template := key.proto.GetVersionTemplate()
+	parameters := algorithms[template.GetAlgorithm()]
+
+	privateKey, err := generateKey(parameters)
+
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Could not generate key: %v", err)
+	}
+
+	name := fmt.Sprintf(
+		"%s/cryptoKeyVersions/%s",
+		key.proto.Name,
+		strconv.Itoa(len(key.versions)+1),
+	)
+
+	version := &cryptoKeyVersion{
+		proto: &kmspb.CryptoKeyVersion{
+			Name:            name,
+			State:           kmspb.CryptoKeyVersion_ENABLED,
+			ProtectionLevel: template.GetProtectionLevel(),
+			Algorithm:       template.GetAlgorithm(),
+			CreateTime:      timestamppb.Now(),
+			GenerateTime:    timestamppb.Now(),
+		},
+		parameters: parameters,
+		privateKey: privateKey,
+	}
+
+	key.versions = append(key.versions, version)
+	client.versions[name] = version
+
+	return version, nil
+}
+
+func (client *KeyManagementClient) getVersion(name string) (*cryptoKeyVersion, error) {
+	version, ok := client.versions[name]
+
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "CryptoKeyVersion %s not found", name)
+	}
+
+	return version, nil
+}
+
+func (client *KeyManagementClient) getUsableVersion(name string) (*cryptoKeyVersion, error) {
+	version, err := client.getVersion(name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if version.proto.State != kmspb.CryptoKeyVersion_ENABLED {
+		return nil, status.Errorf(
+			codes.FailedPrecondition,
+			"CryptoKeyVersion %s is not enabled, current state: %s",
+			name,
+			version.proto.State,
+		)
+	}
+
+	return version, nil
+}
+
+func crc32c(data []byte) *wrapperspb.Int64Value {
+	return wrapperspb.Int64(int64(crc32.Checksum(data, crc32.MakeTable(crc32.Castagnoli))))
+}
+
+// checkContext returns the error a gRPC client would for a cancelled or expired context.
+func checkContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return status.FromContextError(err).Err()
+	}
+
+	return nil
+}
+
+func cut(s, separator string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, separator); i >= 0 {
+		return s[:i], s[i+len(separator):], true
+	}
+
+	return s, "", false
+}
@@ -0,0 +1,51 @@
+package kmsfake
+
+type fault struct {
+	err     error
+	corrupt bool
+}
+
+// FailNext makes the next count calls to method, e.g. "AsymmetricSign", return err.
+func (client *KeyManagementClient) FailNext(method string, count int, err error) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	for i := 0; i < count; i++ {
+		client.faults[method] = append(client.faults[method], fault{err: err})
+	}
+}
+
+// CorruptNext makes the next count responses from method, either "AsymmetricSign" or
+// "GetPublicKey", fail their CRC32C integrity checks.
+func (client *KeyManagementClient) CorruptNext(method string, count int) {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	for i := 0; i < count; i++ {
+		client.faults[method] = append(client.faults[method], fault{corrupt: true})
+	}
+}
+
+// CallCount returns the number of times method has been called, including failed calls.
+func (client *KeyManagementClient) CallCount(method string) int {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	return client.calls[method]
+}
+
+// takeFault records a call to method, and returns the fault to apply to it, if any. client.mu
+// must be held.
+func (client *KeyManagementClient) takeFault(method string) fault {
+	client.calls[method]++
+
+	faults := client.faults[method]
+
+	if len(faults) == 0 {
+		return fault{}
+	}
+
+	client.faults[method] = faults[1:]
+
+	return faults[0]
+}
@@ -0,0 +1,175 @@
+package kmsfake
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"sort"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+type algorithmParameters struct {
+	purpose kmspb.CryptoKey_CryptoKeyPurpose
+	rsaBits int
+	curve   elliptic.Curve
+	hash    crypto.Hash
+	pss     bool
+	ed25519 bool
+
+	// rawPKCS1 keys sign a DigestInfo given as data, rather than a digest.
+	rawPKCS1 bool
+}
+
+var algorithms = map[kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm]algorithmParameters{
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_2048_SHA256: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, rsaBits: 2048, hash: crypto.SHA256, pss: true,
+	},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_3072_SHA256: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, rsaBits: 3072, hash: crypto.SHA256, pss: true,
+	},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA256: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, rsaBits: 4096, hash: crypto.SHA256, pss: true,
+	},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PSS_4096_SHA512: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, rsaBits: 4096, hash: crypto.SHA512, pss: true,
+	},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_2048_SHA256: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, rsaBits: 2048, hash: crypto.SHA256,
+	},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_3072_SHA256: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, rsaBits: 3072, hash: crypto.SHA256,
+	},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA256: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, rsaBits: 4096, hash: crypto.SHA256,
+	},
+	kmspb.CryptoKeyVersion_RSA_SIGN_PKCS1_4096_SHA512: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, rsaBits: 4096, hash: crypto.SHA512,
+	},
+	kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_2048: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, rsaBits: 2048, rawPKCS1: true,
+	},
+	kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_3072: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, rsaBits: 3072, rawPKCS1: true,
+	},
+	kmspb.CryptoKeyVersion_RSA_SIGN_RAW_PKCS1_4096: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, rsaBits: 4096, rawPKCS1: true,
+	},
+	kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_2048_SHA256: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_DECRYPT, rsaBits: 2048, hash: crypto.SHA256,
+	},
+	kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_3072_SHA256: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_DECRYPT, rsaBits: 3072, hash: crypto.SHA256,
+	},
+	kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_4096_SHA256: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_DECRYPT, rsaBits: 4096, hash: crypto.SHA256,
+	},
+	kmspb.CryptoKeyVersion_RSA_DECRYPT_OAEP_4096_SHA512: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_DECRYPT, rsaBits: 4096, hash: crypto.SHA512,
+	},
+	kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, curve: elliptic.P256(), hash: crypto.SHA256,
+	},
+	kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, curve: elliptic.P384(), hash: crypto.SHA384,
+	},
+	kmspb.CryptoKeyVersion_EC_SIGN_SECP256K1_SHA256: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, curve: secp256k1.S256(), hash: crypto.SHA256,
+	},
+	kmspb.CryptoKeyVersion_EC_SIGN_ED25519: {
+		purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN, ed25519: true,
+	},
+}
+
+// SigningAlgorithms lists every asymmetric signing algorithm the fake can create keys for.
+func SigningAlgorithms() []kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm {
+	var signingAlgorithms []kmspb.CryptoKeyVersion_CryptoKeyVersionAlgorithm
+
+	for algorithm, parameters := range algorithms {
+		if parameters.purpose == kmspb.CryptoKey_ASYMMETRIC_SIGN {
+			signingAlgorithms = append(signingAlgorithms, algorithm)
+		}
+	}
+
+	sort.Slice(signingAlgorithms, func(i, j int) bool {
+		return signingAlgorithms[i] < signingAlgorithms[j]
+	})
+
+	return signingAlgorithms
+}
+
+func generateKey(parameters algorithmParameters) (crypto.Signer, error) {
+	switch {
+	case parameters.rsaBits != 0:
+		return rsa.GenerateKey(rand.Reader, parameters.rsaBits)
+
+	case parameters.curve != nil:
+		return ecdsa.GenerateKey(parameters.curve, rand.Reader)
+
+	case parameters.ed25519:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+
+		return privateKey, err
+
+	default:
+		return nil, fmt.Errorf("No key type for algorithm parameters %+v", parameters)
+	}
+}
+
+// sign signs digest, or for Ed25519 and raw PKCS#1 keys the given data, with privateKey.
+func sign(
+	parameters algorithmParameters,
+	privateKey crypto.Signer,
+	digest []byte,
+) ([]byte, error) {
+	var opts crypto.SignerOpts = parameters.hash
+
+	if parameters.pss {
+		opts = &rsa.PSSOptions{
+			SaltLength: rsa.PSSSaltLengthEqualsHash,
+			Hash:       parameters.hash,
+		}
+	}
+
+	return privateKey.Sign(rand.Reader, digest, opts)
+}
+
+// marshalPublicKey is like x509.MarshalPKIXPublicKey, but also encodes secp256k1 keys, which
+// crypto/x509 does not support.
+func marshalPublicKey(publicKey crypto.PublicKey) ([]byte, error) {
+	ecdsaPublicKey, ok := publicKey.(*ecdsa.PublicKey)
+
+	if !ok || ecdsaPublicKey.Curve != secp256k1.S256() {
+		return x509.MarshalPKIXPublicKey(publicKey)
+	}
+
+	point := make([]byte, 65)
+	point[0] = 4
+	ecdsaPublicKey.X.FillBytes(point[1:33])
+	ecdsaPublicKey.Y.FillBytes(point[33:])
+
+	namedCurve, err := asn1.Marshal(asn1.ObjectIdentifier{1, 3, 132, 0, 10})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1},
+			Parameters: asn1.RawValue{FullBytes: namedCurve},
+		},
+		PublicKey: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	})
+}
@@ -0,0 +1,48 @@
+package kmsfake
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	cloudkms "cloud.google.com/go/kms/apiv1"
+	"google.golang.org/api/option"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const loopbackBufferSize = 1024 * 1024
+
+// loopbackClient returns a real Cloud KMS client connected to the fake through an in-memory
+// listener. It is created on first use, and lives as long as the fake.
+func (client *KeyManagementClient) loopbackClient() *cloudkms.KeyManagementClient {
+	client.loopbackOnce.Do(func() {
+		listener := bufconn.Listen(loopbackBufferSize)
+
+		NewServer(client).Serve(listener)
+
+		conn, err := grpc.NewClient(
+			"passthrough:///kmsfake",
+			grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+				return listener.DialContext(ctx)
+			}),
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+		)
+
+		if err != nil {
+			panic(fmt.Sprintf("kmsfake: could not create loopback connection: %v", err))
+		}
+
+		client.loopback, err = cloudkms.NewKeyManagementClient(
+			context.Background(),
+			option.WithGRPCConn(conn),
+		)
+
+		if err != nil {
+			panic(fmt.Sprintf("kmsfake: could not create loopback client: %v", err))
+		}
+	})
+
+	return client.loopback
+}
@@ -0,0 +1,90 @@
+package kmsfake
+
+import (
+	"context"
+	"net"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/grpc"
+)
+
+// Server exposes a KeyManagementClient over gRPC, so that a real *cloudkms.KeyManagementClient
+// (or the google-kms-x509 binary) can be pointed at it. Only the methods implemented by
+// KeyManagementClient are available, the rest return codes.Unimplemented.
+type Server struct {
+	kmspb.UnimplementedKeyManagementServiceServer
+
+	client *KeyManagementClient
+}
+
+func NewServer(client *KeyManagementClient) *Server {
+	return &Server{client: client}
+}
+
+// Serve registers the server with a new grpc.Server and serves requests on the listener until it
+// is closed, or the returned grpc.Server is stopped.
+func (server *Server) Serve(listener net.Listener) *grpc.Server {
+	grpcServer := grpc.NewServer()
+
+	kmspb.RegisterKeyManagementServiceServer(grpcServer, server)
+
+	go grpcServer.Serve(listener)
+
+	return grpcServer
+}
+
+func (server *Server) CreateKeyRing(
+	ctx context.Context,
+	req *kmspb.CreateKeyRingRequest,
+) (*kmspb.KeyRing, error) {
+	return server.client.CreateKeyRing(ctx, req)
+}
+
+func (server *Server) CreateCryptoKey(
+	ctx context.Context,
+	req *kmspb.CreateCryptoKeyRequest,
+) (*kmspb.CryptoKey, error) {
+	return server.client.CreateCryptoKey(ctx, req)
+}
+
+func (server *Server) CreateCryptoKeyVersion(
+	ctx context.Context,
+	req *kmspb.CreateCryptoKeyVersionRequest,
+) (*kmspb.CryptoKeyVersion, error) {
+	return server.client.CreateCryptoKeyVersion(ctx, req)
+}
+
+func (server *Server) GetCryptoKey(
+	ctx context.Context,
+	req *kmspb.GetCryptoKeyRequest,
+) (*kmspb.CryptoKey, error) {
+	return server.client.GetCryptoKey(ctx, req)
+}
+
+func (server *Server) ListCryptoKeyVersions(
+	ctx context.Context,
+	req *kmspb.ListCryptoKeyVersionsRequest,
+) (*kmspb.ListCryptoKeyVersionsResponse, error) {
+	return server.client.listCryptoKeyVersions(ctx, req)
+}
+
+func (server *Server) GetCryptoKeyVersion(
+	ctx context.Context,
+	req *kmspb.GetCryptoKeyVersionRequest,
+) (*kmspb.CryptoKeyVersion, error) {
+	return server.client.GetCryptoKeyVersion(ctx, req)
+}
+
+func (server *Server) GetPublicKey(
+	ctx context.Context,
+	req *kmspb.GetPublicKeyRequest,
+) (*kmspb.PublicKey, error) {
+	return server.client.GetPublicKey(ctx, req)
+}
+
+func (server *Server) AsymmetricSign(
+	ctx context.Context,
+	req *kmspb.AsymmetricSignRequest,
+) (*kmspb.AsymmetricSignResponse, error) {
+	return server.client.AsymmetricSign(ctx, req)
+}
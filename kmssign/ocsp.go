@@ -0,0 +1,483 @@
+package kmssign
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// OCSP request parsing and response signing, as described in RFC 6960. Responses are signed by
+// the signer's key, which is either the issuing CA's key or a delegated responder's key whose
+// certificate is included in the response.
+
+var (
+	// https://tools.ietf.org/html/rfc6960#section-4.2.1
+	ocspBasicResponseOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+	// https://tools.ietf.org/html/rfc8954
+	ocspNonceOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+
+	// https://tools.ietf.org/html/rfc6960#section-4.2.2.2.1
+	ocspNoCheckOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+)
+
+var ocspHashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:   {1, 3, 14, 3, 2, 26},
+	crypto.SHA256: {2, 16, 840, 1, 101, 3, 4, 2, 1},
+	crypto.SHA384: {2, 16, 840, 1, 101, 3, 4, 2, 2},
+	crypto.SHA512: {2, 16, 840, 1, 101, 3, 4, 2, 3},
+}
+
+var signatureAlgorithmOIDs = map[x509.SignatureAlgorithm]asn1.ObjectIdentifier{
+	x509.SHA256WithRSA:    {1, 2, 840, 113549, 1, 1, 11},
+	x509.SHA384WithRSA:    {1, 2, 840, 113549, 1, 1, 12},
+	x509.SHA512WithRSA:    {1, 2, 840, 113549, 1, 1, 13},
+	x509.SHA256WithRSAPSS: {1, 2, 840, 113549, 1, 1, 10},
+	x509.SHA512WithRSAPSS: {1, 2, 840, 113549, 1, 1, 10},
+	x509.ECDSAWithSHA256:  {1, 2, 840, 10045, 4, 3, 2},
+	x509.ECDSAWithSHA384:  {1, 2, 840, 10045, 4, 3, 3},
+	x509.PureEd25519:      {1, 3, 101, 112},
+}
+
+// RSASSA-PSS-params with the hash's MGF1 and a salt the length of the hash, as in crypto/x509.
+var pssParameters = map[x509.SignatureAlgorithm][]byte{
+	x509.SHA256WithRSAPSS: {
+		48, 52, 160, 15, 48, 13, 6, 9, 96, 134, 72, 1, 101, 3, 4, 2, 1, 5, 0, 161, 28, 48, 26, 6,
+		9, 42, 134, 72, 134, 247, 13, 1, 1, 8, 48, 13, 6, 9, 96, 134, 72, 1, 101, 3, 4, 2, 1, 5, 0,
+		162, 3, 2, 1, 32,
+	},
+	x509.SHA512WithRSAPSS: {
+		48, 52, 160, 15, 48, 13, 6, 9, 96, 134, 72, 1, 101, 3, 4, 2, 3, 5, 0, 161, 28, 48, 26, 6,
+		9, 42, 134, 72, 134, 247, 13, 1, 1, 8, 48, 13, 6, 9, 96, 134, 72, 1, 101, 3, 4, 2, 3, 5, 0,
+		162, 3, 2, 1, 64,
+	},
+}
+
+// OCSPResponseStatus is the status of an OCSP response as a whole.
+type OCSPResponseStatus int
+
+const (
+	OCSPSuccessful       OCSPResponseStatus = 0
+	OCSPMalformedRequest OCSPResponseStatus = 1
+	OCSPInternalError    OCSPResponseStatus = 2
+	OCSPTryLater         OCSPResponseStatus = 3
+	OCSPUnauthorized     OCSPResponseStatus = 6
+)
+
+// OCSPCertStatus is the status of a single certificate in an OCSP response.
+type OCSPCertStatus int
+
+const (
+	OCSPGood OCSPCertStatus = iota
+	OCSPRevoked
+	OCSPUnknown
+)
+
+// OCSPNoCheckExtension returns the id-pkix-ocsp-nocheck certificate extension, telling relying
+// parties not to check the revocation status of a delegated OCSP responder certificate.
+func OCSPNoCheckExtension() pkix.Extension {
+	return pkix.Extension{Id: ocspNoCheckOID, Value: asn1.NullBytes}
+}
+
+// ErrMalformedOCSPRequest is returned by ParseOCSPRequest for requests that cannot be parsed.
+var ErrMalformedOCSPRequest = errors.New("malformed OCSP request")
+
+type ocspCertID struct {
+	Raw            asn1.RawContent
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type ocspRequest struct {
+	TBSRequest        ocspTBSRequest
+	OptionalSignature asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspTBSRequest struct {
+	Version           int           `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName     asn1.RawValue `asn1:"explicit,tag:1,optional"`
+	RequestList       []ocspSingleRequest
+	RequestExtensions []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+type ocspSingleRequest struct {
+	CertID                  ocspCertID
+	SingleRequestExtensions []pkix.Extension `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponse struct {
+	Status        asn1.Enumerated
+	ResponseBytes ocspResponseBytes `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseBytes struct {
+	ResponseType asn1.ObjectIdentifier
+	Response     []byte
+}
+
+type ocspBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+type ocspResponseData struct {
+	Version            int `asn1:"explicit,tag:0,default:0,optional"`
+	ResponderID        asn1.RawValue
+	ProducedAt         time.Time `asn1:"generalized"`
+	Responses          []ocspSingleResponse
+	ResponseExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type ocspSingleResponse struct {
+	CertID     ocspCertID
+	Good       asn1.Flag       `asn1:"tag:0,optional"`
+	Revoked    ocspRevokedInfo `asn1:"tag:1,optional"`
+	Unknown    asn1.Flag       `asn1:"tag:2,optional"`
+	ThisUpdate time.Time       `asn1:"generalized"`
+	NextUpdate time.Time       `asn1:"generalized,explicit,tag:0,optional"`
+}
+
+type ocspRevokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+// OCSPCertID identifies a certificate in OCSP requests and responses, by hashes of its issuer's
+// name and public key, and its serial number.
+type OCSPCertID struct {
+	// HashAlgorithm is the hash used for IssuerNameHash and IssuerKeyHash, or zero if the request
+	// used a hash that is not supported.
+	HashAlgorithm  crypto.Hash
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+
+	// raw is the CertID as it appeared in the request, so that the response repeats it exactly.
+	raw []byte
+}
+
+// NewOCSPCertID returns the CertID for the certificate with serialNumber issued by issuer.
+func NewOCSPCertID(
+	issuer *x509.Certificate,
+	serialNumber *big.Int,
+	hashAlgorithm crypto.Hash,
+) (OCSPCertID, error) {
+	if _, ok := ocspHashOIDs[hashAlgorithm]; !ok {
+		return OCSPCertID{}, fmt.Errorf("Unsupported OCSP hash algorithm %v", hashAlgorithm)
+	}
+
+	issuerKeyHash, err := publicKeyHash(issuer.PublicKey, hashAlgorithm)
+
+	if err != nil {
+		return OCSPCertID{}, err
+	}
+
+	issuerNameHash := hashAlgorithm.New()
+	issuerNameHash.Write(issuer.RawSubject)
+
+	return OCSPCertID{
+		HashAlgorithm:  hashAlgorithm,
+		IssuerNameHash: issuerNameHash.Sum(nil),
+		IssuerKeyHash:  issuerKeyHash,
+		SerialNumber:   serialNumber,
+	}, nil
+}
+
+// IssuedBy reports whether the CertID refers to a certificate issued by issuer.
+func (id OCSPCertID) IssuedBy(issuer *x509.Certificate) bool {
+	if id.HashAlgorithm == 0 {
+		return false
+	}
+
+	issuerID, err := NewOCSPCertID(issuer, id.SerialNumber, id.HashAlgorithm)
+
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(id.IssuerNameHash, issuerID.IssuerNameHash) &&
+		bytes.Equal(id.IssuerKeyHash, issuerID.IssuerKeyHash)
+}
+
+func (id OCSPCertID) marshal() ocspCertID {
+	if id.raw != nil {
+		return ocspCertID{Raw: id.raw}
+	}
+
+	return ocspCertID{
+		HashAlgorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  ocspHashOIDs[id.HashAlgorithm],
+			Parameters: asn1.NullRawValue,
+		},
+		IssuerNameHash: id.IssuerNameHash,
+		IssuerKeyHash:  id.IssuerKeyHash,
+		SerialNumber:   id.SerialNumber,
+	}
+}
+
+// publicKeyHash returns the hash of the subjectPublicKey BIT STRING of publicKey, as used for
+// issuer key hashes and responder key IDs.
+func publicKeyHash(publicKey crypto.PublicKey, hashAlgorithm crypto.Hash) ([]byte, error) {
+	spkiBytes, err := marshalPKIXPublicKey(publicKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var spki subjectPublicKeyInfo
+
+	if _, err := asn1.Unmarshal(spkiBytes, &spki); err != nil {
+		return nil, err
+	}
+
+	hash := hashAlgorithm.New()
+	hash.Write(spki.PublicKey.RightAlign())
+
+	return hash.Sum(nil), nil
+}
+
+// OCSPRequest is a parsed OCSP request.
+type OCSPRequest struct {
+	CertIDs []OCSPCertID
+
+	// Nonce is the value of the request's nonce extension, if it had one.
+	Nonce []byte
+}
+
+// ParseOCSPRequest parses a DER-encoded OCSP request. Request signatures are not checked.
+func ParseOCSPRequest(der []byte) (*OCSPRequest, error) {
+	var request ocspRequest
+
+	if rest, err := asn1.Unmarshal(der, &request); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMalformedOCSPRequest, err)
+	} else if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing data", ErrMalformedOCSPRequest)
+	}
+
+	if len(request.TBSRequest.RequestList) == 0 {
+		return nil, fmt.Errorf("%w: no certificates requested", ErrMalformedOCSPRequest)
+	}
+
+	parsed := &OCSPRequest{}
+
+	for _, singleRequest := range request.TBSRequest.RequestList {
+		certID := singleRequest.CertID
+
+		parsed.CertIDs = append(parsed.CertIDs, OCSPCertID{
+			HashAlgorithm:  ocspHashAlgorithm(certID.HashAlgorithm.Algorithm),
+			IssuerNameHash: certID.IssuerNameHash,
+			IssuerKeyHash:  certID.IssuerKeyHash,
+			SerialNumber:   certID.SerialNumber,
+			raw:            certID.Raw,
+		})
+	}
+
+	for _, extension := range request.TBSRequest.RequestExtensions {
+		if !extension.Id.Equal(ocspNonceOID) {
+			continue
+		}
+
+		// RFC 8954 limits nonces to 32 octets.
+		rest, err := asn1.Unmarshal(extension.Value, &parsed.Nonce)
+
+		if err != nil || len(rest) != 0 || len(parsed.Nonce) == 0 || len(parsed.Nonce) > 32 {
+			return nil, fmt.Errorf("%w: invalid nonce", ErrMalformedOCSPRequest)
+		}
+	}
+
+	return parsed, nil
+}
+
+func ocspHashAlgorithm(oid asn1.ObjectIdentifier) crypto.Hash {
+	for hashAlgorithm, hashOID := range ocspHashOIDs {
+		if oid.Equal(hashOID) {
+			return hashAlgorithm
+		}
+	}
+
+	return 0
+}
+
+// OCSPSingleResponse is the status of one certificate in an OCSP response.
+type OCSPSingleResponse struct {
+	CertID OCSPCertID
+	Status OCSPCertStatus
+
+	// RevokedAt and RevocationReason are only used for revoked certificates.
+	RevokedAt        time.Time
+	RevocationReason int
+
+	ThisUpdate time.Time
+	NextUpdate time.Time
+}
+
+// OCSPResponse is the template for a signed OCSP response.
+type OCSPResponse struct {
+	Responses  []OCSPSingleResponse
+	ProducedAt time.Time
+
+	// Nonce is repeated from the request, if it had one.
+	Nonce []byte
+
+	// Certificates are included in the response, e.g. a delegated responder's certificate.
+	Certificates []*x509.Certificate
+
+	SignatureAlgorithm x509.SignatureAlgorithm
+}
+
+// OCSPErrorResponse returns an unsigned OCSP response with an error status, such as
+// OCSPUnauthorized or OCSPMalformedRequest.
+func OCSPErrorResponse(status OCSPResponseStatus) []byte {
+	return []byte{0x30, 0x03, 0x0a, 0x01, byte(status)}
+}
+
+// CreateOCSPResponse returns a DER-encoded, successful OCSP response signed by the signer, with
+// a responder ID naming the signer's key.
+func (signer *GoogleKMSSigner) CreateOCSPResponse(template *OCSPResponse) ([]byte, error) {
+	return signer.CreateOCSPResponseContext(signer.ctx, template)
+}
+
+// CreateOCSPResponseContext is like CreateOCSPResponse, but uses ctx for the call to Cloud KMS.
+func (signer *GoogleKMSSigner) CreateOCSPResponseContext(
+	ctx context.Context,
+	template *OCSPResponse,
+) ([]byte, error) {
+	signatureAlgorithm, _, err := signer.operationSignatureAlgorithm(template.SignatureAlgorithm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	algorithmOID, ok := signatureAlgorithmOIDs[signatureAlgorithm]
+
+	if !ok {
+		return nil, fmt.Errorf("%w: %v for OCSP", ErrUnsupportedAlgorithm, signatureAlgorithm)
+	}
+
+	algorithmIdentifier := pkix.AlgorithmIdentifier{Algorithm: algorithmOID}
+
+	if parameters, ok := pssParameters[signatureAlgorithm]; ok {
+		algorithmIdentifier.Parameters = asn1.RawValue{FullBytes: parameters}
+	} else if signatureAlgorithm != x509.PureEd25519 && !isECDSA(signatureAlgorithm) {
+		algorithmIdentifier.Parameters = asn1.NullRawValue
+	}
+
+	responderKeyHash, err := publicKeyHash(signer.publicKey, crypto.SHA1)
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not compute responder key ID: %w", err)
+	}
+
+	responderKeyHashBytes, err := asn1.Marshal(responderKeyHash)
+
+	if err != nil {
+		return nil, err
+	}
+
+	responseData := ocspResponseData{
+		ResponderID: asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        2,
+			IsCompound: true,
+			Bytes:      responderKeyHashBytes,
+		},
+		ProducedAt: template.ProducedAt.UTC().Truncate(time.Second),
+	}
+
+	for _, response := range template.Responses {
+		singleResponse := ocspSingleResponse{
+			CertID:     response.CertID.marshal(),
+			ThisUpdate: response.ThisUpdate.UTC().Truncate(time.Second),
+			NextUpdate: response.NextUpdate.UTC().Truncate(time.Second),
+		}
+
+		switch response.Status {
+		case OCSPGood:
+			singleResponse.Good = true
+
+		case OCSPRevoked:
+			singleResponse.Revoked = ocspRevokedInfo{
+				RevocationTime: response.RevokedAt.UTC().Truncate(time.Second),
+				Reason:         asn1.Enumerated(response.RevocationReason),
+			}
+
+		case OCSPUnknown:
+			singleResponse.Unknown = true
+
+		default:
+			return nil, fmt.Errorf("Unknown OCSP certificate status %d", response.Status)
+		}
+
+		responseData.Responses = append(responseData.Responses, singleResponse)
+	}
+
+	if template.Nonce != nil {
+		nonce, err := asn1.Marshal(template.Nonce)
+
+		if err != nil {
+			return nil, err
+		}
+
+		responseData.ResponseExtensions = []pkix.Extension{{Id: ocspNonceOID, Value: nonce}}
+	}
+
+	tbs, err := asn1.Marshal(responseData)
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not encode OCSP response: %w", err)
+	}
+
+	signature, err := signer.signToBeSigned(ctx, tbs, signatureAlgorithm)
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not sign OCSP response: %w", err)
+	}
+
+	responder := &x509.Certificate{PublicKey: signer.publicKey}
+
+	if err := responder.CheckSignature(signatureAlgorithm, tbs, signature); err != nil {
+		return nil, fmt.Errorf("%w: OCSP response: %v", ErrSignatureVerificationFailed, err)
+	}
+
+	basicResponse := ocspBasicResponse{
+		TBSResponseData:    asn1.RawValue{FullBytes: tbs},
+		SignatureAlgorithm: algorithmIdentifier,
+		Signature:          asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)},
+	}
+
+	for _, certificate := range template.Certificates {
+		basicResponse.Certificates = append(
+			basicResponse.Certificates,
+			asn1.RawValue{FullBytes: certificate.Raw},
+		)
+	}
+
+	basicResponseBytes, err := asn1.Marshal(basicResponse)
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not encode OCSP response: %w", err)
+	}
+
+	return asn1.Marshal(ocspResponse{
+		Status: asn1.Enumerated(OCSPSuccessful),
+		ResponseBytes: ocspResponseBytes{
+			ResponseType: ocspBasicResponseOID,
+			Response:     basicResponseBytes,
+		},
+	})
+}
+
+func isECDSA(signatureAlgorithm x509.SignatureAlgorithm) bool {
+	return signatureAlgorithm == x509.ECDSAWithSHA256 || signatureAlgorithm == x509.ECDSAWithSHA384
+}
@@ -0,0 +1,279 @@
+package kmssign
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/ericnorris/google-kms-x509/kmssign/kmsfake"
+	"golang.org/x/crypto/ocsp"
+)
+
+// testLeaf returns a leaf certificate issued by signer, for the signer's own key.
+func testLeaf(t *testing.T, signer *GoogleKMSSigner) *x509.Certificate {
+	t.Helper()
+
+	template := testCATemplate("leaf")
+	template.IsCA = false
+
+	rawLeaf, err := signer.CreateCertificate(template, signer.Public(), false)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaf, err := ParseCertificate(rawLeaf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return leaf
+}
+
+// testOCSPRequest returns an OCSP request for certificate, with a nonce if nonce is not nil.
+func testOCSPRequest(
+	t *testing.T,
+	certificate *x509.Certificate,
+	issuer *x509.Certificate,
+	nonce []byte,
+) []byte {
+	t.Helper()
+
+	certID, err := NewOCSPCertID(issuer, certificate.SerialNumber, crypto.SHA256)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := ocspRequest{
+		TBSRequest: ocspTBSRequest{
+			RequestList: []ocspSingleRequest{{CertID: certID.marshal()}},
+		},
+	}
+
+	if nonce != nil {
+		value, err := asn1.Marshal(nonce)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		request.TBSRequest.RequestExtensions = []pkix.Extension{{Id: ocspNonceOID, Value: value}}
+	}
+
+	der, err := asn1.Marshal(request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return der
+}
+
+func TestCreateOCSPResponse(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	nonce := []byte("0123456789abcdef")
+
+	for _, algorithm := range kmsfake.SigningAlgorithms() {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			signer, root := testRootCA(t, algorithm)
+			leaf := testLeaf(t, signer)
+
+			request, err := ParseOCSPRequest(testOCSPRequest(t, leaf, root, nonce))
+
+			if err != nil {
+				t.Fatalf("ParseOCSPRequest() failed: %v", err)
+			}
+
+			if !bytes.Equal(request.Nonce, nonce) {
+				t.Errorf("Nonce = %x, want %x", request.Nonce, nonce)
+			}
+
+			if len(request.CertIDs) != 1 || !request.CertIDs[0].IssuedBy(root) {
+				t.Fatalf("Request is not for a certificate issued by the root: %+v", request.CertIDs)
+			}
+
+			rawResponse, err := signer.CreateOCSPResponse(&OCSPResponse{
+				Responses: []OCSPSingleResponse{{
+					CertID:           request.CertIDs[0],
+					Status:           OCSPRevoked,
+					RevokedAt:        now.Add(-time.Hour),
+					RevocationReason: RevocationReasons["keyCompromise"],
+					ThisUpdate:       now,
+					NextUpdate:       now.Add(time.Hour),
+				}},
+				ProducedAt: now,
+				Nonce:      request.Nonce,
+			})
+
+			if err != nil {
+				t.Fatalf("CreateOCSPResponse() failed: %v", err)
+			}
+
+			var response ocspResponse
+			var basicResponse ocspBasicResponse
+
+			if _, err := asn1.Unmarshal(rawResponse, &response); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := asn1.Unmarshal(response.ResponseBytes.Response, &basicResponse); err != nil {
+				t.Fatal(err)
+			}
+
+			err = root.CheckSignature(
+				signer.signatureAlgorithm,
+				basicResponse.TBSResponseData.FullBytes,
+				basicResponse.Signature.RightAlign(),
+			)
+
+			if err != nil {
+				t.Errorf("OCSP response signature does not verify: %v", err)
+			}
+
+			var responseData ocspResponseData
+			var gotNonce []byte
+
+			if _, err := asn1.Unmarshal(basicResponse.TBSResponseData.FullBytes, &responseData); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, extension := range responseData.ResponseExtensions {
+				if extension.Id.Equal(ocspNonceOID) {
+					asn1.Unmarshal(extension.Value, &gotNonce)
+				}
+			}
+
+			if !bytes.Equal(gotNonce, nonce) {
+				t.Errorf("Response nonce = %x, want %x", gotNonce, nonce)
+			}
+
+			switch signer.signatureAlgorithm {
+			case x509.PureEd25519, x509.SHA256WithRSAPSS, x509.SHA512WithRSAPSS:
+				// not supported by golang.org/x/crypto/ocsp.
+				return
+			}
+
+			parsed, err := ocsp.ParseResponseForCert(rawResponse, leaf, root)
+
+			if err != nil {
+				t.Fatalf("ocsp.ParseResponseForCert() failed: %v", err)
+			}
+
+			if parsed.Status != ocsp.Revoked || parsed.RevocationReason != ocsp.KeyCompromise {
+				t.Errorf(
+					"Status = %d reason %d, want revoked for keyCompromise",
+					parsed.Status,
+					parsed.RevocationReason,
+				)
+			}
+
+			if !parsed.RevokedAt.Equal(now.Add(-time.Hour)) ||
+				!parsed.NextUpdate.Equal(now.Add(time.Hour)) {
+				t.Errorf("RevokedAt = %v, NextUpdate = %v", parsed.RevokedAt, parsed.NextUpdate)
+			}
+
+			responderKeyHash, err := publicKeyHash(signer.Public(), crypto.SHA1)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !bytes.Equal(parsed.ResponderKeyHash, responderKeyHash) {
+				t.Errorf("ResponderKeyHash = %x, want %x", parsed.ResponderKeyHash, responderKeyHash)
+			}
+		})
+	}
+}
+
+func TestCreateOCSPResponseForNewCertID(t *testing.T) {
+	signer, root := testRootCA(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+	leaf := testLeaf(t, signer)
+
+	certID, err := NewOCSPCertID(root, leaf.SerialNumber, crypto.SHA1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rawResponse, err := signer.CreateOCSPResponse(&OCSPResponse{
+		Responses: []OCSPSingleResponse{{
+			CertID:     certID,
+			Status:     OCSPGood,
+			ThisUpdate: time.Now(),
+			NextUpdate: time.Now().Add(time.Hour),
+		}},
+		ProducedAt:   time.Now(),
+		Certificates: []*x509.Certificate{root},
+	})
+
+	if err != nil {
+		t.Fatalf("CreateOCSPResponse() failed: %v", err)
+	}
+
+	parsed, err := ocsp.ParseResponseForCert(rawResponse, leaf, root)
+
+	if err != nil {
+		t.Fatalf("ocsp.ParseResponseForCert() failed: %v", err)
+	}
+
+	if parsed.Status != ocsp.Good || parsed.IssuerHash != crypto.SHA1 {
+		t.Errorf("Status = %d with hash %v, want good with SHA-1", parsed.Status, parsed.IssuerHash)
+	}
+
+	if parsed.Certificate == nil || !parsed.Certificate.Equal(root) {
+		t.Errorf("Response does not include the responder certificate")
+	}
+}
+
+func TestParseOCSPRequestErrors(t *testing.T) {
+	signer, root := testRootCA(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+	leaf := testLeaf(t, signer)
+
+	for name, request := range map[string][]byte{
+		"garbage":       []byte("not an OCSP request"),
+		"empty nonce":   testOCSPRequest(t, leaf, root, []byte{}),
+		"long nonce":    testOCSPRequest(t, leaf, root, make([]byte, 33)),
+		"no requests":   {0x30, 0x04, 0x30, 0x02, 0x30, 0x00},
+		"trailing data": append(testOCSPRequest(t, leaf, root, nil), 0),
+	} {
+		if _, err := ParseOCSPRequest(request); !errors.Is(err, ErrMalformedOCSPRequest) {
+			t.Errorf("ParseOCSPRequest(%s) = %v, want ErrMalformedOCSPRequest", name, err)
+		}
+	}
+
+	otherSigner, other := testRootCA(t, kmspb.CryptoKeyVersion_EC_SIGN_P384_SHA384)
+	request, err := ParseOCSPRequest(testOCSPRequest(t, testLeaf(t, otherSigner), other, nil))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if request.CertIDs[0].IssuedBy(root) {
+		t.Error("IssuedBy() matched a different issuer")
+	}
+
+	request.CertIDs[0].SerialNumber = big.NewInt(1)
+
+	if !request.CertIDs[0].IssuedBy(other) {
+		t.Error("IssuedBy() did not match the issuer")
+	}
+}
+
+func TestOCSPErrorResponse(t *testing.T) {
+	_, err := ocsp.ParseResponse(OCSPErrorResponse(OCSPUnauthorized), nil)
+
+	var responseError ocsp.ResponseError
+
+	if !errors.As(err, &responseError) || responseError.Status != ocsp.Unauthorized {
+		t.Errorf("ocsp.ParseResponse() = %v, want an unauthorized response", err)
+	}
+}
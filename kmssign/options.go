@@ -0,0 +1,68 @@
+package kmssign
+
+import (
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/grpc/codes"
+)
+
+// Option configures optional behavior of a GoogleKMSSigner.
+type Option func(*signerOptions)
+
+type signerOptions struct {
+	retryPolicy            RetryPolicy
+	versionSelector        VersionSelector
+	minimumProtectionLevel kmspb.ProtectionLevel
+	allowExternalKeys      bool
+	issuanceStores         []IssuanceStore
+	requester              string
+	serialNumberGenerator  SerialNumberGenerator
+}
+
+func defaultSignerOptions() signerOptions {
+	return signerOptions{
+		retryPolicy:           DefaultRetryPolicy,
+		versionSelector:       NewestEnabledVersion,
+		serialNumberGenerator: generateSerialNumber,
+	}
+}
+
+// RetryPolicy controls how calls to Cloud KMS are retried. Calls are retried when they fail with
+// one of RetryableCodes, or when the response fails its CRC32C integrity check.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per call, including the first one. Values less
+	// than 1 are treated as 1, i.e. no retries.
+	MaxAttempts int
+
+	// InitialBackoff is the upper bound of the first pause between attempts. Each following pause
+	// is bounded by the previous bound times Multiplier, up to MaxBackoff, and the actual pause is
+	// chosen randomly below that bound.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+
+	RetryableCodes []codes.Code
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    5,
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	Multiplier:     2,
+	RetryableCodes: []codes.Code{
+		codes.Unavailable,
+		codes.DeadlineExceeded,
+		codes.ResourceExhausted,
+		codes.Internal,
+	},
+}
+
+// NoRetries makes a single attempt for every call to Cloud KMS.
+var NoRetries = RetryPolicy{MaxAttempts: 1}
+
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(options *signerOptions) {
+		options.retryPolicy = policy
+	}
+}
@@ -0,0 +1,326 @@
+package kmssign
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net/url"
+	"unicode/utf8"
+)
+
+var (
+	// https://tools.ietf.org/html/rfc5280#section-4.2.1.4
+	certificatePoliciesOID = asn1.ObjectIdentifier{2, 5, 29, 32}
+
+	// AnyPolicyOID is the special policy matching any other policy.
+	AnyPolicyOID = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+
+	// https://tools.ietf.org/html/rfc5280#section-4.2.1.5
+	policyMappingsOID = asn1.ObjectIdentifier{2, 5, 29, 33}
+
+	// https://tools.ietf.org/html/rfc5280#section-4.2.1.11
+	policyConstraintsOID = asn1.ObjectIdentifier{2, 5, 29, 36}
+
+	// https://tools.ietf.org/html/rfc5280#section-4.2.1.14
+	inhibitAnyPolicyOID = asn1.ObjectIdentifier{2, 5, 29, 54}
+
+	cpsQualifierOID        = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}
+	userNoticeQualifierOID = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 2}
+)
+
+// maxExplicitTextLength is the longest user notice explicit text RFC 5280 allows, in characters.
+const maxExplicitTextLength = 200
+
+// PolicyInformation is a certificate policy, with its optional qualifiers.
+type PolicyInformation struct {
+	ID asn1.ObjectIdentifier
+
+	// CPSURIs point to the certification practice statement published by the CA.
+	CPSURIs []string
+
+	UserNotices []UserNotice
+}
+
+// UserNotice is a notice to display to relying parties. It has explicit text, a reference to a
+// numbered notice published by an organization, or both.
+type UserNotice struct {
+	Organization  string
+	NoticeNumbers []int
+	ExplicitText  string
+}
+
+// PolicyMapping declares that the issuer's IssuerDomainPolicy is equivalent to the subject CA's
+// SubjectDomainPolicy.
+type PolicyMapping struct {
+	IssuerDomainPolicy  asn1.ObjectIdentifier
+	SubjectDomainPolicy asn1.ObjectIdentifier
+}
+
+type policyInformation struct {
+	PolicyIdentifier asn1.ObjectIdentifier
+	PolicyQualifiers []policyQualifierInfo `asn1:"optional,omitempty"`
+}
+
+type policyQualifierInfo struct {
+	PolicyQualifierID asn1.ObjectIdentifier
+	Qualifier         asn1.RawValue
+}
+
+type userNotice struct {
+	NoticeRef    noticeReference `asn1:"optional"`
+	ExplicitText string          `asn1:"optional,utf8"`
+}
+
+type noticeReference struct {
+	Organization  string `asn1:"utf8"`
+	NoticeNumbers []int
+}
+
+type policyMapping struct {
+	IssuerDomainPolicy  asn1.ObjectIdentifier
+	SubjectDomainPolicy asn1.ObjectIdentifier
+}
+
+// CertificatePoliciesExtension returns the certificate policies extension for policies, with their
+// CPS and user notice qualifiers, which crypto/x509 cannot encode. Add it to
+// x509.Certificate.ExtraExtensions, where it replaces the extension crypto/x509 would generate.
+func CertificatePoliciesExtension(policies []PolicyInformation) (pkix.Extension, error) {
+	if len(policies) == 0 {
+		return pkix.Extension{}, fmt.Errorf("%w: No policies", ErrInvalidCertificatePolicy)
+	}
+
+	var encoded []policyInformation
+
+	for i, policy := range policies {
+		if len(policy.ID) < 2 {
+			return pkix.Extension{}, fmt.Errorf(
+				"%w: Policy %d has no OID",
+				ErrInvalidCertificatePolicy,
+				i+1,
+			)
+		}
+
+		for _, other := range policies[:i] {
+			if other.ID.Equal(policy.ID) {
+				return pkix.Extension{}, fmt.Errorf(
+					"%w: Policy %s is listed twice",
+					ErrInvalidCertificatePolicy,
+					policy.ID,
+				)
+			}
+		}
+
+		information := policyInformation{PolicyIdentifier: policy.ID}
+
+		for _, cpsURI := range policy.CPSURIs {
+			qualifier, err := cpsQualifier(policy.ID, cpsURI)
+
+			if err != nil {
+				return pkix.Extension{}, err
+			}
+
+			information.PolicyQualifiers = append(information.PolicyQualifiers, qualifier)
+		}
+
+		for _, notice := range policy.UserNotices {
+			qualifier, err := userNoticeQualifier(policy.ID, notice)
+
+			if err != nil {
+				return pkix.Extension{}, err
+			}
+
+			information.PolicyQualifiers = append(information.PolicyQualifiers, qualifier)
+		}
+
+		encoded = append(encoded, information)
+	}
+
+	value, err := asn1.Marshal(encoded)
+
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{Id: certificatePoliciesOID, Value: value}, nil
+}
+
+func cpsQualifier(policyID asn1.ObjectIdentifier, cpsURI string) (policyQualifierInfo, error) {
+	parsed, err := url.Parse(cpsURI)
+
+	if err != nil || parsed.Scheme == "" || !isASCII(cpsURI) {
+		return policyQualifierInfo{}, fmt.Errorf(
+			"%w: CPS URI %q of policy %s is not an absolute ASCII URI",
+			ErrInvalidCertificatePolicy,
+			cpsURI,
+			policyID,
+		)
+	}
+
+	value, err := asn1.MarshalWithParams(cpsURI, "ia5")
+
+	if err != nil {
+		return policyQualifierInfo{}, err
+	}
+
+	return policyQualifierInfo{
+		PolicyQualifierID: cpsQualifierOID,
+		Qualifier:         asn1.RawValue{FullBytes: value},
+	}, nil
+}
+
+func userNoticeQualifier(
+	policyID asn1.ObjectIdentifier,
+	notice UserNotice,
+) (policyQualifierInfo, error) {
+	invalid := func(reason string) error {
+		return fmt.Errorf(
+			"%w: User notice of policy %s %s",
+			ErrInvalidCertificatePolicy,
+			policyID,
+			reason,
+		)
+	}
+
+	hasNoticeRef := notice.Organization != "" || len(notice.NoticeNumbers) > 0
+
+	switch {
+	case !hasNoticeRef && notice.ExplicitText == "":
+		return policyQualifierInfo{}, invalid("needs explicit text or a notice reference")
+
+	case hasNoticeRef && (notice.Organization == "" || len(notice.NoticeNumbers) == 0):
+		return policyQualifierInfo{}, invalid("reference needs an organization and notice numbers")
+
+	case !utf8.ValidString(notice.ExplicitText) || !utf8.ValidString(notice.Organization):
+		return policyQualifierInfo{}, invalid("is not UTF-8")
+
+	case utf8.RuneCountInString(notice.ExplicitText) > maxExplicitTextLength:
+		return policyQualifierInfo{}, invalid(
+			fmt.Sprintf("explicit text is longer than %d characters", maxExplicitTextLength),
+		)
+	}
+
+	value, err := asn1.Marshal(userNotice{
+		NoticeRef: noticeReference{
+			Organization:  notice.Organization,
+			NoticeNumbers: notice.NoticeNumbers,
+		},
+		ExplicitText: notice.ExplicitText,
+	})
+
+	if err != nil {
+		return policyQualifierInfo{}, err
+	}
+
+	return policyQualifierInfo{
+		PolicyQualifierID: userNoticeQualifierOID,
+		Qualifier:         asn1.RawValue{FullBytes: value},
+	}, nil
+}
+
+// PolicyConstraintsExtension returns the critical policy constraints extension of a CA. A
+// non-negative requireExplicitPolicy is the number of further certificates in a path after which
+// every certificate must have an acceptable policy, and a non-negative inhibitPolicyMapping is
+// the number after which policy mappings are ignored. Negative values are omitted, but one of them
+// must be set.
+func PolicyConstraintsExtension(
+	requireExplicitPolicy int,
+	inhibitPolicyMapping int,
+) (pkix.Extension, error) {
+	var constraints []asn1.RawValue
+
+	for tag, skipCerts := range []int{requireExplicitPolicy, inhibitPolicyMapping} {
+		if skipCerts < 0 {
+			continue
+		}
+
+		integer, err := asn1.Marshal(skipCerts)
+
+		if err != nil {
+			return pkix.Extension{}, err
+		}
+
+		var raw asn1.RawValue
+
+		if _, err := asn1.Unmarshal(integer, &raw); err != nil {
+			return pkix.Extension{}, err
+		}
+
+		// SkipCerts are implicitly tagged, [0] for requireExplicitPolicy and [1] for
+		// inhibitPolicyMapping.
+		constraints = append(
+			constraints,
+			asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, Bytes: raw.Bytes},
+		)
+	}
+
+	if len(constraints) == 0 {
+		return pkix.Extension{}, fmt.Errorf(
+			"%w: Policy constraints need requireExplicitPolicy or inhibitPolicyMapping",
+			ErrInvalidCertificatePolicy,
+		)
+	}
+
+	value, err := asn1.Marshal(constraints)
+
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{Id: policyConstraintsOID, Critical: true, Value: value}, nil
+}
+
+// InhibitAnyPolicyExtension returns the critical inhibit anyPolicy extension of a CA: after
+// skipCerts further certificates in a path, anyPolicy no longer matches other policies.
+func InhibitAnyPolicyExtension(skipCerts int) (pkix.Extension, error) {
+	if skipCerts < 0 {
+		return pkix.Extension{}, fmt.Errorf(
+			"%w: inhibitAnyPolicy cannot be negative",
+			ErrInvalidCertificatePolicy,
+		)
+	}
+
+	value, err := asn1.Marshal(skipCerts)
+
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{Id: inhibitAnyPolicyOID, Critical: true, Value: value}, nil
+}
+
+// PolicyMappingsExtension returns the critical policy mappings extension of a CA. anyPolicy
+// cannot be mapped.
+func PolicyMappingsExtension(mappings []PolicyMapping) (pkix.Extension, error) {
+	if len(mappings) == 0 {
+		return pkix.Extension{}, fmt.Errorf("%w: No policy mappings", ErrInvalidCertificatePolicy)
+	}
+
+	var encoded []policyMapping
+
+	for _, mapping := range mappings {
+		if len(mapping.IssuerDomainPolicy) < 2 || len(mapping.SubjectDomainPolicy) < 2 {
+			return pkix.Extension{}, fmt.Errorf(
+				"%w: Policy mappings need two policy OIDs",
+				ErrInvalidCertificatePolicy,
+			)
+		}
+
+		if mapping.IssuerDomainPolicy.Equal(AnyPolicyOID) ||
+			mapping.SubjectDomainPolicy.Equal(AnyPolicyOID) {
+			return pkix.Extension{}, fmt.Errorf(
+				"%w: anyPolicy cannot be mapped",
+				ErrInvalidCertificatePolicy,
+			)
+		}
+
+		encoded = append(encoded, policyMapping(mapping))
+	}
+
+	value, err := asn1.Marshal(encoded)
+
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{Id: policyMappingsOID, Critical: true, Value: value}, nil
+}
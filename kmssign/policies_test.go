@@ -0,0 +1,209 @@
+package kmssign
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"reflect"
+	"testing"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+)
+
+func TestPolicyExtensions(t *testing.T) {
+	signer, _ := testRootCA(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+
+	policyID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	mappedID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 2}
+
+	certificatePoliciesExt, err := CertificatePoliciesExtension([]PolicyInformation{
+		{
+			ID:      policyID,
+			CPSURIs: []string{"https://pki.example.com/cps"},
+			UserNotices: []UserNotice{
+				{Organization: "Example", NoticeNumbers: []int{1, 2}, ExplicitText: "Notice"},
+			},
+		},
+		{ID: AnyPolicyOID},
+	})
+
+	if err != nil {
+		t.Fatalf("CertificatePoliciesExtension() failed: %v", err)
+	}
+
+	policyConstraintsExt, err := PolicyConstraintsExtension(0, 1)
+
+	if err != nil {
+		t.Fatalf("PolicyConstraintsExtension() failed: %v", err)
+	}
+
+	inhibitAnyPolicyExt, err := InhibitAnyPolicyExtension(0)
+
+	if err != nil {
+		t.Fatalf("InhibitAnyPolicyExtension() failed: %v", err)
+	}
+
+	policyMappingsExt, err := PolicyMappingsExtension([]PolicyMapping{
+		{IssuerDomainPolicy: policyID, SubjectDomainPolicy: mappedID},
+	})
+
+	if err != nil {
+		t.Fatalf("PolicyMappingsExtension() failed: %v", err)
+	}
+
+	template := testCATemplate("Policy CA")
+	template.ExtraExtensions = []pkix.Extension{
+		certificatePoliciesExt,
+		policyConstraintsExt,
+		inhibitAnyPolicyExt,
+		policyMappingsExt,
+	}
+
+	rawCertificate, err := signer.CreateCertificate(template, signer.Public(), false)
+
+	if err != nil {
+		t.Fatalf("CreateCertificate() failed: %v", err)
+	}
+
+	certificate, err := ParseCertificate(rawCertificate)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantPolicies := []string{policyID.String(), AnyPolicyOID.String()}
+	var policies []string
+
+	for _, policy := range certificate.Policies {
+		policies = append(policies, policy.String())
+	}
+
+	if !reflect.DeepEqual(policies, wantPolicies) {
+		t.Errorf("Policies = %v, want %v", policies, wantPolicies)
+	}
+
+	if certificate.RequireExplicitPolicy != 0 || !certificate.RequireExplicitPolicyZero ||
+		certificate.InhibitPolicyMapping != 1 ||
+		certificate.InhibitAnyPolicy != 0 || !certificate.InhibitAnyPolicyZero {
+		t.Errorf(
+			"RequireExplicitPolicy = %d, InhibitPolicyMapping = %d, InhibitAnyPolicy = %d",
+			certificate.RequireExplicitPolicy,
+			certificate.InhibitPolicyMapping,
+			certificate.InhibitAnyPolicy,
+		)
+	}
+
+	if len(certificate.PolicyMappings) != 1 ||
+		certificate.PolicyMappings[0].IssuerDomainPolicy.String() != policyID.String() ||
+		certificate.PolicyMappings[0].SubjectDomainPolicy.String() != mappedID.String() {
+		t.Errorf("PolicyMappings = %v", certificate.PolicyMappings)
+	}
+
+	var parsedPolicies []policyInformation
+
+	if _, err := asn1.Unmarshal(certificatePoliciesExt.Value, &parsedPolicies); err != nil {
+		t.Fatal(err)
+	}
+
+	qualifiers := parsedPolicies[0].PolicyQualifiers
+
+	if len(qualifiers) != 2 || len(parsedPolicies[1].PolicyQualifiers) != 0 {
+		t.Fatalf("Unexpected qualifiers %v", parsedPolicies)
+	}
+
+	var cpsURI string
+
+	if _, err := asn1.Unmarshal(qualifiers[0].Qualifier.FullBytes, &cpsURI); err != nil ||
+		!qualifiers[0].PolicyQualifierID.Equal(cpsQualifierOID) ||
+		cpsURI != "https://pki.example.com/cps" {
+		t.Errorf("CPS qualifier = %v %q, %v", qualifiers[0].PolicyQualifierID, cpsURI, err)
+	}
+
+	var notice userNotice
+
+	if _, err := asn1.Unmarshal(qualifiers[1].Qualifier.FullBytes, &notice); err != nil ||
+		!qualifiers[1].PolicyQualifierID.Equal(userNoticeQualifierOID) ||
+		notice.ExplicitText != "Notice" || notice.NoticeRef.Organization != "Example" ||
+		!reflect.DeepEqual(notice.NoticeRef.NoticeNumbers, []int{1, 2}) {
+		t.Errorf("User notice qualifier = %+v, %v", notice, err)
+	}
+}
+
+func TestPolicyExtensionsInvalid(t *testing.T) {
+	policyID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 99999, 1}
+	longText := string(make([]byte, maxExplicitTextLength+1))
+
+	for name, build := range map[string]func() (pkix.Extension, error){
+		"no policies": func() (pkix.Extension, error) {
+			return CertificatePoliciesExtension(nil)
+		},
+		"duplicate policy": func() (pkix.Extension, error) {
+			return CertificatePoliciesExtension([]PolicyInformation{{ID: policyID}, {ID: policyID}})
+		},
+		"relative CPS URI": func() (pkix.Extension, error) {
+			return CertificatePoliciesExtension([]PolicyInformation{
+				{ID: policyID, CPSURIs: []string{"/cps"}},
+			})
+		},
+		"empty user notice": func() (pkix.Extension, error) {
+			return CertificatePoliciesExtension([]PolicyInformation{
+				{ID: policyID, UserNotices: []UserNotice{{}}},
+			})
+		},
+		"notice reference without numbers": func() (pkix.Extension, error) {
+			return CertificatePoliciesExtension([]PolicyInformation{
+				{ID: policyID, UserNotices: []UserNotice{{Organization: "Example"}}},
+			})
+		},
+		"long explicit text": func() (pkix.Extension, error) {
+			return CertificatePoliciesExtension([]PolicyInformation{
+				{ID: policyID, UserNotices: []UserNotice{{ExplicitText: longText}}},
+			})
+		},
+		"empty policy constraints": func() (pkix.Extension, error) {
+			return PolicyConstraintsExtension(-1, -1)
+		},
+		"negative inhibitAnyPolicy": func() (pkix.Extension, error) {
+			return InhibitAnyPolicyExtension(-1)
+		},
+		"mapped anyPolicy": func() (pkix.Extension, error) {
+			return PolicyMappingsExtension([]PolicyMapping{
+				{IssuerDomainPolicy: AnyPolicyOID, SubjectDomainPolicy: policyID},
+			})
+		},
+	} {
+		if _, err := build(); !errors.Is(err, ErrInvalidCertificatePolicy) {
+			t.Errorf("%s: got %v, want ErrInvalidCertificatePolicy", name, err)
+		}
+	}
+}
+
+// The policy constraints extension is only valid with at least one of its fields, and both can be
+// zero.
+func TestPolicyConstraintsExtension(t *testing.T) {
+	for _, test := range []struct {
+		requireExplicitPolicy int
+		inhibitPolicyMapping  int
+		want                  []byte
+	}{
+		{0, -1, []byte{0x30, 0x03, 0x80, 0x01, 0x00}},
+		{-1, 2, []byte{0x30, 0x03, 0x81, 0x01, 0x02}},
+		{1, 0, []byte{0x30, 0x06, 0x80, 0x01, 0x01, 0x81, 0x01, 0x00}},
+	} {
+		extension, err := PolicyConstraintsExtension(
+			test.requireExplicitPolicy,
+			test.inhibitPolicyMapping,
+		)
+
+		if err != nil || !reflect.DeepEqual(extension.Value, test.want) || !extension.Critical {
+			t.Errorf(
+				"PolicyConstraintsExtension(%d, %d) = %x, %v; want %x",
+				test.requireExplicitPolicy,
+				test.inhibitPolicyMapping,
+				extension.Value,
+				err,
+				test.want,
+			)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package kmssign
+
+import (
+	"errors"
+	"fmt"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+)
+
+var (
+	// ErrWrongKeyPurpose is returned by NewGoogleKMSSigner for keys whose purpose is not
+	// ASYMMETRIC_SIGN.
+	ErrWrongKeyPurpose = errors.New("key is not an ASYMMETRIC_SIGN key")
+
+	// ErrProtectionLevelTooLow is returned by NewGoogleKMSSigner for key versions below the level
+	// set with WithMinimumProtectionLevel.
+	ErrProtectionLevelTooLow = errors.New("key version protection level is too low")
+)
+
+// protectionLevelRanks orders the protection levels of keys held by Cloud KMS from weakest to
+// strongest. Single-tenant HSM keys count as HSM keys.
+var protectionLevelRanks = map[kmspb.ProtectionLevel]int{
+	kmspb.ProtectionLevel_SOFTWARE:          1,
+	kmspb.ProtectionLevel_HSM:               2,
+	kmspb.ProtectionLevel_HSM_SINGLE_TENANT: 2,
+}
+
+// externalProtectionLevels are the protection levels of keys held by an external key manager,
+// whose protection Cloud KMS cannot attest to.
+var externalProtectionLevels = map[kmspb.ProtectionLevel]bool{
+	kmspb.ProtectionLevel_EXTERNAL:     true,
+	kmspb.ProtectionLevel_EXTERNAL_VPC: true,
+}
+
+// WithMinimumProtectionLevel makes NewGoogleKMSSigner refuse key versions with a weaker protection
+// level than level, in the order SOFTWARE < HSM. EXTERNAL is a level of its own: external keys
+// meet a SOFTWARE or EXTERNAL minimum, but an HSM minimum only with WithExternalKeysAllowed, and
+// only external keys meet an EXTERNAL minimum.
+func WithMinimumProtectionLevel(level kmspb.ProtectionLevel) Option {
+	return func(options *signerOptions) {
+		options.minimumProtectionLevel = level
+	}
+}
+
+// WithExternalKeysAllowed lets EXTERNAL and EXTERNAL_VPC key versions meet the HSM minimum set with
+// WithMinimumProtectionLevel, for external key managers trusted to keep keys in HSMs.
+func WithExternalKeysAllowed() Option {
+	return func(options *signerOptions) {
+		options.allowExternalKeys = true
+	}
+}
+
+// meetsProtectionLevel reports whether a key version with protection level meets minimum.
+func meetsProtectionLevel(level, minimum kmspb.ProtectionLevel, allowExternalKeys bool) bool {
+	switch {
+	case externalProtectionLevels[level]:
+		return externalProtectionLevels[minimum] ||
+			minimum == kmspb.ProtectionLevel_SOFTWARE ||
+			allowExternalKeys
+
+	case externalProtectionLevels[minimum]:
+		return false
+
+	default:
+		return protectionLevelRanks[level] >= protectionLevelRanks[minimum]
+	}
+}
+
+// checkKeyPolicy returns an error if the key cannot be used for signing, or does not meet the
+// requirements set by options.
+func checkKeyPolicy(
+	cryptoKey *kmspb.CryptoKey,
+	keyVersion *kmspb.CryptoKeyVersion,
+	options signerOptions,
+) error {
+	if cryptoKey.Purpose != kmspb.CryptoKey_ASYMMETRIC_SIGN {
+		return fmt.Errorf(
+			"%w: %s has purpose %s", ErrWrongKeyPurpose, cryptoKey.Name, cryptoKey.Purpose,
+		)
+	}
+
+	if options.minimumProtectionLevel == kmspb.ProtectionLevel_PROTECTION_LEVEL_UNSPECIFIED {
+		return nil
+	}
+
+	if !meetsProtectionLevel(
+		keyVersion.ProtectionLevel,
+		options.minimumProtectionLevel,
+		options.allowExternalKeys,
+	) {
+		return fmt.Errorf(
+			"%w: %s has protection level %s, at least %s is required",
+			ErrProtectionLevelTooLow,
+			keyVersion.Name,
+			keyVersion.ProtectionLevel,
+			options.minimumProtectionLevel,
+		)
+	}
+
+	return nil
+}
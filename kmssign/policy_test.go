@@ -0,0 +1,93 @@
+package kmssign
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/ericnorris/google-kms-x509/kmssign/kmsfake"
+)
+
+func TestWithMinimumProtectionLevel(t *testing.T) {
+	client := kmsfake.NewKeyManagementClient()
+
+	_, err := client.CreateKeyRing(context.Background(), &kmspb.CreateKeyRingRequest{
+		Parent:    "projects/test/locations/global",
+		KeyRingId: "test",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, protectionLevel := range []kmspb.ProtectionLevel{
+		kmspb.ProtectionLevel_SOFTWARE,
+		kmspb.ProtectionLevel_HSM,
+		kmspb.ProtectionLevel_EXTERNAL,
+	} {
+		_, err := client.CreateCryptoKey(context.Background(), &kmspb.CreateCryptoKeyRequest{
+			Parent:      testKeyRing,
+			CryptoKeyId: protectionLevel.String(),
+			CryptoKey: &kmspb.CryptoKey{
+				Purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN,
+				VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+					Algorithm:       kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+					ProtectionLevel: protectionLevel,
+				},
+			},
+		})
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		key           kmspb.ProtectionLevel
+		minimum       kmspb.ProtectionLevel
+		allowExternal bool
+		wantErr       bool
+	}{
+		{kmspb.ProtectionLevel_SOFTWARE, kmspb.ProtectionLevel_PROTECTION_LEVEL_UNSPECIFIED, false, false},
+		{kmspb.ProtectionLevel_SOFTWARE, kmspb.ProtectionLevel_SOFTWARE, false, false},
+		{kmspb.ProtectionLevel_SOFTWARE, kmspb.ProtectionLevel_HSM, false, true},
+		{kmspb.ProtectionLevel_HSM, kmspb.ProtectionLevel_HSM, false, false},
+		{kmspb.ProtectionLevel_HSM, kmspb.ProtectionLevel_EXTERNAL, false, true},
+		{kmspb.ProtectionLevel_EXTERNAL, kmspb.ProtectionLevel_SOFTWARE, false, false},
+		{kmspb.ProtectionLevel_EXTERNAL, kmspb.ProtectionLevel_HSM, false, true},
+		{kmspb.ProtectionLevel_EXTERNAL, kmspb.ProtectionLevel_HSM, true, false},
+		{kmspb.ProtectionLevel_EXTERNAL, kmspb.ProtectionLevel_EXTERNAL, false, false},
+	}
+
+	for _, test := range tests {
+		keyName := testKeyRing + "/cryptoKeys/" + test.key.String() + "/cryptoKeyVersions/1"
+		options := []Option{WithMinimumProtectionLevel(test.minimum)}
+
+		if test.allowExternal {
+			options = append(options, WithExternalKeysAllowed())
+		}
+
+		_, err := NewGoogleKMSSigner(context.Background(), client, keyName, options...)
+
+		if test.wantErr && !errors.Is(err, ErrProtectionLevelTooLow) {
+			t.Errorf(
+				"%s key with minimum %s, allowing external keys %t: got %v, want ErrProtectionLevelTooLow",
+				test.key,
+				test.minimum,
+				test.allowExternal,
+				err,
+			)
+		}
+
+		if !test.wantErr && err != nil {
+			t.Errorf(
+				"%s key with minimum %s, allowing external keys %t: got %v, want success",
+				test.key,
+				test.minimum,
+				test.allowExternal,
+				err,
+			)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package kmssign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	gax "github.com/googleapis/gax-go/v2"
+	"google.golang.org/grpc/status"
+)
+
+// retry calls f until it succeeds, returns an error that is not retryable under the policy, the
+// policy's attempts are exhausted, or ctx is done. The last error is classified with classifyError.
+func (policy RetryPolicy) retry(ctx context.Context, f func() error) error {
+	backoff := gax.Backoff{
+		Initial:    policy.InitialBackoff,
+		Max:        policy.MaxBackoff,
+		Multiplier: policy.Multiplier,
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := f()
+
+		if err == nil {
+			return nil
+		}
+
+		if attempt >= policy.MaxAttempts || !policy.isRetryable(err) {
+			return classifyError(err)
+		}
+
+		if sleepErr := gax.Sleep(ctx, backoff.Pause()); sleepErr != nil {
+			return fmt.Errorf("%w (gave up after %d attempts: %v)", classifyError(err), attempt, sleepErr)
+		}
+	}
+}
+
+func (policy RetryPolicy) isRetryable(err error) bool {
+	if errors.Is(err, ErrIntegrityCheckFailed) {
+		return true
+	}
+
+	code := status.Code(err)
+
+	for _, retryableCode := range policy.RetryableCodes {
+		if code == retryableCode {
+			return true
+		}
+	}
+
+	return false
+}
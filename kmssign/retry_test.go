@@ -0,0 +1,214 @@
+package kmssign
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/ericnorris/google-kms-x509/kmssign/kmsfake"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var fastRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	InitialBackoff: time.Millisecond,
+	MaxBackoff:     time.Millisecond,
+	Multiplier:     2,
+	RetryableCodes: []codes.Code{codes.Unavailable, codes.DeadlineExceeded},
+}
+
+func newRetryTestSigner(t *testing.T, opts ...Option) (*kmsfake.KeyManagementClient, *GoogleKMSSigner) {
+	t.Helper()
+
+	client := kmsfake.NewKeyManagementClient()
+
+	version, err := client.AddSigningKey(
+		context.Background(),
+		testKeyRing+"/cryptoKeys/retry",
+		kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+	)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewGoogleKMSSigner(context.Background(), client, version.Name, opts...)
+
+	if err != nil {
+		t.Fatalf("NewGoogleKMSSigner() failed: %v", err)
+	}
+
+	return client, signer
+}
+
+func TestSignRetries(t *testing.T) {
+	digest := make([]byte, crypto.SHA256.Size())
+	unavailable := status.Error(codes.Unavailable, "try again")
+
+	tests := []struct {
+		name      string
+		inject    func(client *kmsfake.KeyManagementClient)
+		wantCalls int
+		wantErr   error
+	}{
+		{
+			name: "transient errors",
+			inject: func(client *kmsfake.KeyManagementClient) {
+				client.FailNext("AsymmetricSign", 2, unavailable)
+			},
+			wantCalls: 3,
+		},
+		{
+			name: "corrupted responses",
+			inject: func(client *kmsfake.KeyManagementClient) {
+				client.CorruptNext("AsymmetricSign", 2)
+			},
+			wantCalls: 3,
+		},
+		{
+			name: "attempts exhausted",
+			inject: func(client *kmsfake.KeyManagementClient) {
+				client.FailNext("AsymmetricSign", 3, unavailable)
+			},
+			wantCalls: 3,
+			wantErr:   unavailable,
+		},
+		{
+			name: "corruption persists",
+			inject: func(client *kmsfake.KeyManagementClient) {
+				client.CorruptNext("AsymmetricSign", 3)
+			},
+			wantCalls: 3,
+			wantErr:   ErrIntegrityCheckFailed,
+		},
+		{
+			name: "permanent error",
+			inject: func(client *kmsfake.KeyManagementClient) {
+				client.FailNext("AsymmetricSign", 1, status.Error(codes.PermissionDenied, "no"))
+			},
+			wantCalls: 1,
+			wantErr:   errors.New("PermissionDenied"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client, signer := newRetryTestSigner(t, WithRetryPolicy(fastRetryPolicy))
+
+			test.inject(client)
+
+			_, err := signer.Sign(nil, digest, crypto.SHA256)
+
+			if calls := client.CallCount("AsymmetricSign"); calls != test.wantCalls {
+				t.Errorf("AsymmetricSign() called %d times, want %d", calls, test.wantCalls)
+			}
+
+			switch {
+			case test.wantErr == nil && err != nil:
+				t.Errorf("Sign() failed: %v", err)
+
+			case test.wantErr != nil && err == nil:
+				t.Errorf("Sign() succeeded, want error %v", test.wantErr)
+
+			case test.wantErr != nil &&
+				!errors.Is(err, test.wantErr) &&
+				!strings.Contains(err.Error(), test.wantErr.Error()):
+				t.Errorf("Sign() = %v, want error %v", err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewGoogleKMSSignerRetries(t *testing.T) {
+	client, signer := newRetryTestSigner(t)
+
+	client.FailNext("GetCryptoKeyVersion", 1, status.Error(codes.DeadlineExceeded, "slow"))
+	client.CorruptNext("GetPublicKey", 1)
+
+	_, err := NewGoogleKMSSigner(
+		context.Background(),
+		client,
+		signer.keyVersion.Name,
+		WithRetryPolicy(fastRetryPolicy),
+	)
+
+	if err != nil {
+		t.Fatalf("NewGoogleKMSSigner() failed: %v", err)
+	}
+
+	if calls := client.CallCount("GetPublicKey"); calls != 3 {
+		t.Errorf("GetPublicKey() called %d times, want 3", calls)
+	}
+
+	client.CorruptNext("GetPublicKey", 1)
+
+	_, err = NewGoogleKMSSigner(
+		context.Background(),
+		client,
+		signer.keyVersion.Name,
+		WithRetryPolicy(NoRetries),
+	)
+
+	if !errors.Is(err, ErrIntegrityCheckFailed) {
+		t.Errorf("NewGoogleKMSSigner() with a corrupted public key = %v, want %v", err, ErrIntegrityCheckFailed)
+	}
+}
+
+func TestRetryStopsWhenContextDone(t *testing.T) {
+	client, signer := newRetryTestSigner(t)
+
+	client.FailNext("AsymmetricSign", 10, status.Error(codes.Unavailable, "try again"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	policy := fastRetryPolicy
+	policy.MaxAttempts = 100
+	policy.InitialBackoff = time.Second
+	policy.MaxBackoff = time.Second
+
+	signer.options.retryPolicy = policy
+
+	start := time.Now()
+
+	if _, err := signer.SignContext(ctx, nil, make([]byte, 32), crypto.SHA256); err == nil {
+		t.Fatalf("SignContext() succeeded, want error")
+	}
+
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("SignContext() took %v after its context expired", elapsed)
+	}
+}
+
+func TestErrorsAreClassified(t *testing.T) {
+	tests := []struct {
+		code    codes.Code
+		wantErr error
+	}{
+		{codes.Unavailable, ErrKMSUnavailable},
+		{codes.ResourceExhausted, ErrKMSUnavailable},
+		{codes.PermissionDenied, ErrPermissionDenied},
+		{codes.Unauthenticated, ErrPermissionDenied},
+	}
+
+	for _, test := range tests {
+		client, signer := newRetryTestSigner(t, WithRetryPolicy(fastRetryPolicy))
+
+		client.FailNext("AsymmetricSign", fastRetryPolicy.MaxAttempts, status.Error(test.code, "failed"))
+
+		_, err := signer.Sign(nil, make([]byte, crypto.SHA256.Size()), crypto.SHA256)
+
+		if !errors.Is(err, test.wantErr) {
+			t.Errorf("Sign() failing with %s = %v, want %v", test.code, err, test.wantErr)
+		}
+
+		if status.Code(err) != test.code {
+			t.Errorf("Sign() failing with %s lost the status code: %v", test.code, err)
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package kmssign
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	// https://tools.ietf.org/html/rfc5280#section-4.2.1.6
+	subjectAltNameOID = asn1.ObjectIdentifier{2, 5, 29, 17}
+
+	// UPNOtherNameOID is the type of Microsoft user principal name otherNames, which Windows uses
+	// to map client certificates to accounts.
+	UPNOtherNameOID = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 311, 20, 2, 3}
+)
+
+// The GeneralName tags, https://tools.ietf.org/html/rfc5280#section-4.2.1.6
+const (
+	generalNameOtherName = 0
+	generalNameRFC822    = 1
+	generalNameDNS       = 2
+	generalNameURI       = 6
+	generalNameIP        = 7
+)
+
+// OtherName is an otherName subject alternative name with a UTF8String value, such as a UPN.
+type OtherName struct {
+	TypeID asn1.ObjectIdentifier
+	Value  string
+}
+
+// SubjectAltNames are the subject alternative names of a certificate.
+type SubjectAltNames struct {
+	DNSNames       []string
+	IPAddresses    []net.IP
+	EmailAddresses []string
+
+	// URIs may include a SPIFFE ID, https://github.com/spiffe/spiffe/blob/main/standards/SPIFFE-ID.md,
+	// in which case it must be the only URI.
+	URIs []*url.URL
+
+	OtherNames []OtherName
+}
+
+// maxSPIFFEIDLength is the longest SPIFFE ID, in bytes, that implementations must support.
+const maxSPIFFEIDLength = 2048
+
+// Validate returns an error wrapping ErrInvalidSubjectAltName if a name has an invalid syntax:
+// email addresses must be bare RFC 5322 addresses, URIs must be absolute, SPIFFE IDs must follow
+// the SPIFFE ID specification, and UPNs must be of the form user@domain. Names must be ASCII, as
+// they are IA5Strings, except for otherName values.
+func (sans SubjectAltNames) Validate() error {
+	for _, dnsName := range sans.DNSNames {
+		if dnsName == "" || !isASCII(dnsName) {
+			return fmt.Errorf("%w: DNS name %q is not ASCII", ErrInvalidSubjectAltName, dnsName)
+		}
+	}
+
+	for _, emailAddress := range sans.EmailAddresses {
+		if err := validateEmailAddress(emailAddress); err != nil {
+			return err
+		}
+	}
+
+	spiffeIDs := 0
+
+	for _, uri := range sans.URIs {
+		if uri.Scheme == "" || !isASCII(uri.String()) {
+			return fmt.Errorf(
+				"%w: URI %q is not an absolute ASCII URI",
+				ErrInvalidSubjectAltName,
+				uri,
+			)
+		}
+
+		if strings.EqualFold(uri.Scheme, "spiffe") {
+			if err := validateSPIFFEID(uri); err != nil {
+				return err
+			}
+
+			spiffeIDs++
+		}
+	}
+
+	if spiffeIDs > 0 && len(sans.URIs) > 1 {
+		return fmt.Errorf(
+			"%w: A certificate with a SPIFFE ID cannot have other URIs",
+			ErrInvalidSubjectAltName,
+		)
+	}
+
+	for _, otherName := range sans.OtherNames {
+		if len(otherName.TypeID) < 2 {
+			return fmt.Errorf("%w: otherName has no type", ErrInvalidSubjectAltName)
+		}
+
+		if !utf8.ValidString(otherName.Value) {
+			return fmt.Errorf(
+				"%w: otherName %s value is not UTF-8",
+				ErrInvalidSubjectAltName,
+				otherName.TypeID,
+			)
+		}
+
+		if otherName.TypeID.Equal(UPNOtherNameOID) {
+			user, domain, found := strings.Cut(otherName.Value, "@")
+
+			if !found || user == "" || domain == "" || strings.ContainsAny(domain, "@ ") {
+				return fmt.Errorf(
+					"%w: UPN %q is not of the form user@domain",
+					ErrInvalidSubjectAltName,
+					otherName.Value,
+				)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Apply sets the subject alternative names of template, adding the extension returned by
+// SubjectAltNameExtension if there are otherNames.
+func (sans SubjectAltNames) Apply(template *x509.Certificate) error {
+	template.DNSNames = sans.DNSNames
+	template.IPAddresses = sans.IPAddresses
+	template.EmailAddresses = sans.EmailAddresses
+	template.URIs = sans.URIs
+
+	if len(sans.OtherNames) == 0 {
+		return nil
+	}
+
+	subjectAltNameExt, err := SubjectAltNameExtension(template, sans.OtherNames)
+
+	if err != nil {
+		return err
+	}
+
+	template.ExtraExtensions = append(template.ExtraExtensions, subjectAltNameExt)
+
+	return nil
+}
+
+func validateEmailAddress(emailAddress string) error {
+	parsed, err := mail.ParseAddress(emailAddress)
+
+	if err != nil || parsed.Name != "" || parsed.Address != emailAddress || !isASCII(emailAddress) {
+		return fmt.Errorf(
+			"%w: Email address %q is not a bare ASCII address such as user@example.com",
+			ErrInvalidSubjectAltName,
+			emailAddress,
+		)
+	}
+
+	return nil
+}
+
+// validateSPIFFEID checks uri against the SPIFFE ID specification: a lowercase trust domain, and
+// a path of non-empty segments of letters, digits, dots, dashes and underscores.
+func validateSPIFFEID(uri *url.URL) error {
+	invalid := func(reason string) error {
+		return fmt.Errorf("%w: SPIFFE ID %q %s", ErrInvalidSubjectAltName, uri, reason)
+	}
+
+	raw := uri.String()
+
+	switch {
+	case len(raw) > maxSPIFFEIDLength:
+		return invalid(fmt.Sprintf("is longer than %d bytes", maxSPIFFEIDLength))
+
+	case uri.Scheme != "spiffe":
+		return invalid("must use the lowercase spiffe scheme")
+
+	case uri.Opaque != "" || uri.Host == "":
+		return invalid("has no trust domain")
+
+	case uri.User != nil || uri.Port() != "":
+		return invalid("cannot have a user or port")
+
+	case uri.RawQuery != "" || uri.ForceQuery || uri.Fragment != "" || uri.RawFragment != "":
+		return invalid("cannot have a query or fragment")
+
+	case strings.ContainsRune(raw, '%'):
+		return invalid("cannot contain percent-encoded characters")
+	}
+
+	for _, r := range uri.Host {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || strings.ContainsRune(".-_", r)) {
+			return invalid("trust domain may only contain lowercase letters, digits, '.', '-' and '_'")
+		}
+	}
+
+	if uri.Path == "" {
+		return nil
+	}
+
+	for _, segment := range strings.Split(strings.TrimPrefix(uri.Path, "/"), "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return invalid("path cannot have empty, '.' or '..' segments, or a trailing '/'")
+		}
+
+		for _, r := range segment {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+				strings.ContainsRune(".-_", r)) {
+				return invalid("path may only contain letters, digits, '.', '-' and '_'")
+			}
+		}
+	}
+
+	return nil
+}
+
+func isASCII(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SubjectAltNameExtension returns the subject alternative name extension for the DNS names, email
+// addresses, IP addresses and URIs of template, followed by otherNames, which crypto/x509 cannot
+// encode. Add it to template.ExtraExtensions, where it replaces the extension crypto/x509 would
+// generate. As in RFC 5280, the extension is critical for certificates with an empty subject.
+func SubjectAltNameExtension(
+	template *x509.Certificate,
+	otherNames []OtherName,
+) (pkix.Extension, error) {
+	var generalNames []asn1.RawValue
+
+	addName := func(tag int, value []byte) {
+		generalNames = append(
+			generalNames,
+			asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, Bytes: value},
+		)
+	}
+
+	for _, dnsName := range template.DNSNames {
+		addName(generalNameDNS, []byte(dnsName))
+	}
+
+	for _, emailAddress := range template.EmailAddresses {
+		addName(generalNameRFC822, []byte(emailAddress))
+	}
+
+	for _, ip := range template.IPAddresses {
+		if ipv4 := ip.To4(); ipv4 != nil {
+			ip = ipv4
+		}
+
+		addName(generalNameIP, ip)
+	}
+
+	for _, uri := range template.URIs {
+		addName(generalNameURI, []byte(uri.String()))
+	}
+
+	for _, otherName := range otherNames {
+		value, err := asn1.MarshalWithParams(otherName.Value, "utf8")
+
+		if err != nil {
+			return pkix.Extension{}, err
+		}
+
+		encoded, err := asn1.Marshal(struct {
+			TypeID asn1.ObjectIdentifier
+			Value  asn1.RawValue
+		}{
+			TypeID: otherName.TypeID,
+			// encoding/asn1 ignores the tag parameters of RawValue fields, so value is wrapped
+			// in its explicit [0] tag here.
+			Value: asn1.RawValue{
+				Class:      asn1.ClassContextSpecific,
+				Tag:        0,
+				IsCompound: true,
+				Bytes:      value,
+			},
+		})
+
+		if err != nil {
+			return pkix.Extension{}, fmt.Errorf("Could not encode otherName %s: %w", otherName.TypeID, err)
+		}
+
+		// OtherName is implicitly tagged, so its SEQUENCE tag is replaced by the GeneralName tag.
+		var sequence asn1.RawValue
+
+		if _, err := asn1.Unmarshal(encoded, &sequence); err != nil {
+			return pkix.Extension{}, err
+		}
+
+		generalNames = append(generalNames, asn1.RawValue{
+			Class:      asn1.ClassContextSpecific,
+			Tag:        generalNameOtherName,
+			IsCompound: true,
+			Bytes:      sequence.Bytes,
+		})
+	}
+
+	value, err := asn1.Marshal(generalNames)
+
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+
+	return pkix.Extension{
+		Id:       subjectAltNameOID,
+		Critical: len(template.Subject.ToRDNSequence()) == 0 && len(template.RawSubject) == 0,
+		Value:    value,
+	}, nil
+}
@@ -0,0 +1,159 @@
+package kmssign
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+)
+
+func TestSubjectAltNameExtension(t *testing.T) {
+	signer, _ := testRootCA(t, kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256)
+
+	spiffeID, err := url.Parse("spiffe://example.org/ns/web")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := testCATemplate("")
+	template.Subject = pkix.Name{}
+	template.IsCA = false
+	template.DNSNames = []string{"www.example.com"}
+	template.EmailAddresses = []string{"alice@example.com"}
+	template.IPAddresses = []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")}
+	template.URIs = []*url.URL{spiffeID}
+
+	subjectAltNameExt, err := SubjectAltNameExtension(template, []OtherName{
+		{TypeID: UPNOtherNameOID, Value: "alice@corp.example.com"},
+	})
+
+	if err != nil {
+		t.Fatalf("SubjectAltNameExtension() failed: %v", err)
+	}
+
+	template.ExtraExtensions = []pkix.Extension{subjectAltNameExt}
+
+	rawLeaf, err := signer.CreateCertificate(template, signer.Public(), false)
+
+	if err != nil {
+		t.Fatalf("CreateCertificate() failed: %v", err)
+	}
+
+	leaf, err := ParseCertificate(rawLeaf)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(leaf.DNSNames) != 1 || len(leaf.EmailAddresses) != 1 || len(leaf.IPAddresses) != 2 ||
+		len(leaf.URIs) != 1 || leaf.URIs[0].String() != spiffeID.String() ||
+		!leaf.IPAddresses[0].Equal(template.IPAddresses[0]) {
+		t.Errorf("Unexpected names %v %v %v %v",
+			leaf.DNSNames, leaf.EmailAddresses, leaf.IPAddresses, leaf.URIs)
+	}
+
+	var (
+		found        int
+		generalNames []asn1.RawValue
+	)
+
+	for _, extension := range leaf.Extensions {
+		if !extension.Id.Equal(subjectAltNameOID) {
+			continue
+		}
+
+		found++
+
+		if !extension.Critical {
+			t.Errorf("Subject alternative names are not critical with an empty subject")
+		}
+
+		if _, err := asn1.Unmarshal(extension.Value, &generalNames); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if found != 1 || len(generalNames) != 6 {
+		t.Fatalf("Found %d extensions with %d names, want 1 with 6", found, len(generalNames))
+	}
+
+	otherName := generalNames[5]
+
+	var upn struct {
+		TypeID asn1.ObjectIdentifier
+		Value  string `asn1:"explicit,tag:0,utf8"`
+	}
+
+	rest, err := asn1.UnmarshalWithParams(otherName.FullBytes, &upn, "tag:0")
+
+	if err != nil || len(rest) > 0 {
+		t.Fatalf("Could not parse otherName: %v", err)
+	}
+
+	if !upn.TypeID.Equal(UPNOtherNameOID) || upn.Value != "alice@corp.example.com" {
+		t.Errorf("otherName = %v %q", upn.TypeID, upn.Value)
+	}
+}
+
+func TestSubjectAltNamesValidate(t *testing.T) {
+	uris := func(rawURLs ...string) []*url.URL {
+		var parsed []*url.URL
+
+		for _, rawURL := range rawURLs {
+			uri, err := url.Parse(rawURL)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed = append(parsed, uri)
+		}
+
+		return parsed
+	}
+
+	upn := func(value string) []OtherName {
+		return []OtherName{{TypeID: UPNOtherNameOID, Value: value}}
+	}
+
+	tests := []struct {
+		sans  SubjectAltNames
+		valid bool
+	}{
+		{SubjectAltNames{EmailAddresses: []string{"alice@example.com"}}, true},
+		{SubjectAltNames{EmailAddresses: []string{"Alice <alice@example.com>"}}, false},
+		{SubjectAltNames{EmailAddresses: []string{"alice"}}, false},
+		{SubjectAltNames{EmailAddresses: []string{"älice@example.com"}}, false},
+		{SubjectAltNames{URIs: uris("https://example.com/a", "urn:uuid:1234")}, true},
+		{SubjectAltNames{URIs: uris("/relative")}, false},
+		{SubjectAltNames{URIs: uris("spiffe://example.org/ns/web/sa-1")}, true},
+		{SubjectAltNames{URIs: uris("spiffe://example.org")}, true},
+		{SubjectAltNames{URIs: uris("spiffe://Example.org/web")}, false},
+		{SubjectAltNames{URIs: uris("spiffe://example.org:8443/web")}, false},
+		{SubjectAltNames{URIs: uris("spiffe://example.org/web/")}, false},
+		{SubjectAltNames{URIs: uris("spiffe://example.org/a//b")}, false},
+		{SubjectAltNames{URIs: uris("spiffe://example.org/a/../b")}, false},
+		{SubjectAltNames{URIs: uris("spiffe://example.org/web?x=1")}, false},
+		{SubjectAltNames{URIs: uris("spiffe://example.org/web%20x")}, false},
+		{SubjectAltNames{URIs: uris("spiffe://example.org/web", "https://example.com")}, false},
+		{SubjectAltNames{OtherNames: upn("alice@corp.example.com")}, true},
+		{SubjectAltNames{OtherNames: upn("alice")}, false},
+		{SubjectAltNames{OtherNames: upn("@corp.example.com")}, false},
+		{SubjectAltNames{OtherNames: []OtherName{{TypeID: asn1.ObjectIdentifier{1}}}}, false},
+	}
+
+	for _, test := range tests {
+		err := test.sans.Validate()
+
+		if test.valid && err != nil {
+			t.Errorf("Validate(%+v) failed: %v", test.sans, err)
+		} else if !test.valid && !errors.Is(err, ErrInvalidSubjectAltName) {
+			t.Errorf("Validate(%+v) = %v, want ErrInvalidSubjectAltName", test.sans, err)
+		}
+	}
+}
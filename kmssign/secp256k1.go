@@ -0,0 +1,463 @@
+package kmssign
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"sync"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// crypto/x509 cannot parse or encode secp256k1 public keys, which Cloud KMS supports with the
+// EC_SIGN_SECP256K1_SHA256 algorithm. crypto/ecdsa can still sign and verify with them, so the
+// signer represents them as an *ecdsa.PublicKey on the secp256k1 curve, and builds certificates
+// and CSRs with crypto/x509 using a local stand-in key. The stand-in subject public key is then
+// swapped for the real one, and the to-be-signed bytes are re-signed with Cloud KMS.
+
+var (
+	oidPublicKeyECDSA      = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidNamedCurveSecp256k1 = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+type subjectPublicKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// signedData is the outer structure shared by certificates, CSRs and CRLs.
+type signedData struct {
+	ToBeSigned         asn1.RawValue
+	SignatureAlgorithm asn1.RawValue
+	Signature          asn1.BitString
+}
+
+var standInRSAKey = sync.OnceValues(func() (*rsa.PrivateKey, error) {
+	return rsa.GenerateKey(rand.Reader, 2048)
+})
+
+func isSecp256k1(publicKey crypto.PublicKey) bool {
+	ecdsaPublicKey, ok := publicKey.(*ecdsa.PublicKey)
+
+	return ok && ecdsaPublicKey.Curve == secp256k1.S256()
+}
+
+// ParseCertificate is like x509.ParseCertificate, but also accepts certificates for secp256k1
+// keys, whose PublicKey is returned as an *ecdsa.PublicKey on the secp256k1 curve.
+func ParseCertificate(der []byte) (*x509.Certificate, error) {
+	certificate, err := x509.ParseCertificate(der)
+
+	if err == nil {
+		return certificate, nil
+	}
+
+	standInDER, tbs, spki, publicKey, ok := substituteSecp256k1PublicKey(der)
+
+	if !ok {
+		return nil, err
+	}
+
+	certificate, err = x509.ParseCertificate(standInDER)
+
+	if err != nil {
+		return nil, err
+	}
+
+	certificate.Raw = der
+	certificate.RawTBSCertificate = tbs
+	certificate.RawSubjectPublicKeyInfo = spki
+	certificate.PublicKey = publicKey
+
+	return certificate, nil
+}
+
+// ParseCertificateRequest is like x509.ParseCertificateRequest, but also accepts CSRs for
+// secp256k1 keys, whose PublicKey is returned as an *ecdsa.PublicKey on the secp256k1 curve.
+func ParseCertificateRequest(der []byte) (*x509.CertificateRequest, error) {
+	certificateRequest, err := x509.ParseCertificateRequest(der)
+
+	if err == nil {
+		return certificateRequest, nil
+	}
+
+	standInDER, tbs, spki, publicKey, ok := substituteSecp256k1PublicKey(der)
+
+	if !ok {
+		return nil, err
+	}
+
+	certificateRequest, err = x509.ParseCertificateRequest(standInDER)
+
+	if err != nil {
+		return nil, err
+	}
+
+	certificateRequest.Raw = der
+	certificateRequest.RawTBSCertificateRequest = tbs
+	certificateRequest.RawSubjectPublicKeyInfo = spki
+	certificateRequest.PublicKey = publicKey
+
+	return certificateRequest, nil
+}
+
+// substituteSecp256k1PublicKey replaces a secp256k1 SubjectPublicKeyInfo in the to-be-signed part
+// of der with a P-256 one that crypto/x509 can parse. It returns the substituted encoding along
+// with the original to-be-signed bytes, SubjectPublicKeyInfo and public key.
+func substituteSecp256k1PublicKey(
+	der []byte,
+) (standInDER, tbs, spki []byte, publicKey *ecdsa.PublicKey, ok bool) {
+	var signed signedData
+
+	if rest, err := asn1.Unmarshal(der, &signed); err != nil || len(rest) != 0 {
+		return nil, nil, nil, nil, false
+	}
+
+	tbs = signed.ToBeSigned.FullBytes
+
+	for _, child := range sequenceElements(tbs) {
+		if _, err := parseSecp256k1PublicKey(child); err == nil {
+			spki = child
+			break
+		}
+	}
+
+	if spki == nil {
+		return nil, nil, nil, nil, false
+	}
+
+	publicKey, _ = parseSecp256k1PublicKey(spki)
+
+	standInSPKI, err := x509.MarshalPKIXPublicKey(&ecdsa.PublicKey{
+		Curve: elliptic.P256(),
+		X:     elliptic.P256().Params().Gx,
+		Y:     elliptic.P256().Params().Gy,
+	})
+
+	if err != nil {
+		return nil, nil, nil, nil, false
+	}
+
+	standInTBS, err := replaceSequenceElement(tbs, spki, standInSPKI)
+
+	if err != nil {
+		return nil, nil, nil, nil, false
+	}
+
+	signed.ToBeSigned = asn1.RawValue{FullBytes: standInTBS}
+
+	standInDER, err = asn1.Marshal(signed)
+
+	if err != nil {
+		return nil, nil, nil, nil, false
+	}
+
+	return standInDER, tbs, spki, publicKey, true
+}
+
+// marshalPKIXPublicKey is like x509.MarshalPKIXPublicKey, but also accepts secp256k1 keys.
+func marshalPKIXPublicKey(publicKey crypto.PublicKey) ([]byte, error) {
+	if !isSecp256k1(publicKey) {
+		return x509.MarshalPKIXPublicKey(publicKey)
+	}
+
+	ecdsaPublicKey := publicKey.(*ecdsa.PublicKey)
+
+	point := make([]byte, 65)
+	point[0] = 4
+	ecdsaPublicKey.X.FillBytes(point[1:33])
+	ecdsaPublicKey.Y.FillBytes(point[33:])
+
+	namedCurve, err := asn1.Marshal(oidNamedCurveSecp256k1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return asn1.Marshal(subjectPublicKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{
+			Algorithm:  oidPublicKeyECDSA,
+			Parameters: asn1.RawValue{FullBytes: namedCurve},
+		},
+		PublicKey: asn1.BitString{Bytes: point, BitLength: 8 * len(point)},
+	})
+}
+
+// parsePKIXPublicKey is like x509.ParsePKIXPublicKey, but also accepts secp256k1 keys.
+func parsePKIXPublicKey(der []byte) (crypto.PublicKey, error) {
+	publicKey, err := x509.ParsePKIXPublicKey(der)
+
+	if err == nil {
+		return publicKey, nil
+	}
+
+	if secp256k1PublicKey, secp256k1Err := parseSecp256k1PublicKey(der); secp256k1Err == nil {
+		return secp256k1PublicKey, nil
+	}
+
+	return nil, err
+}
+
+func parseSecp256k1PublicKey(der []byte) (*ecdsa.PublicKey, error) {
+	var spki subjectPublicKeyInfo
+
+	if rest, err := asn1.Unmarshal(der, &spki); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, fmt.Errorf("Trailing data after public key")
+	}
+
+	if !spki.Algorithm.Algorithm.Equal(oidPublicKeyECDSA) {
+		return nil, fmt.Errorf("Public key is not an EC key")
+	}
+
+	var namedCurve asn1.ObjectIdentifier
+
+	if _, err := asn1.Unmarshal(spki.Algorithm.Parameters.FullBytes, &namedCurve); err != nil {
+		return nil, err
+	}
+
+	if !namedCurve.Equal(oidNamedCurveSecp256k1) {
+		return nil, fmt.Errorf("Public key is not on the secp256k1 curve")
+	}
+
+	publicKey, err := secp256k1.ParsePubKey(spki.PublicKey.RightAlign())
+
+	if err != nil {
+		return nil, err
+	}
+
+	return publicKey.ToECDSA(), nil
+}
+
+// needsStandIn reports whether crypto/x509 cannot create a certificate or CSR for the signee with
+// this signer directly.
+func (signer *GoogleKMSSigner) needsStandIn(signee crypto.PublicKey) bool {
+	return isSecp256k1(signer.publicKey) || isSecp256k1(signee)
+}
+
+// newStandInSigner returns a local key that crypto/x509 can sign with using signatureAlgorithm, so
+// that the resulting AlgorithmIdentifier can be kept when re-signing.
+func newStandInSigner(signatureAlgorithm x509.SignatureAlgorithm) (crypto.Signer, error) {
+	switch signatureAlgorithm {
+	case x509.ECDSAWithSHA256:
+		return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	case x509.ECDSAWithSHA384:
+		return ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+
+	case x509.PureEd25519:
+		_, privateKey, err := ed25519.GenerateKey(rand.Reader)
+
+		return privateKey, err
+
+	case x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA512WithRSAPSS:
+		return standInRSAKey()
+
+	default:
+		return nil, fmt.Errorf("No stand-in key for signature algorithm %v", signatureAlgorithm)
+	}
+}
+
+func (signer *GoogleKMSSigner) createCertificateWithStandIn(
+	ctx context.Context,
+	template *x509.Certificate,
+	signee crypto.PublicKey,
+) ([]byte, error) {
+	standInSigner, err := newStandInSigner(template.SignatureAlgorithm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var standInSignee crypto.PublicKey = signee
+
+	if isSecp256k1(signee) {
+		standInSigneeKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+		if err != nil {
+			return nil, err
+		}
+
+		standInSignee = standInSigneeKey.Public()
+	}
+
+	// crypto/x509 refuses to sign if the parent's public key doesn't match the signing key.
+	parent := *signer.certificate
+	parent.PublicKey = nil
+
+	rawCertificate, err := x509.CreateCertificate(
+		rand.Reader,
+		template,
+		&parent,
+		standInSignee,
+		standInSigner,
+	)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return signer.resign(ctx, rawCertificate, standInSignee, signee, template.SignatureAlgorithm)
+}
+
+func (signer *GoogleKMSSigner) createCertificateRequestWithStandIn(
+	ctx context.Context,
+	template *x509.CertificateRequest,
+) ([]byte, error) {
+	standInSigner, err := newStandInSigner(template.SignatureAlgorithm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	rawCertificateRequest, err := x509.CreateCertificateRequest(rand.Reader, template, standInSigner)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return signer.resign(
+		ctx,
+		rawCertificateRequest,
+		standInSigner.Public(),
+		signer.publicKey,
+		template.SignatureAlgorithm,
+	)
+}
+
+// resign replaces standInPublicKey with publicKey in the to-be-signed part of a certificate, CSR
+// or CRL, and replaces its signature with one made by Cloud KMS using signatureAlgorithm.
+func (signer *GoogleKMSSigner) resign(
+	ctx context.Context,
+	der []byte,
+	standInPublicKey crypto.PublicKey,
+	publicKey crypto.PublicKey,
+	signatureAlgorithm x509.SignatureAlgorithm,
+) ([]byte, error) {
+	var signed signedData
+
+	if rest, err := asn1.Unmarshal(der, &signed); err != nil {
+		return nil, err
+	} else if len(rest) != 0 {
+		return nil, fmt.Errorf("Trailing data after signed structure")
+	}
+
+	tbs := signed.ToBeSigned.FullBytes
+
+	if !isSecp256k1(standInPublicKey) && isSecp256k1(publicKey) {
+		standInSPKI, err := x509.MarshalPKIXPublicKey(standInPublicKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		spki, err := marshalPKIXPublicKey(publicKey)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if tbs, err = replaceSequenceElement(tbs, standInSPKI, spki); err != nil {
+			return nil, err
+		}
+	}
+
+	signature, err := signer.signToBeSigned(ctx, tbs, signatureAlgorithm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	signed.ToBeSigned = asn1.RawValue{FullBytes: tbs}
+	signed.Signature = asn1.BitString{Bytes: signature, BitLength: 8 * len(signature)}
+
+	return asn1.Marshal(signed)
+}
+
+// signToBeSigned signs the DER-encoded to-be-signed part of a certificate, CSR, CRL or OCSP
+// response with signatureAlgorithm, hashing it first unless the algorithm signs the message itself.
+func (signer *GoogleKMSSigner) signToBeSigned(
+	ctx context.Context,
+	tbs []byte,
+	signatureAlgorithm x509.SignatureAlgorithm,
+) ([]byte, error) {
+	_, hashFunction, err := signer.operationSignatureAlgorithm(signatureAlgorithm)
+
+	if err != nil {
+		return nil, err
+	}
+
+	message := tbs
+
+	if hashFunction != 0 {
+		hash := hashFunction.New()
+		hash.Write(tbs)
+		message = hash.Sum(nil)
+	}
+
+	return signer.SignContext(ctx, rand.Reader, message, hashFunction)
+}
+
+func sequenceElements(der []byte) [][]byte {
+	var sequence asn1.RawValue
+
+	if _, err := asn1.Unmarshal(der, &sequence); err != nil {
+		return nil
+	}
+
+	var elements [][]byte
+
+	for rest := sequence.Bytes; len(rest) > 0; {
+		var element asn1.RawValue
+		var err error
+
+		if rest, err = asn1.Unmarshal(rest, &element); err != nil {
+			return nil
+		}
+
+		elements = append(elements, element.FullBytes)
+	}
+
+	return elements
+}
+
+func replaceSequenceElement(der, old, new []byte) ([]byte, error) {
+	var sequence asn1.RawValue
+
+	if _, err := asn1.Unmarshal(der, &sequence); err != nil {
+		return nil, err
+	}
+
+	var contents []byte
+	found := false
+
+	for _, element := range sequenceElements(der) {
+		if !found && bytes.Equal(element, old) {
+			element = new
+			found = true
+		}
+
+		contents = append(contents, element...)
+	}
+
+	if !found {
+		return nil, fmt.Errorf("Could not find stand-in public key in to-be-signed data")
+	}
+
+	return asn1.Marshal(asn1.RawValue{
+		Class:      sequence.Class,
+		Tag:        sequence.Tag,
+		IsCompound: true,
+		Bytes:      contents,
+	})
+}
@@ -0,0 +1,227 @@
+package kmssign
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"google.golang.org/api/iterator"
+)
+
+// ErrKeyVersionNotEnabled is returned by NewGoogleKMSSigner when the key version, or the version
+// chosen for a CryptoKey, cannot be used to sign because it is not ENABLED.
+var ErrKeyVersionNotEnabled = errors.New("key version is not enabled")
+
+// VersionSelector chooses the version to sign with when NewGoogleKMSSigner is given a CryptoKey
+// name rather than a CryptoKeyVersion name. It is given the CryptoKey and all of its versions, in
+// no particular order.
+type VersionSelector func(
+	cryptoKey *kmspb.CryptoKey,
+	versions []*kmspb.CryptoKeyVersion,
+) (*kmspb.CryptoKeyVersion, error)
+
+// NewestEnabledVersion selects the most recently created ENABLED version. It is the default
+// VersionSelector.
+func NewestEnabledVersion(
+	cryptoKey *kmspb.CryptoKey,
+	versions []*kmspb.CryptoKeyVersion,
+) (*kmspb.CryptoKeyVersion, error) {
+	var newest *kmspb.CryptoKeyVersion
+
+	for _, version := range versions {
+		if version.State != kmspb.CryptoKeyVersion_ENABLED {
+			continue
+		}
+
+		if newest == nil || isNewerVersion(version, newest) {
+			newest = version
+		}
+	}
+
+	if newest == nil {
+		return nil, fmt.Errorf(
+			"%w: CryptoKey %s has no ENABLED versions", ErrKeyVersionNotEnabled, cryptoKey.Name,
+		)
+	}
+
+	return newest, nil
+}
+
+// HighestNumberedVersion selects the version with the highest number, whatever its state. Unlike
+// NewestEnabledVersion, it never falls back to an older version, so NewGoogleKMSSigner fails if the
+// latest version is disabled or still being generated.
+func HighestNumberedVersion(
+	cryptoKey *kmspb.CryptoKey,
+	versions []*kmspb.CryptoKeyVersion,
+) (*kmspb.CryptoKeyVersion, error) {
+	var highest *kmspb.CryptoKeyVersion
+
+	for _, version := range versions {
+		if highest == nil || versionNumber(version) > versionNumber(highest) {
+			highest = version
+		}
+	}
+
+	if highest == nil {
+		return nil, fmt.Errorf("CryptoKey %s has no versions", cryptoKey.Name)
+	}
+
+	return highest, nil
+}
+
+// VersionFromLabel selects the version whose number is the value of label on the CryptoKey, e.g. a
+// "signing-version" label set to "3" selects version 3.
+func VersionFromLabel(label string) VersionSelector {
+	return func(
+		cryptoKey *kmspb.CryptoKey,
+		versions []*kmspb.CryptoKeyVersion,
+	) (*kmspb.CryptoKeyVersion, error) {
+		value, ok := cryptoKey.Labels[label]
+
+		if !ok {
+			return nil, fmt.Errorf("CryptoKey %s has no label %q", cryptoKey.Name, label)
+		}
+
+		for _, version := range versions {
+			if value == strconv.Itoa(versionNumber(version)) {
+				return version, nil
+			}
+		}
+
+		return nil, fmt.Errorf(
+			"CryptoKey %s label %q names version %q, which does not exist",
+			cryptoKey.Name,
+			label,
+			value,
+		)
+	}
+}
+
+// WithVersionSelector sets how NewGoogleKMSSigner chooses a version when given a CryptoKey name.
+// It has no effect when given a CryptoKeyVersion name.
+func WithVersionSelector(selector VersionSelector) Option {
+	return func(options *signerOptions) {
+		options.versionSelector = selector
+	}
+}
+
+// resolveKeyVersion returns the key version named by keyName, which is either a CryptoKeyVersion
+// name or a CryptoKey name whose version is chosen by the configured VersionSelector, along with
+// its CryptoKey.
+func resolveKeyVersion(
+	ctx context.Context,
+	client KeyManagementClient,
+	keyName string,
+	options signerOptions,
+) (*kmspb.CryptoKey, *kmspb.CryptoKeyVersion, error) {
+	cryptoKeyName, _, isVersionName := strings.Cut(keyName, "/cryptoKeyVersions/")
+
+	var cryptoKey *kmspb.CryptoKey
+
+	err := options.retryPolicy.retry(ctx, func() (err error) {
+		cryptoKey, err = client.GetCryptoKey(ctx, &kmspb.GetCryptoKeyRequest{Name: cryptoKeyName})
+
+		return err
+	})
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not get key information: %w", err)
+	}
+
+	if isVersionName {
+		var keyVersion *kmspb.CryptoKeyVersion
+
+		err := options.retryPolicy.retry(ctx, func() (err error) {
+			keyVersion, err = client.GetCryptoKeyVersion(ctx, &kmspb.GetCryptoKeyVersionRequest{
+				Name: keyName,
+			})
+
+			return err
+		})
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("Could not get key version information: %w", err)
+		}
+
+		return cryptoKey, keyVersion, nil
+	}
+
+	var versions []*kmspb.CryptoKeyVersion
+
+	err = options.retryPolicy.retry(ctx, func() error {
+		versions = nil
+
+		versionIterator := client.ListCryptoKeyVersions(ctx, &kmspb.ListCryptoKeyVersionsRequest{
+			Parent: keyName,
+		})
+
+		for {
+			version, err := versionIterator.Next()
+
+			if err == iterator.Done {
+				return nil
+			}
+
+			if err != nil {
+				return err
+			}
+
+			versions = append(versions, version)
+		}
+	})
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not list key versions: %w", err)
+	}
+
+	keyVersion, err := options.versionSelector(cryptoKey, versions)
+
+	if err != nil {
+		return nil, nil, fmt.Errorf("Could not choose a version of %s: %w", keyName, err)
+	}
+
+	return cryptoKey, keyVersion, nil
+}
+
+// checkKeyVersionState returns an error explaining why a key version that is not ENABLED cannot
+// be used.
+func checkKeyVersionState(keyVersion *kmspb.CryptoKeyVersion) error {
+	var reason string
+
+	switch keyVersion.State {
+	case kmspb.CryptoKeyVersion_ENABLED:
+		return nil
+
+	case kmspb.CryptoKeyVersion_DISABLED:
+		reason = "it is DISABLED, enable it or choose another version"
+
+	case kmspb.CryptoKeyVersion_DESTROYED, kmspb.CryptoKeyVersion_DESTROY_SCHEDULED:
+		reason = fmt.Sprintf("it is %s, choose another version", keyVersion.State)
+
+	case kmspb.CryptoKeyVersion_PENDING_GENERATION, kmspb.CryptoKeyVersion_PENDING_IMPORT:
+		reason = fmt.Sprintf("it is %s, try again once it is ENABLED", keyVersion.State)
+
+	default:
+		reason = fmt.Sprintf("it is %s", keyVersion.State)
+	}
+
+	return fmt.Errorf("%w: cannot sign with %s, %s", ErrKeyVersionNotEnabled, keyVersion.Name, reason)
+}
+
+func versionNumber(version *kmspb.CryptoKeyVersion) int {
+	_, number, _ := strings.Cut(version.Name, "/cryptoKeyVersions/")
+	n, _ := strconv.Atoi(number)
+
+	return n
+}
+
+func isNewerVersion(a, b *kmspb.CryptoKeyVersion) bool {
+	if a.CreateTime.AsTime().Equal(b.CreateTime.AsTime()) {
+		return versionNumber(a) > versionNumber(b)
+	}
+
+	return a.CreateTime.AsTime().After(b.CreateTime.AsTime())
+}
@@ -0,0 +1,208 @@
+package kmssign
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"cloud.google.com/go/kms/apiv1/kmspb"
+	"github.com/ericnorris/google-kms-x509/kmssign/kmsfake"
+)
+
+const testRotatedKey = testKeyRing + "/cryptoKeys/rotated"
+
+// newVersionTestClient returns a client with a key that has three versions, the newest of which
+// has the given state.
+func newVersionTestClient(
+	t *testing.T,
+	newestState kmspb.CryptoKeyVersion_CryptoKeyVersionState,
+) *kmsfake.KeyManagementClient {
+	t.Helper()
+
+	client := kmsfake.NewKeyManagementClient()
+
+	for i := 0; i < 3; i++ {
+		_, err := client.AddSigningKey(
+			context.Background(),
+			testRotatedKey,
+			kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+		)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := client.SetVersionState(testRotatedKey+"/cryptoKeyVersions/3", newestState); err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestNewGoogleKMSSignerResolvesCryptoKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		newestState kmspb.CryptoKeyVersion_CryptoKeyVersionState
+		opts        []Option
+		wantVersion string
+		wantErr     string
+	}{
+		{
+			name:        "newest enabled",
+			newestState: kmspb.CryptoKeyVersion_ENABLED,
+			wantVersion: "3",
+		},
+		{
+			name:        "newest enabled skips disabled",
+			newestState: kmspb.CryptoKeyVersion_DISABLED,
+			wantVersion: "2",
+		},
+		{
+			name:        "highest number",
+			newestState: kmspb.CryptoKeyVersion_ENABLED,
+			opts:        []Option{WithVersionSelector(HighestNumberedVersion)},
+			wantVersion: "3",
+		},
+		{
+			name:        "highest number is pending",
+			newestState: kmspb.CryptoKeyVersion_PENDING_GENERATION,
+			opts:        []Option{WithVersionSelector(HighestNumberedVersion)},
+			wantErr:     "PENDING_GENERATION",
+		},
+		{
+			name:        "missing label",
+			newestState: kmspb.CryptoKeyVersion_ENABLED,
+			opts:        []Option{WithVersionSelector(VersionFromLabel("signing-version"))},
+			wantErr:     `no label "signing-version"`,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			client := newVersionTestClient(t, test.newestState)
+
+			signer, err := NewGoogleKMSSigner(context.Background(), client, testRotatedKey, test.opts...)
+
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Fatalf("NewGoogleKMSSigner() = %v, want error containing %q", err, test.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("NewGoogleKMSSigner() failed: %v", err)
+			}
+
+			wantName := testRotatedKey + "/cryptoKeyVersions/" + test.wantVersion
+
+			if signer.KeyVersionName() != wantName {
+				t.Errorf("KeyVersionName() = %s, want %s", signer.KeyVersionName(), wantName)
+			}
+		})
+	}
+}
+
+func TestVersionFromLabel(t *testing.T) {
+	client := kmsfake.NewKeyManagementClient()
+
+	_, err := client.CreateKeyRing(context.Background(), &kmspb.CreateKeyRingRequest{
+		Parent:    "projects/test/locations/global",
+		KeyRingId: "test",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.CreateCryptoKey(context.Background(), &kmspb.CreateCryptoKeyRequest{
+		Parent:      testKeyRing,
+		CryptoKeyId: "labelled",
+		CryptoKey: &kmspb.CryptoKey{
+			Purpose: kmspb.CryptoKey_ASYMMETRIC_SIGN,
+			Labels:  map[string]string{"signing-version": "1"},
+			VersionTemplate: &kmspb.CryptoKeyVersionTemplate{
+				Algorithm: kmspb.CryptoKeyVersion_EC_SIGN_P256_SHA256,
+			},
+		},
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.CreateCryptoKeyVersion(context.Background(), &kmspb.CreateCryptoKeyVersionRequest{
+		Parent: testKeyRing + "/cryptoKeys/labelled",
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := NewGoogleKMSSigner(
+		context.Background(),
+		client,
+		testKeyRing+"/cryptoKeys/labelled",
+		WithVersionSelector(VersionFromLabel("signing-version")),
+	)
+
+	if err != nil {
+		t.Fatalf("NewGoogleKMSSigner() failed: %v", err)
+	}
+
+	if want := testKeyRing + "/cryptoKeys/labelled/cryptoKeyVersions/1"; signer.KeyVersionName() != want {
+		t.Errorf("KeyVersionName() = %s, want %s", signer.KeyVersionName(), want)
+	}
+}
+
+func TestNewGoogleKMSSignerRejectsUnusableVersions(t *testing.T) {
+	for _, state := range []kmspb.CryptoKeyVersion_CryptoKeyVersionState{
+		kmspb.CryptoKeyVersion_DISABLED,
+		kmspb.CryptoKeyVersion_DESTROYED,
+		kmspb.CryptoKeyVersion_DESTROY_SCHEDULED,
+		kmspb.CryptoKeyVersion_PENDING_GENERATION,
+	} {
+		state := state
+
+		t.Run(state.String(), func(t *testing.T) {
+			client := newVersionTestClient(t, state)
+			keyName := testRotatedKey + "/cryptoKeyVersions/3"
+
+			_, err := NewGoogleKMSSigner(context.Background(), client, keyName)
+
+			if !errors.Is(err, ErrKeyVersionNotEnabled) {
+				t.Fatalf("NewGoogleKMSSigner() = %v, want ErrKeyVersionNotEnabled", err)
+			}
+
+			if !strings.Contains(err.Error(), state.String()) {
+				t.Errorf("Error %q does not mention state %s", err, state)
+			}
+		})
+	}
+}
+
+func TestNewGoogleKMSSignerNoEnabledVersions(t *testing.T) {
+	client := newVersionTestClient(t, kmspb.CryptoKeyVersion_DISABLED)
+
+	for _, version := range []string{"1", "2"} {
+		err := client.SetVersionState(
+			testRotatedKey+"/cryptoKeyVersions/"+version,
+			kmspb.CryptoKeyVersion_DESTROYED,
+		)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	_, err := NewGoogleKMSSigner(context.Background(), client, testRotatedKey)
+
+	if !errors.Is(err, ErrKeyVersionNotEnabled) {
+		t.Errorf("NewGoogleKMSSigner() = %v, want ErrKeyVersionNotEnabled", err)
+	}
+}